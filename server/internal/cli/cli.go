@@ -0,0 +1,211 @@
+// Package cli implements the tavily-proxy maintenance subcommands. Running the
+// binary without arguments starts the server instead.
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+	"text/tabwriter"
+
+	"tavily-proxy/server/internal/config"
+	"tavily-proxy/server/internal/db"
+	"tavily-proxy/server/internal/services"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// errUsage marks bad arguments; the command's usage has already been printed.
+var errUsage = errors.New("usage")
+
+type command struct {
+	path  string
+	usage string
+	run   func(ctx context.Context, e *env, args []string) error
+}
+
+var commands = []command{
+	{"keys list", "list upstream Tavily keys", runKeysList},
+	{"keys add", "add an upstream Tavily key", runKeysAdd},
+	{"keys import", "import keys from a txt/json/csv export", runKeysImport},
+	{"keys export", "export keys as txt/json/csv", runKeysExport},
+	{"keys sync", "sync quota usage from upstream", runKeysSync},
+	{"dkeys list", "list distributed user keys", runDKeysList},
+	{"dkeys create", "create a distributed user key and print its token", runDKeysCreate},
+	{"dkeys rotate", "replace a distributed key's token and print the new one", runDKeysRotate},
+	{"dkeys revoke", "deactivate a distributed user key", runDKeysRevoke},
+	{"master-key show", "print the current master key", runMasterKeyShow},
+	{"master-key reset", "generate and print a new master key", runMasterKeyReset},
+	{"logs purge", "delete request logs", runLogsPurge},
+	{"stats", "print quota and request totals", runStats},
+	{"db migrate status", "show applied and pending schema migrations", runMigrateStatus},
+	{"db migrate up", "apply pending schema migrations", runMigrateUp},
+	{"db backup", "write a SQLite snapshot of the database", runDBBackup},
+	{"mcp-stdio", "serve MCP over stdin/stdout, locally or bridged to a remote proxy", runMCPStdio},
+}
+
+// env carries what every subcommand needs; the database is opened lazily so
+// commands that fail argument parsing never touch it.
+type env struct {
+	cfg    config.Config
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+	logger *slog.Logger
+
+	database *gorm.DB
+}
+
+// Run executes the subcommand in args and returns the process exit code.
+func Run(ctx context.Context, cfg config.Config, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	e := &env{
+		cfg:    cfg,
+		stdin:  stdin,
+		stdout: stdout,
+		stderr: stderr,
+		logger: slog.New(slog.NewTextHandler(stderr, &slog.HandlerOptions{Level: slog.LevelWarn})),
+	}
+	defer e.close()
+
+	if len(args) > 0 && (args[0] == "help" || args[0] == "-h" || args[0] == "--help") {
+		printUsage(stdout)
+		return 0
+	}
+
+	cmd, rest := lookup(args)
+	if cmd == nil {
+		fmt.Fprintf(stderr, "unknown command %q\n\n", strings.Join(args, " "))
+		printUsage(stderr)
+		return 2
+	}
+	if err := cmd.run(ctx, e, rest); err != nil {
+		if errors.Is(err, errUsage) || errors.Is(err, flag.ErrHelp) {
+			return 2
+		}
+		fmt.Fprintf(stderr, "%s: %v\n", cmd.path, err)
+		return 1
+	}
+	return 0
+}
+
+func lookup(args []string) (*command, []string) {
+	var best *command
+	bestLen := 0
+	for i := range commands {
+		words := strings.Fields(commands[i].path)
+		if len(words) > len(args) || len(words) <= bestLen {
+			continue
+		}
+		match := true
+		for j, w := range words {
+			if args[j] != w {
+				match = false
+				break
+			}
+		}
+		if match {
+			best, bestLen = &commands[i], len(words)
+		}
+	}
+	if best == nil {
+		return nil, nil
+	}
+	return best, args[bestLen:]
+}
+
+func printUsage(w io.Writer) {
+	fmt.Fprint(w, "usage: tavily-proxy <command> [flags]\n\ncommands:\n")
+	tw := tabwriter.NewWriter(w, 0, 4, 3, ' ', 0)
+	for _, c := range commands {
+		fmt.Fprintf(tw, "  %s\t%s\n", c.path, c.usage)
+	}
+	_ = tw.Flush()
+	fmt.Fprint(w, "\nRun `tavily-proxy <command> -h` for a command's flags. Commands use the same\nDB_PATH / DATABASE_URL settings as the server.\n")
+}
+
+// flags builds a flag set whose usage line names the full subcommand.
+func (e *env) flags(path string) *flag.FlagSet {
+	fs := flag.NewFlagSet(path, flag.ContinueOnError)
+	fs.SetOutput(e.stderr)
+	return fs
+}
+
+func (e *env) parse(fs *flag.FlagSet, args []string) error {
+	if err := fs.Parse(args); err != nil {
+		return errUsage
+	}
+	if fs.NArg() > 0 {
+		fmt.Fprintf(e.stderr, "unexpected argument %q\n", fs.Arg(0))
+		fs.Usage()
+		return errUsage
+	}
+	return nil
+}
+
+// db opens the configured database the same way the server does: a newer
+// schema is refused and pending migrations only run when DB_AUTO_MIGRATE is on.
+func (e *env) db() (*gorm.DB, error) {
+	database, err := e.connect()
+	if err != nil {
+		return nil, err
+	}
+	pending, err := db.CheckSchema(database)
+	if err != nil {
+		return nil, err
+	}
+	if pending > 0 {
+		if !e.cfg.DBAutoMigrate {
+			return nil, fmt.Errorf("%d pending migrations; run `tavily-proxy db migrate up` first", pending)
+		}
+		if _, err := db.Migrate(database); err != nil {
+			return nil, err
+		}
+	}
+	return database, nil
+}
+
+func (e *env) connect() (*gorm.DB, error) {
+	if e.database != nil {
+		return e.database, nil
+	}
+	database, err := db.Connect(e.cfg.DatabaseURL, e.cfg.DatabasePath)
+	if err != nil {
+		return nil, fmt.Errorf("db open failed: %w", err)
+	}
+	// gorm's default logger writes to stdout, which would corrupt output
+	// meant for pipes (tokens, exports); errors are reported by the commands.
+	e.database = database.Session(&gorm.Session{Logger: logger.Default.LogMode(logger.Silent)})
+	return e.database, nil
+}
+
+func (e *env) close() {
+	if e.database == nil {
+		return
+	}
+	if sqlDB, err := e.database.DB(); err == nil {
+		_ = sqlDB.Close()
+	}
+}
+
+func (e *env) cipher() (*services.TokenCipher, error) {
+	if strings.TrimSpace(e.cfg.UserKeyEncryptionKey) == "" {
+		return nil, errors.New("USER_KEY_ENCRYPTION_KEY is not set")
+	}
+	return services.NewTokenCipher(e.cfg.UserKeyEncryptionKey)
+}
+
+func (e *env) printJSON(v any) error {
+	enc := json.NewEncoder(e.stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+func (e *env) table() *tabwriter.Writer {
+	return tabwriter.NewWriter(e.stdout, 0, 4, 2, ' ', 0)
+}
@@ -0,0 +1,207 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"tavily-proxy/server/internal/db"
+	"tavily-proxy/server/internal/services"
+)
+
+func runMasterKeyShow(ctx context.Context, e *env, args []string) error {
+	if err := e.parse(e.flags("master-key show"), args); err != nil {
+		return err
+	}
+	database, err := e.db()
+	if err != nil {
+		return err
+	}
+	master := services.NewMasterKeyService(database, e.logger)
+	if err := master.LoadOrCreateWithDefault(ctx, e.cfg.MasterKey); err != nil {
+		return err
+	}
+	fmt.Fprintln(e.stdout, master.Get())
+	return nil
+}
+
+func runMasterKeyReset(ctx context.Context, e *env, args []string) error {
+	if err := e.parse(e.flags("master-key reset"), args); err != nil {
+		return err
+	}
+	database, err := e.db()
+	if err != nil {
+		return err
+	}
+	key, err := services.NewMasterKeyService(database, e.logger).Reset(ctx)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(e.stderr, "master key reset; restart running servers so they pick it up")
+	fmt.Fprintln(e.stdout, key)
+	return nil
+}
+
+func runLogsPurge(ctx context.Context, e *env, args []string) error {
+	fs := e.flags("logs purge")
+	before := fs.String("before", "", "delete logs created before this date (YYYY-MM-DD or RFC3339)")
+	olderThanDays := fs.Int("older-than-days", 0, "delete logs older than this many days")
+	all := fs.Bool("all", false, "delete every request log")
+	if err := e.parse(fs, args); err != nil {
+		return err
+	}
+
+	chosen := 0
+	for _, set := range []bool{*before != "", *olderThanDays > 0, *all} {
+		if set {
+			chosen++
+		}
+	}
+	if chosen != 1 {
+		fmt.Fprintln(e.stderr, "pass exactly one of -before, -older-than-days or -all")
+		fs.Usage()
+		return errUsage
+	}
+
+	var cutoff time.Time
+	switch {
+	case *before != "":
+		var err error
+		if cutoff, err = time.ParseInLocation("2006-01-02", *before, time.Local); err != nil {
+			if cutoff, err = time.Parse(time.RFC3339, *before); err != nil {
+				return fmt.Errorf("invalid -before %q", *before)
+			}
+		}
+	case *olderThanDays > 0:
+		now := time.Now()
+		cutoff = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()).AddDate(0, 0, -*olderThanDays)
+	}
+
+	database, err := e.db()
+	if err != nil {
+		return err
+	}
+	logs := services.NewLogService(database, e.logger)
+	var deleted int64
+	if *all {
+		deleted, err = logs.DeleteAll(ctx)
+	} else {
+		deleted, err = logs.DeleteOlderThan(ctx, cutoff)
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(e.stdout, "deleted %d request logs\n", deleted)
+	return nil
+}
+
+func runStats(ctx context.Context, e *env, args []string) error {
+	fs := e.flags("stats")
+	asJSON := fs.Bool("json", false, "print JSON")
+	if err := e.parse(fs, args); err != nil {
+		return err
+	}
+	database, err := e.db()
+	if err != nil {
+		return err
+	}
+	stats, err := services.NewStatsService(database).Get(ctx)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		return e.printJSON(stats)
+	}
+
+	tw := e.table()
+	fmt.Fprintf(tw, "keys\t%d (%d active)\n", stats.KeyCount, stats.ActiveKeyCount)
+	fmt.Fprintf(tw, "quota used\t%d / %d\n", stats.TotalUsed, stats.TotalQuota)
+	fmt.Fprintf(tw, "quota remaining\t%d\n", stats.TotalRemaining)
+	fmt.Fprintf(tw, "requests today\t%d\n", stats.TodayRequests)
+	return tw.Flush()
+}
+
+func runMigrateStatus(_ context.Context, e *env, args []string) error {
+	if err := e.parse(e.flags("db migrate status"), args); err != nil {
+		return err
+	}
+	database, err := e.connect()
+	if err != nil {
+		return err
+	}
+	states, err := db.MigrationStatus(database)
+	if err != nil {
+		return err
+	}
+
+	tw := e.table()
+	fmt.Fprintln(tw, "VERSION\tNAME\tSTATUS\tAPPLIED AT")
+	for _, s := range states {
+		status, appliedAt := "pending", "-"
+		if s.Applied {
+			status = "applied"
+			appliedAt = s.AppliedAt.Local().Format(time.RFC3339)
+		}
+		if s.Unknown {
+			status = "unknown (newer binary)"
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", s.Version, s.Name, status, appliedAt)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, err = db.CheckSchema(database)
+	return err
+}
+
+func runMigrateUp(_ context.Context, e *env, args []string) error {
+	if err := e.parse(e.flags("db migrate up"), args); err != nil {
+		return err
+	}
+	database, err := e.connect()
+	if err != nil {
+		return err
+	}
+	ran, err := db.Migrate(database)
+	for _, m := range ran {
+		fmt.Fprintf(e.stdout, "applied %d %s\n", m.Version, m.Name)
+	}
+	if err != nil {
+		return err
+	}
+	if len(ran) == 0 {
+		fmt.Fprintf(e.stdout, "schema is up to date (version %d)\n", db.LatestVersion())
+	}
+	return nil
+}
+
+func runDBBackup(ctx context.Context, e *env, args []string) error {
+	fs := e.flags("db backup")
+	out := fs.String("out", "", "snapshot file to write (required)")
+	includeLogs := fs.Bool("include-logs", false, "keep request logs and stats in the snapshot")
+	if err := e.parse(fs, args); err != nil {
+		return err
+	}
+	if strings.TrimSpace(*out) == "" {
+		fmt.Fprintln(e.stderr, "-out is required")
+		fs.Usage()
+		return errUsage
+	}
+
+	database, err := e.db()
+	if err != nil {
+		return err
+	}
+	backups := services.NewBackupService(database, e.logger)
+	if !backups.Supported() {
+		return errors.New("backups are only supported on SQLite")
+	}
+	info, err := backups.Snapshot(ctx, *out, services.BackupOptions{IncludeLogs: *includeLogs})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(e.stdout, "wrote %s (%d bytes)\n", info.Path, info.Size)
+	return nil
+}
@@ -0,0 +1,172 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"tavily-proxy/server/internal/services"
+)
+
+// distributedKeys opens the service; the cipher is only needed by commands
+// that mint tokens.
+func (e *env) distributedKeys(needCipher bool) (*services.DistributedKeyService, error) {
+	var cipher *services.TokenCipher
+	if needCipher {
+		var err error
+		if cipher, err = e.cipher(); err != nil {
+			return nil, err
+		}
+	}
+	database, err := e.db()
+	if err != nil {
+		return nil, err
+	}
+	return services.NewDistributedKeyService(database, e.logger, cipher, e.cfg.UserKeyRateLimitDefault), nil
+}
+
+func runDKeysList(ctx context.Context, e *env, args []string) error {
+	fs := e.flags("dkeys list")
+	asJSON := fs.Bool("json", false, "print JSON instead of a table")
+	if err := e.parse(fs, args); err != nil {
+		return err
+	}
+
+	dkeys, err := e.distributedKeys(false)
+	if err != nil {
+		return err
+	}
+	items, err := dkeys.List(ctx)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		return e.printJSON(items)
+	}
+
+	tw := e.table()
+	fmt.Fprintln(tw, "ID\tNAME\tPREFIX\tACTIVE\tRATE/MIN\tEXPIRES")
+	for _, k := range items {
+		expires := "-"
+		if k.ExpiresAt != nil {
+			expires = k.ExpiresAt.Local().Format(time.RFC3339)
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%t\t%d\t%s\n", k.ID, k.Name, k.KeyPrefix, k.IsActive, k.RateLimitPerMinute, expires)
+	}
+	return tw.Flush()
+}
+
+func runDKeysCreate(ctx context.Context, e *env, args []string) error {
+	fs := e.flags("dkeys create")
+	name := fs.String("name", "", "display name")
+	note := fs.String("note", "", "free-form note")
+	rateLimit := fs.Int("rate-limit", -1, "requests per window, 0 for unlimited (default USER_KEY_RATE_LIMIT_DEFAULT)")
+	expires := fs.String("expires", "", "expiry as RFC3339 time or a duration from now, e.g. 720h")
+	if err := e.parse(fs, args); err != nil {
+		return err
+	}
+
+	in := services.DistributedKeyCreateInput{Name: *name, Note: *note}
+	if *rateLimit >= 0 {
+		in.RateLimitPerMinute = rateLimit
+	}
+	if raw := strings.TrimSpace(*expires); raw != "" {
+		at, err := parseExpiry(raw, time.Now())
+		if err != nil {
+			return err
+		}
+		in.ExpiresAt = &at
+	}
+
+	dkeys, err := e.distributedKeys(true)
+	if err != nil {
+		return err
+	}
+	created, token, err := dkeys.Create(ctx, in)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(e.stderr, "created distributed key %d (%s); the token is shown only once\n", created.ID, created.Name)
+	fmt.Fprintln(e.stdout, token)
+	return nil
+}
+
+func runDKeysRotate(ctx context.Context, e *env, args []string) error {
+	fs := e.flags("dkeys rotate")
+	id := fs.Uint("id", 0, "distributed key id (required)")
+	if err := e.parse(fs, args); err != nil {
+		return err
+	}
+	if *id == 0 {
+		fmt.Fprintln(e.stderr, "-id is required")
+		fs.Usage()
+		return errUsage
+	}
+
+	dkeys, err := e.distributedKeys(true)
+	if err != nil {
+		return err
+	}
+	rotated, token, err := dkeys.Rotate(ctx, uint(*id))
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(e.stderr, "rotated distributed key %d (%s); the old token no longer works\n", rotated.ID, rotated.Name)
+	fmt.Fprintln(e.stdout, token)
+	return nil
+}
+
+func runDKeysRevoke(ctx context.Context, e *env, args []string) error {
+	fs := e.flags("dkeys revoke")
+	id := fs.Uint("id", 0, "distributed key id (required)")
+	del := fs.Bool("delete", false, "delete the key instead of deactivating it")
+	if err := e.parse(fs, args); err != nil {
+		return err
+	}
+	if *id == 0 {
+		fmt.Fprintln(e.stderr, "-id is required")
+		fs.Usage()
+		return errUsage
+	}
+
+	dkeys, err := e.distributedKeys(false)
+	if err != nil {
+		return err
+	}
+	existing, err := dkeys.FindByID(ctx, uint(*id))
+	if err != nil {
+		return err
+	}
+	if existing == nil {
+		return services.ErrDistributedKeyNotFound
+	}
+
+	if *del {
+		if err := dkeys.Delete(ctx, existing.ID); err != nil {
+			return err
+		}
+		fmt.Fprintf(e.stdout, "deleted distributed key %d\n", existing.ID)
+		return nil
+	}
+	inactive := false
+	if _, err := dkeys.Update(ctx, existing.ID, services.DistributedKeyUpdateInput{IsActive: &inactive}); err != nil {
+		return err
+	}
+	fmt.Fprintf(e.stdout, "revoked distributed key %d\n", existing.ID)
+	return nil
+}
+
+func parseExpiry(raw string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(raw); err == nil {
+		if d <= 0 {
+			return time.Time{}, fmt.Errorf("expiry duration must be positive")
+		}
+		return now.Add(d).UTC(), nil
+	}
+	at, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid expiry %q: use RFC3339 or a duration like 720h", raw)
+	}
+	return at.UTC(), nil
+}
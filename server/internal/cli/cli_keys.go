@@ -0,0 +1,239 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"tavily-proxy/server/internal/services"
+	"tavily-proxy/server/internal/util"
+)
+
+func (e *env) keyService() (*services.KeyService, error) {
+	database, err := e.db()
+	if err != nil {
+		return nil, err
+	}
+	return services.NewKeyService(database, e.logger), nil
+}
+
+func runKeysList(ctx context.Context, e *env, args []string) error {
+	fs := e.flags("keys list")
+	asJSON := fs.Bool("json", false, "print JSON instead of a table")
+	if err := e.parse(fs, args); err != nil {
+		return err
+	}
+
+	keys, err := e.keyService()
+	if err != nil {
+		return err
+	}
+	items, err := keys.List(ctx)
+	if err != nil {
+		return err
+	}
+
+	if *asJSON {
+		type row struct {
+			ID         uint   `json:"id"`
+			Alias      string `json:"alias"`
+			Key        string `json:"key"`
+			UsedQuota  int    `json:"used_quota"`
+			TotalQuota int    `json:"total_quota"`
+			IsActive   bool   `json:"is_active"`
+			IsInvalid  bool   `json:"is_invalid"`
+		}
+		out := make([]row, 0, len(items))
+		for _, k := range items {
+			out = append(out, row{k.ID, k.Alias, util.MaskAPIKey(k.Key), k.UsedQuota, k.TotalQuota, k.IsActive, k.IsInvalid})
+		}
+		return e.printJSON(out)
+	}
+
+	tw := e.table()
+	fmt.Fprintln(tw, "ID\tALIAS\tKEY\tUSED/TOTAL\tACTIVE\tINVALID")
+	for _, k := range items {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%d/%d\t%t\t%t\n", k.ID, k.Alias, util.MaskAPIKey(k.Key), k.UsedQuota, k.TotalQuota, k.IsActive, k.IsInvalid)
+	}
+	return tw.Flush()
+}
+
+func runKeysAdd(ctx context.Context, e *env, args []string) error {
+	fs := e.flags("keys add")
+	key := fs.String("key", "", "Tavily API key (required)")
+	alias := fs.String("alias", "", "display name")
+	quota := fs.Int("quota", 1000, "monthly quota")
+	if err := e.parse(fs, args); err != nil {
+		return err
+	}
+	if strings.TrimSpace(*key) == "" {
+		fmt.Fprintln(e.stderr, "-key is required")
+		fs.Usage()
+		return errUsage
+	}
+
+	keys, err := e.keyService()
+	if err != nil {
+		return err
+	}
+	if existing, err := keys.FindByKey(ctx, strings.TrimSpace(*key)); err != nil {
+		return err
+	} else if existing != nil {
+		return fmt.Errorf("key already exists (id %d)", existing.ID)
+	}
+	created, err := keys.Create(ctx, strings.TrimSpace(*key), strings.TrimSpace(*alias), *quota)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(e.stdout, "added key %d (%s)\n", created.ID, util.MaskAPIKey(created.Key))
+	return nil
+}
+
+func runKeysImport(ctx context.Context, e *env, args []string) error {
+	fs := e.flags("keys import")
+	file := fs.String("file", "-", "file to import, - for stdin")
+	format := fs.String("format", "", "txt, json or csv (detected when empty)")
+	conflict := fs.String("conflict", services.KeyImportConflictSkip, "skip, overwrite or merge existing keys")
+	dryRun := fs.Bool("dry-run", false, "report what would change without writing")
+	passphrase := fs.String("passphrase", "", "passphrase for an encrypted export")
+	if err := e.parse(fs, args); err != nil {
+		return err
+	}
+	if *format != "" {
+		if _, err := services.NormalizeKeyTransferFormat(*format); err != nil {
+			return err
+		}
+	}
+
+	var data []byte
+	var err error
+	if *file == "-" {
+		data, err = io.ReadAll(e.stdin)
+	} else {
+		data, err = os.ReadFile(*file)
+	}
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(string(data)) == "" {
+		return errors.New("empty input")
+	}
+
+	records, err := services.DecodeKeyTransfer(data, *format, *passphrase)
+	if err != nil {
+		return err
+	}
+	keys, err := e.keyService()
+	if err != nil {
+		return err
+	}
+	result, err := keys.Import(ctx, records, services.KeyImportOptions{DryRun: *dryRun, Conflict: *conflict})
+	if err != nil {
+		return err
+	}
+
+	for _, item := range result.Items {
+		if item.Action == "error" {
+			fmt.Fprintf(e.stderr, "%s: %s\n", item.Key, item.Error)
+		}
+	}
+	prefix := ""
+	if result.DryRun {
+		prefix = "dry run: "
+	}
+	fmt.Fprintf(e.stdout, "%s%d total, %d created, %d updated, %d skipped, %d failed\n",
+		prefix, result.Total, result.Created, result.Updated, result.Skipped, result.Failed)
+	if result.Failed > 0 {
+		return fmt.Errorf("%d keys failed to import", result.Failed)
+	}
+	return nil
+}
+
+func runKeysExport(ctx context.Context, e *env, args []string) error {
+	fs := e.flags("keys export")
+	out := fs.String("out", "-", "output file, - for stdout")
+	format := fs.String("format", services.KeyTransferFormatJSON, "txt, json or csv")
+	includeInvalid := fs.Bool("include-invalid", true, "include keys marked invalid")
+	passphrase := fs.String("passphrase", "", "encrypt the export with this passphrase")
+	if err := e.parse(fs, args); err != nil {
+		return err
+	}
+	normalized, err := services.NormalizeKeyTransferFormat(*format)
+	if err != nil {
+		return err
+	}
+
+	keys, err := e.keyService()
+	if err != nil {
+		return err
+	}
+	records, err := keys.ExportRecords(ctx, *includeInvalid)
+	if err != nil {
+		return err
+	}
+	body, err := services.EncodeKeyTransfer(records, normalized)
+	if err != nil {
+		return err
+	}
+	if *passphrase != "" {
+		if body, err = services.SealKeyTransfer(body, normalized, *passphrase); err != nil {
+			return err
+		}
+	}
+
+	if *out == "-" {
+		_, err = e.stdout.Write(body)
+		return err
+	}
+	if err := os.WriteFile(*out, body, 0o600); err != nil {
+		return err
+	}
+	fmt.Fprintf(e.stderr, "exported %d keys to %s\n", len(records), *out)
+	return nil
+}
+
+func runKeysSync(ctx context.Context, e *env, args []string) error {
+	fs := e.flags("keys sync")
+	id := fs.Uint("id", 0, "sync a single key (default: all)")
+	concurrency := fs.Int("concurrency", 4, "parallel upstream requests")
+	if err := e.parse(fs, args); err != nil {
+		return err
+	}
+
+	database, err := e.db()
+	if err != nil {
+		return err
+	}
+	keys := services.NewKeyService(database, e.logger)
+	settings := services.NewSettingsService(database)
+	proxy := services.NewTavilyProxy(e.cfg.TavilyBaseURL, e.cfg.UpstreamTimeout, keys, services.NewLogService(database, e.logger), services.NewStatsService(database), e.logger).
+		WithSettings(settings)
+	sync := services.NewQuotaSyncService(keys, proxy, e.logger)
+
+	if *id != 0 {
+		item, err := sync.SyncOne(ctx, uint(*id))
+		if err != nil {
+			return err
+		}
+		fmt.Fprintf(e.stdout, "key %d (%s): %d/%d\n", item.ID, item.Alias, item.UsedQuota, item.TotalQuota)
+		return nil
+	}
+
+	result, err := sync.SyncAllWithConcurrency(ctx, *concurrency)
+	if err != nil {
+		return err
+	}
+	for _, item := range result.Items {
+		if item.Status != "ok" {
+			fmt.Fprintf(e.stderr, "key %d (%s): %s\n", item.ID, item.Alias, item.Error)
+		}
+	}
+	fmt.Fprintf(e.stdout, "synced %d keys, %d failed\n", result.Succeeded, result.Failed)
+	if result.Failed > 0 {
+		return fmt.Errorf("%d keys failed to sync", result.Failed)
+	}
+	return nil
+}
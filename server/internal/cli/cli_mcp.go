@@ -0,0 +1,86 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"tavily-proxy/server/internal/mcpserver"
+	"tavily-proxy/server/internal/services"
+)
+
+// runMCPStdio speaks JSON-RPC on stdin/stdout, so nothing else may be written
+// to stdout; logs go to stderr.
+func runMCPStdio(ctx context.Context, e *env, args []string) error {
+	fs := e.flags("mcp-stdio")
+	remote := fs.String("remote", "", "base URL of a running proxy to forward to instead of using the local database")
+	key := fs.String("key", os.Getenv("TAVILY_PROXY_KEY"), "distributed key or master key for --remote (default $TAVILY_PROXY_KEY)")
+	if err := e.parse(fs, args); err != nil {
+		return err
+	}
+	transport := &mcp.IOTransport{Reader: io.NopCloser(e.stdin), Writer: nopWriteCloser{e.stdout}}
+
+	if *remote != "" {
+		if strings.TrimSpace(*key) == "" {
+			fmt.Fprintln(e.stderr, "--key or TAVILY_PROXY_KEY is required with --remote")
+			fs.Usage()
+			return errUsage
+		}
+		endpoint, err := mcpEndpoint(*remote)
+		if err != nil {
+			return err
+		}
+		return mcpserver.ServeRemote(ctx, endpoint, *key, transport)
+	}
+
+	database, err := e.db()
+	if err != nil {
+		return err
+	}
+	settings := services.NewSettingsService(database).WithPinned(e.cfg.Settings)
+	keys := services.NewKeyService(database, e.logger)
+	logs := services.NewLogService(database, e.logger)
+	stats := services.NewStatsService(database)
+	proxy := services.NewTavilyProxy(e.cfg.TavilyBaseURL, e.cfg.UpstreamTimeout, keys, logs, stats, e.logger).
+		WithSettings(settings).
+		WithPolicies(services.NewPolicyService(database, e.logger)).
+		WithFilters(services.NewFilterService(database, e.logger)).
+		WithRetry(e.cfg.RetryPolicy())
+	deps := mcpserver.Dependencies{
+		Proxy:     proxy,
+		Stats:     stats,
+		Logs:      logs,
+		Keys:      keys,
+		QuotaSync: services.NewQuotaSyncService(keys, proxy, e.logger),
+		Audit:     services.NewAuditService(database, e.logger),
+		Settings:  settings,
+	}
+	// The distributed key admin tools need the cipher and are left out
+	// without it.
+	if dkeys, err := e.distributedKeys(true); err == nil {
+		deps.DistributedKeys = dkeys
+	}
+	return mcpserver.ServeStdio(ctx, deps, transport)
+}
+
+// mcpEndpoint accepts either a proxy base URL or its /mcp endpoint.
+func mcpEndpoint(raw string) (string, error) {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", errors.New("--remote must be an http(s) URL")
+	}
+	if !strings.HasSuffix(u.Path, "/mcp") {
+		u.Path = strings.TrimSuffix(u.Path, "/") + "/mcp"
+	}
+	return u.String(), nil
+}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
@@ -0,0 +1,212 @@
+package cli
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"tavily-proxy/server/internal/config"
+)
+
+type result struct {
+	code   int
+	stdout string
+	stderr string
+}
+
+func run(t *testing.T, cfg config.Config, stdin string, args ...string) result {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	code := Run(context.Background(), cfg, args, strings.NewReader(stdin), &stdout, &stderr)
+	return result{code: code, stdout: stdout.String(), stderr: stderr.String()}
+}
+
+func testConfig(t *testing.T) config.Config {
+	t.Helper()
+	return config.Config{
+		DatabasePath:            filepath.Join(t.TempDir(), "app.db"),
+		DBAutoMigrate:           true,
+		UserKeyEncryptionKey:    "0123456789abcdef0123456789abcdef",
+		UserKeyRateLimitDefault: 60,
+	}
+}
+
+func TestRun_KeysAndTransfer(t *testing.T) {
+	t.Parallel()
+
+	cfg := testConfig(t)
+	if r := run(t, cfg, "", "keys", "add", "-key", "tvly-cli-000000001", "-alias", "first", "-quota", "500"); r.code != 0 {
+		t.Fatalf("keys add: %+v", r)
+	}
+	if r := run(t, cfg, "", "keys", "add", "-key", "tvly-cli-000000001"); r.code != 1 || !strings.Contains(r.stderr, "already exists") {
+		t.Fatalf("duplicate add should fail: %+v", r)
+	}
+	if r := run(t, cfg, "tvly-cli-000000002\ntvly-cli-000000003\n", "keys", "import", "-format", "txt"); r.code != 0 || !strings.Contains(r.stdout, "2 created") {
+		t.Fatalf("keys import: %+v", r)
+	}
+
+	r := run(t, cfg, "", "keys", "list", "-json")
+	if r.code != 0 {
+		t.Fatalf("keys list: %+v", r)
+	}
+	var listed []struct {
+		Alias      string `json:"alias"`
+		Key        string `json:"key"`
+		TotalQuota int    `json:"total_quota"`
+	}
+	if err := json.Unmarshal([]byte(r.stdout), &listed); err != nil {
+		t.Fatalf("decode list: %v\n%s", err, r.stdout)
+	}
+	if len(listed) != 3 || strings.Contains(r.stdout, "tvly-cli-000000001") {
+		t.Fatalf("expected three masked keys: %s", r.stdout)
+	}
+
+	out := filepath.Join(t.TempDir(), "keys.enc")
+	if r := run(t, cfg, "", "keys", "export", "-format", "csv", "-passphrase", "s3cret", "-out", out); r.code != 0 {
+		t.Fatalf("keys export: %+v", r)
+	}
+	other := testConfig(t)
+	if r := run(t, other, "", "keys", "import", "-file", out); r.code != 1 {
+		t.Fatalf("import without passphrase should fail: %+v", r)
+	}
+	if r := run(t, other, "", "keys", "import", "-file", out, "-passphrase", "s3cret"); r.code != 0 || !strings.Contains(r.stdout, "3 created") {
+		t.Fatalf("encrypted import: %+v", r)
+	}
+
+	if r := run(t, cfg, "", "stats", "-json"); r.code != 0 || !strings.Contains(r.stdout, `"key_count": 3`) {
+		t.Fatalf("stats: %+v", r)
+	}
+}
+
+func TestRun_DistributedAndMasterKeys(t *testing.T) {
+	t.Parallel()
+
+	cfg := testConfig(t)
+	r := run(t, cfg, "", "dkeys", "create", "-name", "ci", "-rate-limit", "5", "-expires", "24h")
+	if r.code != 0 || !strings.HasPrefix(r.stdout, "uk_") {
+		t.Fatalf("dkeys create: %+v", r)
+	}
+	token := strings.TrimSpace(r.stdout)
+
+	if r := run(t, cfg, "", "dkeys", "rotate", "-id", "1"); r.code != 0 || strings.TrimSpace(r.stdout) == token {
+		t.Fatalf("dkeys rotate: %+v", r)
+	}
+	if r := run(t, cfg, "", "dkeys", "revoke", "-id", "1"); r.code != 0 {
+		t.Fatalf("dkeys revoke: %+v", r)
+	}
+	if r := run(t, cfg, "", "dkeys", "list"); r.code != 0 || !strings.Contains(r.stdout, "false") {
+		t.Fatalf("revoked key should be inactive: %+v", r)
+	}
+	if r := run(t, cfg, "", "dkeys", "revoke", "-id", "99"); r.code != 1 {
+		t.Fatalf("revoking a missing key should fail: %+v", r)
+	}
+
+	noCipher := cfg
+	noCipher.UserKeyEncryptionKey = ""
+	if r := run(t, noCipher, "", "dkeys", "create"); r.code != 1 || !strings.Contains(r.stderr, "USER_KEY_ENCRYPTION_KEY") {
+		t.Fatalf("create without cipher should fail: %+v", r)
+	}
+
+	shown := run(t, cfg, "", "master-key", "show")
+	reset := run(t, cfg, "", "master-key", "reset")
+	again := run(t, cfg, "", "master-key", "show")
+	if shown.code != 0 || reset.code != 0 || again.code != 0 {
+		t.Fatalf("master-key: %+v %+v %+v", shown, reset, again)
+	}
+	if shown.stdout == reset.stdout || reset.stdout != again.stdout {
+		t.Fatalf("reset key not persisted: show=%q reset=%q again=%q", shown.stdout, reset.stdout, again.stdout)
+	}
+}
+
+func TestRun_DatabaseCommands(t *testing.T) {
+	t.Parallel()
+
+	cfg := testConfig(t)
+	cfg.DBAutoMigrate = false
+
+	if r := run(t, cfg, "", "stats"); r.code != 1 || !strings.Contains(r.stderr, "pending migrations") {
+		t.Fatalf("stats should refuse an unmigrated database: %+v", r)
+	}
+	if r := run(t, cfg, "", "db", "migrate", "status"); r.code != 0 || !strings.Contains(r.stdout, "pending") {
+		t.Fatalf("migrate status: %+v", r)
+	}
+	if r := run(t, cfg, "", "db", "migrate", "up"); r.code != 0 || !strings.Contains(r.stdout, "applied 1") {
+		t.Fatalf("migrate up: %+v", r)
+	}
+	if r := run(t, cfg, "", "db", "migrate", "up"); r.code != 0 || !strings.Contains(r.stdout, "up to date") {
+		t.Fatalf("second migrate up: %+v", r)
+	}
+
+	if r := run(t, cfg, "", "logs", "purge"); r.code != 2 {
+		t.Fatalf("purge without a selector should be a usage error: %+v", r)
+	}
+	if r := run(t, cfg, "", "logs", "purge", "-older-than-days", "30"); r.code != 0 || !strings.Contains(r.stdout, "deleted 0") {
+		t.Fatalf("logs purge: %+v", r)
+	}
+
+	snapshot := filepath.Join(t.TempDir(), "snap.db")
+	if r := run(t, cfg, "", "db", "backup", "-out", snapshot); r.code != 0 {
+		t.Fatalf("db backup: %+v", r)
+	}
+	if info, err := os.Stat(snapshot); err != nil || info.Size() == 0 {
+		t.Fatalf("snapshot missing: %v", err)
+	}
+
+	if r := run(t, cfg, "", "keys", "frobnicate"); r.code != 2 || !strings.Contains(r.stderr, "unknown command") {
+		t.Fatalf("unknown command: %+v", r)
+	}
+}
+
+func TestRun_MCPStdio(t *testing.T) {
+	t.Parallel()
+
+	cfg := testConfig(t)
+	if r := run(t, cfg, "", "mcp-stdio", "-remote", "http://127.0.0.1:1", "-key", ""); r.code != 2 {
+		t.Fatalf("--remote without a key should be a usage error: %+v", r)
+	}
+	if r := run(t, cfg, "", "mcp-stdio", "-remote", "ftp://pool", "-key", "k"); r.code != 1 || !strings.Contains(r.stderr, "http(s) URL") {
+		t.Fatalf("bad remote URL: %+v", r)
+	}
+	if r := run(t, cfg, "", "keys", "add", "-key", "tvly-stdiostdiostdio", "-alias", "primary"); r.code != 0 {
+		t.Fatalf("keys add: %+v", r)
+	}
+
+	ctx := context.Background()
+	clientRead, serverStdout := io.Pipe()
+	serverStdin, clientWrite := io.Pipe()
+	var stderr bytes.Buffer
+	done := make(chan int, 1)
+	go func() {
+		done <- Run(ctx, cfg, []string{"mcp-stdio"}, serverStdin, serverStdout, &stderr)
+	}()
+
+	session, err := mcp.NewClient(&mcp.Implementation{Name: "test", Version: "0"}, nil).
+		Connect(ctx, &mcp.IOTransport{Reader: clientRead, Writer: clientWrite}, nil)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	res, err := session.CallTool(ctx, &mcp.CallToolParams{Name: "admin-list-keys"})
+	if err != nil || res.IsError {
+		t.Fatalf("admin-list-keys: %v %v", res, err)
+	}
+	if text := res.Content[0].(*mcp.TextContent).Text; !strings.Contains(text, `"alias": "primary"`) {
+		t.Fatalf("local mode should serve the local database: %s", text)
+	}
+	_ = session.Close()
+	select {
+	case code := <-done:
+		if code != 0 {
+			t.Fatalf("unexpected exit code %d: %s", code, stderr.String())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("mcp-stdio did not exit after stdin closed")
+	}
+}
@@ -1,103 +1,365 @@
 package config
 
 import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
 	"os"
+	"path/filepath"
+	"reflect"
 	"strconv"
+	"strings"
 	"time"
+
+	"tavily-proxy/server/internal/services"
 )
 
+// Config fields tagged with `config` can be set from the config file (by that
+// key), from the env vars in `env` (first set wins) or from a --flag named
+// after the key with dashes. Precedence is flag > env > file > default.
 type Config struct {
-	ListenAddr              string
-	DatabasePath            string
-	TavilyBaseURL           string
-	UpstreamTimeout         time.Duration
-	MCPStateless            bool
-	MCPSessionTTL           time.Duration
-	MasterKey               string
-	UserKeyEncryptionKey    string
-	UserKeyRateLimitWindow  time.Duration
-	UserKeyRateLimitDefault int
+	ListenAddr              string        `config:"listen_addr" env:"LISTEN_ADDR"`
+	DatabasePath            string        `config:"database_path" env:"DB_PATH,DATABASE_PATH"`
+	DatabaseURL             string        `config:"database_url" env:"DATABASE_URL"`
+	DBAutoMigrate           bool          `config:"db_auto_migrate" env:"DB_AUTO_MIGRATE"`
+	TavilyBaseURL           string        `config:"tavily_base_url" env:"TAVILY_BASE_URL"`
+	UpstreamTimeout         time.Duration `config:"upstream_timeout" env:"UPSTREAM_TIMEOUT"`
+	UpstreamMaxAttempts     int           `config:"upstream_max_attempts" env:"UPSTREAM_MAX_ATTEMPTS"`
+	UpstreamRetryBudget     time.Duration `config:"upstream_retry_budget" env:"UPSTREAM_RETRY_BUDGET"`
+	UpstreamRetryBackoff    time.Duration `config:"upstream_retry_backoff" env:"UPSTREAM_RETRY_BACKOFF"`
+	MCPStateless            bool          `config:"mcp_stateless" env:"MCP_STATELESS"`
+	MCPSessionTTL           time.Duration `config:"mcp_session_ttl" env:"MCP_SESSION_TTL"`
+	MasterKey               string        `config:"master_key" env:"MASTER_KEY"`
+	UserKeyEncryptionKey    string        `config:"user_key_encryption_key" env:"USER_KEY_ENCRYPTION_KEY"`
+	UserKeyRateLimitWindow  time.Duration `config:"user_key_rate_limit_window" env:"USER_KEY_RATE_LIMIT_WINDOW"`
+	UserKeyRateLimitDefault int           `config:"user_key_rate_limit_default" env:"USER_KEY_RATE_LIMIT_DEFAULT"`
+	JobResumeOnStart        bool          `config:"job_resume_on_start" env:"JOB_RESUME_ON_START"`
+	BackupDir               string        `config:"backup_dir" env:"BACKUP_DIR"`
+	CoordinationBackend     string        `config:"coordination_backend" env:"COORDINATION_BACKEND"`
+	RedisURL                string        `config:"redis_url" env:"REDIS_URL"`
+	InstanceID              string        `config:"instance_id" env:"INSTANCE_ID"`
+	OIDCIssuerURL           string        `config:"oidc_issuer_url" env:"OIDC_ISSUER_URL"`
+	OIDCClientID            string        `config:"oidc_client_id" env:"OIDC_CLIENT_ID"`
+	OIDCClientSecret        string        `config:"oidc_client_secret" env:"OIDC_CLIENT_SECRET"`
+	OIDCRedirectURL         string        `config:"oidc_redirect_url" env:"OIDC_REDIRECT_URL"`
+	OIDCScopes              string        `config:"oidc_scopes" env:"OIDC_SCOPES"`
+	OIDCGroupsClaim         string        `config:"oidc_groups_claim" env:"OIDC_GROUPS_CLAIM"`
+	OIDCRoleMapping         string        `config:"oidc_role_mapping" env:"OIDC_ROLE_MAPPING"`
+	SessionTTL              time.Duration `config:"session_ttl" env:"SESSION_TTL"`
+	IdempotencyTTL          time.Duration `config:"idempotency_ttl" env:"IDEMPOTENCY_TTL"`
+
+	// ConfigFile is the file the values were read from, if any.
+	ConfigFile string
+	// Settings pins registered settings (see services.SettingDefs) from the
+	// file or env; pinned values take precedence over the database.
+	Settings map[string]string
+
+	args []string
+}
+
+// ErrInvalid wraps every validation failure reported by Load.
+var ErrInvalid = errors.New("invalid configuration")
+
+func defaults() Config {
+	return Config{
+		ListenAddr:              ":8080",
+		DatabasePath:            "./server/data/app.db",
+		DBAutoMigrate:           true,
+		TavilyBaseURL:           "https://api.tavily.com",
+		UpstreamTimeout:         150 * time.Second,
+		UpstreamMaxAttempts:     services.DefaultRetryPolicy().MaxAttempts,
+		UpstreamRetryBudget:     services.DefaultRetryPolicy().Budget,
+		UpstreamRetryBackoff:    services.DefaultRetryPolicy().Backoff,
+		MCPStateless:            true,
+		MCPSessionTTL:           10 * time.Minute,
+		UserKeyRateLimitWindow:  time.Minute,
+		UserKeyRateLimitDefault: 60,
+		JobResumeOnStart:        true,
+		CoordinationBackend:     "local",
+		OIDCScopes:              "openid profile email",
+		OIDCGroupsClaim:         "groups",
+		SessionTTL:              12 * time.Hour,
+		IdempotencyTTL:          24 * time.Hour,
+	}
+}
+
+// FromEnv reads the environment only, ignoring files and flags. Invalid values
+// are reported as an error instead of silently falling back to defaults.
+func FromEnv() (Config, error) {
+	cfg, _, err := Load(nil, os.LookupEnv)
+	return cfg, err
 }
 
-func FromEnv() Config {
-	listenAddr := getenv("LISTEN_ADDR", "")
-	if listenAddr == "" {
-		port := getenv("PORT", "8080")
-		listenAddr = ":" + port
+// Load resolves the configuration from command-line flags, env vars and the
+// config file named by --config or CONFIG_FILE. Flags are parsed up to the
+// first non-flag argument; the remaining arguments (a CLI subcommand) are
+// returned untouched.
+func Load(args []string, lookupEnv func(string) (string, bool)) (Config, []string, error) {
+	if lookupEnv == nil {
+		lookupEnv = os.LookupEnv
 	}
 
-	dbPath := getenvFirst("./server/data/app.db", "DB_PATH", "DATABASE_PATH")
-	baseURL := getenv("TAVILY_BASE_URL", "https://api.tavily.com")
-	timeout := getenvDuration("UPSTREAM_TIMEOUT", 150*time.Second)
-	mcpStateless := getenvBool("MCP_STATELESS", true)
-	mcpSessionTTL := getenvDuration("MCP_SESSION_TTL", 10*time.Minute)
-	masterKey := getenv("MASTER_KEY", "")
-	userKeyEncryptionKey := getenv("USER_KEY_ENCRYPTION_KEY", "")
-	userKeyRateLimitWindow := getenvDuration("USER_KEY_RATE_LIMIT_WINDOW", time.Minute)
-	userKeyRateLimitDefault := getenvInt("USER_KEY_RATE_LIMIT_DEFAULT", 60)
-	if userKeyRateLimitDefault < 0 {
-		userKeyRateLimitDefault = 0
+	fs := flag.NewFlagSet("tavily-proxy", flag.ContinueOnError)
+	fs.SetOutput(os.Stderr)
+	configFile := fs.String("config", "", "path to a YAML or TOML config file (env CONFIG_FILE)")
+	flagValues := map[string]*string{}
+	for _, f := range fields() {
+		flagValues[f.key] = fs.String(strings.ReplaceAll(f.key, "_", "-"), "", fmt.Sprintf("overrides %s", f.envNames[0]))
+	}
+	settingFlags := map[string]*string{}
+	for _, def := range services.SettingDefs() {
+		settingFlags[def.Name] = fs.String(settingFlag(def.Name), "", fmt.Sprintf("pins setting %s", def.Name))
 	}
-	if userKeyRateLimitWindow <= 0 {
-		userKeyRateLimitWindow = time.Minute
+	if err := fs.Parse(args); err != nil {
+		return Config{}, nil, err
+	}
+	setFlags := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) { setFlags[strings.ReplaceAll(f.Name, "-", "_")] = true })
+	flagSettings := map[string]string{}
+	for name, val := range settingFlags {
+		if setFlags[name] {
+			flagSettings[name] = *val
+		}
 	}
 
-	return Config{
-		ListenAddr:              listenAddr,
-		DatabasePath:            dbPath,
-		TavilyBaseURL:           baseURL,
-		UpstreamTimeout:         timeout,
-		MCPStateless:            mcpStateless,
-		MCPSessionTTL:           mcpSessionTTL,
-		MasterKey:               masterKey,
-		UserKeyEncryptionKey:    userKeyEncryptionKey,
-		UserKeyRateLimitWindow:  userKeyRateLimitWindow,
-		UserKeyRateLimitDefault: userKeyRateLimitDefault,
+	cfg := defaults()
+	cfg.args = append([]string(nil), args...)
+	var problems []string
+
+	cfg.ConfigFile = *configFile
+	if cfg.ConfigFile == "" {
+		cfg.ConfigFile, _ = lookupEnv("CONFIG_FILE")
+	}
+	file := fileValues{}
+	if cfg.ConfigFile != "" {
+		var err error
+		if file, err = readFile(cfg.ConfigFile); err != nil {
+			return Config{}, nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+		}
+	}
+
+	v := reflect.ValueOf(&cfg).Elem()
+	for _, f := range fields() {
+		raw, source, ok := "", "", false
+		switch {
+		case setFlags[f.key]:
+			raw, source, ok = *flagValues[f.key], "--"+strings.ReplaceAll(f.key, "_", "-"), true
+		default:
+			for _, name := range f.envNames {
+				if val, set := lookupEnv(name); set && val != "" {
+					raw, source, ok = val, name, true
+					break
+				}
+			}
+			if !ok {
+				if val, set := file.core[f.key]; set {
+					raw, source, ok = val, cfg.ConfigFile+": "+f.key, true
+				}
+			}
+		}
+		if !ok {
+			if f.key == "listen_addr" {
+				// PORT is the conventional fallback on PaaS hosts.
+				if port, set := lookupEnv("PORT"); set && port != "" {
+					if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+						problems = append(problems, fmt.Sprintf("PORT=%q: not a valid port", port))
+						continue
+					}
+					cfg.ListenAddr = ":" + port
+				}
+			}
+			continue
+		}
+		if err := setField(v.Field(f.index), raw); err != nil {
+			problems = append(problems, fmt.Sprintf("%s=%q: %v", source, raw, err))
+		}
 	}
-}
 
-func getenv(key, def string) string {
-	if v := os.Getenv(key); v != "" {
-		return v
+	if cfg.BackupDir == "" {
+		cfg.BackupDir = filepath.Join(filepath.Dir(cfg.DatabasePath), "backups")
 	}
-	return def
+
+	settings, settingProblems := resolveSettings(flagSettings, file.settings, cfg.ConfigFile, lookupEnv)
+	cfg.Settings = settings
+	problems = append(problems, settingProblems...)
+	problems = append(problems, cfg.validate()...)
+
+	if len(problems) > 0 {
+		return Config{}, nil, fmt.Errorf("%w:\n  - %s", ErrInvalid, strings.Join(problems, "\n  - "))
+	}
+	return cfg, fs.Args(), nil
+}
+
+// Reload re-reads env and the config file, keeping the original flags.
+func (c Config) Reload(lookupEnv func(string) (string, bool)) (Config, error) {
+	next, _, err := Load(c.args, lookupEnv)
+	return next, err
 }
 
-func getenvFirst(def string, keys ...string) string {
-	for _, key := range keys {
-		if v := os.Getenv(key); v != "" {
-			return v
+// RestartRequired lists the fields that differ between two configurations;
+// only Settings can be applied to a running server.
+func RestartRequired(prev, next Config) []string {
+	var changed []string
+	pv, nv := reflect.ValueOf(prev), reflect.ValueOf(next)
+	for _, f := range fields() {
+		if !reflect.DeepEqual(pv.Field(f.index).Interface(), nv.Field(f.index).Interface()) {
+			changed = append(changed, f.key)
 		}
 	}
-	return def
+	return changed
 }
 
-func getenvDuration(key string, def time.Duration) time.Duration {
-	if v := os.Getenv(key); v != "" {
-		if d, err := time.ParseDuration(v); err == nil {
-			return d
+func (c Config) validate() []string {
+	var problems []string
+	if strings.TrimSpace(c.ListenAddr) == "" {
+		problems = append(problems, "listen_addr must not be empty")
+	}
+	if c.DatabaseURL == "" && strings.TrimSpace(c.DatabasePath) == "" {
+		problems = append(problems, "database_path must not be empty when database_url is unset")
+	}
+	if u, err := url.Parse(c.TavilyBaseURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		problems = append(problems, fmt.Sprintf("tavily_base_url %q must be an http(s) URL", c.TavilyBaseURL))
+	}
+	for name, d := range map[string]time.Duration{
+		"upstream_timeout":           c.UpstreamTimeout,
+		"upstream_retry_budget":      c.UpstreamRetryBudget,
+		"upstream_retry_backoff":     c.UpstreamRetryBackoff,
+		"mcp_session_ttl":            c.MCPSessionTTL,
+		"user_key_rate_limit_window": c.UserKeyRateLimitWindow,
+		"session_ttl":                c.SessionTTL,
+		"idempotency_ttl":            c.IdempotencyTTL,
+	} {
+		if d <= 0 {
+			problems = append(problems, fmt.Sprintf("%s must be positive, got %s", name, d))
+		}
+	}
+	if c.UpstreamMaxAttempts < 1 {
+		problems = append(problems, fmt.Sprintf("upstream_max_attempts must be >= 1, got %d", c.UpstreamMaxAttempts))
+	}
+	if c.UserKeyRateLimitDefault < 0 {
+		problems = append(problems, fmt.Sprintf("user_key_rate_limit_default must be >= 0, got %d", c.UserKeyRateLimitDefault))
+	}
+	switch c.CoordinationBackend {
+	case "local", "db":
+	case "redis":
+		if c.RedisURL == "" {
+			problems = append(problems, "redis_url is required when coordination_backend is redis")
 		}
-		if seconds, err := strconv.Atoi(v); err == nil {
-			return time.Duration(seconds) * time.Second
+	default:
+		problems = append(problems, fmt.Sprintf("coordination_backend %q must be one of local, db, redis", c.CoordinationBackend))
+	}
+	problems = append(problems, c.validateOIDC()...)
+	return problems
+}
+
+func (c Config) validateOIDC() []string {
+	if c.OIDCIssuerURL == "" {
+		return nil
+	}
+	var problems []string
+	for name, raw := range map[string]string{"oidc_issuer_url": c.OIDCIssuerURL, "oidc_redirect_url": c.OIDCRedirectURL} {
+		if u, err := url.Parse(raw); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			problems = append(problems, fmt.Sprintf("%s %q must be an http(s) URL when oidc_issuer_url is set", name, raw))
 		}
 	}
-	return def
+	if c.OIDCClientID == "" {
+		problems = append(problems, "oidc_client_id is required when oidc_issuer_url is set")
+	}
+	mapping, err := services.ParseRoleMapping(c.OIDCRoleMapping)
+	switch {
+	case err != nil:
+		problems = append(problems, fmt.Sprintf("oidc_role_mapping: %v", err))
+	case len(mapping) == 0:
+		problems = append(problems, "oidc_role_mapping must map at least one group to a role")
+	}
+	return problems
+}
+
+// RetryPolicy returns how the proxy retries transient upstream failures.
+func (c Config) RetryPolicy() services.RetryPolicy {
+	return services.RetryPolicy{
+		MaxAttempts: c.UpstreamMaxAttempts,
+		Budget:      c.UpstreamRetryBudget,
+		Backoff:     c.UpstreamRetryBackoff,
+	}
+}
+
+// OIDC returns the provider settings, or false when SSO is not configured.
+func (c Config) OIDC() (services.OIDCConfig, bool) {
+	if c.OIDCIssuerURL == "" {
+		return services.OIDCConfig{}, false
+	}
+	mapping, _ := services.ParseRoleMapping(c.OIDCRoleMapping)
+	return services.OIDCConfig{
+		IssuerURL:    c.OIDCIssuerURL,
+		ClientID:     c.OIDCClientID,
+		ClientSecret: c.OIDCClientSecret,
+		RedirectURL:  c.OIDCRedirectURL,
+		Scopes:       strings.Fields(strings.ReplaceAll(c.OIDCScopes, ",", " ")),
+		GroupsClaim:  c.OIDCGroupsClaim,
+		RoleMapping:  mapping,
+	}, true
+}
+
+type field struct {
+	index    int
+	key      string
+	envNames []string
 }
 
-func getenvBool(key string, def bool) bool {
-	if v := os.Getenv(key); v != "" {
-		if parsed, err := strconv.ParseBool(v); err == nil {
-			return parsed
+func fields() []field {
+	t := reflect.TypeOf(Config{})
+	var out []field
+	for i := 0; i < t.NumField(); i++ {
+		key := t.Field(i).Tag.Get("config")
+		if key == "" {
+			continue
 		}
+		out = append(out, field{index: i, key: key, envNames: strings.Split(t.Field(i).Tag.Get("env"), ",")})
 	}
-	return def
+	return out
 }
 
-func getenvInt(key string, def int) int {
-	if v := os.Getenv(key); v != "" {
-		if parsed, err := strconv.Atoi(v); err == nil {
-			return parsed
+var durationType = reflect.TypeOf(time.Duration(0))
+
+func setField(v reflect.Value, raw string) error {
+	raw = strings.TrimSpace(raw)
+	switch {
+	case v.Type() == durationType:
+		d, err := parseDuration(raw)
+		if err != nil {
+			return err
+		}
+		v.SetInt(int64(d))
+	case v.Kind() == reflect.String:
+		v.SetString(raw)
+	case v.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return errors.New("expected true or false")
 		}
+		v.SetBool(b)
+	case v.Kind() == reflect.Int:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return errors.New("expected an integer")
+		}
+		v.SetInt(int64(n))
+	default:
+		return fmt.Errorf("unsupported field type %s", v.Type())
+	}
+	return nil
+}
+
+// parseDuration accepts Go durations ("90s", "2m") and, as before, a bare
+// number of seconds.
+func parseDuration(raw string) (time.Duration, error) {
+	if d, err := time.ParseDuration(raw); err == nil {
+		return d, nil
+	}
+	if seconds, err := strconv.Atoi(raw); err == nil {
+		return time.Duration(seconds) * time.Second, nil
 	}
-	return def
+	return 0, errors.New(`expected a duration such as "30s" or a number of seconds`)
 }
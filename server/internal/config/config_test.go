@@ -0,0 +1,187 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func envMap(m map[string]string) func(string) (string, bool) {
+	return func(key string) (string, bool) {
+		v, ok := m[key]
+		return v, ok
+	}
+}
+
+func writeConfig(t *testing.T, name, body string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(body), 0o600); err != nil {
+		t.Fatalf("write config: %v", err)
+	}
+	return path
+}
+
+func TestLoad_PrecedenceFlagEnvFile(t *testing.T) {
+	t.Parallel()
+
+	path := writeConfig(t, "proxy.yaml", `
+listen_addr: ":7000"
+upstream_timeout: 30s
+tavily_base_url: https://file.example
+settings:
+  log_retention_days: 14
+  backup_enabled: true
+`)
+	env := envMap(map[string]string{
+		"CONFIG_FILE":        path,
+		"UPSTREAM_TIMEOUT":   "45",
+		"LISTEN_ADDR":        ":7100",
+		"LOG_RETENTION_DAYS": "7",
+	})
+
+	cfg, rest, err := Load([]string{"--listen-addr", ":7200", "--log-retention-days", "3", "keys", "list"}, env)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if cfg.ListenAddr != ":7200" {
+		t.Fatalf("flag should win, got %q", cfg.ListenAddr)
+	}
+	if cfg.UpstreamTimeout != 45*time.Second {
+		t.Fatalf("env should beat file, got %s", cfg.UpstreamTimeout)
+	}
+	if cfg.TavilyBaseURL != "https://file.example" {
+		t.Fatalf("file should beat default, got %q", cfg.TavilyBaseURL)
+	}
+	if cfg.MCPSessionTTL != 10*time.Minute {
+		t.Fatalf("default expected, got %s", cfg.MCPSessionTTL)
+	}
+	if cfg.Settings["log_retention_days"] != "3" || cfg.Settings["backup_enabled"] != "true" {
+		t.Fatalf("unexpected pinned settings: %v", cfg.Settings)
+	}
+	if _, ok := cfg.Settings["auto_sync_enabled"]; ok {
+		t.Fatalf("unset settings must not be pinned: %v", cfg.Settings)
+	}
+	if strings.Join(rest, " ") != "keys list" {
+		t.Fatalf("expected subcommand args, got %v", rest)
+	}
+}
+
+func TestLoad_TOMLFile(t *testing.T) {
+	t.Parallel()
+
+	path := writeConfig(t, "proxy.toml", `
+user_key_rate_limit_default = 5
+
+[settings]
+auto_sync_enabled = true
+`)
+	cfg, _, err := Load([]string{"--config", path}, envMap(nil))
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if cfg.UserKeyRateLimitDefault != 5 || cfg.Settings["auto_sync_enabled"] != "true" {
+		t.Fatalf("unexpected config: %+v", cfg)
+	}
+}
+
+func TestLoad_RejectsInvalidValues(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name string
+		args []string
+		file string
+		env  map[string]string
+		want []string
+	}{
+		{
+			name: "bad env duration",
+			env:  map[string]string{"UPSTREAM_TIMEOUT": "soon"},
+			want: []string{`UPSTREAM_TIMEOUT="soon"`},
+		},
+		{
+			name: "unknown file key",
+			file: "listen_adr: \":9000\"\n",
+			want: []string{`unknown key "listen_adr"`},
+		},
+		{
+			name: "unknown setting",
+			file: "settings:\n  backup_every: 3\n",
+			want: []string{`unknown setting "settings.backup_every"`},
+		},
+		{
+			name: "setting out of range and bad backend reported together",
+			file: "coordination_backend: etcd\nsettings:\n  backup_interval_hours: 0\n",
+			want: []string{"settings.backup_interval_hours", "between 1 and 720", `coordination_backend "etcd"`},
+		},
+		{
+			name: "setting flag out of range",
+			args: []string{"--backup-interval-hours", "0"},
+			want: []string{`--backup-interval-hours="0"`, "between 1 and 720"},
+		},
+		{
+			name: "incomplete oidc",
+			env:  map[string]string{"OIDC_ISSUER_URL": "https://idp.example", "OIDC_ROLE_MAPPING": "admins=root"},
+			want: []string{"oidc_client_id is required", "oidc_redirect_url", `unknown role "root"`},
+		},
+	}
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+			env := map[string]string{}
+			for k, v := range tc.env {
+				env[k] = v
+			}
+			if tc.file != "" {
+				env["CONFIG_FILE"] = writeConfig(t, "proxy.yaml", tc.file)
+			}
+			_, _, err := Load(tc.args, envMap(env))
+			if !errors.Is(err, ErrInvalid) {
+				t.Fatalf("expected ErrInvalid, got %v", err)
+			}
+			for _, want := range tc.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Fatalf("error %q should mention %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestReload_PicksUpFileAndReportsRestartFields(t *testing.T) {
+	t.Parallel()
+
+	path := writeConfig(t, "proxy.yaml", "listen_addr: \":7000\"\nsettings:\n  log_retention_days: 30\n")
+	cfg, _, err := Load([]string{"--config", path, "--instance-id", "node-a"}, envMap(nil))
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	if err := os.WriteFile(path, []byte("listen_addr: \":7001\"\nsettings:\n  log_retention_days: 3\n"), 0o600); err != nil {
+		t.Fatalf("rewrite config: %v", err)
+	}
+	next, err := cfg.Reload(envMap(nil))
+	if err != nil {
+		t.Fatalf("reload: %v", err)
+	}
+	if next.Settings["log_retention_days"] != "3" {
+		t.Fatalf("expected reloaded setting, got %v", next.Settings)
+	}
+	if next.InstanceID != "node-a" {
+		t.Fatalf("flags must survive reload, got %q", next.InstanceID)
+	}
+	if changed := RestartRequired(cfg, next); len(changed) != 1 || changed[0] != "listen_addr" {
+		t.Fatalf("expected only listen_addr to need a restart, got %v", changed)
+	}
+
+	if err := os.WriteFile(path, []byte("settings:\n  log_retention_days: forever\n"), 0o600); err != nil {
+		t.Fatalf("rewrite config: %v", err)
+	}
+	if _, err := cfg.Reload(envMap(nil)); !errors.Is(err, ErrInvalid) {
+		t.Fatalf("expected invalid reload to fail, got %v", err)
+	}
+}
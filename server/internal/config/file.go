@@ -0,0 +1,122 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"tavily-proxy/server/internal/services"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+type fileValues struct {
+	core     map[string]string
+	settings map[string]string
+}
+
+// readFile loads a YAML config file, or TOML when the name ends in .toml.
+// Unknown keys and non-scalar values are rejected so typos fail at startup
+// instead of being ignored.
+func readFile(path string) (fileValues, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fileValues{}, err
+	}
+
+	var raw map[string]any
+	if strings.EqualFold(filepath.Ext(path), ".toml") {
+		if err := toml.Unmarshal(data, &raw); err != nil {
+			return fileValues{}, fmt.Errorf("%s: %v", path, err)
+		}
+	} else {
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		if err := dec.Decode(&raw); err != nil && !errors.Is(err, io.EOF) {
+			return fileValues{}, fmt.Errorf("%s: %v", path, err)
+		}
+	}
+
+	known := map[string]bool{}
+	for _, f := range fields() {
+		known[f.key] = true
+	}
+
+	out := fileValues{core: map[string]string{}, settings: map[string]string{}}
+	var problems []string
+	for _, key := range sortedKeys(raw) {
+		value := raw[key]
+		if key == "settings" {
+			nested, ok := value.(map[string]any)
+			if !ok && value != nil {
+				problems = append(problems, "settings must be a mapping")
+				continue
+			}
+			for _, name := range sortedKeys(nested) {
+				if _, ok := services.LookupSettingDef(name); !ok {
+					problems = append(problems, fmt.Sprintf("unknown setting %q", "settings."+name))
+					continue
+				}
+				s, err := scalarString(nested[name])
+				if err != nil {
+					problems = append(problems, fmt.Sprintf("settings.%s: %v", name, err))
+					continue
+				}
+				if nested[name] != nil {
+					out.settings[name] = s
+				}
+			}
+			continue
+		}
+		if !known[key] {
+			problems = append(problems, fmt.Sprintf("unknown key %q", key))
+			continue
+		}
+		s, err := scalarString(value)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s: %v", key, err))
+			continue
+		}
+		if value != nil {
+			out.core[key] = s
+		}
+	}
+	if len(problems) > 0 {
+		return fileValues{}, fmt.Errorf("%s: %s", path, strings.Join(problems, "; "))
+	}
+	return out, nil
+}
+
+func scalarString(v any) (string, error) {
+	switch t := v.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return t, nil
+	case bool:
+		return strconv.FormatBool(t), nil
+	case int:
+		return strconv.Itoa(t), nil
+	case int64:
+		return strconv.FormatInt(t, 10), nil
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64), nil
+	default:
+		return "", errors.New("must be a scalar value")
+	}
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,48 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+
+	"tavily-proxy/server/internal/services"
+)
+
+// settingEnv is the variable that pins a registered setting, e.g.
+// LOG_RETENTION_DAYS for log_retention_days.
+func settingEnv(name string) string {
+	return strings.ToUpper(name)
+}
+
+// settingFlag is the flag that pins a registered setting, e.g.
+// --log-retention-days for log_retention_days.
+func settingFlag(name string) string {
+	return strings.ReplaceAll(name, "_", "-")
+}
+
+// resolveSettings pins every registered setting that is set by a flag, in env
+// or in the config file's settings section; flags win over env, env over the
+// file.
+func resolveSettings(flags, file map[string]string, path string, lookupEnv func(string) (string, bool)) (map[string]string, []string) {
+	out := map[string]string{}
+	var problems []string
+	for _, def := range services.SettingDefs() {
+		raw, source, ok := "", "", false
+		if v, set := flags[def.Name]; set {
+			raw, source, ok = v, "--"+settingFlag(def.Name), true
+		} else if v, set := lookupEnv(settingEnv(def.Name)); set && v != "" {
+			raw, source, ok = v, settingEnv(def.Name), true
+		} else if v, set := file[def.Name]; set {
+			raw, source, ok = v, path+": settings."+def.Name, true
+		}
+		if !ok {
+			continue
+		}
+		normalized, err := def.Normalize(raw)
+		if err != nil {
+			problems = append(problems, fmt.Sprintf("%s=%q: %v", source, raw, err))
+			continue
+		}
+		out[def.Name] = normalized
+	}
+	return out, problems
+}
@@ -1,34 +1,147 @@
 package db
 
 import (
+	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strings"
 
 	"tavily-proxy/server/internal/models"
 
 	"github.com/glebarez/sqlite"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 )
 
+// mysqlStringSize keeps indexed string columns within InnoDB's key length
+// limit under utf8mb4.
+const mysqlStringSize = 191
+
 func Open(path string) (*gorm.DB, error) {
-	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+	return OpenURL("", path)
+}
+
+// OpenURL connects and applies any pending migrations.
+func OpenURL(databaseURL, sqlitePath string) (*gorm.DB, error) {
+	database, err := Connect(databaseURL, sqlitePath)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := Migrate(database); err != nil {
 		return nil, err
 	}
+	return database, nil
+}
 
-	database, err := gorm.Open(sqlite.Open(path), &gorm.Config{})
+// Connect opens the database without touching its schema. Supported
+// DATABASE_URL schemes are postgres://, postgresql://, mysql:// and
+// sqlite://; an empty url falls back to the SQLite file at sqlitePath.
+func Connect(databaseURL, sqlitePath string) (*gorm.DB, error) {
+	dialector, err := Dialector(databaseURL, sqlitePath)
 	if err != nil {
 		return nil, err
 	}
+	return gorm.Open(dialector, &gorm.Config{})
+}
+
+func Dialector(databaseURL, sqlitePath string) (gorm.Dialector, error) {
+	raw := strings.TrimSpace(databaseURL)
+	scheme, rest, ok := strings.Cut(raw, "://")
+	if raw == "" || !ok {
+		if raw != "" {
+			sqlitePath = raw
+		}
+		return sqliteDialector(sqlitePath)
+	}
+
+	switch strings.ToLower(scheme) {
+	case "postgres", "postgresql":
+		return postgres.Open(raw), nil
+	case "mysql":
+		dsn, err := mysqlDSN(rest)
+		if err != nil {
+			return nil, err
+		}
+		return mysql.New(mysql.Config{DSN: dsn, DefaultStringSize: mysqlStringSize}), nil
+	case "sqlite", "sqlite3", "file":
+		return sqliteDialector(rest)
+	default:
+		return nil, fmt.Errorf("unsupported DATABASE_URL scheme %q", scheme)
+	}
+}
+
+func sqliteDialector(path string) (gorm.Dialector, error) {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return nil, err
+	}
+	return sqlite.Open(path), nil
+}
+
+// mysqlDSN accepts the go-sql-driver form after the scheme
+// (user:pass@tcp(host:3306)/db?...) as well as the URL form
+// (user:pass@host:3306/db?...), and makes sure time columns are parsed.
+func mysqlDSN(rest string) (string, error) {
+	if !strings.Contains(rest, "(") {
+		u, err := url.Parse("mysql://" + rest)
+		if err != nil {
+			return "", fmt.Errorf("invalid mysql DATABASE_URL: %w", err)
+		}
+		host := u.Host
+		if u.Port() == "" {
+			host += ":3306"
+		}
+		userInfo := ""
+		if u.User != nil {
+			userInfo = u.User.Username()
+			if pass, ok := u.User.Password(); ok {
+				userInfo += ":" + pass
+			}
+			userInfo += "@"
+		}
+		rest = userInfo + "tcp(" + host + ")" + u.EscapedPath()
+		if u.RawQuery != "" {
+			rest += "?" + u.RawQuery
+		}
+	}
 
-	if err := database.AutoMigrate(
+	base, query, _ := strings.Cut(rest, "?")
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		return "", fmt.Errorf("invalid mysql DATABASE_URL query: %w", err)
+	}
+	if values.Get("parseTime") == "" {
+		values.Set("parseTime", "true")
+	}
+	if values.Get("charset") == "" {
+		values.Set("charset", "utf8mb4")
+	}
+	return base + "?" + values.Encode(), nil
+}
+
+// Models lists every persisted model that holds application data. The
+// schema_migrations bookkeeping table is deliberately not part of it.
+func Models() []any {
+	return []any{
 		&models.APIKey{},
 		&models.RequestLog{},
 		&models.RequestStat{},
 		&models.Setting{},
+		&models.SettingChange{},
 		&models.DistributedKey{},
 		&models.DistributedKeyUsageDaily{},
-	); err != nil {
-		return nil, err
+		&models.RequestRollup{},
+		&models.Job{},
+		&models.AuditEvent{},
+		&models.AdminUser{},
+		&models.AdminToken{},
+		&models.AdminSession{},
+		&models.OIDCLoginState{},
+		&models.RequestPolicy{},
+		&models.ResponseFilter{},
+		&models.IdempotencyRecord{},
+		&models.CoordinationLease{},
+		&models.RateCounter{},
 	}
-	return database, nil
 }
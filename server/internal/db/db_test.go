@@ -0,0 +1,47 @@
+package db
+
+import "testing"
+
+func TestDialector_SchemeSelection(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]string{
+		"":                                    "sqlite",
+		"sqlite://" + t.TempDir() + "/app.db": "sqlite",
+		"postgres://u:p@localhost:5432/app":   "postgres",
+		"postgresql://u:p@localhost/app":      "postgres",
+		"mysql://u:p@localhost/app":           "mysql",
+		"mysql://u:p@tcp(localhost:3307)/app": "mysql",
+	}
+	for url, want := range cases {
+		d, err := Dialector(url, t.TempDir()+"/fallback.db")
+		if err != nil {
+			t.Fatalf("%q: %v", url, err)
+		}
+		if d.Name() != want {
+			t.Fatalf("%q: got %s, want %s", url, d.Name(), want)
+		}
+	}
+	if _, err := Dialector("mongodb://localhost/app", ""); err == nil {
+		t.Fatalf("expected unsupported scheme to fail")
+	}
+}
+
+func TestMySQLDSN(t *testing.T) {
+	t.Parallel()
+
+	cases := map[string]string{
+		"u:p@localhost/app":                    "u:p@tcp(localhost:3306)/app?charset=utf8mb4&parseTime=true",
+		"u:p@db:3307/app?loc=Local":            "u:p@tcp(db:3307)/app?charset=utf8mb4&loc=Local&parseTime=true",
+		"u:p@tcp(db:3306)/app?parseTime=false": "u:p@tcp(db:3306)/app?charset=utf8mb4&parseTime=false",
+	}
+	for in, want := range cases {
+		got, err := mysqlDSN(in)
+		if err != nil {
+			t.Fatalf("%q: %v", in, err)
+		}
+		if got != want {
+			t.Fatalf("%q: got %q, want %q", in, got, want)
+		}
+	}
+}
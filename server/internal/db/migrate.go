@@ -0,0 +1,296 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"tavily-proxy/server/internal/models"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrSchemaTooNew    = errors.New("database schema is newer than this binary")
+	ErrMigrationLocked = errors.New("timed out waiting for the migration lock")
+)
+
+const (
+	migrationLockName = "tavily_proxy_migrate"
+	// migrationLockID is the Postgres advisory lock key ("tavly" in ASCII).
+	migrationLockID   = 0x7461766c79
+	migrationLockWait = 5 * time.Minute
+)
+
+// Migration is one numbered schema step. Up runs inside a transaction where
+// the backend allows it and must tolerate a database that AutoMigrate already
+// brought up to date, since deployments predating migrations have no
+// schema_migrations rows.
+type Migration struct {
+	Version int
+	Name    string
+	Up      func(tx *gorm.DB) error
+}
+
+// migrations is append-only: never renumber or edit a step once released.
+// Steps only use the frozen definitions in schema.go, never package models.
+var migrations = []Migration{
+	{
+		Version: 1,
+		Name:    "initial_schema",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(
+				&apiKeyV1{},
+				&requestLogV1{},
+				&requestStatV1{},
+				&settingV1{},
+				&distributedKeyV1{},
+				&distributedKeyUsageDailyV1{},
+				&requestRollupV1{},
+				&jobV1{},
+			)
+		},
+	},
+	{
+		Version: 2,
+		Name:    "coordination",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&coordinationLeaseV2{}, &rateCounterV2{})
+		},
+	},
+	{
+		Version: 3,
+		Name:    "setting_changes",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&settingChangeV3{})
+		},
+	},
+	{
+		Version: 4,
+		Name:    "audit_events",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&auditEventV4{})
+		},
+	},
+	{
+		Version: 5,
+		Name:    "admin_accounts",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&adminUserV5{}, &adminTokenV5{})
+		},
+	},
+	{
+		Version: 6,
+		Name:    "admin_sessions",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&adminSessionV6{}, &oidcLoginStateV6{})
+		},
+	},
+	{
+		Version: 7,
+		Name:    "request_policies",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&requestPolicyV7{})
+		},
+	},
+	{
+		Version: 8,
+		Name:    "response_filters",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&responseFilterV8{})
+		},
+	},
+	{
+		Version: 9,
+		Name:    "request_log_coalesced",
+		Up: func(tx *gorm.DB) error {
+			return addColumns(tx, &requestLogV9{}, "Coalesced")
+		},
+	},
+	{
+		Version: 10,
+		Name:    "idempotency_records",
+		Up: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&idempotencyRecordV10{})
+		},
+	},
+	{
+		Version: 11,
+		Name:    "request_log_attempts",
+		Up: func(tx *gorm.DB) error {
+			return addColumns(tx, &requestLogV11{}, "Attempts", "AttemptLog")
+		},
+	},
+}
+
+// addColumns adds the named fields of a frozen definition that the table
+// does not have yet.
+func addColumns(tx *gorm.DB, model any, fields ...string) error {
+	migrator := tx.Migrator()
+	for _, field := range fields {
+		if migrator.HasColumn(model, field) {
+			continue
+		}
+		if err := migrator.AddColumn(model, field); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type MigrationState struct {
+	Version   int        `json:"version"`
+	Name      string     `json:"name"`
+	Applied   bool       `json:"applied"`
+	AppliedAt *time.Time `json:"applied_at,omitempty"`
+	// Unknown marks a version recorded in the database that this binary does
+	// not ship, i.e. the schema was migrated by a newer release.
+	Unknown bool `json:"unknown,omitempty"`
+}
+
+func Migrations() []Migration {
+	out := make([]Migration, len(migrations))
+	copy(out, migrations)
+	return out
+}
+
+func LatestVersion() int {
+	if len(migrations) == 0 {
+		return 0
+	}
+	return migrations[len(migrations)-1].Version
+}
+
+// MigrationStatus lists every known migration alongside any applied version
+// this binary does not know about.
+func MigrationStatus(database *gorm.DB) ([]MigrationState, error) {
+	applied, err := appliedMigrations(database)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]MigrationState, 0, len(migrations))
+	known := make(map[int]bool, len(migrations))
+	for _, m := range migrations {
+		known[m.Version] = true
+		state := MigrationState{Version: m.Version, Name: m.Name}
+		if row, ok := applied[m.Version]; ok {
+			appliedAt := row.AppliedAt
+			state.Applied = true
+			state.AppliedAt = &appliedAt
+		}
+		out = append(out, state)
+	}
+	for version, row := range applied {
+		if known[version] {
+			continue
+		}
+		appliedAt := row.AppliedAt
+		out = append(out, MigrationState{Version: version, Name: row.Name, Applied: true, AppliedAt: &appliedAt, Unknown: true})
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Version < out[j].Version })
+	return out, nil
+}
+
+// CheckSchema refuses a database migrated by a newer release and reports how
+// many known migrations are still pending.
+func CheckSchema(database *gorm.DB) (int, error) {
+	applied, err := appliedMigrations(database)
+	if err != nil {
+		return 0, err
+	}
+	latest := LatestVersion()
+	for version := range applied {
+		if version > latest {
+			return 0, fmt.Errorf("%w: database is at version %d, binary supports up to %d", ErrSchemaTooNew, version, latest)
+		}
+	}
+	pending := 0
+	for _, m := range migrations {
+		if _, ok := applied[m.Version]; !ok {
+			pending++
+		}
+	}
+	return pending, nil
+}
+
+// Migrate applies pending migrations in order and returns the ones it ran.
+// It holds the migration lock throughout, so replicas starting together wait
+// for each other instead of applying the same step twice.
+func Migrate(database *gorm.DB) ([]Migration, error) {
+	var ran []Migration
+	err := withMigrationLock(database, func(conn *gorm.DB) error {
+		if _, err := CheckSchema(conn); err != nil {
+			return err
+		}
+		applied, err := appliedMigrations(conn)
+		if err != nil {
+			return err
+		}
+
+		for _, m := range migrations {
+			if _, ok := applied[m.Version]; ok {
+				continue
+			}
+			err := conn.Transaction(func(tx *gorm.DB) error {
+				if err := m.Up(tx); err != nil {
+					return err
+				}
+				return tx.Create(&models.SchemaMigration{Version: m.Version, Name: m.Name, AppliedAt: time.Now().UTC()}).Error
+			})
+			if err != nil {
+				return fmt.Errorf("migration %d (%s): %w", m.Version, m.Name, err)
+			}
+			ran = append(ran, m)
+		}
+		return nil
+	})
+	return ran, err
+}
+
+// withMigrationLock runs fn on a single connection holding a database-wide
+// advisory lock. SQLite needs none: it serialises writers itself and its file
+// is not shared between replicas.
+func withMigrationLock(database *gorm.DB, fn func(conn *gorm.DB) error) error {
+	switch database.Dialector.Name() {
+	case "postgres":
+		return database.Connection(func(conn *gorm.DB) error {
+			if err := conn.Exec("SELECT pg_advisory_lock(?)", migrationLockID).Error; err != nil {
+				return fmt.Errorf("acquire migration lock: %w", err)
+			}
+			defer conn.Exec("SELECT pg_advisory_unlock(?)", migrationLockID)
+			return fn(conn)
+		})
+	case "mysql":
+		return database.Connection(func(conn *gorm.DB) error {
+			var acquired sql.NullInt64
+			if err := conn.Raw("SELECT GET_LOCK(?, ?)", migrationLockName, int(migrationLockWait.Seconds())).Scan(&acquired).Error; err != nil {
+				return fmt.Errorf("acquire migration lock: %w", err)
+			}
+			if !acquired.Valid || acquired.Int64 != 1 {
+				return ErrMigrationLocked
+			}
+			defer conn.Exec("SELECT RELEASE_LOCK(?)", migrationLockName)
+			return fn(conn)
+		})
+	default:
+		return fn(database)
+	}
+}
+
+func appliedMigrations(database *gorm.DB) (map[int]models.SchemaMigration, error) {
+	if err := database.AutoMigrate(&models.SchemaMigration{}); err != nil {
+		return nil, err
+	}
+	var rows []models.SchemaMigration
+	if err := database.Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	out := make(map[int]models.SchemaMigration, len(rows))
+	for _, row := range rows {
+		out[row.Version] = row
+	}
+	return out, nil
+}
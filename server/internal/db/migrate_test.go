@@ -0,0 +1,104 @@
+package db
+
+import (
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/gorm/schema"
+
+	"tavily-proxy/server/internal/models"
+)
+
+func TestMigrate_AppliesOnceAndRefusesNewerSchema(t *testing.T) {
+	t.Parallel()
+
+	database, err := Connect("", filepath.Join(t.TempDir(), "app.db"))
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	sqlDB, err := database.DB()
+	if err != nil {
+		t.Fatalf("db handle: %v", err)
+	}
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	// A deployment from before migrations: tables exist, no bookkeeping yet.
+	if err := database.AutoMigrate(&models.APIKey{}, &models.Setting{}); err != nil {
+		t.Fatalf("legacy automigrate: %v", err)
+	}
+	if pending, err := CheckSchema(database); err != nil || pending != len(Migrations()) {
+		t.Fatalf("expected every migration pending: %d %v", pending, err)
+	}
+
+	ran, err := Migrate(database)
+	if err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	if len(ran) != len(Migrations()) {
+		t.Fatalf("expected %d migrations to run, got %d", len(Migrations()), len(ran))
+	}
+	if ran, err := Migrate(database); err != nil || len(ran) != 0 {
+		t.Fatalf("second migrate should be a no-op: %d %v", len(ran), err)
+	}
+	for _, model := range Models() {
+		if !database.Migrator().HasTable(model) {
+			t.Fatalf("missing table for %T", model)
+		}
+	}
+
+	future := models.SchemaMigration{Version: LatestVersion() + 1, Name: "from_the_future", AppliedAt: time.Now()}
+	if err := database.Create(&future).Error; err != nil {
+		t.Fatalf("record future migration: %v", err)
+	}
+	if _, err := CheckSchema(database); !errors.Is(err, ErrSchemaTooNew) {
+		t.Fatalf("expected ErrSchemaTooNew, got %v", err)
+	}
+	if _, err := Migrate(database); !errors.Is(err, ErrSchemaTooNew) {
+		t.Fatalf("migrate should refuse a newer schema, got %v", err)
+	}
+	states, err := MigrationStatus(database)
+	if err != nil {
+		t.Fatalf("status: %v", err)
+	}
+	if last := states[len(states)-1]; !last.Unknown || last.Version != future.Version {
+		t.Fatalf("expected the future version to be listed as unknown: %+v", last)
+	}
+}
+
+// TestMigrate_MatchesModels catches a model change that shipped without a
+// migration: a fresh database must end up with every column and index the
+// live models declare.
+func TestMigrate_MatchesModels(t *testing.T) {
+	t.Parallel()
+
+	database, err := Open(filepath.Join(t.TempDir(), "app.db"))
+	if err != nil {
+		t.Fatalf("open: %v", err)
+	}
+	sqlDB, err := database.DB()
+	if err != nil {
+		t.Fatalf("db handle: %v", err)
+	}
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	migrator := database.Migrator()
+	for _, model := range Models() {
+		s, err := schema.Parse(model, &sync.Map{}, database.NamingStrategy)
+		if err != nil {
+			t.Fatalf("parse %T: %v", model, err)
+		}
+		for _, field := range s.Fields {
+			if field.DBName != "" && !migrator.HasColumn(model, field.DBName) {
+				t.Errorf("%s.%s has no migration", s.Table, field.DBName)
+			}
+		}
+		for _, idx := range s.ParseIndexes() {
+			if !migrator.HasIndex(model, idx.Name) {
+				t.Errorf("index %s on %s has no migration", idx.Name, s.Table)
+			}
+		}
+	}
+}
@@ -0,0 +1,314 @@
+package db
+
+import "time"
+
+// Frozen table definitions, one set per migration. Migrations must never use
+// the live models: those describe the latest schema, and an old step run
+// against them would create columns that a later step is meant to add.
+// Once a migration is released its structs are never edited.
+
+// Version 1.
+
+type apiKeyV1 struct {
+	ID         uint   `gorm:"primaryKey"`
+	Key        string `gorm:"uniqueIndex;not null"`
+	Alias      string `gorm:"not null"`
+	TotalQuota int    `gorm:"not null;default:1000"`
+	UsedQuota  int    `gorm:"not null;default:0"`
+	IsActive   bool   `gorm:"not null;default:true"`
+	IsInvalid  bool   `gorm:"not null;default:false"`
+	LastUsedAt *time.Time
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+func (apiKeyV1) TableName() string { return "api_keys" }
+
+type requestLogV1 struct {
+	ID                uint   `gorm:"primaryKey"`
+	RequestID         string `gorm:"index;not null"`
+	KeyUsed           uint   `gorm:"column:key_used;index"`
+	KeyAlias          string
+	Endpoint          string `gorm:"index;not null"`
+	StatusCode        int
+	LatencyMs         int64
+	RequestBody       string `gorm:"type:text"`
+	RequestTruncated  bool   `gorm:"not null;default:false"`
+	ResponseBody      string `gorm:"type:text"`
+	ResponseTruncated bool   `gorm:"not null;default:false"`
+	ClientIP          string
+	CreatedAt         time.Time `gorm:"index"`
+}
+
+func (requestLogV1) TableName() string { return "request_logs" }
+
+type requestStatV1 struct {
+	ID          uint      `gorm:"primaryKey"`
+	Granularity string    `gorm:"not null;index:idx_request_stat_bucket,unique"`
+	Bucket      string    `gorm:"not null;index:idx_request_stat_bucket,unique"`
+	Endpoint    string    `gorm:"not null;default:'';index:idx_request_stat_bucket,unique"`
+	Count       int64     `gorm:"not null;default:0"`
+	UpdatedAt   time.Time `gorm:"index"`
+}
+
+func (requestStatV1) TableName() string { return "request_stats" }
+
+type settingV1 struct {
+	Key       string `gorm:"primaryKey"`
+	Value     string `gorm:"type:text;not null"`
+	UpdatedAt time.Time
+}
+
+func (settingV1) TableName() string { return "settings" }
+
+type distributedKeyV1 struct {
+	ID                 uint   `gorm:"primaryKey"`
+	Name               string `gorm:"not null"`
+	Note               string `gorm:"type:text"`
+	TokenHash          string `gorm:"size:64;uniqueIndex;not null"`
+	Ciphertext         string `gorm:"type:text;not null"`
+	KeyPrefix          string `gorm:"size:64;not null"`
+	IsActive           bool   `gorm:"not null;default:true"`
+	ExpiresAt          *time.Time
+	RateLimitPerMinute int `gorm:"not null;default:60"`
+	LastUsedAt         *time.Time
+	CreatedAt          time.Time
+	UpdatedAt          time.Time
+}
+
+func (distributedKeyV1) TableName() string { return "distributed_keys" }
+
+type distributedKeyUsageDailyV1 struct {
+	ID               uint   `gorm:"primaryKey"`
+	DistributedKeyID uint   `gorm:"not null;index:idx_distributed_key_usage_daily,unique"`
+	Date             string `gorm:"size:10;not null;index:idx_distributed_key_usage_daily,unique"`
+	TotalCount       int64  `gorm:"not null;default:0"`
+	Status2xx        int64  `gorm:"column:status_2xx;not null;default:0"`
+	Status4xx        int64  `gorm:"column:status_4xx;not null;default:0"`
+	Status5xx        int64  `gorm:"column:status_5xx;not null;default:0"`
+	UpdatedAt        time.Time
+}
+
+func (distributedKeyUsageDailyV1) TableName() string { return "distributed_key_usage_dailies" }
+
+type requestRollupV1 struct {
+	ID               uint   `gorm:"primaryKey"`
+	Minute           int64  `gorm:"not null;index:idx_request_rollup_dims,unique;index"`
+	Endpoint         string `gorm:"not null;default:'';index:idx_request_rollup_dims,unique"`
+	KeyID            uint   `gorm:"not null;default:0;index:idx_request_rollup_dims,unique"`
+	DistributedKeyID uint   `gorm:"not null;default:0;index:idx_request_rollup_dims,unique"`
+	StatusClass      string `gorm:"size:8;not null;default:'';index:idx_request_rollup_dims,unique"`
+	Count            int64  `gorm:"not null;default:0"`
+	LatencySumMs     int64  `gorm:"not null;default:0"`
+	LatencyMaxMs     int64  `gorm:"not null;default:0"`
+	Lat50            int64  `gorm:"column:lat_50;not null;default:0"`
+	Lat100           int64  `gorm:"column:lat_100;not null;default:0"`
+	Lat250           int64  `gorm:"column:lat_250;not null;default:0"`
+	Lat500           int64  `gorm:"column:lat_500;not null;default:0"`
+	Lat1000          int64  `gorm:"column:lat_1000;not null;default:0"`
+	Lat2500          int64  `gorm:"column:lat_2500;not null;default:0"`
+	Lat5000          int64  `gorm:"column:lat_5000;not null;default:0"`
+	Lat10000         int64  `gorm:"column:lat_10000;not null;default:0"`
+	Lat30000         int64  `gorm:"column:lat_30000;not null;default:0"`
+	LatInf           int64  `gorm:"column:lat_inf;not null;default:0"`
+	UpdatedAt        time.Time
+}
+
+func (requestRollupV1) TableName() string { return "request_rollups" }
+
+type jobV1 struct {
+	ID        string `gorm:"primaryKey;size:36"`
+	Type      string `gorm:"size:32;not null;index"`
+	Status    string `gorm:"size:16;not null;index"`
+	Params    string `gorm:"type:text"`
+	State     string `gorm:"type:text"`
+	Error     string `gorm:"type:text"`
+	Total     int    `gorm:"not null;default:0"`
+	Completed int    `gorm:"not null;default:0"`
+	Succeeded int    `gorm:"not null;default:0"`
+	Failed    int    `gorm:"not null;default:0"`
+	StartedAt *time.Time
+	EndedAt   *time.Time
+	CreatedAt time.Time `gorm:"index"`
+	UpdatedAt time.Time
+}
+
+func (jobV1) TableName() string { return "jobs" }
+
+// Version 2.
+
+type coordinationLeaseV2 struct {
+	Name      string    `gorm:"primaryKey;size:64"`
+	Holder    string    `gorm:"size:128;not null;default:''"`
+	ExpiresAt time.Time `gorm:"not null;index"`
+	UpdatedAt time.Time
+}
+
+func (coordinationLeaseV2) TableName() string { return "coordination_leases" }
+
+type rateCounterV2 struct {
+	Name        string    `gorm:"primaryKey;size:128"`
+	WindowStart int64     `gorm:"primaryKey;autoIncrement:false"`
+	Count       int64     `gorm:"not null;default:0"`
+	ExpiresAt   time.Time `gorm:"not null;index"`
+}
+
+func (rateCounterV2) TableName() string { return "rate_counters" }
+
+// Version 3.
+
+type settingChangeV3 struct {
+	ID        uint      `gorm:"primaryKey"`
+	Name      string    `gorm:"size:64;not null;index"`
+	OldValue  *string   `gorm:"type:text"`
+	NewValue  string    `gorm:"type:text;not null"`
+	Source    string    `gorm:"size:32;not null;default:''"`
+	CreatedAt time.Time `gorm:"index"`
+}
+
+func (settingChangeV3) TableName() string { return "setting_changes" }
+
+// Version 4.
+
+type auditEventV4 struct {
+	ID         uint      `gorm:"primaryKey"`
+	Actor      string    `gorm:"size:128;not null;default:'';index"`
+	Credential string    `gorm:"size:64;not null;default:''"`
+	Action     string    `gorm:"size:64;not null;index"`
+	TargetType string    `gorm:"size:32;not null;default:'';index:idx_audit_event_target"`
+	TargetID   string    `gorm:"size:128;not null;default:'';index:idx_audit_event_target"`
+	Method     string    `gorm:"size:8;not null;default:''"`
+	Path       string    `gorm:"size:255;not null;default:''"`
+	StatusCode int       `gorm:"not null;default:0"`
+	ClientIP   string    `gorm:"size:64;not null;default:''"`
+	Before     string    `gorm:"type:text"`
+	After      string    `gorm:"type:text"`
+	CreatedAt  time.Time `gorm:"index"`
+}
+
+func (auditEventV4) TableName() string { return "audit_events" }
+
+// Version 5.
+
+type adminUserV5 struct {
+	ID        uint   `gorm:"primaryKey"`
+	Name      string `gorm:"size:64;uniqueIndex;not null"`
+	Role      string `gorm:"size:16;not null"`
+	IsActive  bool   `gorm:"not null;default:true"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (adminUserV5) TableName() string { return "admin_users" }
+
+type adminTokenV5 struct {
+	ID          uint   `gorm:"primaryKey"`
+	AdminUserID uint   `gorm:"not null;index"`
+	Name        string `gorm:"size:64;not null"`
+	TokenHash   string `gorm:"size:64;uniqueIndex;not null"`
+	TokenPrefix string `gorm:"size:64;not null"`
+	ExpiresAt   *time.Time
+	LastUsedAt  *time.Time
+	RevokedAt   *time.Time
+	CreatedAt   time.Time
+}
+
+func (adminTokenV5) TableName() string { return "admin_tokens" }
+
+// Version 6.
+
+type adminSessionV6 struct {
+	ID         uint      `gorm:"primaryKey"`
+	TokenHash  string    `gorm:"size:64;uniqueIndex;not null"`
+	CSRFHash   string    `gorm:"column:csrf_hash;size:64;not null"`
+	Subject    string    `gorm:"size:255;not null"`
+	Email      string    `gorm:"size:255;not null;default:''"`
+	Name       string    `gorm:"size:255;not null;default:''"`
+	Role       string    `gorm:"size:16;not null"`
+	ExpiresAt  time.Time `gorm:"not null;index"`
+	LastSeenAt time.Time
+	CreatedAt  time.Time
+}
+
+func (adminSessionV6) TableName() string { return "admin_sessions" }
+
+type oidcLoginStateV6 struct {
+	ID        uint      `gorm:"primaryKey"`
+	StateHash string    `gorm:"size:64;uniqueIndex;not null"`
+	Nonce     string    `gorm:"size:64;not null"`
+	Verifier  string    `gorm:"size:128;not null"`
+	ReturnTo  string    `gorm:"size:512;not null;default:''"`
+	ExpiresAt time.Time `gorm:"not null;index"`
+	CreatedAt time.Time
+}
+
+func (oidcLoginStateV6) TableName() string { return "o_id_c_login_states" }
+
+// Version 7.
+
+type requestPolicyV7 struct {
+	ID        uint   `gorm:"primaryKey"`
+	Name      string `gorm:"size:64;uniqueIndex;not null"`
+	Priority  int    `gorm:"not null;default:0"`
+	Enabled   bool   `gorm:"not null"`
+	Endpoint  string `gorm:"size:64;not null;default:''"`
+	Caller    string `gorm:"size:16;not null;default:'any'"`
+	Action    string `gorm:"size:16;not null"`
+	Field     string `gorm:"size:64;not null;default:''"`
+	Value     string `gorm:"type:text"`
+	Min       *float64
+	Max       *float64
+	Message   string `gorm:"size:255;not null;default:''"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+func (requestPolicyV7) TableName() string { return "request_policies" }
+
+// Version 8.
+
+type responseFilterV8 struct {
+	ID          uint   `gorm:"primaryKey"`
+	Name        string `gorm:"size:64;uniqueIndex;not null"`
+	Enabled     bool   `gorm:"not null"`
+	Kind        string `gorm:"size:16;not null"`
+	Pattern     string `gorm:"type:text;not null"`
+	Replacement string `gorm:"size:64;not null;default:''"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+}
+
+func (responseFilterV8) TableName() string { return "response_filters" }
+
+// Version 9.
+
+type requestLogV9 struct {
+	Coalesced bool `gorm:"not null;default:false"`
+}
+
+func (requestLogV9) TableName() string { return "request_logs" }
+
+// Version 10.
+
+type idempotencyRecordV10 struct {
+	ID          uint   `gorm:"primaryKey"`
+	Scope       string `gorm:"size:64;not null;uniqueIndex:idx_idempotency_scope_key"`
+	Key         string `gorm:"column:idempotency_key;size:255;not null;uniqueIndex:idx_idempotency_scope_key"`
+	Fingerprint string `gorm:"size:64;not null"`
+	StatusCode  int    `gorm:"not null;default:0"`
+	Headers     string `gorm:"type:text"`
+	Body        []byte
+	ExpiresAt   time.Time `gorm:"index;not null"`
+	CreatedAt   time.Time
+}
+
+func (idempotencyRecordV10) TableName() string { return "idempotency_records" }
+
+// Version 11.
+
+type requestLogV11 struct {
+	Attempts   int    `gorm:"not null;default:0"`
+	AttemptLog string `gorm:"type:text"`
+}
+
+func (requestLogV11) TableName() string { return "request_logs" }
@@ -27,32 +27,71 @@ func NewRouter(deps Dependencies) http.Handler {
 	publicFS, _ := fs.Sub(deps.EmbeddedPublic, "public")
 	frontendReady := hasEmbeddedAssets(publicFS)
 
-	mcpHandler := mcpserver.NewHandler(mcpserver.Dependencies{
-		MasterKey:  deps.MasterKeyService,
-		Proxy:      deps.TavilyProxy,
-		Stateless:  deps.Config.MCPStateless,
-		SessionTTL: deps.Config.MCPSessionTTL,
+	mcpHandlers := mcpserver.NewHandlers(mcpserver.Dependencies{
+		MasterKey:       deps.MasterKeyService,
+		Proxy:           deps.TavilyProxy,
+		Stats:           deps.StatsService,
+		Logs:            deps.LogService,
+		Keys:            deps.KeyService,
+		QuotaSync:       deps.QuotaSyncService,
+		DistributedKeys: deps.DistributedKeyService,
+		RateLimiter:     deps.DistributedRateLimiter,
+		KeyUsage:        deps.DistributedKeyUsageService,
+		Audit:           deps.AuditService,
+		Settings:        deps.SettingsService,
+		Stateless:       deps.Config.MCPStateless,
+		SessionTTL:      deps.Config.MCPSessionTTL,
 	})
-	r.Any("/mcp", gin.WrapH(mcpHandler))
+	r.Any("/mcp", gin.WrapH(mcpHandlers.Streamable))
+	r.Any("/sse", gin.WrapH(mcpHandlers.SSE))
 
 	r.GET("/healthz", func(c *gin.Context) {
 		c.JSON(http.StatusOK, gin.H{"ok": true})
 	})
 
-	api := r.Group("/api", masterAuthMiddleware(deps.MasterKeyService))
+	auth := r.Group("/auth")
 	{
+		auth.GET("/config", func(c *gin.Context) { handleAuthConfig(c, deps.OIDCProvider) })
+		auth.GET("/oidc/login", func(c *gin.Context) { handleOIDCLogin(c, deps.OIDCProvider, deps.SessionService) })
+		auth.GET("/oidc/callback", func(c *gin.Context) {
+			handleOIDCCallback(c, deps.OIDCProvider, deps.SessionService, deps.AuditService)
+		})
+		auth.POST("/logout", func(c *gin.Context) { handleLogout(c, deps.SessionService) })
+	}
+
+	api := r.Group("/api",
+		adminAuthMiddleware(deps.MasterKeyService, deps.AdminService, deps.SessionService),
+		auditMiddleware(deps.AuditService),
+		permissionMiddleware(),
+	)
+	{
+		api.GET("/me", handleGetMe)
+
 		api.GET("/keys", func(c *gin.Context) { handleListKeys(c, deps.KeyService) })
 		api.POST("/keys", func(c *gin.Context) { handleCreateKey(c, deps.KeyService) })
 		api.GET("/keys/batch", func(c *gin.Context) { handleGetBatchCreateKeys(c, deps.KeyBatchCreateJob) })
 		api.POST("/keys/batch", func(c *gin.Context) { handleStartBatchCreateKeys(c, deps.KeyBatchCreateJob) })
+		api.POST("/keys/batch/cancel", func(c *gin.Context) { handleBatchCreateJobAction(c, deps.KeyBatchCreateJob, jobActionCancel) })
+		api.POST("/keys/batch/pause", func(c *gin.Context) { handleBatchCreateJobAction(c, deps.KeyBatchCreateJob, jobActionPause) })
+		api.POST("/keys/batch/resume", func(c *gin.Context) { handleBatchCreateJobAction(c, deps.KeyBatchCreateJob, jobActionResume) })
 		api.GET("/keys/export", func(c *gin.Context) { handleExportKeys(c, deps.KeyService) })
+		api.POST("/keys/import", func(c *gin.Context) { handleImportKeys(c, deps.KeyService) })
 		api.GET("/keys/:id/raw", func(c *gin.Context) { handleGetKeyRaw(c, deps.KeyService, c.Param("id")) })
 		api.GET("/keys/sync", func(c *gin.Context) { handleGetSyncAllKeys(c, deps.QuotaSyncJob) })
 		api.POST("/keys/sync", func(c *gin.Context) { handleStartSyncAllKeys(c, deps.QuotaSyncJob) })
+		api.POST("/keys/sync/cancel", func(c *gin.Context) { handleSyncJobAction(c, deps.QuotaSyncJob, jobActionCancel) })
+		api.POST("/keys/sync/pause", func(c *gin.Context) { handleSyncJobAction(c, deps.QuotaSyncJob, jobActionPause) })
+		api.POST("/keys/sync/resume", func(c *gin.Context) { handleSyncJobAction(c, deps.QuotaSyncJob, jobActionResume) })
 		api.DELETE("/keys/invalid", func(c *gin.Context) { handleDeleteInvalidKeys(c, deps.KeyService) })
 		api.PUT("/keys/:id", func(c *gin.Context) { handleUpdateKey(c, deps, c.Param("id")) })
 		api.DELETE("/keys/:id", func(c *gin.Context) { handleDeleteKey(c, deps.KeyService, c.Param("id")) })
 
+		api.GET("/jobs", func(c *gin.Context) { handleListJobs(c, deps) })
+		api.GET("/jobs/:id", func(c *gin.Context) { handleGetJob(c, deps, c.Param("id")) })
+		api.POST("/jobs/:id/cancel", func(c *gin.Context) { handleJobAction(c, deps, c.Param("id"), jobActionCancel) })
+		api.POST("/jobs/:id/pause", func(c *gin.Context) { handleJobAction(c, deps, c.Param("id"), jobActionPause) })
+		api.POST("/jobs/:id/resume", func(c *gin.Context) { handleJobAction(c, deps, c.Param("id"), jobActionResume) })
+
 		api.GET("/logs/status-codes", func(c *gin.Context) { handleLogStatusCodes(c, deps.LogService) })
 		api.GET("/logs", func(c *gin.Context) { handleListLogs(c, deps.LogService) })
 		api.DELETE("/logs", func(c *gin.Context) { handleClearLogs(c, deps.LogService) })
@@ -82,18 +121,52 @@ func NewRouter(deps Dependencies) http.Handler {
 			c.JSON(http.StatusOK, gin.H{"master_key": deps.MasterKeyService.Get()})
 		})
 		api.POST("/settings/master-key/reset", func(c *gin.Context) {
+			auditBefore(c, gin.H{"master_key": deps.MasterKeyService.Get()})
 			newKey, err := deps.MasterKeyService.Reset(c.Request.Context())
 			if err != nil {
 				c.JSON(http.StatusInternalServerError, gin.H{"error": "reset_failed"})
 				return
 			}
+			auditAfter(c, gin.H{"master_key": newKey})
 			c.JSON(http.StatusOK, gin.H{"master_key": newKey})
 		})
 
+		api.GET("/settings", func(c *gin.Context) { handleListSettings(c, deps.SettingsService) })
+		api.PUT("/settings", func(c *gin.Context) { handleUpdateSettings(c, deps.SettingsService) })
+		api.GET("/settings/:name", func(c *gin.Context) { handleGetSetting(c, deps.SettingsService, c.Param("name")) })
+		api.PUT("/settings/:name", func(c *gin.Context) { handleUpdateSetting(c, deps.SettingsService, c.Param("name")) })
 		api.GET("/settings/auto-sync", func(c *gin.Context) { handleGetAutoSync(c, deps.SettingsService) })
 		api.PUT("/settings/auto-sync", func(c *gin.Context) { handleSetAutoSync(c, deps.SettingsService) })
 		api.GET("/settings/log-cleanup", func(c *gin.Context) { handleGetLogCleanup(c, deps.SettingsService) })
 		api.PUT("/settings/log-cleanup", func(c *gin.Context) { handleSetLogCleanup(c, deps.SettingsService) })
+		api.GET("/settings/backup", func(c *gin.Context) { handleGetBackupSettings(c, deps.SettingsService, deps.Config.BackupDir) })
+		api.PUT("/settings/backup", func(c *gin.Context) { handleSetBackupSettings(c, deps.SettingsService) })
+
+		api.GET("/audit", func(c *gin.Context) { handleListAuditEvents(c, deps.AuditService) })
+
+		api.GET("/admin/backup", func(c *gin.Context) { handleDownloadBackup(c, deps.BackupService) })
+		api.GET("/admin/backups", func(c *gin.Context) { handleListBackups(c, deps.Config.BackupDir) })
+		api.POST("/admin/restore", func(c *gin.Context) { handleRestoreBackup(c, deps.BackupService) })
+
+		api.GET("/policies", func(c *gin.Context) { handleListPolicies(c, deps.PolicyService) })
+		api.POST("/policies", func(c *gin.Context) { handleCreatePolicy(c, deps.PolicyService) })
+		api.PUT("/policies/:id", func(c *gin.Context) { handleUpdatePolicy(c, deps.PolicyService, c.Param("id")) })
+		api.DELETE("/policies/:id", func(c *gin.Context) { handleDeletePolicy(c, deps.PolicyService, c.Param("id")) })
+
+		api.GET("/filters", func(c *gin.Context) { handleListFilters(c, deps.FilterService) })
+		api.POST("/filters", func(c *gin.Context) { handleCreateFilter(c, deps.FilterService) })
+		api.PUT("/filters/:id", func(c *gin.Context) { handleUpdateFilter(c, deps.FilterService, c.Param("id")) })
+		api.DELETE("/filters/:id", func(c *gin.Context) { handleDeleteFilter(c, deps.FilterService, c.Param("id")) })
+
+		api.GET("/admins", func(c *gin.Context) { handleListAdmins(c, deps.AdminService) })
+		api.POST("/admins", func(c *gin.Context) { handleCreateAdmin(c, deps.AdminService) })
+		api.PUT("/admins/:id", func(c *gin.Context) { handleUpdateAdmin(c, deps.AdminService, c.Param("id")) })
+		api.DELETE("/admins/:id", func(c *gin.Context) { handleDeleteAdmin(c, deps.AdminService, c.Param("id")) })
+		api.GET("/admins/:id/tokens", func(c *gin.Context) { handleListAdminTokens(c, deps.AdminService, c.Param("id")) })
+		api.POST("/admins/:id/tokens", func(c *gin.Context) { handleCreateAdminToken(c, deps.AdminService, c.Param("id")) })
+		api.DELETE("/admins/:id/tokens/:token_id", func(c *gin.Context) {
+			handleRevokeAdminToken(c, deps.AdminService, c.Param("id"), c.Param("token_id"))
+		})
 	}
 
 	r.NoRoute(func(c *gin.Context) {
@@ -115,14 +188,16 @@ func NewRouter(deps Dependencies) http.Handler {
 
 		hasCredential := authHeaderToken != "" || apiKeyFromBody != "" || apiKeyFromQuery != ""
 		if deps.MasterKeyService.Authenticate(authHeaderToken) || deps.MasterKeyService.Authenticate(apiKeyFromBody) || deps.MasterKeyService.Authenticate(apiKeyFromQuery) {
-			handleProxy(c, deps.TavilyProxy, sanitizedBody, sanitizedQuery)
+			handleIdempotentProxy(c, deps.IdempotencyService, 0, sanitizedBody, sanitizedQuery, func() int {
+				return handleProxy(c, deps.TavilyProxy, sanitizedBody, sanitizedQuery, 0)
+			})
 			return
 		}
 		if authHeaderToken != "" && deps.DistributedKeyService != nil {
 			now := time.Now().UTC()
 			distributedKey, err := deps.DistributedKeyService.AuthenticateBearer(c.Request.Context(), authHeaderToken, now)
 			if err == nil {
-				if deps.DistributedRateLimiter != nil && !deps.DistributedRateLimiter.Allow(distributedKey.ID, distributedKey.RateLimitPerMinute, now) {
+				if deps.DistributedRateLimiter != nil && !deps.DistributedRateLimiter.AllowContext(c.Request.Context(), distributedKey.ID, distributedKey.RateLimitPerMinute, now) {
 					c.JSON(http.StatusTooManyRequests, gin.H{"error": "rate_limited"})
 					if deps.DistributedKeyUsageService != nil {
 						_ = deps.DistributedKeyUsageService.Record(c.Request.Context(), distributedKey.ID, http.StatusTooManyRequests, now)
@@ -130,7 +205,9 @@ func NewRouter(deps Dependencies) http.Handler {
 					return
 				}
 
-				statusCode := handleProxy(c, deps.TavilyProxy, sanitizedBody, sanitizedQuery)
+				statusCode := handleIdempotentProxy(c, deps.IdempotencyService, distributedKey.ID, sanitizedBody, sanitizedQuery, func() int {
+					return handleProxy(c, deps.TavilyProxy, sanitizedBody, sanitizedQuery, distributedKey.ID)
+				})
 				if deps.DistributedKeyUsageService != nil {
 					_ = deps.DistributedKeyUsageService.Record(c.Request.Context(), distributedKey.ID, statusCode, now)
 				}
@@ -169,18 +246,6 @@ func NewRouter(deps Dependencies) http.Handler {
 	return r
 }
 
-func masterAuthMiddleware(master *services.MasterKeyService) gin.HandlerFunc {
-	return func(c *gin.Context) {
-		token := parseBearerToken(c.GetHeader("Authorization"))
-		if !master.Authenticate(token) {
-			respondUnauthorized(c)
-			c.Abort()
-			return
-		}
-		c.Next()
-	}
-}
-
 func respondUnauthorized(c *gin.Context) {
 	c.JSON(http.StatusUnauthorized, gin.H{"error": "unauthorized"})
 }
@@ -358,35 +423,6 @@ func handleListKeys(c *gin.Context, keys *services.KeyService) {
 	c.JSON(http.StatusOK, gin.H{"items": out})
 }
 
-func handleExportKeys(c *gin.Context, keys *services.KeyService) {
-	items, err := keys.List(c.Request.Context())
-	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error"})
-		return
-	}
-
-	var buf bytes.Buffer
-	var exported int
-	for _, k := range items {
-		if k.IsInvalid {
-			continue
-		}
-		key := strings.TrimSpace(k.Key)
-		if key == "" {
-			continue
-		}
-		buf.WriteString(key)
-		buf.WriteByte('\n')
-		exported++
-	}
-
-	c.Header("Content-Type", "text/plain; charset=utf-8")
-	c.Header("Content-Disposition", `attachment; filename="tavily-keys.txt"`)
-	c.Header("X-Exported-Count", strconv.Itoa(exported))
-	c.Status(http.StatusOK)
-	_, _ = io.Copy(c.Writer, &buf)
-}
-
 func handleCreateKey(c *gin.Context, keys *services.KeyService) {
 	var body struct {
 		Key        string `json:"key"`
@@ -410,6 +446,8 @@ func handleCreateKey(c *gin.Context, keys *services.KeyService) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "create_failed"})
 		return
 	}
+	auditTarget(c, created.ID)
+	auditAfter(c, keyAuditView(created))
 	c.JSON(http.StatusOK, gin.H{
 		"item": gin.H{
 			"id":          created.ID,
@@ -457,11 +495,15 @@ func handleUpdateKey(c *gin.Context, deps Dependencies, idStr string) {
 		return
 	}
 
+	if existing, err := deps.KeyService.Get(c.Request.Context(), uint(id)); err == nil && existing != nil {
+		auditBefore(c, keyAuditView(existing))
+	}
 	updated, err := deps.KeyService.Update(c.Request.Context(), uint(id), body)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "update_failed"})
 		return
 	}
+	auditAfter(c, keyAuditView(updated))
 
 	if body.SyncUsage {
 		if _, err := deps.QuotaSyncService.SyncOne(c.Request.Context(), uint(id)); err != nil {
@@ -470,6 +512,7 @@ func handleUpdateKey(c *gin.Context, deps Dependencies, idStr string) {
 		}
 		if refreshed, err := deps.KeyService.Get(c.Request.Context(), uint(id)); err == nil && refreshed != nil {
 			updated = refreshed
+			auditAfter(c, keyAuditView(updated))
 		}
 	}
 
@@ -492,6 +535,7 @@ func handleDeleteInvalidKeys(c *gin.Context, keys *services.KeyService) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "delete_failed"})
 		return
 	}
+	auditAfter(c, gin.H{"deleted": deleted})
 	c.JSON(http.StatusOK, gin.H{"deleted": deleted})
 }
 
@@ -521,6 +565,18 @@ func handleStartSyncAllKeys(c *gin.Context, jobs *services.QuotaSyncJobService)
 	c.JSON(http.StatusOK, result)
 }
 
+// pinnedSettings lists which of keys are fixed by the config file or env, so
+// the dashboard can show them read-only.
+func pinnedSettings(settings *services.SettingsService, keys ...string) []string {
+	pinned := []string{}
+	for _, key := range keys {
+		if settings.IsPinned(key) {
+			pinned = append(pinned, key)
+		}
+	}
+	return pinned
+}
+
 func handleGetAutoSync(c *gin.Context, settings *services.SettingsService) {
 	enabled, err := settings.GetBool(c.Request.Context(), services.SettingAutoSyncEnabled, false)
 	if err != nil {
@@ -536,7 +592,17 @@ func handleGetAutoSync(c *gin.Context, settings *services.SettingsService) {
 		interval = 1
 	}
 
-	concurrency := 1
+	concurrency, err := settings.GetInt(c.Request.Context(), services.SettingAutoSyncConcurrency, 1)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error"})
+		return
+	}
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	if concurrency > 32 {
+		concurrency = 32
+	}
 
 	requestIntervalSeconds, err := settings.GetInt(c.Request.Context(), services.SettingAutoSyncRequestIntervalSeconds, 0)
 	if err != nil {
@@ -573,6 +639,12 @@ func handleGetAutoSync(c *gin.Context, settings *services.SettingsService) {
 		"last_run_at":              lastRunStr,
 		"last_success_at":          lastSuccessStr,
 		"last_error":               lastErr,
+		"pinned": pinnedSettings(settings,
+			services.SettingAutoSyncEnabled,
+			services.SettingAutoSyncIntervalMinutes,
+			services.SettingAutoSyncConcurrency,
+			services.SettingAutoSyncRequestIntervalSeconds,
+		),
 	})
 }
 
@@ -592,31 +664,26 @@ func handleSetAutoSync(c *gin.Context, settings *services.SettingsService) {
 		return
 	}
 
+	values := map[string]string{}
 	if body.IntervalMinutes != nil {
 		if *body.IntervalMinutes < 1 || *body.IntervalMinutes > 1440 {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_interval_minutes"})
 			return
 		}
-		if err := settings.SetInt(c.Request.Context(), services.SettingAutoSyncIntervalMinutes, *body.IntervalMinutes); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error"})
-			return
-		}
+		values[services.SettingAutoSyncIntervalMinutes] = strconv.Itoa(*body.IntervalMinutes)
 	}
 	if body.RequestIntervalSeconds != nil {
 		if *body.RequestIntervalSeconds < 0 || *body.RequestIntervalSeconds > 60 {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_request_interval_seconds"})
 			return
 		}
-		if err := settings.SetInt(c.Request.Context(), services.SettingAutoSyncRequestIntervalSeconds, *body.RequestIntervalSeconds); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error"})
-			return
-		}
+		values[services.SettingAutoSyncRequestIntervalSeconds] = strconv.Itoa(*body.RequestIntervalSeconds)
 	}
 	if body.Enabled != nil {
-		if err := settings.SetBool(c.Request.Context(), services.SettingAutoSyncEnabled, *body.Enabled); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error"})
-			return
-		}
+		values[services.SettingAutoSyncEnabled] = strconv.FormatBool(*body.Enabled)
+	}
+	if !applySettings(c, settings, values) {
+		return
 	}
 
 	c.Status(http.StatusNoContent)
@@ -652,6 +719,7 @@ func handleGetLogCleanup(c *gin.Context, settings *services.SettingsService) {
 		"retention_days":  retentionDays,
 		"last_run_at":     lastRunStr,
 		"last_error":      lastErr,
+		"pinned":          pinnedSettings(settings, services.SettingRequestLoggingEnabled, services.SettingLogRetentionDays),
 	})
 }
 
@@ -669,22 +737,19 @@ func handleSetLogCleanup(c *gin.Context, settings *services.SettingsService) {
 		return
 	}
 
+	values := map[string]string{}
 	if body.LoggingEnabled != nil {
-		if err := settings.SetBool(c.Request.Context(), services.SettingRequestLoggingEnabled, *body.LoggingEnabled); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error"})
-			return
-		}
+		values[services.SettingRequestLoggingEnabled] = strconv.FormatBool(*body.LoggingEnabled)
 	}
-
 	if body.RetentionDays != nil {
 		if *body.RetentionDays < 0 || *body.RetentionDays > 3650 {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_retention_days"})
 			return
 		}
-		if err := settings.SetInt(c.Request.Context(), services.SettingLogRetentionDays, *body.RetentionDays); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error"})
-			return
-		}
+		values[services.SettingLogRetentionDays] = strconv.Itoa(*body.RetentionDays)
+	}
+	if !applySettings(c, settings, values) {
+		return
 	}
 	c.Status(http.StatusNoContent)
 }
@@ -695,6 +760,9 @@ func handleDeleteKey(c *gin.Context, keys *services.KeyService, idStr string) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_id"})
 		return
 	}
+	if existing, err := keys.Get(c.Request.Context(), uint(id)); err == nil && existing != nil {
+		auditBefore(c, keyAuditView(existing))
+	}
 	if err := keys.Delete(c.Request.Context(), uint(id)); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "delete_failed"})
 		return
@@ -730,6 +798,7 @@ func handleClearLogs(c *gin.Context, logs *services.LogService) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error"})
 		return
 	}
+	auditAfter(c, gin.H{"deleted": deleted})
 	c.JSON(http.StatusOK, gin.H{"deleted": deleted})
 }
 
@@ -753,24 +822,116 @@ func handleStats(c *gin.Context, stats *services.StatsService) {
 
 func handleTimeSeries(c *gin.Context, stats *services.StatsService) {
 	granularity := c.Query("granularity")
-	out, err := stats.TimeSeries(c.Request.Context(), granularity)
+	if !isTimeSeriesQuery(c) {
+		out, err := stats.TimeSeries(c.Request.Context(), granularity)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_granularity"})
+			return
+		}
+		c.JSON(http.StatusOK, out)
+		return
+	}
+
+	q := services.TimeSeriesQuery{
+		Granularity: granularity,
+		GroupBy:     strings.TrimSpace(c.Query("group_by")),
+		Endpoint:    strings.TrimSpace(c.Query("endpoint")),
+		Location:    time.Local,
+	}
+	if tz := strings.TrimSpace(c.Query("tz")); tz != "" {
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_timezone"})
+			return
+		}
+		q.Location = loc
+	}
+
+	var err error
+	if q.From, err = parseTimeSeriesBound(c.Query("from"), q.Location); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_from"})
+		return
+	}
+	if q.To, err = parseTimeSeriesBound(c.Query("to"), q.Location); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_to"})
+		return
+	}
+	if v := strings.TrimSpace(c.Query("key_id")); v != "" {
+		id, err := parseUintParam(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_key_id"})
+			return
+		}
+		q.KeyID = uint(id)
+	}
+	if v := strings.TrimSpace(c.Query("distributed_key_id")); v != "" {
+		id, err := parseUintParam(v)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_distributed_key_id"})
+			return
+		}
+		q.DistributedKeyID = uint(id)
+	}
+
+	out, err := stats.QueryTimeSeries(c.Request.Context(), q)
 	if err != nil {
-		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_granularity"})
+		switch {
+		case errors.Is(err, services.ErrInvalidGranularity),
+			errors.Is(err, services.ErrInvalidGroupBy),
+			errors.Is(err, services.ErrInvalidTimeRange),
+			errors.Is(err, services.ErrTooManyTimeBuckets):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error"})
+		}
 		return
 	}
 	c.JSON(http.StatusOK, out)
 }
 
-func handleProxy(c *gin.Context, proxy *services.TavilyProxy, body []byte, rawQuery string) int {
+// isTimeSeriesQuery reports whether the request needs the rollup-backed query
+// rather than the fixed dashboard windows.
+func isTimeSeriesQuery(c *gin.Context) bool {
+	switch c.Query("granularity") {
+	case "minute", "week":
+		return true
+	}
+	for _, name := range []string{"from", "to", "tz", "group_by", "endpoint", "key_id", "distributed_key_id"} {
+		if strings.TrimSpace(c.Query(name)) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+func parseTimeSeriesBound(raw string, loc *time.Location) (time.Time, error) {
+	v := strings.TrimSpace(raw)
+	if v == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, v); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02T15:04", v, loc); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation("2006-01-02", v, loc)
+}
+
+func handleProxy(c *gin.Context, proxy *services.TavilyProxy, body []byte, rawQuery string, distributedKeyID uint) int {
 	resp, err := proxy.Do(c.Request.Context(), services.ProxyRequest{
-		Method:      c.Request.Method,
-		Path:        c.Request.URL.Path,
-		RawQuery:    rawQuery,
-		Headers:     c.Request.Header.Clone(),
-		Body:        body,
-		ClientIP:    c.ClientIP(),
-		ContentType: c.GetHeader("Content-Type"),
+		Method:           c.Request.Method,
+		Path:             c.Request.URL.Path,
+		RawQuery:         rawQuery,
+		Headers:          c.Request.Header.Clone(),
+		Body:             body,
+		ClientIP:         c.ClientIP(),
+		ContentType:      c.GetHeader("Content-Type"),
+		DistributedKeyID: distributedKeyID,
 	})
+	if resp.Attempts > 0 {
+		c.Header(services.AttemptsHeader, strconv.Itoa(resp.Attempts))
+	}
 	if err != nil {
 		if errors.Is(err, services.ErrNoAvailableKeys) {
 			c.JSON(http.StatusServiceUnavailable, gin.H{
@@ -779,6 +940,15 @@ func handleProxy(c *gin.Context, proxy *services.TavilyProxy, body []byte, rawQu
 			})
 			return http.StatusServiceUnavailable
 		}
+		var rejected *services.PolicyRejectedError
+		if errors.As(err, &rejected) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":   "policy_rejected",
+				"policy":  rejected.Policy,
+				"message": rejected.Message,
+			})
+			return http.StatusForbidden
+		}
 		c.JSON(http.StatusBadGateway, gin.H{"error": "upstream_error"})
 		return http.StatusBadGateway
 	}
@@ -795,6 +965,9 @@ func handleProxy(c *gin.Context, proxy *services.TavilyProxy, body []byte, rawQu
 	if resp.TavilyRequestID != "" {
 		c.Header("X-Tavily-Request-ID", resp.TavilyRequestID)
 	}
+	if resp.Coalesced {
+		c.Header("X-Proxy-Coalesced", "true")
+	}
 
 	c.Status(resp.StatusCode)
 	_, _ = io.Copy(c.Writer, bytes.NewReader(resp.Body))
@@ -0,0 +1,393 @@
+package httpserver
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"tavily-proxy/server/internal/services"
+	"tavily-proxy/server/internal/util"
+)
+
+const principalKey = "admin_principal"
+
+// permAuthenticated marks routes any authenticated admin may call.
+const permAuthenticated services.Permission = ""
+
+// routePermissions names the permission each /api route requires. Routes
+// missing from this map are denied to everyone but owners.
+var routePermissions = map[string]services.Permission{
+	"GET /api/me": permAuthenticated,
+
+	"GET /api/keys":               services.PermKeysRead,
+	"POST /api/keys":              services.PermKeysWrite,
+	"PUT /api/keys/:id":           services.PermKeysWrite,
+	"DELETE /api/keys/:id":        services.PermKeysWrite,
+	"DELETE /api/keys/invalid":    services.PermKeysWrite,
+	"GET /api/keys/:id/raw":       services.PermKeysReveal,
+	"GET /api/keys/export":        services.PermKeysReveal,
+	"POST /api/keys/import":       services.PermKeysWrite,
+	"GET /api/keys/batch":         services.PermJobsRead,
+	"POST /api/keys/batch":        services.PermKeysWrite,
+	"POST /api/keys/batch/cancel": services.PermJobsWrite,
+	"POST /api/keys/batch/pause":  services.PermJobsWrite,
+	"POST /api/keys/batch/resume": services.PermJobsWrite,
+	"GET /api/keys/sync":          services.PermJobsRead,
+	"POST /api/keys/sync":         services.PermJobsWrite,
+	"POST /api/keys/sync/cancel":  services.PermJobsWrite,
+	"POST /api/keys/sync/pause":   services.PermJobsWrite,
+	"POST /api/keys/sync/resume":  services.PermJobsWrite,
+	"GET /api/jobs":               services.PermJobsRead,
+	"GET /api/jobs/:id":           services.PermJobsRead,
+	"POST /api/jobs/:id/cancel":   services.PermJobsWrite,
+	"POST /api/jobs/:id/pause":    services.PermJobsWrite,
+	"POST /api/jobs/:id/resume":   services.PermJobsWrite,
+	"GET /api/logs/status-codes":  services.PermLogsRead,
+	"GET /api/logs":               services.PermLogsRead,
+	"DELETE /api/logs":            services.PermLogsDelete,
+	"GET /api/stats":              services.PermStatsRead,
+	"GET /api/stats/timeseries":   services.PermStatsRead,
+
+	"GET /api/distributed-keys":             services.PermDKeysRead,
+	"POST /api/distributed-keys":            services.PermDKeysWrite,
+	"PUT /api/distributed-keys/:id":         services.PermDKeysWrite,
+	"POST /api/distributed-keys/:id/rotate": services.PermDKeysWrite,
+	"DELETE /api/distributed-keys/:id":      services.PermDKeysWrite,
+	"GET /api/distributed-keys/:id/stats":   services.PermDKeysRead,
+
+	"GET /api/settings/master-key":        services.PermMasterKey,
+	"POST /api/settings/master-key/reset": services.PermMasterKey,
+	"GET /api/settings":                   services.PermSettingsRead,
+	"PUT /api/settings":                   services.PermSettingsWrite,
+	"GET /api/settings/:name":             services.PermSettingsRead,
+	"PUT /api/settings/:name":             services.PermSettingsWrite,
+	"GET /api/settings/auto-sync":         services.PermSettingsRead,
+	"PUT /api/settings/auto-sync":         services.PermSettingsWrite,
+	"GET /api/settings/log-cleanup":       services.PermSettingsRead,
+	"PUT /api/settings/log-cleanup":       services.PermSettingsWrite,
+	"GET /api/settings/backup":            services.PermSettingsRead,
+	"PUT /api/settings/backup":            services.PermSettingsWrite,
+
+	"GET /api/audit": services.PermAuditRead,
+
+	"GET /api/admin/backup":   services.PermBackupManage,
+	"GET /api/admin/backups":  services.PermBackupManage,
+	"POST /api/admin/restore": services.PermBackupManage,
+
+	"GET /api/policies":        services.PermSettingsRead,
+	"POST /api/policies":       services.PermSettingsWrite,
+	"PUT /api/policies/:id":    services.PermSettingsWrite,
+	"DELETE /api/policies/:id": services.PermSettingsWrite,
+	"GET /api/filters":         services.PermSettingsRead,
+	"POST /api/filters":        services.PermSettingsWrite,
+	"PUT /api/filters/:id":     services.PermSettingsWrite,
+	"DELETE /api/filters/:id":  services.PermSettingsWrite,
+
+	"GET /api/admins":                         services.PermAdminsManage,
+	"POST /api/admins":                        services.PermAdminsManage,
+	"PUT /api/admins/:id":                     services.PermAdminsManage,
+	"DELETE /api/admins/:id":                  services.PermAdminsManage,
+	"GET /api/admins/:id/tokens":              services.PermAdminsManage,
+	"POST /api/admins/:id/tokens":             services.PermAdminsManage,
+	"DELETE /api/admins/:id/tokens/:token_id": services.PermAdminsManage,
+}
+
+// adminAuthMiddleware accepts the master key, which always acts as an owner
+// so it keeps working as a break-glass credential, an admin API token, or an
+// SSO session cookie. Cookie-authenticated writes must carry the session's
+// CSRF token; bearer tokens are not sent by browsers implicitly and need none.
+func adminAuthMiddleware(master *services.MasterKeyService, admins *services.AdminService, sessions *services.SessionService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := parseBearerToken(c.GetHeader("Authorization"))
+		var principal services.Principal
+		switch {
+		case master.Authenticate(token):
+			principal = services.Principal{
+				Actor:      "master_key",
+				Role:       services.RoleOwner,
+				Credential: util.MaskAPIKey(token),
+				AuthMethod: services.AuthMethodMasterKey,
+			}
+		case admins != nil && strings.HasPrefix(token, services.AdminTokenPrefix):
+			p, err := admins.Authenticate(c.Request.Context(), token, time.Now().UTC())
+			if err != nil {
+				abortAuth(c, err, services.ErrAdminTokenInvalid)
+				return
+			}
+			principal = p
+		case token == "" && sessions != nil:
+			cookie, _ := c.Cookie(sessionCookieName)
+			p, session, err := sessions.Authenticate(c.Request.Context(), cookie, time.Now().UTC())
+			if err != nil {
+				abortAuth(c, err, services.ErrSessionInvalid)
+				return
+			}
+			if isMutatingMethod(c.Request.Method) && !services.CheckCSRF(session, c.GetHeader(csrfHeaderName)) {
+				c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "csrf_failed"})
+				return
+			}
+			principal = p
+		default:
+			respondUnauthorized(c)
+			c.Abort()
+			return
+		}
+		c.Set(principalKey, principal)
+		c.Set(auditActorKey, principal.Actor)
+		c.Set(auditCredentialKey, principal.Credential)
+		c.Next()
+	}
+}
+
+// abortAuth answers 401 for rejected credentials and 500 for lookup failures.
+func abortAuth(c *gin.Context, err, invalid error) {
+	if !errors.Is(err, invalid) {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "db_error"})
+		return
+	}
+	respondUnauthorized(c)
+	c.Abort()
+}
+
+// permissionMiddleware runs after auditMiddleware so denied attempts at
+// audited routes are recorded too.
+func permissionMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		principal := currentPrincipal(c)
+		perm, ok := routePermissions[c.Request.Method+" "+c.FullPath()]
+		allowed := principal.Role == services.RoleOwner
+		if ok {
+			allowed = perm == permAuthenticated || principal.Can(perm)
+		}
+		if !allowed {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "forbidden", "required_permission": perm})
+			return
+		}
+		c.Next()
+	}
+}
+
+func currentPrincipal(c *gin.Context) services.Principal {
+	v, _ := c.Get(principalKey)
+	p, _ := v.(services.Principal)
+	return p
+}
+
+func handleGetMe(c *gin.Context) {
+	p := currentPrincipal(c)
+	out := gin.H{
+		"actor":       p.Actor,
+		"auth_method": p.AuthMethod,
+		"role":        p.Role,
+		"permissions": p.Role.Permissions(),
+	}
+	if p.AdminID != 0 {
+		out["admin_id"] = p.AdminID
+		out["name"] = p.Name
+	}
+	c.JSON(http.StatusOK, out)
+}
+
+func handleListAdmins(c *gin.Context, admins *services.AdminService) {
+	if admins == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "service_not_configured"})
+		return
+	}
+	items, err := admins.List(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"items": items})
+}
+
+func handleCreateAdmin(c *gin.Context, admins *services.AdminService) {
+	if admins == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "service_not_configured"})
+		return
+	}
+	var body struct {
+		Name string `json:"name"`
+		Role string `json:"role"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_json"})
+		return
+	}
+	role, err := services.ParseRole(body.Role)
+	if err != nil {
+		writeAdminError(c, err)
+		return
+	}
+	created, err := admins.Create(c.Request.Context(), body.Name, role)
+	if err != nil {
+		writeAdminError(c, err)
+		return
+	}
+	auditTarget(c, created.ID)
+	auditAfter(c, created)
+	c.JSON(http.StatusOK, created)
+}
+
+func handleUpdateAdmin(c *gin.Context, admins *services.AdminService, idStr string) {
+	if admins == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "service_not_configured"})
+		return
+	}
+	id, ok := parseAdminID(c, idStr)
+	if !ok {
+		return
+	}
+	var body struct {
+		Role     *string `json:"role"`
+		IsActive *bool   `json:"is_active"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_json"})
+		return
+	}
+	var role *services.Role
+	if body.Role != nil {
+		r, err := services.ParseRole(*body.Role)
+		if err != nil {
+			writeAdminError(c, err)
+			return
+		}
+		role = &r
+	}
+
+	before, err := admins.Get(c.Request.Context(), id)
+	if err != nil {
+		writeAdminError(c, err)
+		return
+	}
+	auditBefore(c, before)
+	updated, err := admins.Update(c.Request.Context(), id, role, body.IsActive)
+	if err != nil {
+		writeAdminError(c, err)
+		return
+	}
+	auditAfter(c, updated)
+	c.JSON(http.StatusOK, updated)
+}
+
+func handleDeleteAdmin(c *gin.Context, admins *services.AdminService, idStr string) {
+	if admins == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "service_not_configured"})
+		return
+	}
+	id, ok := parseAdminID(c, idStr)
+	if !ok {
+		return
+	}
+	if before, err := admins.Get(c.Request.Context(), id); err == nil {
+		auditBefore(c, before)
+	}
+	if err := admins.Delete(c.Request.Context(), id); err != nil {
+		writeAdminError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+func handleListAdminTokens(c *gin.Context, admins *services.AdminService, idStr string) {
+	if admins == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "service_not_configured"})
+		return
+	}
+	id, ok := parseAdminID(c, idStr)
+	if !ok {
+		return
+	}
+	if _, err := admins.Get(c.Request.Context(), id); err != nil {
+		writeAdminError(c, err)
+		return
+	}
+	items, err := admins.ListTokens(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"items": items})
+}
+
+func handleCreateAdminToken(c *gin.Context, admins *services.AdminService, idStr string) {
+	if admins == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "service_not_configured"})
+		return
+	}
+	id, ok := parseAdminID(c, idStr)
+	if !ok {
+		return
+	}
+	var body struct {
+		Name      string `json:"name"`
+		ExpiresAt string `json:"expires_at"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_json"})
+		return
+	}
+	expiresAt, err := services.ParseRFC3339Ptr(body.ExpiresAt)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_expires_at"})
+		return
+	}
+	record, token, err := admins.CreateToken(c.Request.Context(), id, services.AdminTokenCreateInput{Name: body.Name, ExpiresAt: expiresAt})
+	if err != nil {
+		writeAdminError(c, err)
+		return
+	}
+	// The record carries only the token prefix; the plain token is never
+	// part of the audit snapshot.
+	auditAfter(c, record)
+	c.JSON(http.StatusOK, gin.H{"token": token, "item": record})
+}
+
+func handleRevokeAdminToken(c *gin.Context, admins *services.AdminService, idStr, tokenIDStr string) {
+	if admins == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "service_not_configured"})
+		return
+	}
+	id, ok := parseAdminID(c, idStr)
+	if !ok {
+		return
+	}
+	tokenID, err := strconv.ParseUint(tokenIDStr, 10, 64)
+	if err != nil || tokenID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_token_id"})
+		return
+	}
+	if err := admins.RevokeToken(c.Request.Context(), id, uint(tokenID)); err != nil {
+		writeAdminError(c, err)
+		return
+	}
+	auditAfter(c, gin.H{"token_id": tokenID, "revoked": true})
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+func parseAdminID(c *gin.Context, idStr string) (uint, bool) {
+	id, err := strconv.ParseUint(idStr, 10, 64)
+	if err != nil || id == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_id"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+func writeAdminError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrAdminNotFound), errors.Is(err, services.ErrAdminTokenNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrAdminNameTaken):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrAdminInvalidName), errors.Is(err, services.ErrAdminInvalidRole):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error"})
+	}
+}
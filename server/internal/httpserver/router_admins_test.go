@@ -0,0 +1,266 @@
+package httpserver
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"tavily-proxy/server/internal/db"
+	"tavily-proxy/server/internal/services"
+)
+
+func TestAdminTokens_RolesScopeRoutes(t *testing.T) {
+	t.Parallel()
+
+	gin.SetMode(gin.TestMode)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	database, err := db.Open(filepath.Join(t.TempDir(), "app.db"))
+	if err != nil {
+		t.Fatalf("db open: %v", err)
+	}
+	sqlDB, err := database.DB()
+	if err != nil {
+		t.Fatalf("db handle: %v", err)
+	}
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	ctx := context.Background()
+	master := services.NewMasterKeyService(database, logger)
+	if err := master.LoadOrCreate(ctx); err != nil {
+		t.Fatalf("master init: %v", err)
+	}
+	audit := services.NewAuditService(database, logger)
+	router := NewRouter(Dependencies{
+		MasterKeyService: master,
+		KeyService:       services.NewKeyService(database, logger),
+		LogService:       services.NewLogService(database, logger),
+		SettingsService:  services.NewSettingsService(database),
+		AuditService:     audit,
+		AdminService:     services.NewAdminService(database, logger),
+	})
+
+	do := func(method, path, body, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do(http.MethodPost, "/api/keys", `{"key":"tvly-secret-0001-abcd","total_quota":100}`, master.Get()); w.Code != http.StatusOK {
+		t.Fatalf("create key: %d %s", w.Code, w.Body.String())
+	}
+	w := do(http.MethodPost, "/api/admins", `{"name":"vera","role":"viewer"}`, master.Get())
+	if w.Code != http.StatusOK {
+		t.Fatalf("create admin: %d %s", w.Code, w.Body.String())
+	}
+	if w := do(http.MethodPost, "/api/admins", `{"name":"x","role":"root"}`, master.Get()); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected invalid role, got %d", w.Code)
+	}
+
+	w = do(http.MethodPost, "/api/admins/1/tokens", `{"name":"laptop"}`, master.Get())
+	if w.Code != http.StatusOK {
+		t.Fatalf("create token: %d %s", w.Code, w.Body.String())
+	}
+	var created struct {
+		Token string `json:"token"`
+		Item  struct {
+			ID uint `json:"id"`
+		} `json:"item"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	viewer := created.Token
+
+	for _, tc := range []struct {
+		method, path string
+		want         int
+	}{
+		{http.MethodGet, "/api/me", http.StatusOK},
+		{http.MethodGet, "/api/keys", http.StatusOK},
+		{http.MethodGet, "/api/logs", http.StatusOK},
+		{http.MethodGet, "/api/keys/1/raw", http.StatusForbidden},
+		{http.MethodGet, "/api/settings/master-key", http.StatusForbidden},
+		{http.MethodDelete, "/api/keys/1", http.StatusForbidden},
+		{http.MethodGet, "/api/admins", http.StatusForbidden},
+	} {
+		if w := do(tc.method, tc.path, "", viewer); w.Code != tc.want {
+			t.Errorf("%s %s as viewer: expected %d, got %d", tc.method, tc.path, tc.want, w.Code)
+		}
+	}
+
+	// The master key keeps full access as a break-glass owner.
+	if w := do(http.MethodGet, "/api/keys/1/raw", "", master.Get()); w.Code != http.StatusOK {
+		t.Fatalf("master key reveal: %d", w.Code)
+	}
+
+	events, err := audit.List(ctx, 1, 50, services.AuditFilter{Actor: "admin:vera"})
+	if err != nil {
+		t.Fatalf("audit list: %v", err)
+	}
+	if events.Total != 3 {
+		t.Fatalf("denied reveal, master key view and delete should be audited, got %d events", events.Total)
+	}
+	events, err = audit.List(ctx, 1, 50, services.AuditFilter{Action: "admin.token_create"})
+	if err != nil || events.Total != 1 {
+		t.Fatalf("token creation should be audited: %v %v", events, err)
+	}
+	if strings.Contains(string(events.Items[0].After), viewer) {
+		t.Fatalf("plain token leaked into audit log")
+	}
+
+	if w := do(http.MethodDelete, "/api/admins/1/tokens/1", "", master.Get()); w.Code != http.StatusOK {
+		t.Fatalf("revoke: %d %s", w.Code, w.Body.String())
+	}
+	if w := do(http.MethodGet, "/api/me", "", viewer); w.Code != http.StatusUnauthorized {
+		t.Fatalf("revoked token: expected 401, got %d", w.Code)
+	}
+}
+
+func TestAdminTokens_ViewerCannotSeeRawKeysInJobs(t *testing.T) {
+	t.Parallel()
+
+	gin.SetMode(gin.TestMode)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	database, err := db.Open(filepath.Join(t.TempDir(), "app.db"))
+	if err != nil {
+		t.Fatalf("db open: %v", err)
+	}
+	sqlDB, err := database.DB()
+	if err != nil {
+		t.Fatalf("db handle: %v", err)
+	}
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	ctx := context.Background()
+	master := services.NewMasterKeyService(database, logger)
+	if err := master.LoadOrCreate(ctx); err != nil {
+		t.Fatalf("master init: %v", err)
+	}
+	keys := services.NewKeyService(database, logger)
+	store := services.NewJobStore(database)
+	deps := Dependencies{
+		MasterKeyService:  master,
+		KeyService:        keys,
+		LogService:        services.NewLogService(database, logger),
+		SettingsService:   services.NewSettingsService(database),
+		AuditService:      services.NewAuditService(database, logger),
+		AdminService:      services.NewAdminService(database, logger),
+		JobStore:          store,
+		KeyBatchCreateJob: services.NewKeyBatchCreateJobService(keys, logger).WithJobStore(store),
+	}
+	router := NewRouter(deps)
+	// Without the live job service, job detail is served from the store.
+	stored := deps
+	stored.KeyBatchCreateJob = nil
+	storeRouter := NewRouter(stored)
+
+	do := func(r http.Handler, method, path, body, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	const existing = "tvly-viewer-secret-0001"
+	if _, err := keys.Create(ctx, existing, "Default", 100); err != nil {
+		t.Fatalf("seed key: %v", err)
+	}
+	if w := do(router, http.MethodPost, "/api/admins", `{"name":"vera","role":"viewer"}`, master.Get()); w.Code != http.StatusOK {
+		t.Fatalf("create admin: %d %s", w.Code, w.Body.String())
+	}
+	w := do(router, http.MethodPost, "/api/admins/1/tokens", `{"name":"laptop"}`, master.Get())
+	if w.Code != http.StatusOK {
+		t.Fatalf("create token: %d %s", w.Code, w.Body.String())
+	}
+	var created struct {
+		Token string `json:"token"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	viewer := created.Token
+
+	w = do(router, http.MethodPost, "/api/keys/batch", `{"keys":["`+existing+`","tvly-viewer-secret-0002"],"total_quota":100}`, master.Get())
+	if w.Code != http.StatusOK {
+		t.Fatalf("start batch: %d %s", w.Code, w.Body.String())
+	}
+	var started struct {
+		Job services.KeyBatchCreateJobStatus `json:"job"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &started); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		rec, err := store.Get(ctx, started.Job.ID)
+		if err != nil {
+			t.Fatalf("get job: %v", err)
+		}
+		if rec != nil && rec.Status == "completed" {
+			if rec.Failed != 1 {
+				t.Fatalf("expected the duplicate to fail: %+v", rec)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for completion")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	for _, tc := range []struct {
+		router http.Handler
+		path   string
+	}{
+		{router, "/api/keys/batch"},
+		{router, "/api/jobs/" + started.Job.ID},
+		{storeRouter, "/api/jobs/" + started.Job.ID},
+	} {
+		w := do(tc.router, http.MethodGet, tc.path, "", viewer)
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %s as viewer: %d %s", tc.path, w.Code, w.Body.String())
+		}
+		if strings.Contains(w.Body.String(), existing) || strings.Contains(w.Body.String(), "tvly-viewer-secret-0002") {
+			t.Fatalf("GET %s exposes a raw key to a viewer: %s", tc.path, w.Body.String())
+		}
+	}
+}
+
+func TestRoutePermissions_CoverAPIRoutes(t *testing.T) {
+	t.Parallel()
+
+	gin.SetMode(gin.TestMode)
+	engine, ok := NewRouter(Dependencies{}).(*gin.Engine)
+	if !ok {
+		t.Fatalf("router is not a gin engine")
+	}
+	for _, route := range engine.Routes() {
+		if !strings.HasPrefix(route.Path, "/api/") {
+			continue
+		}
+		if _, ok := routePermissions[route.Method+" "+route.Path]; !ok {
+			t.Errorf("route %s %s has no permission", route.Method, route.Path)
+		}
+	}
+}
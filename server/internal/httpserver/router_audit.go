@@ -0,0 +1,209 @@
+package httpserver
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"tavily-proxy/server/internal/models"
+	"tavily-proxy/server/internal/services"
+	"tavily-proxy/server/internal/util"
+)
+
+const (
+	auditActorKey      = "audit_actor"
+	auditCredentialKey = "audit_credential"
+	auditBeforeKey     = "audit_before"
+	auditAfterKey      = "audit_after"
+	auditTargetKey     = "audit_target"
+)
+
+// maxAuditBodyBytes caps how much of a JSON request body is kept as the
+// "after" snapshot when a handler does not report one itself.
+const maxAuditBodyBytes = 64 * 1024
+
+// auditActions names every audited /api route. All mutating routes are
+// audited; reads are only audited when listed here because they reveal
+// secrets or bulk data.
+var auditActions = map[string]string{
+	"POST /api/keys":                          "key.create",
+	"PUT /api/keys/:id":                       "key.update",
+	"DELETE /api/keys/:id":                    "key.delete",
+	"DELETE /api/keys/invalid":                "key.delete_invalid",
+	"GET /api/keys/:id/raw":                   "key.reveal",
+	"GET /api/keys/export":                    "key.export",
+	"POST /api/keys/import":                   "key.import",
+	"POST /api/keys/batch":                    "job.start_batch_create",
+	"POST /api/keys/batch/cancel":             "job.cancel",
+	"POST /api/keys/batch/pause":              "job.pause",
+	"POST /api/keys/batch/resume":             "job.resume",
+	"POST /api/keys/sync":                     "job.start_sync",
+	"POST /api/keys/sync/cancel":              "job.cancel",
+	"POST /api/keys/sync/pause":               "job.pause",
+	"POST /api/keys/sync/resume":              "job.resume",
+	"POST /api/jobs/:id/cancel":               "job.cancel",
+	"POST /api/jobs/:id/pause":                "job.pause",
+	"POST /api/jobs/:id/resume":               "job.resume",
+	"DELETE /api/logs":                        "logs.clear",
+	"POST /api/distributed-keys":              "distributed_key.create",
+	"PUT /api/distributed-keys/:id":           "distributed_key.update",
+	"POST /api/distributed-keys/:id/rotate":   "distributed_key.rotate",
+	"DELETE /api/distributed-keys/:id":        "distributed_key.delete",
+	"GET /api/settings/master-key":            "master_key.view",
+	"POST /api/settings/master-key/reset":     "master_key.reset",
+	"PUT /api/settings":                       "setting.update",
+	"PUT /api/settings/:name":                 "setting.update",
+	"PUT /api/settings/auto-sync":             "setting.update",
+	"PUT /api/settings/log-cleanup":           "setting.update",
+	"PUT /api/settings/backup":                "setting.update",
+	"GET /api/admin/backup":                   "backup.download",
+	"POST /api/admin/restore":                 "backup.restore",
+	"POST /api/policies":                      "policy.create",
+	"PUT /api/policies/:id":                   "policy.update",
+	"DELETE /api/policies/:id":                "policy.delete",
+	"POST /api/filters":                       "filter.create",
+	"PUT /api/filters/:id":                    "filter.update",
+	"DELETE /api/filters/:id":                 "filter.delete",
+	"POST /api/admins":                        "admin.create",
+	"PUT /api/admins/:id":                     "admin.update",
+	"DELETE /api/admins/:id":                  "admin.delete",
+	"POST /api/admins/:id/tokens":             "admin.token_create",
+	"DELETE /api/admins/:id/tokens/:token_id": "admin.token_revoke",
+}
+
+func isMutatingMethod(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// auditMiddleware records an audit event after each audited request,
+// including rejected ones. It runs after authentication, which sets the actor.
+func auditMiddleware(audit *services.AuditService) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route := c.Request.Method + " " + c.FullPath()
+		action, listed := auditActions[route]
+		if audit == nil || (!listed && !isMutatingMethod(c.Request.Method)) {
+			c.Next()
+			return
+		}
+		if action == "" {
+			action = strings.ToLower(route)
+		}
+
+		var body []byte
+		if isMutatingMethod(c.Request.Method) &&
+			strings.HasPrefix(c.ContentType(), "application/json") &&
+			c.Request.ContentLength > 0 && c.Request.ContentLength <= maxAuditBodyBytes {
+			body, _ = io.ReadAll(c.Request.Body)
+			c.Request.Body = io.NopCloser(bytes.NewReader(body))
+		}
+
+		c.Next()
+
+		entry := services.AuditEntry{
+			Actor:      c.GetString(auditActorKey),
+			Credential: c.GetString(auditCredentialKey),
+			Action:     action,
+			TargetType: strings.SplitN(action, ".", 2)[0],
+			TargetID:   c.GetString(auditTargetKey),
+			Method:     c.Request.Method,
+			Path:       c.Request.URL.Path,
+			StatusCode: c.Writer.Status(),
+			ClientIP:   c.ClientIP(),
+		}
+		if entry.TargetID == "" {
+			entry.TargetID = c.Param("id") + c.Param("name")
+		}
+		entry.Before, _ = c.Get(auditBeforeKey)
+		if after, ok := c.Get(auditAfterKey); ok {
+			entry.After = after
+		} else if len(body) > 0 {
+			entry.After = body
+		}
+
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(c.Request.Context()), 5*time.Second)
+		defer cancel()
+		if err := audit.Record(ctx, entry); err != nil {
+			// The action already happened; failing the response would only
+			// hide that from the caller.
+			_ = c.Error(fmt.Errorf("audit: %w", err))
+		}
+	}
+}
+
+// auditBefore and auditAfter attach snapshots of the target to the current
+// request's audit event. Secrets in them are masked when recorded.
+func auditBefore(c *gin.Context, v any) { c.Set(auditBeforeKey, v) }
+
+func auditAfter(c *gin.Context, v any) { c.Set(auditAfterKey, v) }
+
+// auditTarget sets the target id for routes without an :id parameter, e.g.
+// a created resource.
+func auditTarget(c *gin.Context, id any) { c.Set(auditTargetKey, fmt.Sprint(id)) }
+
+func keyAuditView(k *models.APIKey) gin.H {
+	return gin.H{
+		"key":         util.MaskAPIKey(k.Key),
+		"alias":       k.Alias,
+		"total_quota": k.TotalQuota,
+		"used_quota":  k.UsedQuota,
+		"is_active":   k.IsActive,
+		"is_invalid":  k.IsInvalid,
+	}
+}
+
+// auditSettings snapshots the current values of the settings about to be
+// written.
+func auditSettings(c *gin.Context, settings *services.SettingsService, values map[string]string) {
+	before := gin.H{}
+	for name := range values {
+		if v, ok, err := settings.Get(c.Request.Context(), name); err == nil && ok {
+			before[name] = v
+		} else {
+			before[name] = nil
+		}
+	}
+	auditBefore(c, before)
+	auditAfter(c, values)
+}
+
+func handleListAuditEvents(c *gin.Context, audit *services.AuditService) {
+	page, _ := strconv.Atoi(c.Query("page"))
+	size, _ := strconv.Atoi(c.Query("page_size"))
+
+	filter := services.AuditFilter{
+		Actor:      strings.TrimSpace(c.Query("actor")),
+		Action:     strings.TrimSpace(c.Query("action")),
+		TargetType: strings.TrimSpace(c.Query("target_type")),
+		TargetID:   strings.TrimSpace(c.Query("target_id")),
+	}
+	for name, dst := range map[string]**time.Time{"since": &filter.Since, "until": &filter.Until} {
+		raw := strings.TrimSpace(c.Query(name))
+		if raw == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_" + name})
+			return
+		}
+		*dst = &t
+	}
+
+	out, err := audit.List(c.Request.Context(), page, size, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error"})
+		return
+	}
+	c.JSON(http.StatusOK, out)
+}
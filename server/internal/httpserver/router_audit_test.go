@@ -0,0 +1,144 @@
+package httpserver
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"tavily-proxy/server/internal/db"
+	"tavily-proxy/server/internal/services"
+)
+
+func TestAuditMiddleware_RecordsMaskedDiffs(t *testing.T) {
+	t.Parallel()
+
+	gin.SetMode(gin.TestMode)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	database, err := db.Open(filepath.Join(t.TempDir(), "app.db"))
+	if err != nil {
+		t.Fatalf("db open: %v", err)
+	}
+	sqlDB, err := database.DB()
+	if err != nil {
+		t.Fatalf("db handle: %v", err)
+	}
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	ctx := context.Background()
+	master := services.NewMasterKeyService(database, logger)
+	if err := master.LoadOrCreate(ctx); err != nil {
+		t.Fatalf("master init: %v", err)
+	}
+	audit := services.NewAuditService(database, logger)
+	router := NewRouter(Dependencies{
+		MasterKeyService: master,
+		KeyService:       services.NewKeyService(database, logger),
+		SettingsService:  services.NewSettingsService(database),
+		AuditService:     audit,
+	})
+
+	do := func(method, path, body, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := do(http.MethodPost, "/api/keys", `{"key":"tvly-secret-0001-abcd","alias":"one","total_quota":100}`, master.Get())
+	if w.Code != http.StatusOK {
+		t.Fatalf("create key: %d %s", w.Code, w.Body.String())
+	}
+	if w := do(http.MethodPut, "/api/keys/1", `{"alias":"renamed"}`, master.Get()); w.Code != http.StatusOK {
+		t.Fatalf("update key: %d %s", w.Code, w.Body.String())
+	}
+	if w := do(http.MethodPut, "/api/settings/log_retention_days", `{"value":9999}`, master.Get()); w.Code != http.StatusBadRequest {
+		t.Fatalf("expected invalid setting, got %d", w.Code)
+	}
+	// Unauthenticated requests never reach the handler and are not audited.
+	if w := do(http.MethodDelete, "/api/keys/1", "", "wrong"); w.Code != http.StatusUnauthorized {
+		t.Fatalf("expected 401, got %d", w.Code)
+	}
+	// Reads are only audited when they reveal secrets.
+	do(http.MethodGet, "/api/keys", "", master.Get())
+	do(http.MethodGet, "/api/keys/1/raw", "", master.Get())
+
+	w = do(http.MethodGet, "/api/audit?page_size=10", "", master.Get())
+	var out struct {
+		Items []struct {
+			Actor      string         `json:"actor"`
+			Credential string         `json:"credential"`
+			Action     string         `json:"action"`
+			TargetType string         `json:"target_type"`
+			TargetID   string         `json:"target_id"`
+			StatusCode int            `json:"status_code"`
+			Before     map[string]any `json:"before"`
+			After      map[string]any `json:"after"`
+		} `json:"items"`
+		Total int64 `json:"total"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if out.Total != 4 {
+		t.Fatalf("expected 4 audit events, got %d: %s", out.Total, w.Body.String())
+	}
+
+	reveal, setting, update, create := out.Items[0], out.Items[1], out.Items[2], out.Items[3]
+	if create.Action != "key.create" || create.TargetType != "key" || create.TargetID != "1" || create.Actor != "master_key" {
+		t.Fatalf("unexpected create event: %+v", create)
+	}
+	if create.Credential == "" || strings.Contains(create.Credential, master.Get()) {
+		t.Fatalf("credential must be masked: %q", create.Credential)
+	}
+	if create.After["key"] != "tvly-****abcd" {
+		t.Fatalf("key must be masked in snapshots: %v", create.After)
+	}
+	if len(update.Before) != 1 || update.Before["alias"] != "one" || update.After["alias"] != "renamed" {
+		t.Fatalf("update should only keep changed fields: before=%v after=%v", update.Before, update.After)
+	}
+	if setting.Action != "setting.update" || setting.TargetID != "log_retention_days" || setting.StatusCode != http.StatusBadRequest {
+		t.Fatalf("failed attempts are audited too: %+v", setting)
+	}
+	if reveal.Action != "key.reveal" || reveal.After != nil {
+		t.Fatalf("unexpected reveal event: %+v", reveal)
+	}
+
+	w = do(http.MethodGet, "/api/audit?action=key.*&target_id=1", "", master.Get())
+	if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if out.Total != 3 {
+		t.Fatalf("expected 3 key events, got %d", out.Total)
+	}
+}
+
+func TestAuditActions_CoverMutatingRoutes(t *testing.T) {
+	t.Parallel()
+
+	gin.SetMode(gin.TestMode)
+	engine, ok := NewRouter(Dependencies{}).(*gin.Engine)
+	if !ok {
+		t.Fatalf("router is not a gin engine")
+	}
+	for _, route := range engine.Routes() {
+		if !strings.HasPrefix(route.Path, "/api/") || !isMutatingMethod(route.Method) {
+			continue
+		}
+		if _, ok := auditActions[route.Method+" "+route.Path]; !ok {
+			t.Errorf("mutating route %s %s has no audit action", route.Method, route.Path)
+		}
+	}
+}
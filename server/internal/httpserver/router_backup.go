@@ -0,0 +1,230 @@
+package httpserver
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"tavily-proxy/server/internal/services"
+)
+
+const maxRestoreBodyBytes = 1 << 30
+
+func parseBoolQuery(c *gin.Context, name string, def bool) (bool, bool) {
+	raw := strings.TrimSpace(c.Query(name))
+	if raw == "" {
+		return def, true
+	}
+	v, err := strconv.ParseBool(raw)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_" + name})
+		return false, false
+	}
+	return v, true
+}
+
+func handleDownloadBackup(c *gin.Context, backups *services.BackupService) {
+	if backups == nil || !backups.Supported() {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "backup_unsupported"})
+		return
+	}
+	includeLogs, ok := parseBoolQuery(c, "include_logs", false)
+	if !ok {
+		return
+	}
+
+	dir, err := os.MkdirTemp("", "tavily-proxy-backup-")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "backup_failed"})
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	name := "tavily-proxy-" + time.Now().UTC().Format("20060102-150405") + ".db"
+	info, err := backups.Snapshot(c.Request.Context(), filepath.Join(dir, name), services.BackupOptions{IncludeLogs: includeLogs})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "backup_failed"})
+		return
+	}
+
+	c.Header("X-Backup-Include-Logs", strconv.FormatBool(includeLogs))
+	c.FileAttachment(info.Path, info.Name)
+}
+
+// handleRestoreBackup accepts the SQLite file either as the raw request body
+// or as the "file" field of a multipart form.
+func handleRestoreBackup(c *gin.Context, backups *services.BackupService) {
+	if backups == nil || !backups.Supported() {
+		c.JSON(http.StatusNotImplemented, gin.H{"error": "backup_unsupported"})
+		return
+	}
+	includeLogs, ok := parseBoolQuery(c, "include_logs", false)
+	if !ok {
+		return
+	}
+	restoreMasterKey, ok := parseBoolQuery(c, "restore_master_key", false)
+	if !ok {
+		return
+	}
+
+	// Limit the body before any parsing, multipart included.
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxRestoreBodyBytes)
+	body := io.Reader(c.Request.Body)
+	if strings.HasPrefix(c.ContentType(), "multipart/") {
+		file, _, err := c.Request.FormFile("file")
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "file_too_large"})
+				return
+			}
+			c.JSON(http.StatusBadRequest, gin.H{"error": "missing_file"})
+			return
+		}
+		defer file.Close()
+		body = file
+	}
+
+	tmp, err := os.CreateTemp("", "tavily-proxy-restore-*.db")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "restore_failed"})
+		return
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, body); err != nil {
+		_ = tmp.Close()
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "file_too_large"})
+		return
+	}
+	if err := tmp.Close(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "restore_failed"})
+		return
+	}
+
+	result, err := backups.Restore(c.Request.Context(), tmp.Name(), services.RestoreOptions{
+		IncludeLogs:      includeLogs,
+		RestoreMasterKey: restoreMasterKey,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrRestoreInvalidFile):
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_backup_file"})
+		case errors.Is(err, services.ErrRestoreCipherMissing),
+			errors.Is(err, services.ErrRestoreCipherMismatch):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "restore_failed"})
+		}
+		return
+	}
+	auditAfter(c, result)
+	c.JSON(http.StatusOK, result)
+}
+
+func handleListBackups(c *gin.Context, dir string) {
+	items, err := services.ListBackups(dir)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "list_failed"})
+		return
+	}
+	if items == nil {
+		items = []services.BackupInfo{}
+	}
+	c.JSON(http.StatusOK, gin.H{"dir": dir, "items": items})
+}
+
+func handleGetBackupSettings(c *gin.Context, settings *services.SettingsService, dir string) {
+	ctx := c.Request.Context()
+	enabled, err := settings.GetBool(ctx, services.SettingBackupEnabled, false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error"})
+		return
+	}
+	intervalHours, err := settings.GetInt(ctx, services.SettingBackupIntervalHours, 24)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error"})
+		return
+	}
+	retention, err := settings.GetInt(ctx, services.SettingBackupRetentionCount, 7)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error"})
+		return
+	}
+	includeLogs, err := settings.GetBool(ctx, services.SettingBackupIncludeLogs, false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error"})
+		return
+	}
+
+	lastRun, _ := settings.GetTime(ctx, services.SettingBackupLastRunAt)
+	lastSuccess, _ := settings.GetTime(ctx, services.SettingBackupLastSuccessAt)
+	lastErr, _, _ := settings.Get(ctx, services.SettingBackupLastError)
+
+	c.JSON(http.StatusOK, gin.H{
+		"enabled":         enabled,
+		"interval_hours":  intervalHours,
+		"retention_count": retention,
+		"include_logs":    includeLogs,
+		"dir":             dir,
+		"last_run_at":     formatTimePtr(lastRun),
+		"last_success_at": formatTimePtr(lastSuccess),
+		"last_error":      lastErr,
+		"pinned": pinnedSettings(settings,
+			services.SettingBackupEnabled,
+			services.SettingBackupIntervalHours,
+			services.SettingBackupRetentionCount,
+			services.SettingBackupIncludeLogs,
+		),
+	})
+}
+
+func handleSetBackupSettings(c *gin.Context, settings *services.SettingsService) {
+	var body struct {
+		Enabled        *bool `json:"enabled"`
+		IntervalHours  *int  `json:"interval_hours"`
+		RetentionCount *int  `json:"retention_count"`
+		IncludeLogs    *bool `json:"include_logs"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_json"})
+		return
+	}
+	if body.Enabled == nil && body.IntervalHours == nil && body.RetentionCount == nil && body.IncludeLogs == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "missing_fields"})
+		return
+	}
+
+	values := map[string]string{}
+	if body.IntervalHours != nil {
+		if *body.IntervalHours < 1 || *body.IntervalHours > 720 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_interval_hours"})
+			return
+		}
+		values[services.SettingBackupIntervalHours] = strconv.Itoa(*body.IntervalHours)
+	}
+	if body.RetentionCount != nil {
+		if *body.RetentionCount < 1 || *body.RetentionCount > 365 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_retention_count"})
+			return
+		}
+		values[services.SettingBackupRetentionCount] = strconv.Itoa(*body.RetentionCount)
+	}
+	if body.IncludeLogs != nil {
+		values[services.SettingBackupIncludeLogs] = strconv.FormatBool(*body.IncludeLogs)
+	}
+	if body.Enabled != nil {
+		values[services.SettingBackupEnabled] = strconv.FormatBool(*body.Enabled)
+	}
+	if !applySettings(c, settings, values) {
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -27,19 +27,26 @@ func handleStartBatchCreateKeys(c *gin.Context, jobs *services.KeyBatchCreateJob
 		Keys       []string `json:"keys"`
 		Alias      string   `json:"alias"`
 		TotalQuota int      `json:"total_quota"`
+		Validate   bool     `json:"validate"`
 	}
 	if err := c.ShouldBindJSON(&body); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_json"})
 		return
 	}
 
-	job, alreadyRunning, err := jobs.Start(body.Keys, body.Alias, body.TotalQuota)
+	job, alreadyRunning, err := jobs.StartWithOptions(body.Keys, services.KeyBatchCreateOptions{
+		Alias:      body.Alias,
+		TotalQuota: body.TotalQuota,
+		Validate:   body.Validate,
+	})
 	if err != nil {
 		switch {
 		case errors.Is(err, services.ErrBatchCreateNoKeys):
 			c.JSON(http.StatusBadRequest, gin.H{"error": "missing_keys"})
 		case errors.Is(err, services.ErrBatchCreateTooLarge):
 			c.JSON(http.StatusBadRequest, gin.H{"error": "too_many_keys"})
+		case errors.Is(err, services.ErrBatchValidationUnavailable):
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "validation_unavailable"})
 		default:
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "batch_create_failed"})
 		}
@@ -106,19 +106,22 @@ func handleCreateDistributedKey(c *gin.Context, distributedKeys *services.Distri
 		return
 	}
 
+	item := gin.H{
+		"id":                    created.ID,
+		"name":                  created.Name,
+		"note":                  created.Note,
+		"key_prefix":            created.KeyPrefix,
+		"is_active":             created.IsActive,
+		"expires_at":            formatTimePtr(created.ExpiresAt),
+		"rate_limit_per_minute": created.RateLimitPerMinute,
+		"last_used_at":          formatTimePtr(created.LastUsedAt),
+		"created_at":            created.CreatedAt.Format(time.RFC3339),
+	}
+	auditTarget(c, created.ID)
+	auditAfter(c, item)
 	c.JSON(http.StatusOK, gin.H{
 		"plain_key": plain,
-		"item": gin.H{
-			"id":                    created.ID,
-			"name":                  created.Name,
-			"note":                  created.Note,
-			"key_prefix":            created.KeyPrefix,
-			"is_active":             created.IsActive,
-			"expires_at":            formatTimePtr(created.ExpiresAt),
-			"rate_limit_per_minute": created.RateLimitPerMinute,
-			"last_used_at":          formatTimePtr(created.LastUsedAt),
-			"created_at":            created.CreatedAt.Format(time.RFC3339),
-		},
+		"item":      item,
 	})
 }
 
@@ -167,6 +170,9 @@ func handleUpdateDistributedKey(c *gin.Context, distributedKeys *services.Distri
 		expiresAt = parsed
 	}
 
+	if existing, err := distributedKeys.FindByID(c.Request.Context(), uint(id)); err == nil && existing != nil {
+		auditBefore(c, existing)
+	}
 	updated, err := distributedKeys.Update(c.Request.Context(), uint(id), services.DistributedKeyUpdateInput{
 		Name:               body.Name,
 		Note:               body.Note,
@@ -187,6 +193,7 @@ func handleUpdateDistributedKey(c *gin.Context, distributedKeys *services.Distri
 		return
 	}
 
+	auditAfter(c, updated)
 	c.JSON(http.StatusOK, gin.H{
 		"item": gin.H{
 			"id":                    updated.ID,
@@ -214,6 +221,9 @@ func handleRotateDistributedKey(c *gin.Context, distributedKeys *services.Distri
 		return
 	}
 
+	if existing, err := distributedKeys.FindByID(c.Request.Context(), uint(id)); err == nil && existing != nil {
+		auditBefore(c, gin.H{"key_prefix": existing.KeyPrefix})
+	}
 	updated, plain, err := distributedKeys.Rotate(c.Request.Context(), uint(id))
 	if err != nil {
 		if errors.Is(err, services.ErrDistributedKeyNotFound) {
@@ -223,6 +233,7 @@ func handleRotateDistributedKey(c *gin.Context, distributedKeys *services.Distri
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "rotate_failed"})
 		return
 	}
+	auditAfter(c, gin.H{"key_prefix": updated.KeyPrefix})
 
 	c.JSON(http.StatusOK, gin.H{
 		"plain_key": plain,
@@ -252,6 +263,9 @@ func handleDeleteDistributedKey(c *gin.Context, distributedKeys *services.Distri
 		return
 	}
 
+	if existing, err := distributedKeys.FindByID(c.Request.Context(), uint(id)); err == nil && existing != nil {
+		auditBefore(c, existing)
+	}
 	if err := distributedKeys.Delete(c.Request.Context(), uint(id)); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "delete_failed"})
 		return
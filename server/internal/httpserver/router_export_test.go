@@ -91,3 +91,87 @@ func TestHandleExportKeys_ExcludesInvalidKeys(t *testing.T) {
 		t.Fatalf("unexpected second key: got %q want %q", lines[1], active.Key)
 	}
 }
+
+func TestHandleExportImportKeys_EncryptedJSONRoundTrip(t *testing.T) {
+	t.Parallel()
+
+	gin.SetMode(gin.TestMode)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	openKeys := func() *services.KeyService {
+		database, err := db.Open(filepath.Join(t.TempDir(), "app.db"))
+		if err != nil {
+			t.Fatalf("db open: %v", err)
+		}
+		sqlDB, err := database.DB()
+		if err != nil {
+			t.Fatalf("db handle: %v", err)
+		}
+		t.Cleanup(func() { _ = sqlDB.Close() })
+		return services.NewKeyService(database, logger)
+	}
+
+	ctx := context.Background()
+	source := openKeys()
+	if _, err := source.Create(ctx, "tvly-source-active", "eu", 700); err != nil {
+		t.Fatalf("create active: %v", err)
+	}
+	invalid, err := source.Create(ctx, "tvly-source-invalid", "us", 1000)
+	if err != nil {
+		t.Fatalf("create invalid: %v", err)
+	}
+	if err := source.MarkInvalid(ctx, invalid.ID); err != nil {
+		t.Fatalf("mark invalid: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/api/keys/export?format=json", nil)
+	c.Request.Header.Set("X-Export-Passphrase", "s3cret")
+	handleExportKeys(c, source)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected export status: %d body=%s", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get("X-Exported-Count"); got != "2" {
+		t.Fatalf("unexpected X-Exported-Count: %q", got)
+	}
+	exported := w.Body.String()
+	if strings.Contains(exported, "tvly-source-active") {
+		t.Fatalf("encrypted export leaks raw keys")
+	}
+
+	target := openKeys()
+	importReq := func(query, passphrase string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Request = httptest.NewRequest(http.MethodPost, "/api/keys/import"+query, strings.NewReader(exported))
+		if passphrase != "" {
+			c.Request.Header.Set("X-Import-Passphrase", passphrase)
+		}
+		handleImportKeys(c, target)
+		return w
+	}
+
+	if w := importReq("", "wrong"); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "decrypt_failed") {
+		t.Fatalf("unexpected wrong-passphrase response: %d %s", w.Code, w.Body.String())
+	}
+	if w := importReq("?dry_run=true", "s3cret"); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), `"created":2`) {
+		t.Fatalf("unexpected dry run response: %d %s", w.Code, w.Body.String())
+	}
+	if items, _ := target.List(ctx); len(items) != 0 {
+		t.Fatalf("dry run wrote %d keys", len(items))
+	}
+	if w := importReq("?conflict=skip", "s3cret"); w.Code != http.StatusOK {
+		t.Fatalf("unexpected import response: %d %s", w.Code, w.Body.String())
+	}
+
+	got, err := target.FindByKey(ctx, "tvly-source-invalid")
+	if err != nil || got == nil || !got.IsInvalid || got.IsActive || got.Alias != "us" {
+		t.Fatalf("invalid key not carried over: %+v err=%v", got, err)
+	}
+	got, err = target.FindByKey(ctx, "tvly-source-active")
+	if err != nil || got == nil || got.TotalQuota != 700 || !got.IsActive {
+		t.Fatalf("active key not carried over: %+v err=%v", got, err)
+	}
+}
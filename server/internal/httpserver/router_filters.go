@@ -0,0 +1,128 @@
+package httpserver
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"tavily-proxy/server/internal/services"
+)
+
+type filterBody struct {
+	Name        string `json:"name"`
+	Enabled     *bool  `json:"enabled"`
+	Kind        string `json:"kind"`
+	Pattern     string `json:"pattern"`
+	Replacement string `json:"replacement"`
+}
+
+func (b filterBody) input() services.FilterInput {
+	enabled := true
+	if b.Enabled != nil {
+		enabled = *b.Enabled
+	}
+	return services.FilterInput{
+		Name:        b.Name,
+		Enabled:     enabled,
+		Kind:        b.Kind,
+		Pattern:     b.Pattern,
+		Replacement: b.Replacement,
+	}
+}
+
+func handleListFilters(c *gin.Context, filters *services.FilterService) {
+	if filters == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "service_not_configured"})
+		return
+	}
+	items, err := filters.List(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"items": items})
+}
+
+func handleCreateFilter(c *gin.Context, filters *services.FilterService) {
+	if filters == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "service_not_configured"})
+		return
+	}
+	var body filterBody
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_json"})
+		return
+	}
+	created, err := filters.Create(c.Request.Context(), body.input())
+	if err != nil {
+		writeFilterError(c, err)
+		return
+	}
+	auditTarget(c, created.ID)
+	auditAfter(c, created)
+	c.JSON(http.StatusOK, created)
+}
+
+func handleUpdateFilter(c *gin.Context, filters *services.FilterService, idStr string) {
+	if filters == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "service_not_configured"})
+		return
+	}
+	id, ok := parseAdminID(c, idStr)
+	if !ok {
+		return
+	}
+	var body filterBody
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_json"})
+		return
+	}
+	before, err := filters.Get(c.Request.Context(), id)
+	if err != nil {
+		writeFilterError(c, err)
+		return
+	}
+	auditBefore(c, before)
+	updated, err := filters.Update(c.Request.Context(), id, body.input())
+	if err != nil {
+		writeFilterError(c, err)
+		return
+	}
+	auditAfter(c, updated)
+	c.JSON(http.StatusOK, updated)
+}
+
+func handleDeleteFilter(c *gin.Context, filters *services.FilterService, idStr string) {
+	if filters == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "service_not_configured"})
+		return
+	}
+	id, ok := parseAdminID(c, idStr)
+	if !ok {
+		return
+	}
+	if before, err := filters.Get(c.Request.Context(), id); err == nil {
+		auditBefore(c, before)
+	}
+	if err := filters.Delete(c.Request.Context(), id); err != nil {
+		writeFilterError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+func writeFilterError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrFilterNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrFilterNameTaken):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrFilterInvalidName), errors.Is(err, services.ErrFilterInvalidKind):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrFilterInvalidPattern):
+		c.JSON(http.StatusBadRequest, gin.H{"error": services.ErrFilterInvalidPattern.Error(), "message": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error"})
+	}
+}
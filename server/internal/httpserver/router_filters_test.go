@@ -0,0 +1,113 @@
+package httpserver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"tavily-proxy/server/internal/db"
+	"tavily-proxy/server/internal/services"
+)
+
+func TestFilters_ManagedViaAPIAndAppliedToProxy(t *testing.T) {
+	t.Parallel()
+
+	gin.SetMode(gin.TestMode)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	database, err := db.Open(filepath.Join(t.TempDir(), "app.db"))
+	if err != nil {
+		t.Fatalf("db open: %v", err)
+	}
+	sqlDB, err := database.DB()
+	if err != nil {
+		t.Fatalf("db handle: %v", err)
+	}
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"results":[{"url":"https://blocked.example/a"},{"url":"https://ok.example/b"}]}`))
+	}))
+	t.Cleanup(upstream.Close)
+
+	ctx := context.Background()
+	master := services.NewMasterKeyService(database, logger)
+	if err := master.LoadOrCreate(ctx); err != nil {
+		t.Fatalf("master init: %v", err)
+	}
+	keys := services.NewKeyService(database, logger)
+	if _, err := keys.Create(ctx, "tvly-test", "test", 1000); err != nil {
+		t.Fatalf("create key: %v", err)
+	}
+	filters := services.NewFilterService(database, logger)
+	audit := services.NewAuditService(database, logger)
+	router := NewRouter(Dependencies{
+		MasterKeyService: master,
+		KeyService:       keys,
+		SettingsService:  services.NewSettingsService(database),
+		AuditService:     audit,
+		FilterService:    filters,
+		TavilyProxy:      services.NewTavilyProxy(upstream.URL, 5*time.Second, keys, nil, nil, logger).WithFilters(filters),
+	})
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+master.Get())
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do(http.MethodPost, "/api/filters", `{"name":"x","kind":"url_regex","pattern":"("}`); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "invalid_filter_pattern") {
+		t.Fatalf("expected invalid pattern: %d %s", w.Code, w.Body.String())
+	}
+	w := do(http.MethodPost, "/api/filters", `{"name":"legal","kind":"domain_suffix","pattern":"blocked.example"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("create filter: %d %s", w.Code, w.Body.String())
+	}
+	var created struct {
+		ID      uint `json:"id"`
+		Enabled bool `json:"enabled"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil || !created.Enabled {
+		t.Fatalf("unexpected filter: %s %v", w.Body.String(), err)
+	}
+
+	w = do(http.MethodPost, "/search", `{"query":"q"}`)
+	if w.Code != http.StatusOK || strings.Contains(w.Body.String(), "blocked.example") || !strings.Contains(w.Body.String(), `"filtered_results":1`) {
+		t.Fatalf("blocked result reached the client: %d %s", w.Code, w.Body.String())
+	}
+	if got := w.Header().Get(services.FilteredResultsHeader); got != "1" {
+		t.Fatalf("expected filtered header, got %q", got)
+	}
+
+	path := fmt.Sprintf("/api/filters/%d", created.ID)
+	if w := do(http.MethodPut, path, `{"name":"legal","enabled":false,"kind":"domain_suffix","pattern":"blocked.example"}`); w.Code != http.StatusOK {
+		t.Fatalf("update filter: %d %s", w.Code, w.Body.String())
+	}
+	if w := do(http.MethodPost, "/search", `{"query":"q"}`); !strings.Contains(w.Body.String(), "blocked.example") {
+		t.Fatalf("disabled filter should not apply: %s", w.Body.String())
+	}
+
+	if w := do(http.MethodDelete, path, ""); w.Code != http.StatusOK {
+		t.Fatalf("delete filter: %d %s", w.Code, w.Body.String())
+	}
+	if w := do(http.MethodGet, "/api/filters", ""); !strings.Contains(w.Body.String(), `"items":[]`) {
+		t.Fatalf("filter should be gone: %s", w.Body.String())
+	}
+	events, err := audit.List(ctx, 1, 10, services.AuditFilter{})
+	if err != nil || events.Total != 4 {
+		t.Fatalf("expected the filter writes to be audited, got %d %v", events.Total, err)
+	}
+}
@@ -0,0 +1,131 @@
+package httpserver
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"tavily-proxy/server/internal/services"
+)
+
+// captureWriter keeps a copy of the response body written through it, up to
+// limit bytes; overflow is set once the body outgrows it.
+type captureWriter struct {
+	gin.ResponseWriter
+	body     bytes.Buffer
+	limit    int
+	overflow bool
+}
+
+func (w *captureWriter) capture(n int) bool {
+	if w.overflow {
+		return false
+	}
+	if w.body.Len()+n > w.limit {
+		w.overflow = true
+		w.body = bytes.Buffer{}
+		return false
+	}
+	return true
+}
+
+func (w *captureWriter) Write(b []byte) (int, error) {
+	if w.capture(len(b)) {
+		w.body.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *captureWriter) WriteString(s string) (int, error) {
+	if w.capture(len(s)) {
+		w.body.WriteString(s)
+	}
+	return w.ResponseWriter.WriteString(s)
+}
+
+func idempotencyScope(distributedKeyID uint) string {
+	if distributedKeyID == 0 {
+		return "master"
+	}
+	return "dk:" + strconv.FormatUint(uint64(distributedKeyID), 10)
+}
+
+// handleIdempotentProxy runs proxy at most once per Idempotency-Key and
+// caller. Retries of a stored request replay its response; only upstream
+// responses below 500 that fit the size cap are stored, so anything else can
+// be retried.
+func handleIdempotentProxy(c *gin.Context, idem *services.IdempotencyService, distributedKeyID uint, body []byte, rawQuery string, proxy func() int) int {
+	key := c.GetHeader("Idempotency-Key")
+	if idem == nil || key == "" || c.Request.Method != http.MethodPost {
+		return proxy()
+	}
+
+	scope := idempotencyScope(distributedKeyID)
+	ctx := c.Request.Context()
+	stored, err := idem.Begin(ctx, services.IdempotencyRequest{
+		Scope:    scope,
+		Key:      key,
+		Method:   c.Request.Method,
+		Path:     c.Request.URL.Path,
+		RawQuery: rawQuery,
+		Body:     body,
+	}, time.Now())
+	switch {
+	case errors.Is(err, services.ErrIdempotencyKeyInvalid):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return http.StatusBadRequest
+	case errors.Is(err, services.ErrIdempotencyKeyReused):
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": err.Error()})
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, services.ErrIdempotencyInProgress):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return http.StatusConflict
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error"})
+		return http.StatusInternalServerError
+	}
+
+	if stored != nil {
+		for k, vv := range stored.Headers {
+			for _, v := range vv {
+				c.Writer.Header().Add(k, v)
+			}
+		}
+		c.Header("Idempotent-Replayed", "true")
+		c.Status(stored.StatusCode)
+		_, _ = c.Writer.Write(stored.Body)
+		return stored.StatusCode
+	}
+
+	// The client may give up and retry while this runs; finish anyway so the
+	// retry can be answered from the stored response.
+	detached := context.WithoutCancel(ctx)
+	c.Request = c.Request.WithContext(detached)
+	writer := &captureWriter{ResponseWriter: c.Writer, limit: idem.MaxBody()}
+	c.Writer = writer
+	status := proxy()
+	c.Writer = writer.ResponseWriter
+
+	fromUpstream := c.Writer.Header().Get("X-Proxy-Request-ID") != ""
+	if !fromUpstream || status >= http.StatusInternalServerError || writer.overflow {
+		_ = idem.Release(detached, scope, key)
+		return status
+	}
+	headers := http.Header{}
+	for k, vv := range c.Writer.Header() {
+		if isHopByHopHeader(k) || strings.EqualFold(k, "Content-Length") {
+			continue
+		}
+		headers[k] = append([]string(nil), vv...)
+	}
+	if err := idem.Complete(detached, scope, key, services.StoredResponse{StatusCode: status, Headers: headers, Body: writer.body.Bytes()}, time.Now()); err != nil {
+		_ = idem.Release(detached, scope, key)
+	}
+	return status
+}
@@ -0,0 +1,121 @@
+package httpserver
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"tavily-proxy/server/internal/db"
+	"tavily-proxy/server/internal/services"
+)
+
+func TestProxy_IdempotencyKeyReplaysFirstResponse(t *testing.T) {
+	t.Parallel()
+
+	gin.SetMode(gin.TestMode)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	database, err := db.Open(filepath.Join(t.TempDir(), "app.db"))
+	if err != nil {
+		t.Fatalf("db open: %v", err)
+	}
+	sqlDB, err := database.DB()
+	if err != nil {
+		t.Fatalf("db handle: %v", err)
+	}
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	var calls atomic.Int32
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := calls.Add(1)
+		if strings.Contains(r.URL.Path, "flaky") && n == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"results":["page"],"call":` + string(rune('0'+n)) + `}`))
+	}))
+	t.Cleanup(upstream.Close)
+
+	ctx := context.Background()
+	master := services.NewMasterKeyService(database, logger)
+	if err := master.LoadOrCreate(ctx); err != nil {
+		t.Fatalf("master init: %v", err)
+	}
+	keys := services.NewKeyService(database, logger)
+	if _, err := keys.Create(ctx, "tvly-test", "test", 1000); err != nil {
+		t.Fatalf("create key: %v", err)
+	}
+	newRouter := func(idem *services.IdempotencyService) http.Handler {
+		return NewRouter(Dependencies{
+			MasterKeyService:   master,
+			KeyService:         keys,
+			SettingsService:    services.NewSettingsService(database),
+			IdempotencyService: idem,
+			TavilyProxy:        services.NewTavilyProxy(upstream.URL, 5*time.Second, keys, nil, nil, logger).WithRetry(services.RetryPolicy{MaxAttempts: 1}),
+		})
+	}
+	send := func(router http.Handler, path, key, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+master.Get())
+		req.Header.Set("Content-Type", "application/json")
+		if key != "" {
+			req.Header.Set("Idempotency-Key", key)
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	router := newRouter(services.NewIdempotencyService(database, logger))
+	do := func(path, key, body string) *httptest.ResponseRecorder {
+		return send(router, path, key, body)
+	}
+
+	first := do("/crawl", "k1", `{"url":"https://example.com"}`)
+	if first.Code != http.StatusOK || first.Header().Get("Idempotent-Replayed") != "" || first.Header().Get(services.AttemptsHeader) != "1" {
+		t.Fatalf("first request: %d %s", first.Code, first.Body.String())
+	}
+	retry := do("/crawl", "k1", `{"url":"https://example.com"}`)
+	if retry.Code != http.StatusOK || retry.Body.String() != first.Body.String() || retry.Header().Get("Idempotent-Replayed") != "true" {
+		t.Fatalf("retry should replay the first response: %d %s", retry.Code, retry.Body.String())
+	}
+	if retry.Header().Get("X-Proxy-Request-ID") != first.Header().Get("X-Proxy-Request-ID") || retry.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("replayed headers differ: %v", retry.Header())
+	}
+	if got := calls.Load(); got != 1 {
+		t.Fatalf("expected one upstream call, got %d", got)
+	}
+
+	if w := do("/crawl", "k1", `{"url":"https://example.org"}`); w.Code != http.StatusUnprocessableEntity || !strings.Contains(w.Body.String(), "idempotency_key_reused") {
+		t.Fatalf("expected 422 for a different body: %d %s", w.Code, w.Body.String())
+	}
+	if w := do("/crawl", "", `{"url":"https://example.com"}`); w.Code != http.StatusOK || calls.Load() != 2 {
+		t.Fatalf("requests without a key are not deduplicated: %d calls=%d", w.Code, calls.Load())
+	}
+
+	calls.Store(0)
+	if w := do("/flaky", "k2", `{}`); w.Code != http.StatusServiceUnavailable {
+		t.Fatalf("expected the upstream failure to pass through: %d", w.Code)
+	}
+	if w := do("/flaky", "k2", `{}`); w.Code != http.StatusOK || w.Header().Get("Idempotent-Replayed") != "" {
+		t.Fatalf("failed attempts must not be replayed: %d %v", w.Code, w.Header())
+	}
+
+	// Responses over the size cap are passed through but not kept.
+	calls.Store(0)
+	small := newRouter(services.NewIdempotencyService(database, logger).WithMaxBody(8))
+	for i := 1; i <= 2; i++ {
+		if w := send(small, "/crawl", "k3", `{}`); w.Code != http.StatusOK || w.Header().Get("Idempotent-Replayed") != "" || calls.Load() != int32(i) {
+			t.Fatalf("oversized response must not be replayed: %d %v calls=%d", w.Code, w.Header(), calls.Load())
+		}
+	}
+}
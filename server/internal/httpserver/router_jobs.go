@@ -0,0 +1,235 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"tavily-proxy/server/internal/models"
+	"tavily-proxy/server/internal/services"
+)
+
+type jobDTO struct {
+	ID        string          `json:"id"`
+	Type      string          `json:"type"`
+	Status    string          `json:"status"`
+	Error     string          `json:"error,omitempty"`
+	Total     int             `json:"total"`
+	Completed int             `json:"completed"`
+	Succeeded int             `json:"succeeded"`
+	Failed    int             `json:"failed"`
+	StartedAt *string         `json:"started_at"`
+	EndedAt   *string         `json:"ended_at"`
+	State     json.RawMessage `json:"state,omitempty"`
+}
+
+func jobDTOFromModel(job models.Job, withState bool) jobDTO {
+	out := jobDTO{
+		ID:        job.ID,
+		Type:      job.Type,
+		Status:    job.Status,
+		Error:     job.Error,
+		Total:     job.Total,
+		Completed: job.Completed,
+		Succeeded: job.Succeeded,
+		Failed:    job.Failed,
+		StartedAt: formatTimePtr(job.StartedAt),
+		EndedAt:   formatTimePtr(job.EndedAt),
+	}
+	if withState && strings.TrimSpace(job.State) != "" {
+		out.State = json.RawMessage(job.State)
+	}
+	return out
+}
+
+// liveJob returns the in-memory status when id is the current job of either
+// service, so callers see progress that has not been persisted yet.
+func liveJob(deps Dependencies, id string) (jobDTO, bool) {
+	if deps.QuotaSyncJob != nil {
+		if job := deps.QuotaSyncJob.Get(); job.ID == id {
+			state, _ := json.Marshal(job)
+			return jobDTO{
+				ID:        job.ID,
+				Type:      services.JobTypeQuotaSync,
+				Status:    job.Status,
+				Error:     job.Error,
+				Total:     job.Total,
+				Completed: job.Completed,
+				Succeeded: job.Succeeded,
+				Failed:    job.Failed,
+				StartedAt: formatTimePtr(job.StartedAt),
+				EndedAt:   formatTimePtr(job.EndedAt),
+				State:     state,
+			}, true
+		}
+	}
+	if deps.KeyBatchCreateJob != nil {
+		if job := deps.KeyBatchCreateJob.Get(); job.ID == id {
+			state, _ := json.Marshal(job)
+			return jobDTO{
+				ID:        job.ID,
+				Type:      services.JobTypeKeyBatchCreate,
+				Status:    job.Status,
+				Error:     job.Error,
+				Total:     job.Total,
+				Completed: job.Completed,
+				Succeeded: job.Succeeded,
+				Failed:    job.Failed,
+				StartedAt: formatTimePtr(job.StartedAt),
+				EndedAt:   formatTimePtr(job.EndedAt),
+				State:     state,
+			}, true
+		}
+	}
+	return jobDTO{}, false
+}
+
+func handleListJobs(c *gin.Context, deps Dependencies) {
+	jobType := strings.TrimSpace(c.Query("type"))
+	switch jobType {
+	case "", services.JobTypeQuotaSync, services.JobTypeKeyBatchCreate:
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_type"})
+		return
+	}
+	limit, _ := strconv.Atoi(c.Query("limit"))
+
+	items := make([]jobDTO, 0)
+	if deps.JobStore != nil {
+		jobs, err := deps.JobStore.List(c.Request.Context(), jobType, limit)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error"})
+			return
+		}
+		for _, job := range jobs {
+			if live, ok := liveJob(deps, job.ID); ok {
+				live.State = nil
+				items = append(items, live)
+				continue
+			}
+			items = append(items, jobDTOFromModel(job, false))
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"items": items})
+}
+
+func handleGetJob(c *gin.Context, deps Dependencies, id string) {
+	if live, ok := liveJob(deps, id); ok {
+		c.JSON(http.StatusOK, gin.H{"item": live})
+		return
+	}
+	if deps.JobStore == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
+		return
+	}
+
+	job, err := deps.JobStore.Get(c.Request.Context(), id)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error"})
+		return
+	}
+	if job == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"item": jobDTOFromModel(*job, true)})
+}
+
+const (
+	jobActionCancel = "cancel"
+	jobActionPause  = "pause"
+	jobActionResume = "resume"
+)
+
+func applyQuotaSyncJobAction(jobs *services.QuotaSyncJobService, id, action string) (services.QuotaSyncJobStatus, error) {
+	switch action {
+	case jobActionPause:
+		return jobs.Pause(id)
+	case jobActionResume:
+		return jobs.Resume(id)
+	default:
+		return jobs.Cancel(id)
+	}
+}
+
+func applyKeyBatchCreateJobAction(jobs *services.KeyBatchCreateJobService, id, action string) (services.KeyBatchCreateJobStatus, error) {
+	switch action {
+	case jobActionPause:
+		return jobs.Pause(id)
+	case jobActionResume:
+		return jobs.Resume(id)
+	default:
+		return jobs.Cancel(id)
+	}
+}
+
+func writeJobActionError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrJobNotRunning):
+		c.JSON(http.StatusConflict, gin.H{"error": "job_not_running"})
+	case errors.Is(err, services.ErrJobNotPaused):
+		c.JSON(http.StatusConflict, gin.H{"error": "job_not_paused"})
+	case errors.Is(err, services.ErrJobNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "not_found"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "job_action_failed"})
+	}
+}
+
+// handleSyncJobAction applies action to the current quota sync job.
+func handleSyncJobAction(c *gin.Context, jobs *services.QuotaSyncJobService, action string) {
+	if jobs == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "quota_sync_unavailable"})
+		return
+	}
+	job, err := applyQuotaSyncJobAction(jobs, jobs.Get().ID, action)
+	if err != nil {
+		writeJobActionError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+// handleBatchCreateJobAction applies action to the current batch import job.
+func handleBatchCreateJobAction(c *gin.Context, jobs *services.KeyBatchCreateJobService, action string) {
+	if jobs == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "batch_create_unavailable"})
+		return
+	}
+	job, err := applyKeyBatchCreateJobAction(jobs, jobs.Get().ID, action)
+	if err != nil {
+		writeJobActionError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+func handleJobAction(c *gin.Context, deps Dependencies, id string, action string) {
+	var err error = services.ErrJobNotFound
+	if deps.QuotaSyncJob != nil {
+		_, err = applyQuotaSyncJobAction(deps.QuotaSyncJob, id, action)
+	}
+	if errors.Is(err, services.ErrJobNotFound) && deps.KeyBatchCreateJob != nil {
+		_, err = applyKeyBatchCreateJobAction(deps.KeyBatchCreateJob, id, action)
+	}
+
+	if err == nil {
+		live, _ := liveJob(deps, id)
+		c.JSON(http.StatusOK, gin.H{"item": live})
+		return
+	}
+	// A job that only exists in history has already finished.
+	if errors.Is(err, services.ErrJobNotFound) && deps.JobStore != nil {
+		if job, dbErr := deps.JobStore.Get(c.Request.Context(), id); dbErr == nil && job != nil {
+			err = services.ErrJobNotRunning
+			if action == jobActionResume {
+				err = services.ErrJobNotPaused
+			}
+		}
+	}
+	writeJobActionError(c, err)
+}
@@ -0,0 +1,53 @@
+package httpserver
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"tavily-proxy/server/internal/db"
+	"tavily-proxy/server/internal/services"
+)
+
+func TestJobActions_UnavailableWithoutService(t *testing.T) {
+	t.Parallel()
+
+	gin.SetMode(gin.TestMode)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	database, err := db.Open(filepath.Join(t.TempDir(), "app.db"))
+	if err != nil {
+		t.Fatalf("db open: %v", err)
+	}
+	sqlDB, err := database.DB()
+	if err != nil {
+		t.Fatalf("db handle: %v", err)
+	}
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	master := services.NewMasterKeyService(database, logger)
+	if err := master.LoadOrCreate(context.Background()); err != nil {
+		t.Fatalf("master init: %v", err)
+	}
+	router := NewRouter(Dependencies{
+		MasterKeyService: master,
+		SettingsService:  services.NewSettingsService(database),
+		AuditService:     services.NewAuditService(database, logger),
+	})
+
+	for _, path := range []string{"/api/keys/sync/cancel", "/api/keys/sync/pause", "/api/keys/sync/resume", "/api/keys/batch/cancel"} {
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		req.Header.Set("Authorization", "Bearer "+master.Get())
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		if w.Code != http.StatusServiceUnavailable {
+			t.Errorf("POST %s: expected 503, got %d %s", path, w.Code, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package httpserver
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"tavily-proxy/server/internal/services"
+)
+
+const maxKeyImportBodyBytes = 32 << 20
+
+// handleExportKeys writes every key in the requested format. The plain txt
+// format skips invalid keys unless asked; json and csv carry them (with their
+// state) unless include_invalid=false.
+func handleExportKeys(c *gin.Context, keys *services.KeyService) {
+	format, err := services.NormalizeKeyTransferFormat(c.Query("format"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "unsupported_format"})
+		return
+	}
+
+	includeInvalid := format != services.KeyTransferFormatTXT
+	if raw := strings.TrimSpace(c.Query("include_invalid")); raw != "" {
+		includeInvalid, err = strconv.ParseBool(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_include_invalid"})
+			return
+		}
+	}
+
+	records, err := keys.ExportRecords(c.Request.Context(), includeInvalid)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error"})
+		return
+	}
+
+	body, err := services.EncodeKeyTransfer(records, format)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "export_failed"})
+		return
+	}
+
+	contentType := map[string]string{
+		services.KeyTransferFormatTXT:  "text/plain; charset=utf-8",
+		services.KeyTransferFormatJSON: "application/json",
+		services.KeyTransferFormatCSV:  "text/csv; charset=utf-8",
+	}[format]
+	filename := "tavily-keys." + format
+
+	if passphrase := c.GetHeader("X-Export-Passphrase"); passphrase != "" {
+		body, err = services.SealKeyTransfer(body, format, passphrase)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "encrypt_failed"})
+			return
+		}
+		contentType = "application/json"
+		filename += ".enc"
+	}
+
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Header("X-Exported-Count", strconv.Itoa(len(records)))
+	c.Status(http.StatusOK)
+	_, _ = c.Writer.Write(body)
+}
+
+// handleImportKeys reads an export file from the request body. The format is
+// detected when not given; encrypted files need X-Import-Passphrase.
+func handleImportKeys(c *gin.Context, keys *services.KeyService) {
+	format := strings.TrimSpace(c.Query("format"))
+	if format != "" {
+		if _, err := services.NormalizeKeyTransferFormat(format); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "unsupported_format"})
+			return
+		}
+	}
+
+	dryRun := false
+	if raw := strings.TrimSpace(c.Query("dry_run")); raw != "" {
+		v, err := strconv.ParseBool(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_dry_run"})
+			return
+		}
+		dryRun = v
+	}
+
+	data, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, maxKeyImportBodyBytes))
+	if err != nil {
+		c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "file_too_large"})
+		return
+	}
+	if strings.TrimSpace(string(data)) == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "empty_file"})
+		return
+	}
+
+	records, err := services.DecodeKeyTransfer(data, format, c.GetHeader("X-Import-Passphrase"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	result, err := keys.Import(c.Request.Context(), records, services.KeyImportOptions{
+		DryRun:   dryRun,
+		Conflict: c.Query("conflict"),
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, services.ErrKeyTransferConflictPolicy),
+			errors.Is(err, services.ErrKeyTransferTooLarge):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "import_failed"})
+		}
+		return
+	}
+	auditAfter(c, result)
+	c.JSON(http.StatusOK, result)
+}
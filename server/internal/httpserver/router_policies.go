@@ -0,0 +1,163 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"tavily-proxy/server/internal/models"
+	"tavily-proxy/server/internal/services"
+)
+
+type policyBody struct {
+	Name     string          `json:"name"`
+	Priority int             `json:"priority"`
+	Enabled  *bool           `json:"enabled"`
+	Endpoint string          `json:"endpoint"`
+	Caller   string          `json:"caller"`
+	Action   string          `json:"action"`
+	Field    string          `json:"field"`
+	Value    json.RawMessage `json:"value"`
+	Min      *float64        `json:"min"`
+	Max      *float64        `json:"max"`
+	Message  string          `json:"message"`
+}
+
+func (b policyBody) input() services.PolicyInput {
+	enabled := true
+	if b.Enabled != nil {
+		enabled = *b.Enabled
+	}
+	return services.PolicyInput{
+		Name:     b.Name,
+		Priority: b.Priority,
+		Enabled:  enabled,
+		Endpoint: b.Endpoint,
+		Caller:   b.Caller,
+		Action:   b.Action,
+		Field:    b.Field,
+		Value:    b.Value,
+		Min:      b.Min,
+		Max:      b.Max,
+		Message:  b.Message,
+	}
+}
+
+// policyView returns value as JSON rather than the string it is stored as.
+type policyView struct {
+	models.RequestPolicy
+	Value json.RawMessage `json:"value"`
+}
+
+func newPolicyView(p models.RequestPolicy) policyView {
+	v := policyView{RequestPolicy: p}
+	if p.Value != "" {
+		v.Value = json.RawMessage(p.Value)
+	}
+	return v
+}
+
+func handleListPolicies(c *gin.Context, policies *services.PolicyService) {
+	if policies == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "service_not_configured"})
+		return
+	}
+	items, err := policies.List(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error"})
+		return
+	}
+	out := make([]policyView, 0, len(items))
+	for _, p := range items {
+		out = append(out, newPolicyView(p))
+	}
+	c.JSON(http.StatusOK, gin.H{"items": out})
+}
+
+func handleCreatePolicy(c *gin.Context, policies *services.PolicyService) {
+	if policies == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "service_not_configured"})
+		return
+	}
+	var body policyBody
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_json"})
+		return
+	}
+	created, err := policies.Create(c.Request.Context(), body.input())
+	if err != nil {
+		writePolicyError(c, err)
+		return
+	}
+	view := newPolicyView(*created)
+	auditTarget(c, created.ID)
+	auditAfter(c, view)
+	c.JSON(http.StatusOK, view)
+}
+
+func handleUpdatePolicy(c *gin.Context, policies *services.PolicyService, idStr string) {
+	if policies == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "service_not_configured"})
+		return
+	}
+	id, ok := parseAdminID(c, idStr)
+	if !ok {
+		return
+	}
+	var body policyBody
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_json"})
+		return
+	}
+	before, err := policies.Get(c.Request.Context(), id)
+	if err != nil {
+		writePolicyError(c, err)
+		return
+	}
+	auditBefore(c, newPolicyView(*before))
+	updated, err := policies.Update(c.Request.Context(), id, body.input())
+	if err != nil {
+		writePolicyError(c, err)
+		return
+	}
+	view := newPolicyView(*updated)
+	auditAfter(c, view)
+	c.JSON(http.StatusOK, view)
+}
+
+func handleDeletePolicy(c *gin.Context, policies *services.PolicyService, idStr string) {
+	if policies == nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "service_not_configured"})
+		return
+	}
+	id, ok := parseAdminID(c, idStr)
+	if !ok {
+		return
+	}
+	if before, err := policies.Get(c.Request.Context(), id); err == nil {
+		auditBefore(c, newPolicyView(*before))
+	}
+	if err := policies.Delete(c.Request.Context(), id); err != nil {
+		writePolicyError(c, err)
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+func writePolicyError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, services.ErrPolicyNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrPolicyNameTaken):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrPolicyInvalidName), errors.Is(err, services.ErrPolicyInvalidAction),
+		errors.Is(err, services.ErrPolicyInvalidCaller):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, services.ErrPolicyInvalidRule):
+		c.JSON(http.StatusBadRequest, gin.H{"error": services.ErrPolicyInvalidRule.Error(), "message": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error"})
+	}
+}
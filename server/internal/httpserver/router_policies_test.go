@@ -0,0 +1,122 @@
+package httpserver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"tavily-proxy/server/internal/db"
+	"tavily-proxy/server/internal/services"
+)
+
+func TestPolicies_ManagedViaAPIAndAppliedToProxy(t *testing.T) {
+	t.Parallel()
+
+	gin.SetMode(gin.TestMode)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	database, err := db.Open(filepath.Join(t.TempDir(), "app.db"))
+	if err != nil {
+		t.Fatalf("db open: %v", err)
+	}
+	sqlDB, err := database.DB()
+	if err != nil {
+		t.Fatalf("db handle: %v", err)
+	}
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	upstreamBodies := make(chan string, 4)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw, _ := io.ReadAll(r.Body)
+		upstreamBodies <- string(raw)
+		_, _ = w.Write([]byte(`{"results":[]}`))
+	}))
+	t.Cleanup(upstream.Close)
+
+	ctx := context.Background()
+	master := services.NewMasterKeyService(database, logger)
+	if err := master.LoadOrCreate(ctx); err != nil {
+		t.Fatalf("master init: %v", err)
+	}
+	keys := services.NewKeyService(database, logger)
+	if _, err := keys.Create(ctx, "tvly-test", "test", 1000); err != nil {
+		t.Fatalf("create key: %v", err)
+	}
+	policies := services.NewPolicyService(database, logger)
+	audit := services.NewAuditService(database, logger)
+	router := NewRouter(Dependencies{
+		MasterKeyService: master,
+		KeyService:       keys,
+		SettingsService:  services.NewSettingsService(database),
+		AuditService:     audit,
+		PolicyService:    policies,
+		TavilyProxy:      services.NewTavilyProxy(upstream.URL, 5*time.Second, keys, nil, nil, logger).WithPolicies(policies),
+	})
+
+	do := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+master.Get())
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := do(http.MethodPost, "/api/policies", `{"name":"x","action":"clamp","field":"max_results"}`); w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), "invalid_policy_rule") {
+		t.Fatalf("expected invalid rule: %d %s", w.Code, w.Body.String())
+	}
+	w := do(http.MethodPost, "/api/policies", `{"name":"depth","endpoint":"/search","action":"override","field":"search_depth","value":"basic"}`)
+	if w.Code != http.StatusOK {
+		t.Fatalf("create policy: %d %s", w.Code, w.Body.String())
+	}
+	var created struct {
+		ID      uint   `json:"id"`
+		Value   string `json:"value"`
+		Enabled bool   `json:"enabled"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &created); err != nil || created.Value != "basic" || !created.Enabled {
+		t.Fatalf("unexpected policy: %s %v", w.Body.String(), err)
+	}
+
+	if w := do(http.MethodPost, "/search", `{"query":"q","search_depth":"advanced"}`); w.Code != http.StatusOK {
+		t.Fatalf("proxy: %d %s", w.Code, w.Body.String())
+	}
+	if got := <-upstreamBodies; !strings.Contains(got, `"search_depth":"basic"`) {
+		t.Fatalf("policy not applied upstream: %s", got)
+	}
+
+	path := fmt.Sprintf("/api/policies/%d", created.ID)
+	if w := do(http.MethodPut, path, `{"name":"depth","endpoint":"/search","action":"reject","field":"search_depth","value":"advanced","message":"advanced search is disabled"}`); w.Code != http.StatusOK {
+		t.Fatalf("update policy: %d %s", w.Code, w.Body.String())
+	}
+	w = do(http.MethodPost, "/search", `{"query":"q","search_depth":"advanced"}`)
+	if w.Code != http.StatusForbidden || !strings.Contains(w.Body.String(), `"error":"policy_rejected"`) || !strings.Contains(w.Body.String(), "advanced search is disabled") {
+		t.Fatalf("expected the request to be rejected: %d %s", w.Code, w.Body.String())
+	}
+	select {
+	case got := <-upstreamBodies:
+		t.Fatalf("rejected request reached upstream: %s", got)
+	default:
+	}
+
+	if w := do(http.MethodDelete, path, ""); w.Code != http.StatusOK {
+		t.Fatalf("delete policy: %d %s", w.Code, w.Body.String())
+	}
+	if w := do(http.MethodGet, "/api/policies", ""); !strings.Contains(w.Body.String(), `"items":[]`) {
+		t.Fatalf("policy should be gone: %s", w.Body.String())
+	}
+	events, err := audit.List(ctx, 1, 10, services.AuditFilter{})
+	if err != nil || events.Total != 4 {
+		t.Fatalf("expected the policy writes to be audited, got %d %v", events.Total, err)
+	}
+}
@@ -0,0 +1,146 @@
+package httpserver
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+
+	"tavily-proxy/server/internal/services"
+)
+
+func handleListSettings(c *gin.Context, settings *services.SettingsService) {
+	items, err := settings.Values(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"items": items})
+}
+
+// handleUpdateSettings takes an object of setting name to value and applies
+// it atomically: one bad entry rejects the whole request.
+func handleUpdateSettings(c *gin.Context, settings *services.SettingsService) {
+	var body map[string]any
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_json"})
+		return
+	}
+	if len(body) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "missing_fields"})
+		return
+	}
+
+	values := make(map[string]string, len(body))
+	for name, raw := range body {
+		def, ok := services.LookupSettingDef(name)
+		if !ok {
+			writeSettingError(c, &services.SettingError{Name: name, Err: services.ErrUnknownSetting})
+			return
+		}
+		v, err := def.NormalizeValue(raw)
+		if err != nil {
+			writeSettingError(c, &services.SettingError{Name: name, Err: err})
+			return
+		}
+		values[name] = v
+	}
+	auditSettings(c, settings, values)
+	changes, err := settings.Apply(c.Request.Context(), values, services.SettingSourceAPI)
+	if err != nil {
+		writeSettingError(c, err)
+		return
+	}
+
+	items, err := settings.Values(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"items": items, "changed": len(changes)})
+}
+
+func handleGetSetting(c *gin.Context, settings *services.SettingsService, name string) {
+	value, err := settings.Value(c.Request.Context(), name)
+	if err != nil {
+		writeSettingError(c, err)
+		return
+	}
+	limit, _ := strconv.Atoi(c.Query("history_limit"))
+	history, err := settings.History(c.Request.Context(), name, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"setting": value, "history": history})
+}
+
+func handleUpdateSetting(c *gin.Context, settings *services.SettingsService, name string) {
+	def, ok := services.LookupSettingDef(name)
+	if !ok {
+		writeSettingError(c, &services.SettingError{Name: name, Err: services.ErrUnknownSetting})
+		return
+	}
+	var body struct {
+		Value any `json:"value"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid_json"})
+		return
+	}
+	if body.Value == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "missing_fields"})
+		return
+	}
+	v, err := def.NormalizeValue(body.Value)
+	if err != nil {
+		writeSettingError(c, &services.SettingError{Name: name, Err: err})
+		return
+	}
+	values := map[string]string{name: v}
+	auditSettings(c, settings, values)
+	if _, err := settings.Apply(c.Request.Context(), values, services.SettingSourceAPI); err != nil {
+		writeSettingError(c, err)
+		return
+	}
+
+	value, err := settings.Value(c.Request.Context(), name)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"setting": value})
+}
+
+// applySettings writes values validated by one of the dedicated settings
+// handlers through the registry, so they share its checks and history.
+func applySettings(c *gin.Context, settings *services.SettingsService, values map[string]string) bool {
+	auditSettings(c, settings, values)
+	if _, err := settings.Apply(c.Request.Context(), values, services.SettingSourceAPI); err != nil {
+		writeSettingError(c, err)
+		return false
+	}
+	return true
+}
+
+func writeSettingError(c *gin.Context, err error) {
+	var settingErr *services.SettingError
+	if !errors.As(err, &settingErr) {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error"})
+		return
+	}
+	switch {
+	case errors.Is(err, services.ErrUnknownSetting):
+		c.JSON(http.StatusNotFound, gin.H{"error": "unknown_setting", "setting": settingErr.Name})
+	case errors.Is(err, services.ErrSettingPinned):
+		c.JSON(http.StatusConflict, gin.H{"error": "setting_managed_by_config", "setting": settingErr.Name})
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   "invalid_setting",
+			"setting": settingErr.Name,
+			"message": fmt.Sprintf("%s %v", settingErr.Name, settingErr.Err),
+		})
+	}
+}
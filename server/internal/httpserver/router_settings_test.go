@@ -0,0 +1,194 @@
+package httpserver
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"tavily-proxy/server/internal/db"
+	"tavily-proxy/server/internal/services"
+)
+
+func TestHandleSetLogCleanup_RejectsPinnedSetting(t *testing.T) {
+	t.Parallel()
+
+	gin.SetMode(gin.TestMode)
+
+	database, err := db.Open(filepath.Join(t.TempDir(), "app.db"))
+	if err != nil {
+		t.Fatalf("db open: %v", err)
+	}
+	sqlDB, err := database.DB()
+	if err != nil {
+		t.Fatalf("db handle: %v", err)
+	}
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	settings := services.NewSettingsService(database).
+		WithPinned(map[string]string{services.SettingLogRetentionDays: "5"})
+	ctx := context.Background()
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPut, "/api/settings/log-cleanup",
+		strings.NewReader(`{"logging_enabled":false,"retention_days":60}`))
+	handleSetLogCleanup(c, settings)
+
+	if w.Code != http.StatusConflict {
+		t.Fatalf("unexpected status: got %d want %d", w.Code, http.StatusConflict)
+	}
+	// Nothing is written when any touched setting is pinned.
+	if enabled, err := settings.GetBool(ctx, services.SettingRequestLoggingEnabled, true); err != nil || !enabled {
+		t.Fatalf("logging_enabled should be untouched: %v %v", enabled, err)
+	}
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/api/settings/log-cleanup", nil)
+	handleGetLogCleanup(c, settings)
+
+	var out struct {
+		RetentionDays int      `json:"retention_days"`
+		Pinned        []string `json:"pinned"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if out.RetentionDays != 5 || len(out.Pinned) != 1 || out.Pinned[0] != services.SettingLogRetentionDays {
+		t.Fatalf("unexpected response: %+v", out)
+	}
+
+	settings.SetPinned(nil)
+	if err := settings.SetInt(ctx, services.SettingLogRetentionDays, 60); err != nil {
+		t.Fatalf("unpinned setting should be writable: %v", err)
+	}
+}
+
+func TestSettingsEndpoints_UpdateAndHistory(t *testing.T) {
+	t.Parallel()
+
+	gin.SetMode(gin.TestMode)
+
+	database, err := db.Open(filepath.Join(t.TempDir(), "app.db"))
+	if err != nil {
+		t.Fatalf("db open: %v", err)
+	}
+	sqlDB, err := database.DB()
+	if err != nil {
+		t.Fatalf("db handle: %v", err)
+	}
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	settings := services.NewSettingsService(database)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPut, "/api/settings",
+		strings.NewReader(`{"request_logging_enabled":false,"backup_retention_count":1000}`))
+	handleUpdateSettings(c, settings)
+	if w.Code != http.StatusBadRequest || !strings.Contains(w.Body.String(), `"setting":"backup_retention_count"`) {
+		t.Fatalf("expected invalid_setting, got %d %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPut, "/api/settings",
+		strings.NewReader(`{"request_logging_enabled":false,"backup_retention_count":3}`))
+	handleUpdateSettings(c, settings)
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPut, "/api/settings/request_logging_enabled", strings.NewReader(`{"value":"on"}`))
+	handleUpdateSetting(c, settings, "request_logging_enabled")
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("expected a non-boolean string to be rejected, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPut, "/api/settings/request_logging_enabled", strings.NewReader(`{"value":true}`))
+	handleUpdateSetting(c, settings, "request_logging_enabled")
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/api/settings/request_logging_enabled", nil)
+	handleGetSetting(c, settings, "request_logging_enabled")
+
+	var out struct {
+		Setting services.SettingValue `json:"setting"`
+		History []struct {
+			OldValue *string `json:"old_value"`
+			NewValue string  `json:"new_value"`
+		} `json:"history"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if out.Setting.Value != true || out.Setting.Type != services.SettingTypeBool {
+		t.Fatalf("unexpected setting: %+v", out.Setting)
+	}
+	if len(out.History) != 2 || out.History[0].NewValue != "true" || out.History[1].NewValue != "false" {
+		t.Fatalf("unexpected history: %+v", out.History)
+	}
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/api/settings/nope", nil)
+	handleGetSetting(c, settings, "nope")
+	if w.Code != http.StatusNotFound {
+		t.Fatalf("expected 404 for an unknown setting, got %d", w.Code)
+	}
+}
+
+func TestHandleGetAutoSync_ReportsConcurrencySetting(t *testing.T) {
+	t.Parallel()
+
+	gin.SetMode(gin.TestMode)
+
+	database, err := db.Open(filepath.Join(t.TempDir(), "app.db"))
+	if err != nil {
+		t.Fatalf("db open: %v", err)
+	}
+	sqlDB, err := database.DB()
+	if err != nil {
+		t.Fatalf("db handle: %v", err)
+	}
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	settings := services.NewSettingsService(database)
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodPut, "/api/settings/auto_sync_concurrency", strings.NewReader(`{"value":8}`))
+	handleUpdateSetting(c, settings, services.SettingAutoSyncConcurrency)
+	if w.Code != http.StatusOK {
+		t.Fatalf("unexpected status: %d %s", w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/api/settings/auto-sync", nil)
+	handleGetAutoSync(c, settings)
+
+	var out struct {
+		Concurrency int `json:"concurrency"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &out); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if out.Concurrency != 8 {
+		t.Fatalf("unexpected concurrency: got %d want 8", out.Concurrency)
+	}
+}
@@ -0,0 +1,175 @@
+package httpserver
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"tavily-proxy/server/internal/services"
+)
+
+const (
+	sessionCookieName    = "tp_session"
+	csrfCookieName       = "tp_csrf"
+	csrfHeaderName       = "X-CSRF-Token"
+	loginStateCookieName = "tp_oidc_state"
+)
+
+func handleAuthConfig(c *gin.Context, oidc *services.OIDCProvider) {
+	c.JSON(http.StatusOK, gin.H{"oidc_enabled": oidc != nil})
+}
+
+// handleOIDCLogin redirects the browser to the IdP. The state is also kept in
+// a short-lived cookie so the callback can only complete in the browser that
+// started the login.
+func handleOIDCLogin(c *gin.Context, oidc *services.OIDCProvider, sessions *services.SessionService) {
+	if oidc == nil || sessions == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "sso_not_configured"})
+		return
+	}
+	now := time.Now().UTC()
+	state, nonce, challenge, err := sessions.BeginLogin(c.Request.Context(), safeReturnTo(c.Query("return_to")), now)
+	if errors.Is(err, services.ErrTooManyLogins) {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error"})
+		return
+	}
+	target, err := oidc.AuthCodeURL(c.Request.Context(), state, nonce, challenge)
+	if err != nil {
+		_ = c.Error(err)
+		c.JSON(http.StatusBadGateway, gin.H{"error": "oidc_discovery_failed"})
+		return
+	}
+	setCookie(c, loginStateCookieName, state, int((10 * time.Minute).Seconds()), true)
+	c.Redirect(http.StatusFound, target)
+}
+
+func handleOIDCCallback(c *gin.Context, oidc *services.OIDCProvider, sessions *services.SessionService, audit *services.AuditService) {
+	if oidc == nil || sessions == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "sso_not_configured"})
+		return
+	}
+	fail := func(code string, err error) {
+		if err != nil {
+			_ = c.Error(fmt.Errorf("oidc callback: %w", err))
+		}
+		setCookie(c, loginStateCookieName, "", -1, true)
+		c.Redirect(http.StatusFound, "/?sso_error="+url.QueryEscape(code))
+	}
+	if c.Query("error") != "" {
+		fail("idp_error", errors.New(c.Query("error")+": "+c.Query("error_description")))
+		return
+	}
+
+	state := c.Query("state")
+	cookieState, _ := c.Cookie(loginStateCookieName)
+	if state == "" || subtle.ConstantTimeCompare([]byte(state), []byte(cookieState)) != 1 {
+		fail("state_mismatch", nil)
+		return
+	}
+	now := time.Now().UTC()
+	pending, err := sessions.CompleteLogin(c.Request.Context(), state, now)
+	if err != nil {
+		fail("state_mismatch", err)
+		return
+	}
+	identity, err := oidc.Exchange(c.Request.Context(), c.Query("code"), pending.Verifier, pending.Nonce, now)
+	if err != nil {
+		fail("login_failed", err)
+		return
+	}
+
+	role, ok := oidc.RoleFor(identity.Groups)
+	if !ok {
+		recordLogin(c, audit, identity, "", http.StatusForbidden)
+		fail("no_role", nil)
+		return
+	}
+	token, csrf, session, err := sessions.Create(c.Request.Context(), identity, role, now)
+	if err != nil {
+		fail("login_failed", err)
+		return
+	}
+	_, _ = sessions.DeleteExpired(c.Request.Context(), now)
+
+	c.Set(auditTargetKey, fmt.Sprint(session.ID))
+	recordLogin(c, audit, identity, role, http.StatusFound)
+	setCookie(c, loginStateCookieName, "", -1, true)
+	setCookie(c, sessionCookieName, token, int(sessions.TTL().Seconds()), true)
+	// The CSRF cookie is readable by the dashboard, which echoes it back in
+	// the X-CSRF-Token header.
+	setCookie(c, csrfCookieName, csrf, int(sessions.TTL().Seconds()), false)
+	c.Redirect(http.StatusFound, pending.ReturnTo)
+}
+
+func handleLogout(c *gin.Context, sessions *services.SessionService) {
+	if sessions == nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "sso_not_configured"})
+		return
+	}
+	token, _ := c.Cookie(sessionCookieName)
+	_, session, err := sessions.Authenticate(c.Request.Context(), token, time.Now().UTC())
+	if err == nil {
+		if !services.CheckCSRF(session, c.GetHeader(csrfHeaderName)) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "csrf_failed"})
+			return
+		}
+		if err := sessions.Delete(c.Request.Context(), token); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "db_error"})
+			return
+		}
+	}
+	setCookie(c, sessionCookieName, "", -1, true)
+	setCookie(c, csrfCookieName, "", -1, false)
+	c.JSON(http.StatusOK, gin.H{"ok": true})
+}
+
+// recordLogin writes SSO logins, including ones refused for lack of a mapped
+// role, to the audit log.
+func recordLogin(c *gin.Context, audit *services.AuditService, id services.OIDCIdentity, role services.Role, status int) {
+	if audit == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(c.Request.Context()), 5*time.Second)
+	defer cancel()
+	err := audit.Record(ctx, services.AuditEntry{
+		Actor:      "sso:" + id.DisplayName(),
+		Action:     "session.login",
+		TargetType: "session",
+		TargetID:   c.GetString(auditTargetKey),
+		Method:     c.Request.Method,
+		Path:       c.Request.URL.Path,
+		StatusCode: status,
+		ClientIP:   c.ClientIP(),
+		After:      gin.H{"subject": id.Subject, "groups": id.Groups, "role": role},
+	})
+	if err != nil {
+		_ = c.Error(fmt.Errorf("audit: %w", err))
+	}
+}
+
+// setCookie deletes the cookie when maxAge is negative.
+func setCookie(c *gin.Context, name, value string, maxAge int, httpOnly bool) {
+	secure := c.Request.TLS != nil || strings.EqualFold(c.GetHeader("X-Forwarded-Proto"), "https")
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(name, value, maxAge, "/", "", secure, httpOnly)
+}
+
+// safeReturnTo only allows local paths so the login cannot be turned into an
+// open redirect.
+func safeReturnTo(raw string) string {
+	if !strings.HasPrefix(raw, "/") || strings.HasPrefix(raw, "//") || strings.HasPrefix(raw, "/\\") {
+		return "/"
+	}
+	return raw
+}
@@ -0,0 +1,162 @@
+package httpserver
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"tavily-proxy/server/internal/db"
+	"tavily-proxy/server/internal/oidctest"
+	"tavily-proxy/server/internal/services"
+)
+
+func TestOIDCLogin_SessionCookiesAndCSRF(t *testing.T) {
+	t.Parallel()
+
+	gin.SetMode(gin.TestMode)
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	database, err := db.Open(filepath.Join(t.TempDir(), "app.db"))
+	if err != nil {
+		t.Fatalf("db open: %v", err)
+	}
+	sqlDB, err := database.DB()
+	if err != nil {
+		t.Fatalf("db handle: %v", err)
+	}
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	ctx := context.Background()
+	master := services.NewMasterKeyService(database, logger)
+	if err := master.LoadOrCreate(ctx); err != nil {
+		t.Fatalf("master init: %v", err)
+	}
+	idp := oidctest.New(t)
+	audit := services.NewAuditService(database, logger)
+	router := NewRouter(Dependencies{
+		MasterKeyService: master,
+		SettingsService:  services.NewSettingsService(database),
+		AuditService:     audit,
+		SessionService:   services.NewSessionService(database, logger),
+		OIDCProvider: services.NewOIDCProvider(services.OIDCConfig{
+			IssuerURL:    idp.URL,
+			ClientID:     oidctest.ClientID,
+			ClientSecret: oidctest.ClientSecret,
+			RedirectURL:  "http://proxy.test/auth/oidc/callback",
+			RoleMapping:  map[string]services.Role{"ops": services.RoleOperator},
+		}),
+	})
+
+	do := func(method, target string, cookies []*http.Cookie, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, target, nil)
+		for _, ck := range cookies {
+			req.AddCookie(ck)
+		}
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	cookie := func(w *httptest.ResponseRecorder, name string) *http.Cookie {
+		for _, ck := range w.Result().Cookies() {
+			if ck.Name == name {
+				return ck
+			}
+		}
+		return nil
+	}
+
+	// login starts a login, lets the mock IdP grant a code for the given
+	// groups and returns the callback response.
+	login := func(code, email string, groups []string) *httptest.ResponseRecorder {
+		w := do(http.MethodGet, "/auth/oidc/login?return_to=/logs", nil, nil)
+		if w.Code != http.StatusFound {
+			t.Fatalf("login: %d %s", w.Code, w.Body.String())
+		}
+		authorize, err := url.Parse(w.Header().Get("Location"))
+		if err != nil || !strings.HasPrefix(authorize.String(), idp.URL+"/authorize") {
+			t.Fatalf("unexpected authorize redirect: %q", w.Header().Get("Location"))
+		}
+		q := authorize.Query()
+		if q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" {
+			t.Fatalf("login must use PKCE: %v", q)
+		}
+		idp.Grant(code, "sub-"+code, email, q.Get("nonce"), q.Get("code_challenge"), groups)
+		return do(http.MethodGet, "/auth/oidc/callback?code="+code+"&state="+url.QueryEscape(q.Get("state")),
+			[]*http.Cookie{cookie(w, loginStateCookieName)}, nil)
+	}
+
+	if w := do(http.MethodGet, "/auth/config", nil, nil); !strings.Contains(w.Body.String(), `"oidc_enabled":true`) {
+		t.Fatalf("unexpected auth config: %s", w.Body.String())
+	}
+
+	w := login("c1", "ops@example.com", []string{"ops"})
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "/logs" {
+		t.Fatalf("callback: %d %q", w.Code, w.Header().Get("Location"))
+	}
+	session, csrf := cookie(w, sessionCookieName), cookie(w, csrfCookieName)
+	if session == nil || !session.HttpOnly || csrf == nil || csrf.HttpOnly {
+		t.Fatalf("expected HttpOnly session and readable CSRF cookies: %v %v", session, csrf)
+	}
+	jar := []*http.Cookie{session, csrf}
+
+	w = do(http.MethodGet, "/api/me", jar, nil)
+	var me struct {
+		Actor      string `json:"actor"`
+		Role       string `json:"role"`
+		AuthMethod string `json:"auth_method"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &me); err != nil || w.Code != http.StatusOK {
+		t.Fatalf("me: %d %s", w.Code, w.Body.String())
+	}
+	if me.Actor != "sso:ops@example.com" || me.Role != "operator" || me.AuthMethod != "session" {
+		t.Fatalf("unexpected principal: %+v", me)
+	}
+
+	if w := do(http.MethodGet, "/api/settings/master-key", jar, nil); w.Code != http.StatusForbidden {
+		t.Fatalf("operator must not see the master key, got %d", w.Code)
+	}
+	if w := do(http.MethodPost, "/api/settings/master-key/reset", jar, nil); w.Code != http.StatusForbidden ||
+		!strings.Contains(w.Body.String(), "csrf_failed") {
+		t.Fatalf("cookie writes without CSRF header must fail: %d %s", w.Code, w.Body.String())
+	}
+	if w := do(http.MethodDelete, "/api/logs", jar, http.Header{"X-Csrf-Token": {"wrong"}}); w.Code != http.StatusForbidden {
+		t.Fatalf("wrong CSRF token must fail, got %d", w.Code)
+	}
+
+	// Bearer auth for automation is unaffected by sessions and CSRF.
+	if w := do(http.MethodGet, "/api/me", nil, http.Header{"Authorization": {"Bearer " + master.Get()}}); w.Code != http.StatusOK {
+		t.Fatalf("bearer auth: %d", w.Code)
+	}
+
+	if w := login("c2", "sales@example.com", []string{"sales"}); !strings.Contains(w.Header().Get("Location"), "sso_error=no_role") {
+		t.Fatalf("unmapped groups must be refused: %q", w.Header().Get("Location"))
+	}
+	events, err := audit.List(ctx, 1, 10, services.AuditFilter{Action: "session.login"})
+	if err != nil || events.Total != 2 {
+		t.Fatalf("both logins should be audited: %v %v", events.Total, err)
+	}
+
+	// A callback without the state cookie set by /auth/oidc/login is refused.
+	if w := do(http.MethodGet, "/auth/oidc/callback?code=x&state=y", nil, nil); !strings.Contains(w.Header().Get("Location"), "sso_error=state_mismatch") {
+		t.Fatalf("expected state mismatch: %q", w.Header().Get("Location"))
+	}
+
+	if w := do(http.MethodPost, "/auth/logout", jar, http.Header{"X-Csrf-Token": {csrf.Value}}); w.Code != http.StatusOK {
+		t.Fatalf("logout: %d %s", w.Code, w.Body.String())
+	}
+	if w := do(http.MethodGet, "/api/me", jar, nil); w.Code != http.StatusUnauthorized {
+		t.Fatalf("session must be gone after logout, got %d", w.Code)
+	}
+}
@@ -22,8 +22,17 @@ type Dependencies struct {
 	KeyBatchCreateJob          *services.KeyBatchCreateJobService
 	QuotaSyncService           *services.QuotaSyncService
 	QuotaSyncJob               *services.QuotaSyncJobService
+	JobStore                   *services.JobStore
 	LogService                 *services.LogService
 	StatsService               *services.StatsService
+	BackupService              *services.BackupService
+	AuditService               *services.AuditService
+	AdminService               *services.AdminService
+	SessionService             *services.SessionService
+	OIDCProvider               *services.OIDCProvider
+	PolicyService              *services.PolicyService
+	FilterService              *services.FilterService
+	IdempotencyService         *services.IdempotencyService
 	TavilyProxy                *services.TavilyProxy
 	Logger                     *slog.Logger
 }
@@ -0,0 +1,67 @@
+package jobs
+
+import (
+	"context"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"tavily-proxy/server/internal/services"
+)
+
+func StartAuditCleanup(ctx context.Context, leader *services.LeaderElector, settings *services.SettingsService, audit *services.AuditService, logger *slog.Logger) {
+	var running atomic.Bool
+
+	go func() {
+		ticker := time.NewTicker(30 * time.Minute)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if running.Load() || !leader.IsLeader() {
+					continue
+				}
+
+				retentionDays, err := settings.GetInt(ctx, services.SettingAuditRetentionDays, 365)
+				if err != nil {
+					logger.Error("audit-cleanup: failed to read retention setting", "err", err)
+					continue
+				}
+				if retentionDays <= 0 {
+					continue
+				}
+
+				lastRunAt, _ := settings.GetTime(ctx, services.SettingAuditCleanupLastRunAt)
+				if lastRunAt != nil && time.Since(*lastRunAt) < 24*time.Hour {
+					continue
+				}
+
+				if !running.CompareAndSwap(false, true) {
+					continue
+				}
+
+				go func(retention int) {
+					defer running.Store(false)
+
+					now := time.Now()
+					_ = settings.SetTime(context.Background(), services.SettingAuditCleanupLastRunAt, now)
+
+					cutoff := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location()).AddDate(0, 0, -retention)
+
+					runCtx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+					defer cancel()
+
+					deleted, err := audit.DeleteOlderThan(runCtx, cutoff)
+					if err != nil {
+						logger.Error("audit-cleanup: delete failed", "err", err)
+						return
+					}
+					logger.Info("audit-cleanup: completed", "deleted", deleted, "cutoff", cutoff.Format(time.RFC3339))
+				}(retentionDays)
+			}
+		}
+	}()
+}
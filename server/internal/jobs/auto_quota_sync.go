@@ -9,7 +9,7 @@ import (
 	"tavily-proxy/server/internal/services"
 )
 
-func StartAutoQuotaSync(ctx context.Context, settings *services.SettingsService, sync *services.QuotaSyncService, logger *slog.Logger) {
+func StartAutoQuotaSync(ctx context.Context, leader *services.LeaderElector, settings *services.SettingsService, sync *services.QuotaSyncService, logger *slog.Logger) {
 	var running atomic.Bool
 
 	go func() {
@@ -21,7 +21,7 @@ func StartAutoQuotaSync(ctx context.Context, settings *services.SettingsService,
 			case <-ctx.Done():
 				return
 			case <-ticker.C:
-				if running.Load() {
+				if running.Load() || !leader.IsLeader() {
 					continue
 				}
 
@@ -43,7 +43,17 @@ func StartAutoQuotaSync(ctx context.Context, settings *services.SettingsService,
 					intervalMinutes = 1
 				}
 
-				concurrency := 1
+				concurrency, err := settings.GetInt(ctx, services.SettingAutoSyncConcurrency, 1)
+				if err != nil {
+					logger.Error("auto-sync: failed to read concurrency setting", "err", err)
+					continue
+				}
+				if concurrency < 1 {
+					concurrency = 1
+				}
+				if concurrency > 32 {
+					concurrency = 32
+				}
 
 				requestIntervalSeconds, err := settings.GetInt(ctx, services.SettingAutoSyncRequestIntervalSeconds, 0)
 				if err != nil {
@@ -92,6 +102,8 @@ func StartAutoQuotaSync(ctx context.Context, settings *services.SettingsService,
 						result.Total,
 						"failed",
 						result.Failed,
+						"concurrency",
+						concurrency,
 						"interval_seconds",
 						requestIntervalSeconds,
 					)
@@ -0,0 +1,41 @@
+package jobs
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"tavily-proxy/server/internal/services"
+)
+
+// StartIdempotencyCleanup drops stored Idempotency-Key responses once their
+// window has passed. Expired keys are already ignored on lookup; this only
+// keeps the table small.
+func StartIdempotencyCleanup(ctx context.Context, leader *services.LeaderElector, idempotency *services.IdempotencyService, logger *slog.Logger) {
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if !leader.IsLeader() {
+					continue
+				}
+
+				runCtx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+				deleted, err := idempotency.DeleteExpired(runCtx, time.Now())
+				cancel()
+				if err != nil {
+					logger.Error("idempotency-cleanup: delete failed", "err", err)
+					continue
+				}
+				if deleted > 0 {
+					logger.Info("idempotency-cleanup: completed", "deleted", deleted)
+				}
+			}
+		}
+	}()
+}
@@ -9,7 +9,7 @@ import (
 	"tavily-proxy/server/internal/services"
 )
 
-func StartLogCleanup(ctx context.Context, settings *services.SettingsService, logs *services.LogService, logger *slog.Logger) {
+func StartLogCleanup(ctx context.Context, leader *services.LeaderElector, settings *services.SettingsService, logs *services.LogService, stats *services.StatsService, logger *slog.Logger) {
 	var running atomic.Bool
 
 	go func() {
@@ -21,7 +21,7 @@ func StartLogCleanup(ctx context.Context, settings *services.SettingsService, lo
 			case <-ctx.Done():
 				return
 			case <-ticker.C:
-				if running.Load() {
+				if running.Load() || !leader.IsLeader() {
 					continue
 				}
 
@@ -61,8 +61,16 @@ func StartLogCleanup(ctx context.Context, settings *services.SettingsService, lo
 						return
 					}
 
+					// Rollups back the dashboards; keep them no longer than the logs they summarise.
+					rollups, err := stats.DeleteRollupsOlderThan(runCtx, cutoff)
+					if err != nil {
+						_ = settings.Set(context.Background(), services.SettingLogCleanupLastError, err.Error())
+						logger.Error("log-cleanup: rollup delete failed", "err", err)
+						return
+					}
+
 					_ = settings.Set(context.Background(), services.SettingLogCleanupLastError, "")
-					logger.Info("log-cleanup: completed", "deleted", deleted, "cutoff", cutoff.Format(time.RFC3339))
+					logger.Info("log-cleanup: completed", "deleted", deleted, "rollups_deleted", rollups, "cutoff", cutoff.Format(time.RFC3339))
 				}(retentionDays)
 			}
 		}
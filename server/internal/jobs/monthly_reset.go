@@ -8,26 +8,60 @@ import (
 	"tavily-proxy/server/internal/services"
 )
 
-func StartMonthlyReset(ctx context.Context, keys *services.KeyService, logger *slog.Logger) {
+// StartMonthlyReset resets key usage once per calendar month. The leader
+// checks every minute, so a reset missed while no replica held the lease (or
+// the process was down at midnight on the 1st) is caught up as soon as one
+// does.
+func StartMonthlyReset(ctx context.Context, leader *services.LeaderElector, settings *services.SettingsService, keys *services.KeyService, logger *slog.Logger) {
 	go func() {
+		ticker := time.NewTicker(time.Minute)
+		defer ticker.Stop()
+
 		for {
-			now := time.Now()
-			nextMidnight := time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, now.Location())
-			timer := time.NewTimer(time.Until(nextMidnight))
 			select {
 			case <-ctx.Done():
-				timer.Stop()
 				return
-			case <-timer.C:
-				if nextMidnight.Day() == 1 {
-					if err := keys.ResetAllUsage(context.Background()); err != nil {
-						logger.Error("monthly reset failed", "err", err)
-					} else {
-						logger.Info("monthly quota reset completed")
-					}
+			case <-ticker.C:
+				if !leader.IsLeader() {
+					continue
 				}
+				runMonthlyReset(ctx, settings, keys, logger, time.Now())
 			}
 		}
 	}()
 }
 
+func runMonthlyReset(ctx context.Context, settings *services.SettingsService, keys *services.KeyService, logger *slog.Logger, now time.Time) {
+	// The month marker keeps a leader handover from resetting twice: a replica
+	// resets only after moving the marker from last month to this one, which
+	// at most one replica can do. Skip the cache so the read is current.
+	month := now.Format("2006-01")
+	settings.InvalidateCache(services.SettingMonthlyResetLastMonth)
+	lastMonth, _, err := settings.Get(ctx, services.SettingMonthlyResetLastMonth)
+	if err != nil {
+		logger.Error("monthly reset: failed to read last month", "err", err)
+		return
+	}
+	if lastMonth == month {
+		return
+	}
+
+	claimed, err := settings.CompareAndSet(ctx, services.SettingMonthlyResetLastMonth, lastMonth, month)
+	if err != nil {
+		logger.Error("monthly reset: failed to claim month", "err", err)
+		return
+	}
+	if !claimed || lastMonth == "" {
+		// Another replica claimed the month, or this is the first run and
+		// usage so far belongs to this month.
+		return
+	}
+
+	if err := keys.ResetAllUsage(ctx); err != nil {
+		logger.Error("monthly reset failed", "err", err)
+		// Release the month so the next check retries.
+		_, _ = settings.CompareAndSet(context.Background(), services.SettingMonthlyResetLastMonth, month, lastMonth)
+		return
+	}
+	logger.Info("monthly quota reset completed", "month", month)
+}
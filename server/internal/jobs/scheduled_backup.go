@@ -0,0 +1,93 @@
+package jobs
+
+import (
+	"context"
+	"log/slog"
+	"sync/atomic"
+	"time"
+
+	"tavily-proxy/server/internal/services"
+)
+
+func StartScheduledBackup(ctx context.Context, leader *services.LeaderElector, settings *services.SettingsService, backups *services.BackupService, dir string, logger *slog.Logger) {
+	if !backups.Supported() {
+		logger.Info("scheduled-backup: disabled, database is not SQLite")
+		return
+	}
+
+	var running atomic.Bool
+
+	go func() {
+		ticker := time.NewTicker(5 * time.Minute)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if running.Load() || !leader.IsLeader() {
+					continue
+				}
+
+				enabled, err := settings.GetBool(ctx, services.SettingBackupEnabled, false)
+				if err != nil {
+					logger.Error("scheduled-backup: failed to read enabled setting", "err", err)
+					continue
+				}
+				if !enabled {
+					continue
+				}
+
+				intervalHours, err := settings.GetInt(ctx, services.SettingBackupIntervalHours, 24)
+				if err != nil {
+					logger.Error("scheduled-backup: failed to read interval setting", "err", err)
+					continue
+				}
+				if intervalHours < 1 {
+					intervalHours = 1
+				}
+
+				lastRunAt, _ := settings.GetTime(ctx, services.SettingBackupLastRunAt)
+				if lastRunAt != nil && time.Since(*lastRunAt) < time.Duration(intervalHours)*time.Hour {
+					continue
+				}
+
+				retention, err := settings.GetInt(ctx, services.SettingBackupRetentionCount, 7)
+				if err != nil {
+					logger.Error("scheduled-backup: failed to read retention setting", "err", err)
+					continue
+				}
+				includeLogs, err := settings.GetBool(ctx, services.SettingBackupIncludeLogs, false)
+				if err != nil {
+					logger.Error("scheduled-backup: failed to read include-logs setting", "err", err)
+					continue
+				}
+
+				if !running.CompareAndSwap(false, true) {
+					continue
+				}
+
+				go func() {
+					defer running.Store(false)
+
+					_ = settings.SetTime(context.Background(), services.SettingBackupLastRunAt, time.Now())
+
+					runCtx, cancel := context.WithTimeout(ctx, 30*time.Minute)
+					defer cancel()
+
+					info, err := backups.WriteScheduled(runCtx, dir, retention, services.BackupOptions{IncludeLogs: includeLogs})
+					if err != nil {
+						_ = settings.Set(context.Background(), services.SettingBackupLastError, err.Error())
+						logger.Error("scheduled-backup: snapshot failed", "err", err)
+						return
+					}
+
+					_ = settings.SetTime(context.Background(), services.SettingBackupLastSuccessAt, time.Now())
+					_ = settings.Set(context.Background(), services.SettingBackupLastError, "")
+					logger.Info("scheduled-backup: completed", "file", info.Name, "size", info.Size)
+				}()
+			}
+		}
+	}()
+}
@@ -0,0 +1,41 @@
+package jobs
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"tavily-proxy/server/internal/services"
+)
+
+// StartSessionCleanup purges expired admin sessions and abandoned SSO logins.
+// Expired rows are already rejected on lookup; this keeps the tables small
+// and frees room under the pending login cap.
+func StartSessionCleanup(ctx context.Context, leader *services.LeaderElector, sessions *services.SessionService, logger *slog.Logger) {
+	go func() {
+		ticker := time.NewTicker(10 * time.Minute)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				if !leader.IsLeader() {
+					continue
+				}
+
+				runCtx, cancel := context.WithTimeout(ctx, 5*time.Minute)
+				deleted, err := sessions.DeleteExpired(runCtx, time.Now().UTC())
+				cancel()
+				if err != nil {
+					logger.Error("session-cleanup: delete failed", "err", err)
+					continue
+				}
+				if deleted > 0 {
+					logger.Info("session-cleanup: completed", "deleted", deleted)
+				}
+			}
+		}
+	}()
+}
@@ -0,0 +1,261 @@
+package mcpserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"tavily-proxy/server/internal/services"
+)
+
+// adminTools lets master-key callers manage the pool. Upstream keys are only
+// ever returned masked; mutations are written to the audit log like their REST
+// counterparts.
+type adminTools struct {
+	deps Dependencies
+}
+
+func addAdminTools(server *mcp.Server, deps Dependencies) {
+	a := adminTools{deps: deps}
+
+	if deps.Keys != nil {
+		server.AddTool(&mcp.Tool{
+			Name:        "admin-list-keys",
+			Description: "List the upstream Tavily keys in the pool with masked values, quota and state.",
+			InputSchema: objectSchema(nil, map[string]any{}),
+		}, func(ctx context.Context, _ *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			keys, err := deps.Keys.List(ctx)
+			if err != nil {
+				return toolError(err.Error()), nil
+			}
+			items := make([]keyQuota, 0, len(keys))
+			for _, k := range keys {
+				items = append(items, newKeyQuota(k))
+			}
+			return jsonResult(map[string]any{"items": items})
+		})
+
+		server.AddTool(&mcp.Tool{
+			Name:        "admin-set-key-active",
+			Description: "Enable or disable an upstream key by id.",
+			InputSchema: objectSchema([]string{"id", "active"}, map[string]any{
+				"id":     map[string]any{"type": "integer", "minimum": 1, "description": "Key id from admin-list-keys."},
+				"active": map[string]any{"type": "boolean", "description": "Whether the key may serve requests."},
+			}),
+		}, func(ctx context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			var args struct {
+				ID     uint  `json:"id"`
+				Active *bool `json:"active"`
+			}
+			if err := json.Unmarshal(req.Params.Arguments, &args); err != nil || args.ID == 0 || args.Active == nil {
+				return toolError("id and active are required"), nil
+			}
+			before, err := deps.Keys.Get(ctx, args.ID)
+			if err != nil {
+				return toolError("key not found"), nil
+			}
+			updated, err := deps.Keys.Update(ctx, args.ID, services.KeyUpdate{IsActive: args.Active})
+			if err != nil {
+				a.audit(ctx, req, "key.update", args.ID, newKeyQuota(*before), nil, false)
+				return toolError(err.Error()), nil
+			}
+			after := newKeyQuota(*updated)
+			a.audit(ctx, req, "key.update", args.ID, newKeyQuota(*before), after, true)
+			return jsonResult(after)
+		})
+	}
+
+	if deps.QuotaSync != nil {
+		server.AddTool(&mcp.Tool{
+			Name:        "admin-sync-key",
+			Description: "Refresh one key's used and total quota from Tavily.",
+			InputSchema: objectSchema([]string{"id"}, map[string]any{
+				"id": map[string]any{"type": "integer", "minimum": 1, "description": "Key id from admin-list-keys."},
+			}),
+		}, func(ctx context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			var args struct {
+				ID uint `json:"id"`
+			}
+			if err := json.Unmarshal(req.Params.Arguments, &args); err != nil || args.ID == 0 {
+				return toolError("id is required"), nil
+			}
+			item, err := deps.QuotaSync.SyncOne(ctx, args.ID)
+			a.audit(ctx, req, "key.sync", args.ID, nil, item, err == nil)
+			if err != nil {
+				return toolError("sync failed: " + err.Error()), nil
+			}
+			return jsonResult(item)
+		})
+	}
+
+	if deps.DistributedKeys != nil {
+		server.AddTool(&mcp.Tool{
+			Name:        "admin-create-distributed-key",
+			Description: "Create a distributed key for a client. The plain key is returned once and cannot be retrieved later.",
+			InputSchema: objectSchema([]string{"name"}, map[string]any{
+				"name":                  map[string]any{"type": "string", "description": "Who or what the key is for."},
+				"note":                  map[string]any{"type": "string"},
+				"expires_at":            map[string]any{"type": "string", "format": "date-time", "description": "RFC 3339 expiry; omit for none."},
+				"rate_limit_per_minute": map[string]any{"type": "integer", "minimum": 0, "description": "0 disables the limit; omit for the default."},
+			}),
+		}, func(ctx context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			var args struct {
+				Name               string `json:"name"`
+				Note               string `json:"note"`
+				ExpiresAt          string `json:"expires_at"`
+				RateLimitPerMinute *int   `json:"rate_limit_per_minute"`
+			}
+			if err := json.Unmarshal(req.Params.Arguments, &args); err != nil {
+				return toolError("invalid arguments: " + err.Error()), nil
+			}
+			expiresAt, err := services.ParseRFC3339Ptr(args.ExpiresAt)
+			if err != nil {
+				return toolError("expires_at must be an RFC 3339 timestamp"), nil
+			}
+			created, plain, err := deps.DistributedKeys.Create(ctx, services.DistributedKeyCreateInput{
+				Name:               args.Name,
+				Note:               args.Note,
+				ExpiresAt:          expiresAt,
+				RateLimitPerMinute: args.RateLimitPerMinute,
+			})
+			if err != nil {
+				if errors.Is(err, services.ErrInvalidRateLimit) {
+					return toolError("invalid rate_limit_per_minute"), nil
+				}
+				return toolError(err.Error()), nil
+			}
+			a.audit(ctx, req, "distributed_key.create", created.ID, nil, created, true)
+			return jsonResult(map[string]any{"plain_key": plain, "item": created})
+		})
+
+		server.AddTool(&mcp.Tool{
+			Name:        "admin-revoke-distributed-key",
+			Description: "Disable a distributed key by id. Its usage history is kept.",
+			InputSchema: objectSchema([]string{"id"}, map[string]any{
+				"id": map[string]any{"type": "integer", "minimum": 1},
+			}),
+		}, func(ctx context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			var args struct {
+				ID uint `json:"id"`
+			}
+			if err := json.Unmarshal(req.Params.Arguments, &args); err != nil || args.ID == 0 {
+				return toolError("id is required"), nil
+			}
+			before, err := deps.DistributedKeys.FindByID(ctx, args.ID)
+			if err != nil {
+				return toolError("distributed key not found"), nil
+			}
+			inactive := false
+			updated, err := deps.DistributedKeys.Update(ctx, args.ID, services.DistributedKeyUpdateInput{IsActive: &inactive})
+			if err != nil {
+				a.audit(ctx, req, "distributed_key.update", args.ID, before, nil, false)
+				return toolError(err.Error()), nil
+			}
+			a.audit(ctx, req, "distributed_key.update", args.ID, before, updated, true)
+			return jsonResult(updated)
+		})
+	}
+
+	if deps.Logs != nil {
+		server.AddTool(&mcp.Tool{
+			Name:        "admin-query-logs",
+			Description: "List proxied requests, newest first, without request or response bodies.",
+			InputSchema: objectSchema(nil, map[string]any{
+				"page":        map[string]any{"type": "integer", "minimum": 1, "default": 1},
+				"page_size":   map[string]any{"type": "integer", "minimum": 1, "maximum": 200, "default": 20},
+				"status_code": map[string]any{"type": "integer", "description": "Only requests with this status code."},
+			}),
+		}, func(ctx context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			var args struct {
+				Page       int  `json:"page"`
+				PageSize   int  `json:"page_size"`
+				StatusCode *int `json:"status_code"`
+			}
+			if len(req.Params.Arguments) > 0 {
+				if err := json.Unmarshal(req.Params.Arguments, &args); err != nil {
+					return toolError("invalid arguments: " + err.Error()), nil
+				}
+			}
+			logs, err := deps.Logs.List(ctx, args.Page, args.PageSize, args.StatusCode)
+			if err != nil {
+				return toolError(err.Error()), nil
+			}
+			items := make([]logSummary, 0, len(logs.Items))
+			for _, l := range logs.Items {
+				items = append(items, newLogSummary(l))
+			}
+			return jsonResult(map[string]any{"items": items, "total": logs.Total, "page": logs.Page, "page_size": logs.Size})
+		})
+	}
+
+	if deps.Stats != nil {
+		server.AddTool(&mcp.Tool{
+			Name:        "admin-stats",
+			Description: "Pool quota totals, key counts and today's request count.",
+			InputSchema: objectSchema(nil, map[string]any{}),
+		}, func(ctx context.Context, _ *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			stats, err := deps.Stats.Get(ctx)
+			if err != nil {
+				return toolError(err.Error()), nil
+			}
+			return jsonResult(stats)
+		})
+	}
+}
+
+func (a adminTools) audit(ctx context.Context, req *mcp.CallToolRequest, action string, targetID uint, before, after any, ok bool) {
+	if a.deps.Audit == nil {
+		return
+	}
+	status := http.StatusOK
+	if !ok {
+		status = http.StatusInternalServerError
+	}
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 5*time.Second)
+	defer cancel()
+	_ = a.deps.Audit.Record(ctx, services.AuditEntry{
+		Actor:      "master_key",
+		Action:     action,
+		TargetType: strings.SplitN(action, ".", 2)[0],
+		TargetID:   fmt.Sprint(targetID),
+		Method:     "MCP",
+		Path:       "/mcp#" + req.Params.Name,
+		StatusCode: status,
+		ClientIP:   "mcp",
+		Before:     before,
+		After:      after,
+	})
+}
+
+func objectSchema(required []string, properties map[string]any) map[string]any {
+	schema := map[string]any{
+		"type":                 "object",
+		"additionalProperties": false,
+		"properties":           properties,
+	}
+	if len(required) > 0 {
+		schema["required"] = required
+	}
+	return schema
+}
+
+func jsonResult(v any) (*mcp.CallToolResult, error) {
+	raw, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	var structured map[string]any
+	if err := json.Unmarshal(raw, &structured); err != nil {
+		structured = map[string]any{"raw": string(raw)}
+	}
+	return &mcp.CallToolResult{
+		Content:           []mcp.Content{&mcp.TextContent{Text: string(raw)}},
+		StructuredContent: structured,
+	}, nil
+}
@@ -0,0 +1,169 @@
+package mcpserver
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"tavily-proxy/server/internal/db"
+	"tavily-proxy/server/internal/services"
+)
+
+func TestHandler_AdminToolsOnlyForMasterKey(t *testing.T) {
+	t.Parallel()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	database, err := db.Open(filepath.Join(t.TempDir(), "app.db"))
+	if err != nil {
+		t.Fatalf("db open: %v", err)
+	}
+	sqlDB, err := database.DB()
+	if err != nil {
+		t.Fatalf("db handle: %v", err)
+	}
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"results":[]}`))
+	}))
+	t.Cleanup(upstream.Close)
+
+	ctx := context.Background()
+	master := services.NewMasterKeyService(database, logger)
+	if err := master.LoadOrCreate(ctx); err != nil {
+		t.Fatalf("master init: %v", err)
+	}
+	keys := services.NewKeyService(database, logger)
+	key, err := keys.Create(ctx, "tvly-secretsecretsecret", "primary", 100)
+	if err != nil {
+		t.Fatalf("create key: %v", err)
+	}
+	cipher, err := services.NewTokenCipher("0123456789abcdef0123456789abcdef")
+	if err != nil {
+		t.Fatalf("cipher: %v", err)
+	}
+	distributedKeys := services.NewDistributedKeyService(database, logger, cipher, 60)
+	audit := services.NewAuditService(database, logger)
+	handler := NewHandler(Dependencies{
+		MasterKey:       master,
+		Proxy:           services.NewTavilyProxy(upstream.URL, 5*time.Second, keys, nil, nil, logger),
+		Stats:           services.NewStatsService(database),
+		Logs:            services.NewLogService(database, logger),
+		Keys:            keys,
+		DistributedKeys: distributedKeys,
+		RateLimiter:     services.NewDistributedRateLimiter(time.Minute),
+		KeyUsage:        services.NewDistributedKeyUsageService(database),
+		Audit:           audit,
+		Stateless:       true,
+	})
+	srv := httptest.NewServer(handler)
+	t.Cleanup(srv.Close)
+
+	connect := func(token string) (*mcp.ClientSession, error) {
+		client := mcp.NewClient(&mcp.Implementation{Name: "test", Version: "0"}, nil)
+		return client.Connect(ctx, &mcp.StreamableClientTransport{
+			Endpoint:   srv.URL,
+			HTTPClient: &http.Client{Transport: bearerRoundTripper{token: token, base: http.DefaultTransport}},
+		}, nil)
+	}
+	toolNames := func(s *mcp.ClientSession) []string {
+		res, err := s.ListTools(ctx, nil)
+		if err != nil {
+			t.Fatalf("list tools: %v", err)
+		}
+		var names []string
+		for _, tool := range res.Tools {
+			names = append(names, tool.Name)
+		}
+		return names
+	}
+	call := func(s *mcp.ClientSession, name string, args map[string]any) *mcp.CallToolResult {
+		res, err := s.CallTool(ctx, &mcp.CallToolParams{Name: name, Arguments: args})
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if res.IsError {
+			t.Fatalf("%s: %s", name, res.Content[0].(*mcp.TextContent).Text)
+		}
+		return res
+	}
+
+	if _, err := connect("wrong"); err == nil {
+		t.Fatalf("unknown token must be rejected")
+	}
+
+	admin, err := connect(master.Get())
+	if err != nil {
+		t.Fatalf("master connect: %v", err)
+	}
+	t.Cleanup(func() { _ = admin.Close() })
+	if names := toolNames(admin); !slices.Contains(names, "admin-list-keys") || !slices.Contains(names, "tavily-search") {
+		t.Fatalf("master key should see admin and proxy tools: %v", names)
+	}
+
+	listed := call(admin, "admin-list-keys", nil).Content[0].(*mcp.TextContent).Text
+	if strings.Contains(listed, "secretsecretsecret") || !strings.Contains(listed, `"alias": "primary"`) {
+		t.Fatalf("keys must be listed masked: %s", listed)
+	}
+
+	created := call(admin, "admin-create-distributed-key", map[string]any{"name": "agent"})
+	var out struct {
+		PlainKey string `json:"plain_key"`
+		Item     struct {
+			ID uint `json:"id"`
+		} `json:"item"`
+	}
+	raw, _ := json.Marshal(created.StructuredContent)
+	if err := json.Unmarshal(raw, &out); err != nil || out.PlainKey == "" {
+		t.Fatalf("create distributed key: %s %v", raw, err)
+	}
+
+	user, err := connect(out.PlainKey)
+	if err != nil {
+		t.Fatalf("distributed key connect: %v", err)
+	}
+	t.Cleanup(func() { _ = user.Close() })
+	for _, name := range toolNames(user) {
+		if strings.HasPrefix(name, "admin-") {
+			t.Fatalf("admin tool %s advertised to a distributed key", name)
+		}
+	}
+	if res, err := user.ListResources(ctx, nil); err == nil && len(res.Resources) != 0 {
+		t.Fatalf("resources advertised to a distributed key: %v", res.Resources)
+	}
+	if _, err := user.ReadResource(ctx, &mcp.ReadResourceParams{URI: poolStatusURI}); err == nil {
+		t.Fatalf("pool status must not be readable with a distributed key")
+	}
+	if err := user.Subscribe(ctx, &mcp.SubscribeParams{URI: poolStatusURI}); err == nil {
+		t.Fatalf("distributed keys must not subscribe to quota updates")
+	}
+	call(user, "tavily-search", map[string]any{"query": "q"})
+	dk, err := distributedKeys.FindByID(ctx, out.Item.ID)
+	if err != nil || dk.LastUsedAt == nil {
+		t.Fatalf("tool calls should be attributed to the distributed key: %+v %v", dk, err)
+	}
+
+	call(admin, "admin-set-key-active", map[string]any{"id": key.ID, "active": false})
+	if k, _ := keys.Get(ctx, key.ID); k.IsActive {
+		t.Fatalf("key should be disabled")
+	}
+	call(admin, "admin-revoke-distributed-key", map[string]any{"id": out.Item.ID})
+	if _, err := connect(out.PlainKey); err == nil {
+		t.Fatalf("revoked distributed key must be rejected")
+	}
+
+	events, err := audit.List(ctx, 1, 10, services.AuditFilter{Actor: "master_key"})
+	if err != nil || events.Total != 3 {
+		t.Fatalf("expected the three admin mutations to be audited, got %d %v", events.Total, err)
+	}
+}
@@ -3,73 +3,248 @@ package mcpserver
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
-	"strings"
+	"slices"
+	"sync"
 	"time"
 
+	"github.com/modelcontextprotocol/go-sdk/auth"
 	"github.com/modelcontextprotocol/go-sdk/mcp"
 
+	"tavily-proxy/server/internal/models"
 	"tavily-proxy/server/internal/services"
 )
 
 type Dependencies struct {
-	MasterKey  *services.MasterKeyService
-	Proxy      *services.TavilyProxy
-	Stateless  bool
-	SessionTTL time.Duration
+	MasterKey       *services.MasterKeyService
+	Proxy           *services.TavilyProxy
+	Stats           *services.StatsService
+	Logs            *services.LogService
+	Keys            *services.KeyService
+	QuotaSync       *services.QuotaSyncService
+	DistributedKeys *services.DistributedKeyService
+	RateLimiter     *services.DistributedRateLimiter
+	KeyUsage        *services.DistributedKeyUsageService
+	Audit           *services.AuditService
+	Settings        *services.SettingsService
+	Stateless       bool
+	SessionTTL      time.Duration
 }
 
+const (
+	// adminScope marks master-key callers, who get the admin toolset.
+	adminScope = "admin"
+	// distributedKeyExtra holds the *models.DistributedKey of callers that
+	// authenticated with a distributed key.
+	distributedKeyExtra = "distributed_key"
+)
+
+// Handlers holds the MCP endpoints: the Streamable HTTP transport and the
+// legacy HTTP+SSE transport for older clients.
+type Handlers struct {
+	Streamable http.Handler
+	SSE        http.Handler
+}
+
+// NewHandler serves MCP to master-key and distributed-key callers. Each gets
+// its own server so admin tools are only advertised to the master key.
 func NewHandler(deps Dependencies) http.Handler {
+	return NewHandlers(deps).Streamable
+}
+
+// NewHandlers builds both transports. They share the servers, so tools,
+// resources and quota subscriptions behave the same on either endpoint.
+func NewHandlers(deps Dependencies) Handlers {
+	server := newServer(deps, false)
+	adminServer := newServer(deps, true)
+	streamableOpts := &mcp.StreamableHTTPOptions{
+		Stateless:      deps.Stateless,
+		SessionTimeout: deps.SessionTTL,
+	}
+
+	// The Streamable transport attaches each request's token to tool calls,
+	// so distributed keys can share one server; they still get a handler
+	// each so a session only accepts requests from the caller that opened it.
+	streamable := &callerHandler{
+		admin: mcp.NewStreamableHTTPHandler(func(*http.Request) *mcp.Server { return adminServer }, streamableOpts),
+		newForKey: func(uint) http.Handler {
+			return mcp.NewStreamableHTTPHandler(func(*http.Request) *mcp.Server { return server }, streamableOpts)
+		},
+		byKey: map[uint]http.Handler{},
+	}
+	// The SSE transport does not pass the token of each message to tool
+	// handlers, so every distributed key also gets its own server that
+	// attributes calls to that key.
+	sse := &callerHandler{
+		admin: mcp.NewSSEHandler(func(*http.Request) *mcp.Server { return adminServer }, nil),
+		newForKey: func(id uint) http.Handler {
+			keyServer := newServer(deps, false)
+			keyServer.AddReceivingMiddleware(attributeToKey(deps.DistributedKeys, id))
+			return mcp.NewSSEHandler(func(*http.Request) *mcp.Server { return keyServer }, nil)
+		},
+		byKey: map[uint]http.Handler{},
+	}
+	requireAuth := auth.RequireBearerToken(tokenVerifier(deps), nil)
+	return Handlers{Streamable: requireAuth(streamable), SSE: requireAuth(sse)}
+}
+
+// callerHandler routes MCP traffic by caller: the master key and every
+// distributed key have their own transport handler. Neither transport ties a
+// session to the credential that opened it, so this keeps a session opened
+// by one caller from receiving requests sent with another caller's token:
+// the session is unknown to the other handler.
+type callerHandler struct {
+	admin     http.Handler
+	newForKey func(id uint) http.Handler
+
+	mu    sync.Mutex
+	byKey map[uint]http.Handler
+}
+
+func (h *callerHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	info := auth.TokenInfoFromContext(r.Context())
+	if info != nil && slices.Contains(info.Scopes, adminScope) {
+		h.admin.ServeHTTP(w, r)
+		return
+	}
+	var key *models.DistributedKey
+	if info != nil {
+		key, _ = info.Extra[distributedKeyExtra].(*models.DistributedKey)
+	}
+	if key == nil {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	h.forKey(key.ID).ServeHTTP(w, r)
+}
+
+// forKey creates handlers lazily; there is at most one per distributed key.
+func (h *callerHandler) forKey(id uint) http.Handler {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if handler, ok := h.byKey[id]; ok {
+		return handler
+	}
+	handler := h.newForKey(id)
+	h.byKey[id] = handler
+	return handler
+}
+
+// attributeToKey gives tool calls the token info the Streamable HTTP
+// transport would have attached. The key is reloaded on every call so rate
+// limit changes apply to open sessions.
+func attributeToKey(keys *services.DistributedKeyService, id uint) mcp.Middleware {
+	return func(next mcp.MethodHandler) mcp.MethodHandler {
+		return func(ctx context.Context, method string, req mcp.Request) (mcp.Result, error) {
+			call, ok := req.(*mcp.CallToolRequest)
+			if !ok || keys == nil {
+				return next(ctx, method, req)
+			}
+			key, err := keys.FindByID(ctx, id)
+			if err != nil {
+				return nil, err
+			}
+			if call.Extra == nil {
+				call.Extra = &mcp.RequestExtra{}
+			}
+			call.Extra.TokenInfo = &auth.TokenInfo{Extra: map[string]any{distributedKeyExtra: key}}
+			return next(ctx, method, req)
+		}
+	}
+}
+
+// tokenVerifier checks every HTTP request, so the expiration it reports only
+// has to outlive the request.
+func tokenVerifier(deps Dependencies) auth.TokenVerifier {
+	return func(ctx context.Context, token string, _ *http.Request) (*auth.TokenInfo, error) {
+		now := time.Now().UTC()
+		if deps.MasterKey.Authenticate(token) {
+			return &auth.TokenInfo{Scopes: []string{adminScope}, Expiration: now.Add(time.Minute)}, nil
+		}
+		if deps.DistributedKeys == nil {
+			return nil, auth.ErrInvalidToken
+		}
+		key, err := deps.DistributedKeys.AuthenticateBearer(ctx, token, now)
+		switch {
+		case err == nil:
+			return &auth.TokenInfo{Expiration: now.Add(time.Minute), Extra: map[string]any{distributedKeyExtra: key}}, nil
+		case errors.Is(err, services.ErrDistributedKeyDisabled):
+			return nil, fmt.Errorf("%w: key_disabled", auth.ErrInvalidToken)
+		case errors.Is(err, services.ErrDistributedKeyExpired):
+			return nil, fmt.Errorf("%w: key_expired", auth.ErrInvalidToken)
+		case errors.Is(err, services.ErrDistributedKeyNotFound):
+			return nil, auth.ErrInvalidToken
+		default:
+			return nil, err
+		}
+	}
+}
+
+func newServer(deps Dependencies, admin bool) *mcp.Server {
+	var opts *mcp.ServerOptions
+	// Resources expose pool-wide quota and logs, so only admin sessions get
+	// them and their update subscriptions.
+	var quota *quotaNotifier
+	if admin && deps.Keys != nil {
+		quota = newQuotaNotifier(deps.Keys)
+		opts = &mcp.ServerOptions{
+			SubscribeHandler:   quota.subscribe,
+			UnsubscribeHandler: func(context.Context, *mcp.UnsubscribeRequest) error { return nil },
+		}
+	}
 	server := mcp.NewServer(&mcp.Implementation{
 		Name:    "tavily-proxy-mcp",
 		Version: "0.1.0",
-	}, nil)
+	}, opts)
+	proxy := proxyCaller{
+		proxy:   deps.Proxy,
+		keys:    deps.DistributedKeys,
+		limiter: deps.RateLimiter,
+		usage:   deps.KeyUsage,
+	}
+	output := newOutputShaper(deps.Settings)
 
-	addProxyTool(server, deps.Proxy, &mcp.Tool{
+	addProxyTool(server, proxy, output, &mcp.Tool{
 		Name:        "tavily-search",
 		Description: "Execute a search query using Tavily Search (via Tavily Proxy Pool). Returns ranked results and optional answer/raw_content/images/usage.",
 		InputSchema: tavilySearchInputSchema,
 	}, http.MethodPost, "/search")
-	addProxyTool(server, deps.Proxy, &mcp.Tool{
+	addProxyTool(server, proxy, output, &mcp.Tool{
 		Name:        "tavily-extract",
 		Description: "Extract structured content from URLs (via Tavily Proxy Pool)",
 		InputSchema: tavilyExtractInputSchema,
 	}, http.MethodPost, "/extract")
-	addProxyTool(server, deps.Proxy, &mcp.Tool{
+	addProxyTool(server, proxy, output, &mcp.Tool{
 		Name:        "tavily-crawl",
 		Description: "Crawl a website starting from a root URL (via Tavily Proxy Pool)",
 		InputSchema: tavilyCrawlInputSchema,
 	}, http.MethodPost, "/crawl")
-	addProxyTool(server, deps.Proxy, &mcp.Tool{
+	addProxyTool(server, proxy, output, &mcp.Tool{
 		Name:        "tavily-map",
 		Description: "Map a website's URL structure (via Tavily Proxy Pool)",
 		InputSchema: tavilyMapInputSchema,
 	}, http.MethodPost, "/map")
-	addProxyTool(server, deps.Proxy, &mcp.Tool{
+	addProxyTool(server, proxy, output, &mcp.Tool{
 		Name:        "tavily-usage",
 		Description: "Get usage/quota info (via Tavily Proxy Pool)",
 		InputSchema: map[string]any{"type": "object", "properties": map[string]any{}, "additionalProperties": false},
 	}, http.MethodGet, "/usage")
-
-	base := mcp.NewStreamableHTTPHandler(func(_ *http.Request) *mcp.Server {
-		return server
-	}, &mcp.StreamableHTTPOptions{
-		Stateless:      deps.Stateless,
-		SessionTimeout: deps.SessionTTL,
-	})
-
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		token := parseBearerToken(r.Header.Get("Authorization"))
-		if !deps.MasterKey.Authenticate(token) {
-			http.Error(w, "unauthorized", http.StatusUnauthorized)
-			return
-		}
-		base.ServeHTTP(w, r)
-	})
+	addResearchTool(server, proxy)
+	addContinueTool(server, output)
+	if admin {
+		addAdminTools(server, deps)
+		addResources(server, deps)
+	}
+	addPrompts(server)
+	if quota != nil {
+		quota.attach(server)
+	}
+	return server
 }
 
-func addProxyTool(server *mcp.Server, proxy *services.TavilyProxy, tool *mcp.Tool, method, path string) {
+func addProxyTool(server *mcp.Server, proxy proxyCaller, output outputShaper, tool *mcp.Tool, method, path string) {
 	server.AddTool(tool, func(ctx context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
 		var body []byte
 		if method == http.MethodPost {
@@ -80,20 +255,7 @@ func addProxyTool(server *mcp.Server, proxy *services.TavilyProxy, tool *mcp.Too
 			}
 		}
 
-		headers := make(http.Header)
-		headers.Set("User-Agent", "tavily-proxy-mcp")
-		if method == http.MethodPost {
-			headers.Set("Content-Type", "application/json")
-		}
-
-		resp, err := proxy.Do(ctx, services.ProxyRequest{
-			Method:      method,
-			Path:        path,
-			Headers:     headers,
-			Body:        body,
-			ClientIP:    "mcp",
-			ContentType: "application/json",
-		})
+		resp, err := proxy.call(ctx, req, method, path, body)
 		if err != nil {
 			return &mcp.CallToolResult{
 				IsError: true,
@@ -128,15 +290,75 @@ func addProxyTool(server *mcp.Server, proxy *services.TavilyProxy, tool *mcp.Too
 			}, nil
 		}
 
-		return &mcp.CallToolResult{
-			Content: []mcp.Content{
-				&mcp.TextContent{Text: text},
-			},
-			StructuredContent: structured,
-		}, nil
+		m, _ := parsed.(map[string]any)
+		return output.result(ctx, path, resp.Body, m), nil
 	})
 }
 
+var errRateLimited = errors.New("rate_limited: the distributed key exceeded its per-minute request limit")
+
+// proxyCaller sends tool calls through the key pool. Calls made with a
+// distributed key are rate limited and counted against that key, as on the
+// REST proxy.
+type proxyCaller struct {
+	proxy   *services.TavilyProxy
+	keys    *services.DistributedKeyService
+	limiter *services.DistributedRateLimiter
+	usage   *services.DistributedKeyUsageService
+}
+
+func (p proxyCaller) call(ctx context.Context, req *mcp.CallToolRequest, method, path string, body []byte) (services.ProxyResponse, error) {
+	headers := make(http.Header)
+	headers.Set("User-Agent", "tavily-proxy-mcp")
+	if method == http.MethodPost {
+		headers.Set("Content-Type", "application/json")
+	}
+	proxyReq := services.ProxyRequest{
+		Method:      method,
+		Path:        path,
+		Headers:     headers,
+		Body:        body,
+		ClientIP:    "mcp",
+		ContentType: "application/json",
+	}
+
+	key := callerDistributedKey(req)
+	if key == nil {
+		return p.proxy.Do(ctx, proxyReq)
+	}
+	now := time.Now().UTC()
+	if p.limiter != nil && !p.limiter.AllowContext(ctx, key.ID, key.RateLimitPerMinute, now) {
+		if p.usage != nil {
+			_ = p.usage.Record(ctx, key.ID, http.StatusTooManyRequests, now)
+		}
+		return services.ProxyResponse{}, errRateLimited
+	}
+	proxyReq.DistributedKeyID = key.ID
+	resp, err := p.proxy.Do(ctx, proxyReq)
+	status := resp.StatusCode
+	if err != nil {
+		status = http.StatusBadGateway
+		if errors.Is(err, services.ErrNoAvailableKeys) {
+			status = http.StatusServiceUnavailable
+		}
+	}
+	if p.usage != nil {
+		_ = p.usage.Record(ctx, key.ID, status, now)
+	}
+	if p.keys != nil {
+		_ = p.keys.TouchLastUsed(ctx, key.ID, now)
+	}
+	return resp, err
+}
+
+func callerDistributedKey(req *mcp.CallToolRequest) *models.DistributedKey {
+	if req == nil || req.Extra == nil || req.Extra.TokenInfo == nil {
+		return nil
+	}
+	key, _ := req.Extra.TokenInfo.Extra[distributedKeyExtra].(*models.DistributedKey)
+	return key
+}
+
 var tavilySearchInputSchema = map[string]any{
 	"type":                 "object",
 	"additionalProperties": true,
@@ -483,17 +705,3 @@ var tavilyCrawlInputSchema = map[string]any{
 		},
 	},
 }
-
-func parseBearerToken(authHeader string) string {
-	if authHeader == "" {
-		return ""
-	}
-	parts := strings.SplitN(authHeader, " ", 2)
-	if len(parts) != 2 {
-		return ""
-	}
-	if !strings.EqualFold(parts[0], "Bearer") {
-		return ""
-	}
-	return strings.TrimSpace(parts[1])
-}
@@ -0,0 +1,285 @@
+package mcpserver
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"tavily-proxy/server/internal/services"
+)
+
+const (
+	continuationTTL        = 10 * time.Minute
+	maxContinuationEntries = 256
+)
+
+// outputOptions shape tool output so large upstream responses fit an agent's
+// context. The zero value returns responses unchanged.
+type outputOptions struct {
+	Markdown       bool
+	StripMedia     bool
+	MaxResultChars int
+	MaxChars       int
+	Continuation   bool
+}
+
+func loadOutputOptions(ctx context.Context, settings *services.SettingsService) outputOptions {
+	if settings == nil {
+		return outputOptions{}
+	}
+	var o outputOptions
+	o.Markdown, _ = settings.GetBool(ctx, services.SettingMCPOutputMarkdown, false)
+	o.StripMedia, _ = settings.GetBool(ctx, services.SettingMCPOutputStripMedia, false)
+	o.MaxResultChars, _ = settings.GetInt(ctx, services.SettingMCPOutputMaxResultChars, 0)
+	o.MaxChars, _ = settings.GetInt(ctx, services.SettingMCPOutputMaxChars, 0)
+	o.Continuation, _ = settings.GetBool(ctx, services.SettingMCPOutputContinuation, true)
+	return o
+}
+
+// shapeResponse applies the per-result options to a successful upstream JSON
+// body and renders it. It reports changed=false when the body was left as is.
+func shapeResponse(path string, parsed map[string]any, opts outputOptions) (text string, changed bool) {
+	if opts.StripMedia {
+		delete(parsed, "images")
+		delete(parsed, "favicon")
+	}
+	results, _ := parsed["results"].([]any)
+	for _, r := range results {
+		item, ok := r.(map[string]any)
+		if !ok {
+			continue
+		}
+		if opts.StripMedia {
+			delete(item, "images")
+			delete(item, "favicon")
+		}
+		if opts.MaxResultChars > 0 {
+			for _, field := range []string{"content", "raw_content"} {
+				s, ok := item[field].(string)
+				if !ok {
+					continue
+				}
+				if cut, truncated := truncateRunes(s, opts.MaxResultChars); truncated {
+					item[field] = cut
+					item["truncated"] = true
+				}
+			}
+		}
+	}
+	if opts.Markdown {
+		if md, ok := renderMarkdown(path, parsed); ok {
+			return md, true
+		}
+	}
+	if !opts.StripMedia && opts.MaxResultChars <= 0 {
+		return "", false
+	}
+	raw, err := json.Marshal(parsed)
+	if err != nil {
+		return "", false
+	}
+	return string(raw), true
+}
+
+func renderMarkdown(path string, body map[string]any) (string, bool) {
+	results, _ := body["results"].([]any)
+	var b strings.Builder
+	switch path {
+	case "/search":
+		if q, _ := body["query"].(string); q != "" {
+			fmt.Fprintf(&b, "# Search: %s\n\n", q)
+		}
+		if answer, _ := body["answer"].(string); answer != "" {
+			fmt.Fprintf(&b, "**Answer:** %s\n\n", answer)
+		}
+		for i, r := range results {
+			item, _ := r.(map[string]any)
+			title, _ := item["title"].(string)
+			u, _ := item["url"].(string)
+			fmt.Fprintf(&b, "## %d. %s\n%s\n", i+1, title, u)
+			if date, _ := item["published_date"].(string); date != "" {
+				fmt.Fprintf(&b, "Published: %s\n", date)
+			}
+			if content, _ := item["content"].(string); content != "" {
+				fmt.Fprintf(&b, "\n%s\n", content)
+			}
+			if raw, _ := item["raw_content"].(string); raw != "" {
+				fmt.Fprintf(&b, "\n%s\n", raw)
+			}
+			b.WriteString("\n")
+		}
+		if len(results) == 0 {
+			b.WriteString("No results.\n")
+		}
+	case "/extract", "/crawl":
+		if base, _ := body["base_url"].(string); base != "" {
+			fmt.Fprintf(&b, "# Crawl: %s\n\n", base)
+		}
+		for _, r := range results {
+			item, _ := r.(map[string]any)
+			u, _ := item["url"].(string)
+			raw, _ := item["raw_content"].(string)
+			fmt.Fprintf(&b, "## %s\n\n%s\n\n", u, raw)
+		}
+		failed, _ := body["failed_results"].([]any)
+		if len(failed) > 0 {
+			b.WriteString("## Failed\n")
+			for _, f := range failed {
+				item, _ := f.(map[string]any)
+				fmt.Fprintf(&b, "- %v: %v\n", item["url"], item["error"])
+			}
+		}
+	case "/map":
+		if base, _ := body["base_url"].(string); base != "" {
+			fmt.Fprintf(&b, "# Map: %s\n\n", base)
+		}
+		for _, r := range results {
+			fmt.Fprintf(&b, "- %v\n", r)
+		}
+	default:
+		return "", false
+	}
+	return strings.TrimRight(b.String(), "\n") + "\n", true
+}
+
+// outputShaper applies the output settings to tool results.
+type outputShaper struct {
+	settings *services.SettingsService
+	store    *continuationStore
+}
+
+func newOutputShaper(settings *services.SettingsService) outputShaper {
+	return outputShaper{settings: settings, store: newContinuationStore()}
+}
+
+// result builds the tool result for a successful upstream response. parsed is
+// nil when the body is not a JSON object.
+func (o outputShaper) result(ctx context.Context, path string, body []byte, parsed map[string]any) *mcp.CallToolResult {
+	opts := loadOutputOptions(ctx, o.settings)
+	text := string(body)
+	var structured any = parsed
+	if parsed == nil {
+		structured = map[string]any{"raw": text}
+	} else if shaped, changed := shapeResponse(path, parsed, opts); changed {
+		text = shaped
+	}
+	if paged, meta := o.store.paginate(text, opts); meta != nil {
+		// The full structured copy would defeat the budget.
+		text, structured = paged, meta
+	}
+	return &mcp.CallToolResult{
+		Content:           []mcp.Content{&mcp.TextContent{Text: text}},
+		StructuredContent: structured,
+	}
+}
+
+// continuationStore keeps the unread tail of large tool outputs for a short
+// time. It is per process, so with several replicas a token only works on the
+// replica that issued it.
+type continuationStore struct {
+	mu      sync.Mutex
+	entries map[string]continuationEntry
+}
+
+type continuationEntry struct {
+	rest    string
+	expires time.Time
+}
+
+func newContinuationStore() *continuationStore {
+	return &continuationStore{entries: map[string]continuationEntry{}}
+}
+
+func (s *continuationStore) put(rest string, now time.Time) (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	token := hex.EncodeToString(buf)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var oldest string
+	for k, e := range s.entries {
+		if !e.expires.After(now) {
+			delete(s.entries, k)
+		} else if oldest == "" || e.expires.Before(s.entries[oldest].expires) {
+			oldest = k
+		}
+	}
+	if len(s.entries) >= maxContinuationEntries {
+		delete(s.entries, oldest)
+	}
+	s.entries[token] = continuationEntry{rest: rest, expires: now.Add(continuationTTL)}
+	return token, nil
+}
+
+// take removes and returns the text stored under token; tokens are single use.
+func (s *continuationStore) take(token string, now time.Time) (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	e, ok := s.entries[token]
+	delete(s.entries, token)
+	if !ok || !e.expires.After(now) {
+		return "", false
+	}
+	return e.rest, true
+}
+
+// paginate cuts text to opts.MaxChars. The rest is stored for tavily-continue
+// when continuation is enabled, and dropped otherwise.
+func (s *continuationStore) paginate(text string, opts outputOptions) (string, map[string]any) {
+	if opts.MaxChars <= 0 {
+		return text, nil
+	}
+	runes := []rune(text)
+	if len(runes) <= opts.MaxChars {
+		return text, nil
+	}
+	head, rest := string(runes[:opts.MaxChars]), string(runes[opts.MaxChars:])
+	remaining := len(runes) - opts.MaxChars
+	if opts.Continuation {
+		if token, err := s.put(rest, time.Now()); err == nil {
+			return head + fmt.Sprintf("\n\n[Output truncated: %d more characters. Call tavily-continue with {\"token\": %q} within %s to read more.]", remaining, token, continuationTTL),
+				map[string]any{"truncated": true, "remaining_chars": remaining, "continuation_token": token}
+		}
+	}
+	return head + fmt.Sprintf("\n\n[Output truncated: %d characters omitted.]", remaining),
+		map[string]any{"truncated": true, "remaining_chars": remaining}
+}
+
+func addContinueTool(server *mcp.Server, output outputShaper) {
+	server.AddTool(&mcp.Tool{
+		Name:        "tavily-continue",
+		Description: "Read the next part of a tool result that was truncated. Pass the token from the truncation notice; each token can be used once.",
+		InputSchema: objectSchema([]string{"token"}, map[string]any{
+			"token": map[string]any{"type": "string", "description": "Continuation token from a truncated result."},
+		}),
+	}, func(ctx context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		var args struct {
+			Token string `json:"token"`
+		}
+		if err := json.Unmarshal(req.Params.Arguments, &args); err != nil || args.Token == "" {
+			return toolError("token is required"), nil
+		}
+		rest, ok := output.store.take(args.Token, time.Now())
+		if !ok {
+			return toolError("unknown or expired continuation token"), nil
+		}
+		opts := loadOutputOptions(ctx, output.settings)
+		opts.Continuation = true
+		text, meta := output.store.paginate(rest, opts)
+		result := &mcp.CallToolResult{Content: []mcp.Content{&mcp.TextContent{Text: text}}}
+		if meta != nil {
+			result.StructuredContent = meta
+		}
+		return result, nil
+	})
+}
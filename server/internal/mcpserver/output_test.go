@@ -0,0 +1,130 @@
+package mcpserver
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"tavily-proxy/server/internal/db"
+	"tavily-proxy/server/internal/services"
+)
+
+func TestShapeResponse_StripsMediaAndBudgetsResults(t *testing.T) {
+	t.Parallel()
+
+	body := map[string]any{
+		"query":  "go generics",
+		"images": []any{"https://img.example/1.png"},
+		"results": []any{
+			map[string]any{"title": "Intro", "url": "https://go.dev/a", "content": strings.Repeat("x", 50), "favicon": "https://go.dev/favicon.ico"},
+		},
+	}
+	text, changed := shapeResponse("/search", body, outputOptions{StripMedia: true, MaxResultChars: 10, Markdown: true})
+	if !changed {
+		t.Fatalf("expected the body to be reshaped")
+	}
+	if strings.Contains(text, "img.example") || strings.Contains(text, "favicon") {
+		t.Fatalf("media should be stripped: %s", text)
+	}
+	if !strings.Contains(text, "# Search: go generics") || !strings.Contains(text, "## 1. Intro\nhttps://go.dev/a") {
+		t.Fatalf("unexpected markdown: %s", text)
+	}
+	if !strings.Contains(text, strings.Repeat("x", 10)+"…") || strings.Contains(text, strings.Repeat("x", 11)) {
+		t.Fatalf("content should be cut to the per-result budget: %s", text)
+	}
+
+	if _, changed := shapeResponse("/search", map[string]any{"results": []any{}}, outputOptions{}); changed {
+		t.Fatalf("zero options must leave the body untouched")
+	}
+}
+
+func TestProxyTool_PaginatesWithContinuationToken(t *testing.T) {
+	t.Parallel()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	database, err := db.Open(filepath.Join(t.TempDir(), "app.db"))
+	if err != nil {
+		t.Fatalf("db open: %v", err)
+	}
+	sqlDB, err := database.DB()
+	if err != nil {
+		t.Fatalf("db handle: %v", err)
+	}
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	page := strings.Repeat("abcdefghij", 25)
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]any{
+			"base_url": "https://docs.example",
+			"results":  []any{map[string]any{"url": "https://docs.example/a", "raw_content": page}},
+		})
+	}))
+	t.Cleanup(upstream.Close)
+
+	ctx := context.Background()
+	keys := services.NewKeyService(database, logger)
+	if _, err := keys.Create(ctx, "tvly-key", "k", 100); err != nil {
+		t.Fatalf("create key: %v", err)
+	}
+	settings := services.NewSettingsService(database)
+	if _, err := settings.Apply(ctx, map[string]string{
+		services.SettingMCPOutputMarkdown: "true",
+		services.SettingMCPOutputMaxChars: "120",
+	}, "test"); err != nil {
+		t.Fatalf("apply settings: %v", err)
+	}
+	server := newServer(Dependencies{
+		Proxy:    services.NewTavilyProxy(upstream.URL, 5*time.Second, keys, nil, nil, logger),
+		Settings: settings,
+	}, false)
+	serverTransport, clientTransport := mcp.NewInMemoryTransports()
+	if _, err := server.Connect(ctx, serverTransport, nil); err != nil {
+		t.Fatalf("server connect: %v", err)
+	}
+	session, err := mcp.NewClient(&mcp.Implementation{Name: "test", Version: "0"}, nil).Connect(ctx, clientTransport, nil)
+	if err != nil {
+		t.Fatalf("client connect: %v", err)
+	}
+	t.Cleanup(func() { _ = session.Close() })
+
+	call := func(name string, args map[string]any) (*mcp.CallToolResult, string) {
+		res, err := session.CallTool(ctx, &mcp.CallToolParams{Name: name, Arguments: args})
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		return res, res.Content[0].(*mcp.TextContent).Text
+	}
+	token := func(res *mcp.CallToolResult) string {
+		meta, _ := res.StructuredContent.(map[string]any)
+		s, _ := meta["continuation_token"].(string)
+		return s
+	}
+
+	res, text := call("tavily-crawl", map[string]any{"url": "https://docs.example"})
+	if !strings.HasPrefix(text, "# Crawl: https://docs.example") || !strings.Contains(text, "Call tavily-continue") || token(res) == "" {
+		t.Fatalf("expected a truncated markdown page with a token: %s", text)
+	}
+	full := strings.SplitN(text, "\n\n[Output truncated", 2)[0]
+	for next := token(res); next != ""; next = token(res) {
+		res, text = call("tavily-continue", map[string]any{"token": next})
+		if res.IsError {
+			t.Fatalf("continue: %s", text)
+		}
+		full += strings.SplitN(text, "\n\n[Output truncated", 2)[0]
+		if again, _ := call("tavily-continue", map[string]any{"token": next}); !again.IsError {
+			t.Fatalf("continuation tokens must be single use")
+		}
+	}
+	if !strings.Contains(full, page) {
+		t.Fatalf("pages should reassemble the whole output: %q", full)
+	}
+}
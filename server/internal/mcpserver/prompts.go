@@ -0,0 +1,89 @@
+package mcpserver
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+const defaultResearchSources = 3
+
+func addPrompts(server *mcp.Server) {
+	server.AddPrompt(&mcp.Prompt{
+		Name:        "research-topic",
+		Title:       "Research a topic",
+		Description: "Search for a topic, extract the top results and write a summary with citations.",
+		Arguments: []*mcp.PromptArgument{
+			{Name: "topic", Description: "What to research.", Required: true},
+			{Name: "sources", Description: fmt.Sprintf("How many top results to extract (1-10, default %d).", defaultResearchSources)},
+		},
+	}, func(_ context.Context, req *mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+		topic := strings.TrimSpace(req.Params.Arguments["topic"])
+		if topic == "" {
+			return nil, fmt.Errorf("argument topic is required")
+		}
+		sources := defaultResearchSources
+		if raw := strings.TrimSpace(req.Params.Arguments["sources"]); raw != "" {
+			n, err := strconv.Atoi(raw)
+			if err != nil || n < 1 || n > 10 {
+				return nil, fmt.Errorf("argument sources must be a number between 1 and 10")
+			}
+			sources = n
+		}
+		return userPrompt("Research "+topic, fmt.Sprintf(
+			"Research the following topic: %s\n\n"+
+				"1. Call tavily-search with the topic as the query, search_depth \"advanced\" and max_results %d.\n"+
+				"2. Pick the %d most relevant results, preferring distinct sites, and call tavily-extract with their URLs.\n"+
+				"3. Write a concise summary of what the sources say. Cite every claim with the source URL in brackets, note where sources disagree, and end with a list of the sources used.",
+			topic, sources*2, sources)), nil
+	})
+
+	server.AddPrompt(&mcp.Prompt{
+		Name:        "news-briefing",
+		Title:       "News briefing",
+		Description: "Summarize recent news on a topic.",
+		Arguments: []*mcp.PromptArgument{
+			{Name: "topic", Description: "The news topic.", Required: true},
+			{Name: "time_range", Description: "day, week or month (default day)."},
+		},
+	}, func(_ context.Context, req *mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+		topic := strings.TrimSpace(req.Params.Arguments["topic"])
+		if topic == "" {
+			return nil, fmt.Errorf("argument topic is required")
+		}
+		timeRange := strings.TrimSpace(req.Params.Arguments["time_range"])
+		switch timeRange {
+		case "":
+			timeRange = "day"
+		case "day", "week", "month":
+		default:
+			return nil, fmt.Errorf("argument time_range must be day, week or month")
+		}
+		return userPrompt("News briefing: "+topic, fmt.Sprintf(
+			"Prepare a news briefing on: %s\n\n"+
+				"Call tavily-search with the topic as the query, topic \"news\", time_range %q and max_results 10. "+
+				"Group the results into the main stories, give each story two or three sentences with its publication date, and link the source URL for each.",
+			topic, timeRange)), nil
+	})
+
+	server.AddPrompt(&mcp.Prompt{
+		Name:        "pool-health",
+		Title:       "Check key pool health",
+		Description: "Review the key pool's remaining quota and recent errors.",
+	}, func(context.Context, *mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+		return userPrompt("Key pool health", fmt.Sprintf(
+			"Read the resources %s, %s and %s. Report the remaining quota, keys that are exhausted, inactive or invalid, "+
+				"and any pattern in recent failed requests (non-2xx status codes). Suggest what the operator should do, if anything.",
+			poolStatusURI, keysQuotaURI, recentLogsURI)), nil
+	})
+}
+
+func userPrompt(description, text string) *mcp.GetPromptResult {
+	return &mcp.GetPromptResult{
+		Description: description,
+		Messages:    []*mcp.PromptMessage{{Role: "user", Content: &mcp.TextContent{Text: text}}},
+	}
+}
@@ -0,0 +1,393 @@
+package mcpserver
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+const (
+	defaultResearchMaxChars = 20000
+	defaultResearchTimeout  = 60 * time.Second
+	maxResearchTimeout      = 120 * time.Second
+)
+
+type researchArgs struct {
+	Query          string   `json:"query"`
+	MaxSources     int      `json:"max_sources"`
+	Topic          string   `json:"topic"`
+	SearchDepth    string   `json:"search_depth"`
+	TimeRange      string   `json:"time_range"`
+	IncludeDomains []string `json:"include_domains"`
+	ExcludeDomains []string `json:"exclude_domains"`
+	ExtractDepth   string   `json:"extract_depth"`
+	MaxChars       int      `json:"max_chars"`
+	TimeoutSeconds int      `json:"timeout_seconds"`
+}
+
+type searchHit struct {
+	Title   string `json:"title"`
+	URL     string `json:"url"`
+	Content string `json:"content"`
+}
+
+type researchSource struct {
+	Index     int    `json:"index"`
+	Title     string `json:"title"`
+	URL       string `json:"url"`
+	Content   string `json:"content"`
+	Extracted bool   `json:"extracted"`
+	Error     string `json:"error,omitempty"`
+}
+
+type researchResult struct {
+	Query     string           `json:"query"`
+	Sources   []researchSource `json:"sources"`
+	Partial   bool             `json:"partial"`
+	Truncated bool             `json:"truncated"`
+}
+
+// addResearchTool registers tavily-research, which runs a search and extracts
+// the top results in one call. Sources that are not extracted before the
+// timeout fall back to their search snippet; a search that times out returns
+// an empty partial result.
+func addResearchTool(server *mcp.Server, proxy proxyCaller) {
+	server.AddTool(&mcp.Tool{
+		Name:        "tavily-research",
+		Description: "Search a topic and extract the top results in one call (via Tavily Proxy Pool). Picks at most one result per domain, extracts them concurrently and returns their content with numbered citations. Costs one search plus one extract per source.",
+		InputSchema: tavilyResearchInputSchema,
+	}, func(ctx context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		var args researchArgs
+		if len(req.Params.Arguments) > 0 {
+			if err := json.Unmarshal(req.Params.Arguments, &args); err != nil {
+				return toolError("invalid arguments: " + err.Error()), nil
+			}
+		}
+		args.Query = strings.TrimSpace(args.Query)
+		if args.Query == "" {
+			return toolError("query is required"), nil
+		}
+		if args.MaxSources <= 0 {
+			args.MaxSources = defaultResearchSources
+		}
+		args.MaxSources = min(args.MaxSources, 10)
+		if args.MaxChars <= 0 {
+			args.MaxChars = defaultResearchMaxChars
+		}
+		timeout := defaultResearchTimeout
+		if args.TimeoutSeconds > 0 {
+			timeout = min(time.Duration(args.TimeoutSeconds)*time.Second, maxResearchTimeout)
+		}
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		total := float64(args.MaxSources + 1)
+		progress := func(done int, message string) {
+			token := req.Params.GetProgressToken()
+			if token == nil || req.Session == nil {
+				return
+			}
+			_ = req.Session.NotifyProgress(ctx, &mcp.ProgressNotificationParams{
+				ProgressToken: token,
+				Progress:      float64(done),
+				Total:         total,
+				Message:       message,
+			})
+		}
+
+		// The search gets at most half the budget so a slow search still
+		// leaves time to extract, and a timed-out one yields a partial result.
+		progress(0, "searching")
+		searchCtx, cancelSearch := context.WithTimeout(ctx, timeout/2)
+		hits, err := researchSearch(searchCtx, proxy, req, args)
+		timedOut := searchCtx.Err() != nil
+		cancelSearch()
+		if err != nil && !timedOut {
+			return toolError("search failed: " + err.Error()), nil
+		}
+		if err != nil {
+			result := researchResult{Query: args.Query, Sources: []researchSource{}, Partial: true}
+			return &mcp.CallToolResult{
+				Content:           []mcp.Content{&mcp.TextContent{Text: renderResearch(result)}},
+				StructuredContent: result,
+			}, nil
+		}
+		picked := pickSources(hits, args.MaxSources, args.IncludeDomains, args.ExcludeDomains)
+		total = float64(len(picked) + 1)
+		progress(1, fmt.Sprintf("extracting %d of %d results", len(picked), len(hits)))
+
+		result := researchResult{Query: args.Query, Sources: make([]researchSource, len(picked))}
+		type extracted struct {
+			index   int
+			content string
+			err     error
+		}
+		done := make(chan extracted, len(picked))
+		for i, hit := range picked {
+			result.Sources[i] = researchSource{Index: i + 1, Title: hit.Title, URL: hit.URL, Content: hit.Content}
+			go func(i int, u string) {
+				content, err := researchExtract(ctx, proxy, req, u, args.ExtractDepth)
+				done <- extracted{index: i, content: content, err: err}
+			}(i, hit.URL)
+		}
+
+	collect:
+		for n := range picked {
+			select {
+			case r := <-done:
+				src := &result.Sources[r.index]
+				if r.err != nil {
+					src.Error = r.err.Error()
+				} else {
+					src.Content, src.Extracted = r.content, true
+				}
+				progress(n+2, "extracted "+src.URL)
+			case <-ctx.Done():
+				result.Partial = true
+				break collect
+			}
+		}
+		for i := range result.Sources {
+			src := &result.Sources[i]
+			if !src.Extracted && src.Error == "" {
+				src.Error = "not extracted before the timeout"
+			}
+		}
+
+		if len(result.Sources) > 0 {
+			budget := args.MaxChars / len(result.Sources)
+			for i := range result.Sources {
+				var cut bool
+				result.Sources[i].Content, cut = truncateRunes(result.Sources[i].Content, budget)
+				result.Truncated = result.Truncated || cut
+			}
+		}
+
+		return &mcp.CallToolResult{
+			Content:           []mcp.Content{&mcp.TextContent{Text: renderResearch(result)}},
+			StructuredContent: result,
+		}, nil
+	})
+}
+
+func researchSearch(ctx context.Context, proxy proxyCaller, req *mcp.CallToolRequest, args researchArgs) ([]searchHit, error) {
+	body := map[string]any{
+		"query": args.Query,
+		// Over-fetch so there is something left after per-domain dedup.
+		"max_results": min(args.MaxSources*3, 20),
+	}
+	for k, v := range map[string]string{"topic": args.Topic, "search_depth": args.SearchDepth, "time_range": args.TimeRange} {
+		if v != "" {
+			body[k] = v
+		}
+	}
+	if len(args.IncludeDomains) > 0 {
+		body["include_domains"] = args.IncludeDomains
+	}
+	if len(args.ExcludeDomains) > 0 {
+		body["exclude_domains"] = args.ExcludeDomains
+	}
+	raw, _ := json.Marshal(body)
+	resp, err := proxy.call(ctx, req, http.MethodPost, "/search", raw)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("upstream status %d: %s", resp.StatusCode, resp.Body)
+	}
+	var parsed struct {
+		Results []searchHit `json:"results"`
+	}
+	if err := json.Unmarshal(resp.Body, &parsed); err != nil {
+		return nil, err
+	}
+	return parsed.Results, nil
+}
+
+func researchExtract(ctx context.Context, proxy proxyCaller, req *mcp.CallToolRequest, u, depth string) (string, error) {
+	body := map[string]any{"urls": []string{u}, "format": "markdown"}
+	if depth != "" {
+		body["extract_depth"] = depth
+	}
+	raw, _ := json.Marshal(body)
+	resp, err := proxy.call(ctx, req, http.MethodPost, "/extract", raw)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return "", fmt.Errorf("upstream status %d", resp.StatusCode)
+	}
+	var parsed struct {
+		Results []struct {
+			RawContent string `json:"raw_content"`
+		} `json:"results"`
+		FailedResults []struct {
+			Error string `json:"error"`
+		} `json:"failed_results"`
+	}
+	if err := json.Unmarshal(resp.Body, &parsed); err != nil {
+		return "", err
+	}
+	if len(parsed.Results) == 0 || parsed.Results[0].RawContent == "" {
+		if len(parsed.FailedResults) > 0 && parsed.FailedResults[0].Error != "" {
+			return "", errors.New(parsed.FailedResults[0].Error)
+		}
+		return "", errors.New("no content extracted")
+	}
+	return parsed.Results[0].RawContent, nil
+}
+
+// pickSources keeps hits in rank order, at most one per domain, honouring the
+// include/exclude lists even if the upstream search did not.
+func pickSources(hits []searchHit, n int, include, exclude []string) []searchHit {
+	seen := map[string]bool{}
+	var out []searchHit
+	for _, hit := range hits {
+		if len(out) == n {
+			break
+		}
+		host := hostOf(hit.URL)
+		if host == "" || seen[host] || matchesDomain(host, exclude) {
+			continue
+		}
+		if len(include) > 0 && !matchesDomain(host, include) {
+			continue
+		}
+		seen[host] = true
+		out = append(out, hit)
+	}
+	return out
+}
+
+func hostOf(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+}
+
+func matchesDomain(host string, domains []string) bool {
+	for _, d := range domains {
+		d = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(d)), "www.")
+		if d != "" && (host == d || strings.HasSuffix(host, "."+d)) {
+			return true
+		}
+	}
+	return false
+}
+
+func truncateRunes(s string, limit int) (string, bool) {
+	if limit <= 0 {
+		return "", s != ""
+	}
+	runes := []rune(s)
+	if len(runes) <= limit {
+		return s, false
+	}
+	return string(runes[:limit]) + "…", true
+}
+
+func renderResearch(r researchResult) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Research: %s\n\n", r.Query)
+	if len(r.Sources) == 0 && r.Partial {
+		b.WriteString("_Partial result: the search did not finish before the timeout._\n")
+		return b.String()
+	}
+	if len(r.Sources) == 0 {
+		b.WriteString("No results found.\n")
+		return b.String()
+	}
+	if r.Partial {
+		b.WriteString("_Partial result: some sources were not extracted before the timeout; their search snippets are shown instead._\n\n")
+	}
+	for _, s := range r.Sources {
+		fmt.Fprintf(&b, "## [%d] %s\n%s\n\n%s\n\n", s.Index, s.Title, s.URL, s.Content)
+	}
+	b.WriteString("## Sources\n")
+	for _, s := range r.Sources {
+		fmt.Fprintf(&b, "[%d] %s — %s\n", s.Index, s.Title, s.URL)
+	}
+	return b.String()
+}
+
+func toolError(message string) *mcp.CallToolResult {
+	return &mcp.CallToolResult{
+		IsError:           true,
+		Content:           []mcp.Content{&mcp.TextContent{Text: message}},
+		StructuredContent: map[string]any{"error": message},
+	}
+}
+
+var tavilyResearchInputSchema = map[string]any{
+	"type":                 "object",
+	"additionalProperties": false,
+	"required":             []string{"query"},
+	"properties": map[string]any{
+		"query": map[string]any{
+			"type":        "string",
+			"description": "The research question or topic.",
+		},
+		"max_sources": map[string]any{
+			"type":        "integer",
+			"minimum":     1,
+			"maximum":     10,
+			"default":     defaultResearchSources,
+			"description": "How many top results to extract, at most one per domain.",
+		},
+		"topic": map[string]any{
+			"type":        "string",
+			"enum":        []string{"general", "news", "finance"},
+			"default":     "general",
+			"description": "Search topic/category.",
+		},
+		"search_depth": map[string]any{
+			"type":        "string",
+			"enum":        []string{"advanced", "basic", "fast", "ultra-fast"},
+			"default":     "basic",
+			"description": "Search depth; advanced costs 2 credits.",
+		},
+		"time_range": map[string]any{
+			"type":        "string",
+			"enum":        []string{"day", "week", "month", "year", "d", "w", "m", "y"},
+			"description": "Only consider results published within this window.",
+		},
+		"include_domains": map[string]any{
+			"type":        "array",
+			"items":       map[string]any{"type": "string"},
+			"description": "Only use sources from these domains (subdomains included).",
+		},
+		"exclude_domains": map[string]any{
+			"type":        "array",
+			"items":       map[string]any{"type": "string"},
+			"description": "Never use sources from these domains (subdomains included).",
+		},
+		"extract_depth": map[string]any{
+			"type":        "string",
+			"enum":        []string{"basic", "advanced"},
+			"default":     "basic",
+			"description": "Depth of extraction for each source.",
+		},
+		"max_chars": map[string]any{
+			"type":        "integer",
+			"minimum":     1000,
+			"default":     defaultResearchMaxChars,
+			"description": "Upper bound on the returned content, split evenly across sources.",
+		},
+		"timeout_seconds": map[string]any{
+			"type":        "integer",
+			"minimum":     1,
+			"maximum":     int(maxResearchTimeout / time.Second),
+			"default":     int(defaultResearchTimeout / time.Second),
+			"description": "Overall time limit. Sources not extracted in time fall back to their search snippet.",
+		},
+	},
+}
@@ -0,0 +1,219 @@
+package mcpserver
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"tavily-proxy/server/internal/db"
+	"tavily-proxy/server/internal/services"
+)
+
+func TestResearchTool_DedupsExtractsAndReturnsPartialOnTimeout(t *testing.T) {
+	t.Parallel()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	database, err := db.Open(filepath.Join(t.TempDir(), "app.db"))
+	if err != nil {
+		t.Fatalf("db open: %v", err)
+	}
+	sqlDB, err := database.DB()
+	if err != nil {
+		t.Fatalf("db handle: %v", err)
+	}
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	var mu sync.Mutex
+	var searchBody map[string]any
+	var extracted []string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]any
+		_ = json.NewDecoder(r.Body).Decode(&body)
+		switch r.URL.Path {
+		case "/search":
+			mu.Lock()
+			searchBody = body
+			mu.Unlock()
+			_ = json.NewEncoder(w).Encode(map[string]any{"results": []map[string]string{
+				{"title": "A1", "url": "https://a.com/1", "content": "snippet a1"},
+				{"title": "A2", "url": "https://www.a.com/2", "content": "snippet a2"},
+				{"title": "Ads", "url": "https://ads.c.com/x", "content": "snippet c"},
+				{"title": "B", "url": "https://b.com/x", "content": "snippet b"},
+				{"title": "Slow", "url": "https://slow.com/", "content": "snippet slow"},
+			}})
+		case "/extract":
+			u := body["urls"].([]any)[0].(string)
+			mu.Lock()
+			extracted = append(extracted, u)
+			mu.Unlock()
+			if u == "https://slow.com/" {
+				select {
+				case <-r.Context().Done():
+				case <-time.After(5 * time.Second):
+				}
+				return
+			}
+			_ = json.NewEncoder(w).Encode(map[string]any{"results": []map[string]string{
+				{"url": u, "raw_content": "full text of " + u + strings.Repeat(" more", 100)},
+			}})
+		}
+	}))
+	t.Cleanup(upstream.Close)
+
+	ctx := context.Background()
+	keys := services.NewKeyService(database, logger)
+	if _, err := keys.Create(ctx, "tvly-key", "k", 100); err != nil {
+		t.Fatalf("create key: %v", err)
+	}
+	server := newServer(Dependencies{Proxy: services.NewTavilyProxy(upstream.URL, 5*time.Second, keys, nil, nil, logger)}, false)
+
+	var progress []string
+	var progressMu sync.Mutex
+	client := mcp.NewClient(&mcp.Implementation{Name: "test", Version: "0"}, &mcp.ClientOptions{
+		ProgressNotificationHandler: func(_ context.Context, req *mcp.ProgressNotificationClientRequest) {
+			progressMu.Lock()
+			progress = append(progress, req.Params.Message)
+			progressMu.Unlock()
+		},
+	})
+	serverTransport, clientTransport := mcp.NewInMemoryTransports()
+	if _, err := server.Connect(ctx, serverTransport, nil); err != nil {
+		t.Fatalf("server connect: %v", err)
+	}
+	session, err := client.Connect(ctx, clientTransport, nil)
+	if err != nil {
+		t.Fatalf("client connect: %v", err)
+	}
+	t.Cleanup(func() { _ = session.Close() })
+
+	params := &mcp.CallToolParams{Meta: mcp.Meta{}, Name: "tavily-research", Arguments: map[string]any{
+		"query":           "q",
+		"max_sources":     3,
+		"exclude_domains": []string{"c.com"},
+		"max_chars":       300,
+		"timeout_seconds": 1,
+	}}
+	params.SetProgressToken("research-1")
+	res, err := session.CallTool(ctx, params)
+	if err != nil || res.IsError {
+		t.Fatalf("call: %v %+v", err, res)
+	}
+
+	var result researchResult
+	raw, _ := json.Marshal(res.StructuredContent)
+	if err := json.Unmarshal(raw, &result); err != nil {
+		t.Fatalf("decode result: %v", err)
+	}
+	if len(result.Sources) != 3 || result.Sources[0].URL != "https://a.com/1" || result.Sources[1].URL != "https://b.com/x" {
+		t.Fatalf("expected one source per domain without excluded ones: %+v", result.Sources)
+	}
+	if !result.Partial || !result.Truncated {
+		t.Fatalf("expected a partial, truncated result: %+v", result)
+	}
+	slow := result.Sources[2]
+	if slow.Extracted || slow.Content != "snippet slow" || slow.Error == "" {
+		t.Fatalf("timed out source should fall back to its snippet: %+v", slow)
+	}
+	if !result.Sources[0].Extracted || len([]rune(result.Sources[0].Content)) > 101 {
+		t.Fatalf("content should be extracted and bounded: %+v", result.Sources[0])
+	}
+	text := res.Content[0].(*mcp.TextContent).Text
+	if !strings.Contains(text, "[2] B — https://b.com/x") || !strings.Contains(text, "Partial result") {
+		t.Fatalf("unexpected rendering: %s", text)
+	}
+
+	mu.Lock()
+	if searchBody["max_results"] != float64(9) || len(extracted) != 3 {
+		t.Fatalf("unexpected upstream calls: %v %v", searchBody, extracted)
+	}
+	mu.Unlock()
+	// Notifications are delivered asynchronously.
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		progressMu.Lock()
+		got := append([]string(nil), progress...)
+		progressMu.Unlock()
+		if len(got) >= 3 && got[0] == "searching" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("expected progress notifications, got %q", got)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestResearchTool_SlowSearchReturnsPartialResult(t *testing.T) {
+	t.Parallel()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	database, err := db.Open(filepath.Join(t.TempDir(), "app.db"))
+	if err != nil {
+		t.Fatalf("db open: %v", err)
+	}
+	sqlDB, err := database.DB()
+	if err != nil {
+		t.Fatalf("db handle: %v", err)
+	}
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-r.Context().Done():
+		case <-release:
+		}
+	}))
+	t.Cleanup(upstream.Close)
+	t.Cleanup(func() { close(release) })
+
+	ctx := context.Background()
+	keys := services.NewKeyService(database, logger)
+	if _, err := keys.Create(ctx, "tvly-key", "k", 100); err != nil {
+		t.Fatalf("create key: %v", err)
+	}
+	server := newServer(Dependencies{Proxy: services.NewTavilyProxy(upstream.URL, 5*time.Second, keys, nil, nil, logger)}, false)
+	serverTransport, clientTransport := mcp.NewInMemoryTransports()
+	if _, err := server.Connect(ctx, serverTransport, nil); err != nil {
+		t.Fatalf("server connect: %v", err)
+	}
+	session, err := mcp.NewClient(&mcp.Implementation{Name: "test", Version: "0"}, nil).Connect(ctx, clientTransport, nil)
+	if err != nil {
+		t.Fatalf("client connect: %v", err)
+	}
+	t.Cleanup(func() { _ = session.Close() })
+
+	started := time.Now()
+	res, err := session.CallTool(ctx, &mcp.CallToolParams{Name: "tavily-research", Arguments: map[string]any{
+		"query":           "q",
+		"timeout_seconds": 2,
+	}})
+	if err != nil || res.IsError {
+		t.Fatalf("a slow search should not fail the call: %v %+v", err, res)
+	}
+	// The search only gets half the budget.
+	if elapsed := time.Since(started); elapsed > 1500*time.Millisecond {
+		t.Fatalf("search ran past its share of the timeout: %s", elapsed)
+	}
+	var result researchResult
+	raw, _ := json.Marshal(res.StructuredContent)
+	if err := json.Unmarshal(raw, &result); err != nil {
+		t.Fatalf("decode result: %v", err)
+	}
+	if !result.Partial || len(result.Sources) != 0 {
+		t.Fatalf("expected an empty partial result: %+v", result)
+	}
+	if text := res.Content[0].(*mcp.TextContent).Text; !strings.Contains(text, "Partial result") {
+		t.Fatalf("unexpected rendering: %s", text)
+	}
+}
@@ -0,0 +1,272 @@
+package mcpserver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"tavily-proxy/server/internal/models"
+	"tavily-proxy/server/internal/services"
+	"tavily-proxy/server/internal/util"
+)
+
+const (
+	poolStatusURI       = "tavily-proxy://pool/status"
+	recentLogsURI       = "tavily-proxy://logs/recent"
+	keysQuotaURI        = "tavily-proxy://keys/quota"
+	keyQuotaURITemplate = "tavily-proxy://keys/{id}/quota"
+
+	recentLogsLimit = 20
+
+	// quotaNotifyInterval coalesces quota notifications; every proxied request
+	// changes a key's usage, so subscribers get at most one update per resource
+	// per interval.
+	quotaNotifyInterval = time.Second
+)
+
+type keyQuota struct {
+	ID         uint       `json:"id"`
+	KeyMasked  string     `json:"key_masked"`
+	Alias      string     `json:"alias"`
+	TotalQuota int        `json:"total_quota"`
+	UsedQuota  int        `json:"used_quota"`
+	Remaining  int        `json:"remaining_quota"`
+	IsActive   bool       `json:"is_active"`
+	IsInvalid  bool       `json:"is_invalid"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+}
+
+func newKeyQuota(k models.APIKey) keyQuota {
+	return keyQuota{
+		ID:         k.ID,
+		KeyMasked:  util.MaskAPIKey(k.Key),
+		Alias:      k.Alias,
+		TotalQuota: k.TotalQuota,
+		UsedQuota:  k.UsedQuota,
+		Remaining:  max(k.TotalQuota-k.UsedQuota, 0),
+		IsActive:   k.IsActive,
+		IsInvalid:  k.IsInvalid,
+		LastUsedAt: k.LastUsedAt,
+	}
+}
+
+// logSummary leaves out request and response bodies, which may be large and
+// contain user data.
+type logSummary struct {
+	ID         uint      `json:"id"`
+	RequestID  string    `json:"request_id"`
+	KeyUsed    uint      `json:"key_used"`
+	KeyAlias   string    `json:"key_alias"`
+	Endpoint   string    `json:"endpoint"`
+	StatusCode int       `json:"status_code"`
+	LatencyMs  int64     `json:"latency"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+func newLogSummary(l models.RequestLog) logSummary {
+	return logSummary{
+		ID:         l.ID,
+		RequestID:  l.RequestID,
+		KeyUsed:    l.KeyUsed,
+		KeyAlias:   l.KeyAlias,
+		Endpoint:   l.Endpoint,
+		StatusCode: l.StatusCode,
+		LatencyMs:  l.LatencyMs,
+		CreatedAt:  l.CreatedAt,
+	}
+}
+
+func addResources(server *mcp.Server, deps Dependencies) {
+	if deps.Stats != nil {
+		server.AddResource(&mcp.Resource{
+			URI:         poolStatusURI,
+			Name:        "pool-status",
+			Title:       "Key pool status",
+			Description: "Total, used and remaining quota across the key pool, key counts and today's request count. Supports subscriptions.",
+			MIMEType:    "application/json",
+		}, func(ctx context.Context, req *mcp.ReadResourceRequest) (*mcp.ReadResourceResult, error) {
+			stats, err := deps.Stats.Get(ctx)
+			if err != nil {
+				return nil, err
+			}
+			return jsonResource(req.Params.URI, stats)
+		})
+	}
+
+	if deps.Logs != nil {
+		server.AddResource(&mcp.Resource{
+			URI:         recentLogsURI,
+			Name:        "recent-logs",
+			Title:       "Recent requests",
+			Description: fmt.Sprintf("The %d most recent proxied requests without request or response bodies.", recentLogsLimit),
+			MIMEType:    "application/json",
+		}, func(ctx context.Context, req *mcp.ReadResourceRequest) (*mcp.ReadResourceResult, error) {
+			logs, err := deps.Logs.List(ctx, 1, recentLogsLimit, nil)
+			if err != nil {
+				return nil, err
+			}
+			items := make([]logSummary, 0, len(logs.Items))
+			for _, l := range logs.Items {
+				items = append(items, newLogSummary(l))
+			}
+			return jsonResource(req.Params.URI, map[string]any{"items": items, "total": logs.Total})
+		})
+	}
+
+	if deps.Keys != nil {
+		server.AddResource(&mcp.Resource{
+			URI:         keysQuotaURI,
+			Name:        "keys-quota",
+			Title:       "Per-key quota",
+			Description: "Quota and state of every key in the pool, with keys masked. Supports subscriptions.",
+			MIMEType:    "application/json",
+		}, func(ctx context.Context, req *mcp.ReadResourceRequest) (*mcp.ReadResourceResult, error) {
+			keys, err := deps.Keys.List(ctx)
+			if err != nil {
+				return nil, err
+			}
+			items := make([]keyQuota, 0, len(keys))
+			for _, k := range keys {
+				items = append(items, newKeyQuota(k))
+			}
+			return jsonResource(req.Params.URI, map[string]any{"items": items})
+		})
+		server.AddResourceTemplate(&mcp.ResourceTemplate{
+			URITemplate: keyQuotaURITemplate,
+			Name:        "key-quota",
+			Title:       "Key quota",
+			Description: "Quota and state of a single key by id, with the key masked. Supports subscriptions.",
+			MIMEType:    "application/json",
+		}, func(ctx context.Context, req *mcp.ReadResourceRequest) (*mcp.ReadResourceResult, error) {
+			id, ok := parseKeyQuotaURI(req.Params.URI)
+			if !ok {
+				return nil, mcp.ResourceNotFoundError(req.Params.URI)
+			}
+			key, err := deps.Keys.Get(ctx, id)
+			if err != nil {
+				return nil, mcp.ResourceNotFoundError(req.Params.URI)
+			}
+			return jsonResource(req.Params.URI, newKeyQuota(*key))
+		})
+	}
+}
+
+func jsonResource(uri string, v any) (*mcp.ReadResourceResult, error) {
+	raw, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return &mcp.ReadResourceResult{
+		Contents: []*mcp.ResourceContents{{URI: uri, MIMEType: "application/json", Text: string(raw)}},
+	}, nil
+}
+
+func keyQuotaURI(id uint) string {
+	return fmt.Sprintf("tavily-proxy://keys/%d/quota", id)
+}
+
+func parseKeyQuotaURI(uri string) (uint, bool) {
+	rest, ok := strings.CutPrefix(uri, "tavily-proxy://keys/")
+	if !ok {
+		return 0, false
+	}
+	rest, ok = strings.CutSuffix(rest, "/quota")
+	if !ok {
+		return 0, false
+	}
+	id, err := strconv.ParseUint(rest, 10, 64)
+	if err != nil || id == 0 {
+		return 0, false
+	}
+	return uint(id), true
+}
+
+// quotaNotifier turns KeyService quota changes into resources/updated
+// notifications for subscribed sessions.
+type quotaNotifier struct {
+	keys     *services.KeyService
+	interval time.Duration
+
+	mu      sync.Mutex
+	server  *mcp.Server
+	pending map[uint]struct{}
+	all     bool
+	timer   *time.Timer
+}
+
+func newQuotaNotifier(keys *services.KeyService) *quotaNotifier {
+	return &quotaNotifier{keys: keys, interval: quotaNotifyInterval, pending: map[uint]struct{}{}}
+}
+
+func (n *quotaNotifier) attach(server *mcp.Server) {
+	n.mu.Lock()
+	n.server = server
+	n.mu.Unlock()
+	n.keys.OnQuotaChange(n.changed)
+}
+
+func (n *quotaNotifier) subscribe(ctx context.Context, req *mcp.SubscribeRequest) error {
+	uri := req.Params.URI
+	switch uri {
+	case poolStatusURI, keysQuotaURI:
+		return nil
+	case recentLogsURI:
+		return fmt.Errorf("resource %s does not support subscriptions", uri)
+	}
+	id, ok := parseKeyQuotaURI(uri)
+	if !ok {
+		return mcp.ResourceNotFoundError(uri)
+	}
+	if _, err := n.keys.Get(ctx, id); err != nil {
+		return mcp.ResourceNotFoundError(uri)
+	}
+	return nil
+}
+
+// changed is called by KeyService; keyID 0 means several keys changed.
+func (n *quotaNotifier) changed(keyID uint) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if keyID == 0 {
+		n.all = true
+	} else {
+		n.pending[keyID] = struct{}{}
+	}
+	if n.timer == nil {
+		n.timer = time.AfterFunc(n.interval, n.flush)
+	}
+}
+
+func (n *quotaNotifier) flush() {
+	n.mu.Lock()
+	server, pending, all := n.server, n.pending, n.all
+	n.pending, n.all, n.timer = map[uint]struct{}{}, false, nil
+	n.mu.Unlock()
+	if server == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if all {
+		keys, err := n.keys.List(ctx)
+		if err == nil {
+			for _, k := range keys {
+				pending[k.ID] = struct{}{}
+			}
+		}
+	}
+	uris := []string{poolStatusURI, keysQuotaURI}
+	for id := range pending {
+		uris = append(uris, keyQuotaURI(id))
+	}
+	for _, uri := range uris {
+		_ = server.ResourceUpdated(ctx, &mcp.ResourceUpdatedNotificationParams{URI: uri})
+	}
+}
@@ -0,0 +1,137 @@
+package mcpserver
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"tavily-proxy/server/internal/db"
+	"tavily-proxy/server/internal/services"
+)
+
+func TestResources_ReadAndSubscribe(t *testing.T) {
+	t.Parallel()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	database, err := db.Open(filepath.Join(t.TempDir(), "app.db"))
+	if err != nil {
+		t.Fatalf("db open: %v", err)
+	}
+	sqlDB, err := database.DB()
+	if err != nil {
+		t.Fatalf("db handle: %v", err)
+	}
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	ctx := context.Background()
+	keys := services.NewKeyService(database, logger)
+	key, err := keys.Create(ctx, "tvly-abcdefghijklmnop", "primary", 100)
+	if err != nil {
+		t.Fatalf("create key: %v", err)
+	}
+
+	server := newServer(Dependencies{
+		Stats: services.NewStatsService(database),
+		Logs:  services.NewLogService(database, logger),
+		Keys:  keys,
+	}, true)
+	updated := make(chan string, 16)
+	client := mcp.NewClient(&mcp.Implementation{Name: "test", Version: "0"}, &mcp.ClientOptions{
+		ResourceUpdatedHandler: func(_ context.Context, req *mcp.ResourceUpdatedNotificationRequest) {
+			updated <- req.Params.URI
+		},
+	})
+	serverTransport, clientTransport := mcp.NewInMemoryTransports()
+	if _, err := server.Connect(ctx, serverTransport, nil); err != nil {
+		t.Fatalf("server connect: %v", err)
+	}
+	session, err := client.Connect(ctx, clientTransport, nil)
+	if err != nil {
+		t.Fatalf("client connect: %v", err)
+	}
+	t.Cleanup(func() { _ = session.Close() })
+
+	resources, err := session.ListResources(ctx, nil)
+	if err != nil || len(resources.Resources) != 3 {
+		t.Fatalf("list resources: %v %v", resources, err)
+	}
+	prompts, err := session.ListPrompts(ctx, nil)
+	if err != nil || len(prompts.Prompts) != 3 {
+		t.Fatalf("list prompts: %v %v", prompts, err)
+	}
+
+	keyURI := keyQuotaURI(key.ID)
+	read, err := session.ReadResource(ctx, &mcp.ReadResourceParams{URI: keyURI})
+	if err != nil {
+		t.Fatalf("read key quota: %v", err)
+	}
+	var quota keyQuota
+	if err := json.Unmarshal([]byte(read.Contents[0].Text), &quota); err != nil {
+		t.Fatalf("decode key quota: %v", err)
+	}
+	if quota.Remaining != 100 || strings.Contains(read.Contents[0].Text, "abcdefghijklmnop") {
+		t.Fatalf("unexpected key quota: %s", read.Contents[0].Text)
+	}
+	if _, err := session.ReadResource(ctx, &mcp.ReadResourceParams{URI: keyQuotaURI(key.ID + 1)}); err == nil {
+		t.Fatalf("unknown key must not be readable")
+	}
+
+	if err := session.Subscribe(ctx, &mcp.SubscribeParams{URI: recentLogsURI}); err == nil {
+		t.Fatalf("recent logs must not accept subscriptions")
+	}
+	for _, uri := range []string{poolStatusURI, keyURI} {
+		if err := session.Subscribe(ctx, &mcp.SubscribeParams{URI: uri}); err != nil {
+			t.Fatalf("subscribe %s: %v", uri, err)
+		}
+	}
+
+	// A burst of usage is coalesced into one notification per resource.
+	for range 5 {
+		if err := keys.IncrementUsed(ctx, key.ID); err != nil {
+			t.Fatalf("increment: %v", err)
+		}
+	}
+	got := map[string]int{}
+	timeout := time.After(5 * time.Second)
+	for len(got) < 2 {
+		select {
+		case uri := <-updated:
+			got[uri]++
+		case <-timeout:
+			t.Fatalf("missing notifications, got %v", got)
+		}
+	}
+	select {
+	case uri := <-updated:
+		got[uri]++
+	case <-time.After(200 * time.Millisecond):
+	}
+	if got[poolStatusURI] != 1 || got[keyURI] != 1 {
+		t.Fatalf("expected one notification per subscribed resource, got %v", got)
+	}
+
+	read, err = session.ReadResource(ctx, &mcp.ReadResourceParams{URI: poolStatusURI})
+	if err != nil || !strings.Contains(read.Contents[0].Text, `"total_used": 5`) {
+		t.Fatalf("pool status not updated: %v %v", read, err)
+	}
+
+	prompt, err := session.GetPrompt(ctx, &mcp.GetPromptParams{Name: "research-topic", Arguments: map[string]string{"topic": "sqlite wal", "sources": "2"}})
+	if err != nil {
+		t.Fatalf("get prompt: %v", err)
+	}
+	text := prompt.Messages[0].Content.(*mcp.TextContent).Text
+	if !strings.Contains(text, "sqlite wal") || !strings.Contains(text, "tavily-extract") || !strings.Contains(text, fmt.Sprintf("max_results %d", 4)) {
+		t.Fatalf("unexpected prompt: %s", text)
+	}
+	if _, err := session.GetPrompt(ctx, &mcp.GetPromptParams{Name: "research-topic", Arguments: map[string]string{}}); err == nil {
+		t.Fatalf("missing topic must be rejected")
+	}
+}
@@ -0,0 +1,129 @@
+package mcpserver
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+)
+
+// ServeStdio serves MCP over t with the local services. Whoever can start the
+// binary can read the database, so the session gets the admin toolset.
+func ServeStdio(ctx context.Context, deps Dependencies, t mcp.Transport) error {
+	return newServer(deps, true).Run(ctx, t)
+}
+
+// ServeRemote serves MCP over t by forwarding to the Streamable HTTP endpoint
+// of a remote proxy, authenticated with token. The remote tools, resources and
+// prompts are listed once at startup and mirrored locally; resource
+// subscriptions and progress notifications are passed through.
+func ServeRemote(ctx context.Context, endpoint, token string, t mcp.Transport) error {
+	var local atomic.Pointer[mcp.Server]
+	client := mcp.NewClient(&mcp.Implementation{Name: "tavily-proxy-bridge", Version: "0.1.0"}, &mcp.ClientOptions{
+		ResourceUpdatedHandler: func(ctx context.Context, req *mcp.ResourceUpdatedNotificationRequest) {
+			if s := local.Load(); s != nil {
+				_ = s.ResourceUpdated(ctx, req.Params)
+			}
+		},
+		ProgressNotificationHandler: func(ctx context.Context, req *mcp.ProgressNotificationClientRequest) {
+			if s := local.Load(); s != nil {
+				for ss := range s.Sessions() {
+					_ = ss.NotifyProgress(ctx, req.Params)
+				}
+			}
+		},
+	})
+	remote, err := client.Connect(ctx, &mcp.StreamableClientTransport{
+		Endpoint:   endpoint,
+		HTTPClient: &http.Client{Transport: bearerRoundTripper{token: token, base: http.DefaultTransport}},
+	}, nil)
+	if err != nil {
+		return fmt.Errorf("connect %s: %w", endpoint, err)
+	}
+	defer remote.Close()
+
+	server, err := mirrorServer(ctx, remote)
+	if err != nil {
+		return err
+	}
+	local.Store(server)
+	return server.Run(ctx, t)
+}
+
+func mirrorServer(ctx context.Context, remote *mcp.ClientSession) (*mcp.Server, error) {
+	impl := &mcp.Implementation{Name: "tavily-proxy-mcp", Version: "0.1.0"}
+	var opts *mcp.ServerOptions
+	initResult := remote.InitializeResult()
+	if initResult.ServerInfo != nil {
+		impl = initResult.ServerInfo
+	}
+	caps := initResult.Capabilities
+	if caps != nil && caps.Resources != nil && caps.Resources.Subscribe {
+		opts = &mcp.ServerOptions{
+			SubscribeHandler: func(ctx context.Context, req *mcp.SubscribeRequest) error {
+				return remote.Subscribe(ctx, req.Params)
+			},
+			UnsubscribeHandler: func(ctx context.Context, req *mcp.UnsubscribeRequest) error {
+				return remote.Unsubscribe(ctx, req.Params)
+			},
+		}
+	}
+	server := mcp.NewServer(impl, opts)
+
+	if caps != nil && caps.Tools != nil {
+		for tool, err := range remote.Tools(ctx, nil) {
+			if err != nil {
+				return nil, fmt.Errorf("list remote tools: %w", err)
+			}
+			server.AddTool(tool, func(ctx context.Context, req *mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+				return remote.CallTool(ctx, &mcp.CallToolParams{
+					Meta:      req.Params.Meta,
+					Name:      req.Params.Name,
+					Arguments: req.Params.Arguments,
+				})
+			})
+		}
+	}
+	if caps != nil && caps.Resources != nil {
+		for resource, err := range remote.Resources(ctx, nil) {
+			if err != nil {
+				return nil, fmt.Errorf("list remote resources: %w", err)
+			}
+			server.AddResource(resource, func(ctx context.Context, req *mcp.ReadResourceRequest) (*mcp.ReadResourceResult, error) {
+				return remote.ReadResource(ctx, req.Params)
+			})
+		}
+		for template, err := range remote.ResourceTemplates(ctx, nil) {
+			if err != nil {
+				return nil, fmt.Errorf("list remote resource templates: %w", err)
+			}
+			server.AddResourceTemplate(template, func(ctx context.Context, req *mcp.ReadResourceRequest) (*mcp.ReadResourceResult, error) {
+				return remote.ReadResource(ctx, req.Params)
+			})
+		}
+	}
+	if caps != nil && caps.Prompts != nil {
+		for prompt, err := range remote.Prompts(ctx, nil) {
+			if err != nil {
+				return nil, fmt.Errorf("list remote prompts: %w", err)
+			}
+			server.AddPrompt(prompt, func(ctx context.Context, req *mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+				return remote.GetPrompt(ctx, req.Params)
+			})
+		}
+	}
+	return server, nil
+}
+
+type bearerRoundTripper struct {
+	token string
+	base  http.RoundTripper
+}
+
+func (b bearerRoundTripper) RoundTrip(r *http.Request) (*http.Response, error) {
+	r = r.Clone(r.Context())
+	r.Header.Set("Authorization", "Bearer "+b.token)
+	return b.base.RoundTrip(r)
+}
@@ -0,0 +1,292 @@
+package mcpserver
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/modelcontextprotocol/go-sdk/mcp"
+
+	"tavily-proxy/server/internal/db"
+	"tavily-proxy/server/internal/services"
+)
+
+type transportFixture struct {
+	handlers        Handlers
+	master          *services.MasterKeyService
+	distributedKeys *services.DistributedKeyService
+	plainKey        string
+	keyID           uint
+}
+
+func newTransportFixture(t *testing.T, stateless bool) transportFixture {
+	t.Helper()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	database, err := db.Open(filepath.Join(t.TempDir(), "app.db"))
+	if err != nil {
+		t.Fatalf("db open: %v", err)
+	}
+	sqlDB, err := database.DB()
+	if err != nil {
+		t.Fatalf("db handle: %v", err)
+	}
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(`{"query":"q","results":[]}`))
+	}))
+	t.Cleanup(upstream.Close)
+
+	ctx := context.Background()
+	master := services.NewMasterKeyService(database, logger)
+	if err := master.LoadOrCreate(ctx); err != nil {
+		t.Fatalf("master init: %v", err)
+	}
+	keys := services.NewKeyService(database, logger)
+	if _, err := keys.Create(ctx, "tvly-secretsecretsecret", "primary", 100); err != nil {
+		t.Fatalf("create key: %v", err)
+	}
+	cipher, err := services.NewTokenCipher("0123456789abcdef0123456789abcdef")
+	if err != nil {
+		t.Fatalf("cipher: %v", err)
+	}
+	distributedKeys := services.NewDistributedKeyService(database, logger, cipher, 60)
+	dk, plainKey, err := distributedKeys.Create(ctx, services.DistributedKeyCreateInput{Name: "agent"})
+	if err != nil {
+		t.Fatalf("create distributed key: %v", err)
+	}
+	handlers := NewHandlers(Dependencies{
+		MasterKey:       master,
+		Proxy:           services.NewTavilyProxy(upstream.URL, 5*time.Second, keys, nil, nil, logger),
+		Stats:           services.NewStatsService(database),
+		Logs:            services.NewLogService(database, logger),
+		Keys:            keys,
+		DistributedKeys: distributedKeys,
+		RateLimiter:     services.NewDistributedRateLimiter(time.Minute),
+		KeyUsage:        services.NewDistributedKeyUsageService(database),
+		Stateless:       stateless,
+	})
+	return transportFixture{
+		handlers:        handlers,
+		master:          master,
+		distributedKeys: distributedKeys,
+		plainKey:        plainKey,
+		keyID:           dk.ID,
+	}
+}
+
+func toolNamesOf(t *testing.T, ctx context.Context, s *mcp.ClientSession) []string {
+	t.Helper()
+	res, err := s.ListTools(ctx, nil)
+	if err != nil {
+		t.Fatalf("list tools: %v", err)
+	}
+	var names []string
+	for _, tool := range res.Tools {
+		names = append(names, tool.Name)
+	}
+	return names
+}
+
+func TestSSEHandler_SeparatesCallers(t *testing.T) {
+	t.Parallel()
+
+	f := newTransportFixture(t, true)
+	srv := httptest.NewServer(f.handlers.SSE)
+	t.Cleanup(srv.Close)
+	ctx := context.Background()
+
+	connect := func(token string) (*mcp.ClientSession, error) {
+		client := mcp.NewClient(&mcp.Implementation{Name: "test", Version: "0"}, nil)
+		return client.Connect(ctx, &mcp.SSEClientTransport{
+			Endpoint:   srv.URL,
+			HTTPClient: &http.Client{Transport: bearerRoundTripper{token: token, base: http.DefaultTransport}},
+		}, nil)
+	}
+
+	if _, err := connect("wrong"); err == nil {
+		t.Fatalf("unknown token must be rejected")
+	}
+	admin, err := connect(f.master.Get())
+	if err != nil {
+		t.Fatalf("master connect: %v", err)
+	}
+	t.Cleanup(func() { _ = admin.Close() })
+	if names := toolNamesOf(t, ctx, admin); !slices.Contains(names, "admin-list-keys") {
+		t.Fatalf("master key should see admin tools over SSE: %v", names)
+	}
+
+	user, err := connect(f.plainKey)
+	if err != nil {
+		t.Fatalf("distributed key connect: %v", err)
+	}
+	t.Cleanup(func() { _ = user.Close() })
+	if names := toolNamesOf(t, ctx, user); slices.Contains(names, "admin-list-keys") {
+		t.Fatalf("admin tools advertised to a distributed key over SSE: %v", names)
+	}
+	res, err := user.CallTool(ctx, &mcp.CallToolParams{Name: "tavily-search", Arguments: map[string]any{"query": "q"}})
+	if err != nil || res.IsError {
+		t.Fatalf("search over SSE: %v %v", res, err)
+	}
+	dk, err := f.distributedKeys.FindByID(ctx, f.keyID)
+	if err != nil || dk.LastUsedAt == nil {
+		t.Fatalf("SSE tool calls should be attributed to the distributed key: %+v %v", dk, err)
+	}
+
+	// A distributed key must not be able to post into the admin session.
+	endpoint := sessionEndpoint(t, srv.URL, f.master.Get())
+	req, _ := http.NewRequest(http.MethodPost, endpoint, strings.NewReader(`{"jsonrpc":"2.0","id":1,"method":"tools/list"}`))
+	req.Header.Set("Authorization", "Bearer "+f.plainKey)
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("cross post: %v", err)
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 for a session of another caller, got %d", resp.StatusCode)
+	}
+}
+
+func TestStreamableHandler_SeparatesCallers(t *testing.T) {
+	t.Parallel()
+
+	f := newTransportFixture(t, false)
+	srv := httptest.NewServer(f.handlers.Streamable)
+	t.Cleanup(srv.Close)
+	ctx := context.Background()
+
+	client := mcp.NewClient(&mcp.Implementation{Name: "test", Version: "0"}, nil)
+	admin, err := client.Connect(ctx, &mcp.StreamableClientTransport{
+		Endpoint:   srv.URL,
+		HTTPClient: &http.Client{Transport: bearerRoundTripper{token: f.master.Get(), base: http.DefaultTransport}},
+	}, nil)
+	if err != nil {
+		t.Fatalf("master connect: %v", err)
+	}
+	t.Cleanup(func() { _ = admin.Close() })
+	if admin.ID() == "" {
+		t.Fatalf("expected a stateful session")
+	}
+
+	post := func(token string) int {
+		t.Helper()
+		req, _ := http.NewRequest(http.MethodPost, srv.URL, strings.NewReader(`{"jsonrpc":"2.0","id":7,"method":"tools/call","params":{"name":"admin-list-keys","arguments":{}}}`))
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", "application/json, text/event-stream")
+		req.Header.Set("Mcp-Session-Id", admin.ID())
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatalf("post: %v", err)
+		}
+		_, _ = io.Copy(io.Discard, resp.Body)
+		_ = resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	if code := post(f.master.Get()); code != http.StatusOK {
+		t.Fatalf("master key should reach its own session, got %d", code)
+	}
+	// A distributed key must not reach admin tools through the admin session.
+	if code := post(f.plainKey); code != http.StatusNotFound {
+		t.Fatalf("expected 404 for a session of another caller, got %d", code)
+	}
+}
+
+// sessionEndpoint opens an SSE stream and returns the message endpoint from
+// its first event.
+func sessionEndpoint(t *testing.T, base, token string) string {
+	t.Helper()
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, base, nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatalf("open stream: %v", err)
+	}
+	t.Cleanup(func() { _ = resp.Body.Close() })
+	buf := make([]byte, 512)
+	var got string
+	for !strings.Contains(got, "sessionid=") || !strings.Contains(got[strings.Index(got, "sessionid="):], "\n") {
+		n, err := resp.Body.Read(buf)
+		if err != nil {
+			t.Fatalf("read stream: %v (got %q)", err, got)
+		}
+		got += string(buf[:n])
+	}
+	for _, line := range strings.Split(got, "\n") {
+		if data, ok := strings.CutPrefix(line, "data: "); ok {
+			u, err := resp.Request.URL.Parse(strings.TrimSpace(data))
+			if err != nil {
+				t.Fatalf("parse endpoint: %v", err)
+			}
+			return u.String()
+		}
+	}
+	t.Fatalf("no endpoint event in %q", got)
+	return ""
+}
+
+func TestServeRemote_BridgesStdioToRemoteProxy(t *testing.T) {
+	t.Parallel()
+
+	f := newTransportFixture(t, true)
+	srv := httptest.NewServer(f.handlers.Streamable)
+	t.Cleanup(srv.Close)
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	clientRead, bridgeWrite := io.Pipe()
+	bridgeRead, clientWrite := io.Pipe()
+	done := make(chan error, 1)
+	go func() {
+		done <- ServeRemote(ctx, srv.URL, f.plainKey, &mcp.IOTransport{Reader: bridgeRead, Writer: bridgeWrite})
+	}()
+
+	session, err := mcp.NewClient(&mcp.Implementation{Name: "test", Version: "0"}, nil).
+		Connect(ctx, &mcp.IOTransport{Reader: clientRead, Writer: clientWrite}, nil)
+	if err != nil {
+		t.Fatalf("connect bridge: %v", err)
+	}
+	names := toolNamesOf(t, ctx, session)
+	if !slices.Contains(names, "tavily-search") || slices.Contains(names, "admin-list-keys") {
+		t.Fatalf("bridge should mirror the distributed key's toolset: %v", names)
+	}
+	res, err := session.CallTool(ctx, &mcp.CallToolParams{Name: "tavily-search", Arguments: map[string]any{"query": "q"}})
+	if err != nil || res.IsError || !strings.Contains(res.Content[0].(*mcp.TextContent).Text, `"query":"q"`) {
+		t.Fatalf("search through bridge: %v %v", res, err)
+	}
+	if _, err := session.ReadResource(ctx, &mcp.ReadResourceParams{URI: poolStatusURI}); err == nil {
+		t.Fatalf("bridge must not expose admin resources to a distributed key")
+	}
+	dk, err := f.distributedKeys.FindByID(ctx, f.keyID)
+	if err != nil || dk.LastUsedAt == nil {
+		t.Fatalf("bridged calls should be attributed to the distributed key: %+v %v", dk, err)
+	}
+
+	_ = session.Close()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("bridge did not stop after the client disconnected")
+	}
+
+	if err := ServeRemote(ctx, srv.URL, "wrong", &mcp.IOTransport{Reader: io.NopCloser(strings.NewReader("")), Writer: nopWriteCloser{io.Discard}}); err == nil {
+		t.Fatalf("a rejected token must fail before serving")
+	}
+}
+
+type nopWriteCloser struct{ io.Writer }
+
+func (nopWriteCloser) Close() error { return nil }
@@ -27,6 +27,9 @@ type RequestLog struct {
 	RequestTruncated  bool      `gorm:"not null;default:false" json:"request_truncated"`
 	ResponseBody      string    `gorm:"type:text" json:"response_body,omitempty"`
 	ResponseTruncated bool      `gorm:"not null;default:false" json:"response_truncated"`
+	Coalesced         bool      `gorm:"not null;default:false" json:"coalesced"`
+	Attempts          int       `gorm:"not null;default:0" json:"attempts"`
+	AttemptLog        string    `gorm:"type:text" json:"attempt_log,omitempty"`
 	ClientIP          string    `json:"client_ip"`
 	CreatedAt         time.Time `gorm:"index" json:"created_at"`
 }
@@ -68,6 +71,194 @@ type RequestStat struct {
 
 type Setting struct {
 	Key       string    `gorm:"primaryKey" json:"key"`
-	Value     string    `gorm:"not null" json:"value"`
+	Value     string    `gorm:"type:text;not null" json:"value"`
 	UpdatedAt time.Time `json:"updated_at"`
 }
+
+// SettingChange records one edit of a registered setting. OldValue is nil
+// when the setting was unset, i.e. still at its default.
+type SettingChange struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Name      string    `gorm:"size:64;not null;index" json:"name"`
+	OldValue  *string   `gorm:"type:text" json:"old_value"`
+	NewValue  string    `gorm:"type:text;not null" json:"new_value"`
+	Source    string    `gorm:"size:32;not null;default:''" json:"source"`
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+}
+
+// AuditEvent records one admin action. Before and After hold JSON snapshots
+// with secrets masked; for updates only the changed fields are kept.
+type AuditEvent struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	Actor      string    `gorm:"size:128;not null;default:'';index" json:"actor"`
+	Credential string    `gorm:"size:64;not null;default:''" json:"credential"`
+	Action     string    `gorm:"size:64;not null;index" json:"action"`
+	TargetType string    `gorm:"size:32;not null;default:'';index:idx_audit_event_target" json:"target_type"`
+	TargetID   string    `gorm:"size:128;not null;default:'';index:idx_audit_event_target" json:"target_id"`
+	Method     string    `gorm:"size:8;not null;default:''" json:"method"`
+	Path       string    `gorm:"size:255;not null;default:''" json:"path"`
+	StatusCode int       `gorm:"not null;default:0" json:"status_code"`
+	ClientIP   string    `gorm:"size:64;not null;default:''" json:"client_ip"`
+	Before     string    `gorm:"type:text" json:"-"`
+	After      string    `gorm:"type:text" json:"-"`
+	CreatedAt  time.Time `gorm:"index" json:"created_at"`
+}
+
+// AdminUser is a named admin identity; its role decides which admin API
+// routes its tokens may call.
+type AdminUser struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Name      string    `gorm:"size:64;uniqueIndex;not null" json:"name"`
+	Role      string    `gorm:"size:16;not null" json:"role"`
+	IsActive  bool      `gorm:"not null;default:true" json:"is_active"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// AdminToken is a revocable API token belonging to an AdminUser. Only the
+// SHA-256 hash of the token is stored.
+type AdminToken struct {
+	ID          uint       `gorm:"primaryKey" json:"id"`
+	AdminUserID uint       `gorm:"not null;index" json:"admin_user_id"`
+	Name        string     `gorm:"size:64;not null" json:"name"`
+	TokenHash   string     `gorm:"size:64;uniqueIndex;not null" json:"-"`
+	TokenPrefix string     `gorm:"size:64;not null" json:"token_prefix"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+	LastUsedAt  *time.Time `json:"last_used_at"`
+	RevokedAt   *time.Time `json:"revoked_at"`
+	CreatedAt   time.Time  `json:"created_at"`
+}
+
+// AdminSession is a browser session created by an SSO login. Only hashes of
+// the session and CSRF tokens are stored.
+type AdminSession struct {
+	ID         uint      `gorm:"primaryKey" json:"id"`
+	TokenHash  string    `gorm:"size:64;uniqueIndex;not null" json:"-"`
+	CSRFHash   string    `gorm:"column:csrf_hash;size:64;not null" json:"-"`
+	Subject    string    `gorm:"size:255;not null" json:"subject"`
+	Email      string    `gorm:"size:255;not null;default:''" json:"email"`
+	Name       string    `gorm:"size:255;not null;default:''" json:"name"`
+	Role       string    `gorm:"size:16;not null" json:"role"`
+	ExpiresAt  time.Time `gorm:"not null;index" json:"expires_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// OIDCLoginState holds the PKCE verifier and nonce of a login that has been
+// redirected to the IdP but not yet completed.
+type OIDCLoginState struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	StateHash string    `gorm:"size:64;uniqueIndex;not null" json:"-"`
+	Nonce     string    `gorm:"size:64;not null" json:"-"`
+	Verifier  string    `gorm:"size:128;not null" json:"-"`
+	ReturnTo  string    `gorm:"size:512;not null;default:''" json:"return_to"`
+	ExpiresAt time.Time `gorm:"not null;index" json:"expires_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// RequestRollup is a per-minute (UTC) aggregate; latency is kept as a fixed-bucket histogram.
+type RequestRollup struct {
+	ID               uint      `gorm:"primaryKey" json:"id"`
+	Minute           int64     `gorm:"not null;index:idx_request_rollup_dims,unique;index" json:"minute"`
+	Endpoint         string    `gorm:"not null;default:'';index:idx_request_rollup_dims,unique" json:"endpoint"`
+	KeyID            uint      `gorm:"not null;default:0;index:idx_request_rollup_dims,unique" json:"key_id"`
+	DistributedKeyID uint      `gorm:"not null;default:0;index:idx_request_rollup_dims,unique" json:"distributed_key_id"`
+	StatusClass      string    `gorm:"size:8;not null;default:'';index:idx_request_rollup_dims,unique" json:"status_class"`
+	Count            int64     `gorm:"not null;default:0" json:"count"`
+	LatencySumMs     int64     `gorm:"not null;default:0" json:"latency_sum_ms"`
+	LatencyMaxMs     int64     `gorm:"not null;default:0" json:"latency_max_ms"`
+	Lat50            int64     `gorm:"column:lat_50;not null;default:0" json:"-"`
+	Lat100           int64     `gorm:"column:lat_100;not null;default:0" json:"-"`
+	Lat250           int64     `gorm:"column:lat_250;not null;default:0" json:"-"`
+	Lat500           int64     `gorm:"column:lat_500;not null;default:0" json:"-"`
+	Lat1000          int64     `gorm:"column:lat_1000;not null;default:0" json:"-"`
+	Lat2500          int64     `gorm:"column:lat_2500;not null;default:0" json:"-"`
+	Lat5000          int64     `gorm:"column:lat_5000;not null;default:0" json:"-"`
+	Lat10000         int64     `gorm:"column:lat_10000;not null;default:0" json:"-"`
+	Lat30000         int64     `gorm:"column:lat_30000;not null;default:0" json:"-"`
+	LatInf           int64     `gorm:"column:lat_inf;not null;default:0" json:"-"`
+	UpdatedAt        time.Time `json:"updated_at"`
+}
+
+type Job struct {
+	ID        string     `gorm:"primaryKey;size:36" json:"id"`
+	Type      string     `gorm:"size:32;not null;index" json:"type"`
+	Status    string     `gorm:"size:16;not null;index" json:"status"`
+	Params    string     `gorm:"type:text" json:"-"`
+	State     string     `gorm:"type:text" json:"-"`
+	Error     string     `gorm:"type:text" json:"error,omitempty"`
+	Total     int        `gorm:"not null;default:0" json:"total"`
+	Completed int        `gorm:"not null;default:0" json:"completed"`
+	Succeeded int        `gorm:"not null;default:0" json:"succeeded"`
+	Failed    int        `gorm:"not null;default:0" json:"failed"`
+	StartedAt *time.Time `json:"started_at"`
+	EndedAt   *time.Time `json:"ended_at"`
+	CreatedAt time.Time  `gorm:"index" json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+type CoordinationLease struct {
+	Name      string    `gorm:"primaryKey;size:64" json:"name"`
+	Holder    string    `gorm:"size:128;not null;default:''" json:"holder"`
+	ExpiresAt time.Time `gorm:"not null;index" json:"expires_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+type RateCounter struct {
+	Name        string    `gorm:"primaryKey;size:128" json:"name"`
+	WindowStart int64     `gorm:"primaryKey;autoIncrement:false" json:"window_start"`
+	Count       int64     `gorm:"not null;default:0" json:"count"`
+	ExpiresAt   time.Time `gorm:"not null;index" json:"expires_at"`
+}
+
+type SchemaMigration struct {
+	Version   int       `gorm:"primaryKey;autoIncrement:false" json:"version"`
+	Name      string    `gorm:"size:128;not null" json:"name"`
+	AppliedAt time.Time `gorm:"not null" json:"applied_at"`
+}
+
+// RequestPolicy rewrites or rejects proxied request bodies before they are
+// sent upstream. Value holds a JSON value; Min and Max are only used by clamp.
+type RequestPolicy struct {
+	ID        uint      `gorm:"primaryKey" json:"id"`
+	Name      string    `gorm:"size:64;uniqueIndex;not null" json:"name"`
+	Priority  int       `gorm:"not null;default:0" json:"priority"`
+	Enabled   bool      `gorm:"not null" json:"enabled"`
+	Endpoint  string    `gorm:"size:64;not null;default:''" json:"endpoint"`
+	Caller    string    `gorm:"size:16;not null;default:'any'" json:"caller"`
+	Action    string    `gorm:"size:16;not null" json:"action"`
+	Field     string    `gorm:"size:64;not null;default:''" json:"field"`
+	Value     string    `gorm:"type:text" json:"value"`
+	Min       *float64  `json:"min"`
+	Max       *float64  `json:"max"`
+	Message   string    `gorm:"size:255;not null;default:''" json:"message"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ResponseFilter removes results from /search and /extract responses or
+// redacts text in them. Kind decides how Pattern is matched.
+type ResponseFilter struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	Name        string    `gorm:"size:64;uniqueIndex;not null" json:"name"`
+	Enabled     bool      `gorm:"not null" json:"enabled"`
+	Kind        string    `gorm:"size:16;not null" json:"kind"`
+	Pattern     string    `gorm:"type:text;not null" json:"pattern"`
+	Replacement string    `gorm:"size:64;not null;default:''" json:"replacement"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// IdempotencyRecord holds the first response to a proxied POST sent with an
+// Idempotency-Key. StatusCode is 0 while the original request is in flight.
+type IdempotencyRecord struct {
+	ID          uint      `gorm:"primaryKey" json:"id"`
+	Scope       string    `gorm:"size:64;not null;uniqueIndex:idx_idempotency_scope_key" json:"scope"`
+	Key         string    `gorm:"column:idempotency_key;size:255;not null;uniqueIndex:idx_idempotency_scope_key" json:"key"`
+	Fingerprint string    `gorm:"size:64;not null" json:"-"`
+	StatusCode  int       `gorm:"not null;default:0" json:"status_code"`
+	Headers     string    `gorm:"type:text" json:"-"`
+	Body        []byte    `json:"-"`
+	ExpiresAt   time.Time `gorm:"index;not null" json:"expires_at"`
+	CreatedAt   time.Time `json:"created_at"`
+}
@@ -0,0 +1,314 @@
+package services
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"log/slog"
+	"strings"
+	"time"
+
+	"tavily-proxy/server/internal/models"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrAdminNotFound      = errors.New("admin_not_found")
+	ErrAdminNameTaken     = errors.New("admin_name_taken")
+	ErrAdminInvalidName   = errors.New("invalid_admin_name")
+	ErrAdminInvalidRole   = errors.New("invalid_role")
+	ErrAdminTokenNotFound = errors.New("admin_token_not_found")
+	ErrAdminTokenInvalid  = errors.New("admin_token_invalid")
+)
+
+// AdminTokenPrefix marks admin API tokens so they can be told apart from the
+// master key and distributed user keys without a database lookup.
+const AdminTokenPrefix = "adm_"
+
+type Role string
+
+const (
+	RoleOwner    Role = "owner"
+	RoleOperator Role = "operator"
+	RoleViewer   Role = "viewer"
+	RoleBilling  Role = "billing"
+)
+
+type Permission string
+
+const (
+	PermStatsRead     Permission = "stats:read"
+	PermLogsRead      Permission = "logs:read"
+	PermLogsDelete    Permission = "logs:delete"
+	PermKeysRead      Permission = "keys:read"
+	PermKeysWrite     Permission = "keys:write"
+	PermKeysReveal    Permission = "keys:reveal"
+	PermJobsRead      Permission = "jobs:read"
+	PermJobsWrite     Permission = "jobs:write"
+	PermDKeysRead     Permission = "distributed_keys:read"
+	PermDKeysWrite    Permission = "distributed_keys:write"
+	PermSettingsRead  Permission = "settings:read"
+	PermSettingsWrite Permission = "settings:write"
+	PermMasterKey     Permission = "master_key:manage"
+	PermBackupManage  Permission = "backup:manage"
+	PermAuditRead     Permission = "audit:read"
+	PermAdminsManage  Permission = "admins:manage"
+)
+
+var rolePermissions = map[Role][]Permission{
+	RoleOwner: {
+		PermStatsRead, PermLogsRead, PermLogsDelete,
+		PermKeysRead, PermKeysWrite, PermKeysReveal,
+		PermJobsRead, PermJobsWrite,
+		PermDKeysRead, PermDKeysWrite,
+		PermSettingsRead, PermSettingsWrite,
+		PermMasterKey, PermBackupManage, PermAuditRead, PermAdminsManage,
+	},
+	RoleOperator: {
+		PermStatsRead, PermLogsRead, PermLogsDelete,
+		PermKeysRead, PermKeysWrite,
+		PermJobsRead, PermJobsWrite,
+		PermDKeysRead, PermDKeysWrite,
+		PermSettingsRead, PermSettingsWrite,
+		PermAuditRead,
+	},
+	RoleViewer: {
+		PermStatsRead, PermLogsRead, PermKeysRead, PermJobsRead, PermDKeysRead, PermSettingsRead,
+	},
+	RoleBilling: {
+		PermStatsRead, PermKeysRead, PermDKeysRead,
+	},
+}
+
+func ParseRole(raw string) (Role, error) {
+	role := Role(strings.ToLower(strings.TrimSpace(raw)))
+	if _, ok := rolePermissions[role]; !ok {
+		return "", ErrAdminInvalidRole
+	}
+	return role, nil
+}
+
+func (r Role) Permissions() []Permission {
+	out := make([]Permission, len(rolePermissions[r]))
+	copy(out, rolePermissions[r])
+	return out
+}
+
+func (r Role) Can(p Permission) bool {
+	for _, granted := range rolePermissions[r] {
+		if granted == p {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	AuthMethodMasterKey = "master_key"
+	AuthMethodToken     = "token"
+	AuthMethodSession   = "session"
+)
+
+// Principal is an authenticated caller of the admin API.
+type Principal struct {
+	// Actor identifies the caller in audit events, e.g. "admin:alice" or
+	// "master_key".
+	Actor   string
+	AdminID uint
+	Name    string
+	Role    Role
+	// Credential is a masked form of the credential that was presented.
+	Credential string
+	AuthMethod string
+}
+
+func (p Principal) Can(perm Permission) bool { return p.Role.Can(perm) }
+
+type AdminTokenCreateInput struct {
+	Name      string
+	ExpiresAt *time.Time
+}
+
+type AdminService struct {
+	db     *gorm.DB
+	logger *slog.Logger
+}
+
+func NewAdminService(db *gorm.DB, logger *slog.Logger) *AdminService {
+	return &AdminService{db: db, logger: logger}
+}
+
+func (s *AdminService) List(ctx context.Context) ([]models.AdminUser, error) {
+	var out []models.AdminUser
+	err := s.db.WithContext(ctx).Order("id asc").Find(&out).Error
+	return out, err
+}
+
+func (s *AdminService) Get(ctx context.Context, id uint) (*models.AdminUser, error) {
+	var admin models.AdminUser
+	if err := s.db.WithContext(ctx).First(&admin, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrAdminNotFound
+		}
+		return nil, err
+	}
+	return &admin, nil
+}
+
+func (s *AdminService) Create(ctx context.Context, name string, role Role) (*models.AdminUser, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > 64 {
+		return nil, ErrAdminInvalidName
+	}
+	if _, ok := rolePermissions[role]; !ok {
+		return nil, ErrAdminInvalidRole
+	}
+	admin := models.AdminUser{Name: name, Role: string(role), IsActive: true}
+	if err := s.db.WithContext(ctx).Create(&admin).Error; err != nil {
+		if isUniqueConstraintError(err) {
+			return nil, ErrAdminNameTaken
+		}
+		return nil, err
+	}
+	s.logger.Info("admin created", "id", admin.ID, "name", admin.Name, "role", admin.Role)
+	return &admin, nil
+}
+
+// Update changes role and/or active state. Deactivating an admin immediately
+// invalidates all of their tokens.
+func (s *AdminService) Update(ctx context.Context, id uint, role *Role, isActive *bool) (*models.AdminUser, error) {
+	admin, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	updates := map[string]any{}
+	if role != nil {
+		if _, ok := rolePermissions[*role]; !ok {
+			return nil, ErrAdminInvalidRole
+		}
+		updates["role"] = string(*role)
+	}
+	if isActive != nil {
+		updates["is_active"] = *isActive
+	}
+	if len(updates) > 0 {
+		if err := s.db.WithContext(ctx).Model(admin).Updates(updates).Error; err != nil {
+			return nil, err
+		}
+	}
+	return s.Get(ctx, id)
+}
+
+// Delete removes the admin and all of their tokens.
+func (s *AdminService) Delete(ctx context.Context, id uint) error {
+	return s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("admin_user_id = ?", id).Delete(&models.AdminToken{}).Error; err != nil {
+			return err
+		}
+		res := tx.Delete(&models.AdminUser{}, id)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return ErrAdminNotFound
+		}
+		return nil
+	})
+}
+
+func (s *AdminService) ListTokens(ctx context.Context, adminID uint) ([]models.AdminToken, error) {
+	var out []models.AdminToken
+	err := s.db.WithContext(ctx).Where("admin_user_id = ?", adminID).Order("id asc").Find(&out).Error
+	return out, err
+}
+
+// CreateToken issues a new token and returns it in plain text; only its hash
+// is stored, so it cannot be shown again.
+func (s *AdminService) CreateToken(ctx context.Context, adminID uint, in AdminTokenCreateInput) (*models.AdminToken, string, error) {
+	if _, err := s.Get(ctx, adminID); err != nil {
+		return nil, "", err
+	}
+	name := strings.TrimSpace(in.Name)
+	if name == "" {
+		name = "API token"
+	}
+	for i := 0; i < 3; i++ {
+		raw := make([]byte, 32)
+		if _, err := rand.Read(raw); err != nil {
+			return nil, "", err
+		}
+		token := AdminTokenPrefix + base64.RawURLEncoding.EncodeToString(raw)
+		record := models.AdminToken{
+			AdminUserID: adminID,
+			Name:        name,
+			TokenHash:   hashToken(token),
+			TokenPrefix: tokenPrefix(token),
+			ExpiresAt:   in.ExpiresAt,
+		}
+		if err := s.db.WithContext(ctx).Create(&record).Error; err != nil {
+			if isUniqueConstraintError(err) {
+				continue
+			}
+			return nil, "", err
+		}
+		s.logger.Info("admin token created", "admin_id", adminID, "token_id", record.ID)
+		return &record, token, nil
+	}
+	return nil, "", errors.New("failed to create unique token")
+}
+
+func (s *AdminService) RevokeToken(ctx context.Context, adminID, tokenID uint) error {
+	now := time.Now()
+	res := s.db.WithContext(ctx).
+		Model(&models.AdminToken{}).
+		Where("id = ? AND admin_user_id = ? AND revoked_at IS NULL", tokenID, adminID).
+		Update("revoked_at", now)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrAdminTokenNotFound
+	}
+	return nil
+}
+
+// Authenticate resolves an adm_ token to its admin. Revoked or expired
+// tokens and deactivated admins are rejected alike.
+func (s *AdminService) Authenticate(ctx context.Context, token string, now time.Time) (Principal, error) {
+	token = strings.TrimSpace(token)
+	if !strings.HasPrefix(token, AdminTokenPrefix) {
+		return Principal{}, ErrAdminTokenInvalid
+	}
+	var record models.AdminToken
+	if err := s.db.WithContext(ctx).Where("token_hash = ?", hashToken(token)).Limit(1).Find(&record).Error; err != nil {
+		return Principal{}, err
+	}
+	if record.ID == 0 || record.RevokedAt != nil || (record.ExpiresAt != nil && !record.ExpiresAt.After(now)) {
+		return Principal{}, ErrAdminTokenInvalid
+	}
+	admin, err := s.Get(ctx, record.AdminUserID)
+	if err != nil {
+		if errors.Is(err, ErrAdminNotFound) {
+			return Principal{}, ErrAdminTokenInvalid
+		}
+		return Principal{}, err
+	}
+	if !admin.IsActive {
+		return Principal{}, ErrAdminTokenInvalid
+	}
+
+	// Last-used is informational; a failed write must not block the request.
+	if record.LastUsedAt == nil || now.Sub(*record.LastUsedAt) > time.Minute {
+		_ = s.db.WithContext(ctx).Model(&record).Update("last_used_at", now).Error
+	}
+	return Principal{
+		Actor:      "admin:" + admin.Name,
+		AdminID:    admin.ID,
+		Name:       admin.Name,
+		Role:       Role(admin.Role),
+		Credential: record.TokenPrefix + "…",
+		AuthMethod: AuthMethodToken,
+	}, nil
+}
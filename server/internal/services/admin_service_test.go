@@ -0,0 +1,106 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"tavily-proxy/server/internal/db"
+	"tavily-proxy/server/internal/models"
+)
+
+func TestAdminService_TokensAreHashedAndRevocable(t *testing.T) {
+	t.Parallel()
+
+	database, err := db.Open(filepath.Join(t.TempDir(), "app.db"))
+	if err != nil {
+		t.Fatalf("db open: %v", err)
+	}
+	sqlDB, err := database.DB()
+	if err != nil {
+		t.Fatalf("db handle: %v", err)
+	}
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	admins := NewAdminService(database, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	alice, err := admins.Create(ctx, "alice", RoleViewer)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if _, err := admins.Create(ctx, "alice", RoleOwner); !errors.Is(err, ErrAdminNameTaken) {
+		t.Fatalf("expected name taken, got %v", err)
+	}
+	if _, err := ParseRole("superuser"); !errors.Is(err, ErrAdminInvalidRole) {
+		t.Fatalf("expected invalid role, got %v", err)
+	}
+
+	record, token, err := admins.CreateToken(ctx, alice.ID, AdminTokenCreateInput{Name: "ci"})
+	if err != nil {
+		t.Fatalf("create token: %v", err)
+	}
+	if !strings.HasPrefix(token, AdminTokenPrefix) {
+		t.Fatalf("unexpected token format: %q", token)
+	}
+	var stored models.AdminToken
+	if err := database.First(&stored, record.ID).Error; err != nil {
+		t.Fatalf("load token: %v", err)
+	}
+	if stored.TokenHash == token || stored.TokenHash != hashToken(token) {
+		t.Fatalf("token must be stored hashed")
+	}
+
+	p, err := admins.Authenticate(ctx, token, now)
+	if err != nil {
+		t.Fatalf("authenticate: %v", err)
+	}
+	if p.Actor != "admin:alice" || p.Role != RoleViewer || p.Can(PermKeysReveal) || !p.Can(PermLogsRead) {
+		t.Fatalf("unexpected principal: %+v", p)
+	}
+
+	inactive := false
+	if _, err := admins.Update(ctx, alice.ID, nil, &inactive); err != nil {
+		t.Fatalf("deactivate: %v", err)
+	}
+	if _, err := admins.Authenticate(ctx, token, now); !errors.Is(err, ErrAdminTokenInvalid) {
+		t.Fatalf("deactivated admin must not authenticate, got %v", err)
+	}
+	active := true
+	if _, err := admins.Update(ctx, alice.ID, nil, &active); err != nil {
+		t.Fatalf("reactivate: %v", err)
+	}
+
+	if err := admins.RevokeToken(ctx, alice.ID, record.ID); err != nil {
+		t.Fatalf("revoke: %v", err)
+	}
+	if _, err := admins.Authenticate(ctx, token, now); !errors.Is(err, ErrAdminTokenInvalid) {
+		t.Fatalf("revoked token must not authenticate, got %v", err)
+	}
+	if err := admins.RevokeToken(ctx, alice.ID, record.ID); !errors.Is(err, ErrAdminTokenNotFound) {
+		t.Fatalf("expected not found on second revoke, got %v", err)
+	}
+
+	expiresAt := now.Add(time.Hour)
+	_, expiring, err := admins.CreateToken(ctx, alice.ID, AdminTokenCreateInput{ExpiresAt: &expiresAt})
+	if err != nil {
+		t.Fatalf("create token: %v", err)
+	}
+	if _, err := admins.Authenticate(ctx, expiring, now.Add(2*time.Hour)); !errors.Is(err, ErrAdminTokenInvalid) {
+		t.Fatalf("expired token must not authenticate, got %v", err)
+	}
+
+	if err := admins.Delete(ctx, alice.ID); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	tokens, err := admins.ListTokens(ctx, alice.ID)
+	if err != nil || len(tokens) != 0 {
+		t.Fatalf("tokens should be deleted with their admin: %v %v", tokens, err)
+	}
+}
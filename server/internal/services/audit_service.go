@@ -0,0 +1,257 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"reflect"
+	"strings"
+	"time"
+
+	"tavily-proxy/server/internal/models"
+	"tavily-proxy/server/internal/util"
+
+	"gorm.io/gorm"
+)
+
+// auditSecretFields are masked wherever they appear in a before/after
+// snapshot, at any depth.
+var auditSecretFields = map[string]bool{
+	"key":           true,
+	"keys":          true,
+	"api_key":       true,
+	"plain_key":     true,
+	"token":         true,
+	"master_key":    true,
+	"passphrase":    true,
+	"password":      true,
+	"secret":        true,
+	"authorization": true,
+}
+
+// auditIgnoredFields change on every write and would only add noise to diffs.
+var auditIgnoredFields = map[string]bool{
+	"updated_at": true,
+}
+
+// AuditEntry is what handlers report; Before and After are any JSON-encodable
+// values and are masked before they are stored.
+type AuditEntry struct {
+	Actor      string
+	Credential string
+	Action     string
+	TargetType string
+	TargetID   string
+	Method     string
+	Path       string
+	StatusCode int
+	ClientIP   string
+	Before     any
+	After      any
+}
+
+// AuditEventView is an AuditEvent with its snapshots decoded for the API.
+type AuditEventView struct {
+	models.AuditEvent
+	Before json.RawMessage `json:"before,omitempty"`
+	After  json.RawMessage `json:"after,omitempty"`
+}
+
+type AuditFilter struct {
+	Actor string
+	// Action matches exactly, or as a prefix when it ends in ".*"
+	// (e.g. "key.*").
+	Action     string
+	TargetType string
+	TargetID   string
+	Since      *time.Time
+	Until      *time.Time
+}
+
+type PaginatedAuditEvents struct {
+	Items []AuditEventView `json:"items"`
+	Total int64            `json:"total"`
+	Page  int              `json:"page"`
+	Size  int              `json:"page_size"`
+}
+
+type AuditService struct {
+	db     *gorm.DB
+	logger *slog.Logger
+}
+
+func NewAuditService(db *gorm.DB, logger *slog.Logger) *AuditService {
+	return &AuditService{db: db, logger: logger}
+}
+
+// Record stores one event. When both snapshots are objects only the fields
+// that differ are kept.
+func (s *AuditService) Record(ctx context.Context, e AuditEntry) error {
+	before, after := maskAuditValue(toAuditJSON(e.Before)), maskAuditValue(toAuditJSON(e.After))
+	if b, ok := before.(map[string]any); ok {
+		if a, ok := after.(map[string]any); ok {
+			before, after = diffAuditObjects(b, a)
+		}
+	}
+
+	event := models.AuditEvent{
+		Actor:      e.Actor,
+		Credential: e.Credential,
+		Action:     e.Action,
+		TargetType: e.TargetType,
+		TargetID:   e.TargetID,
+		Method:     e.Method,
+		Path:       e.Path,
+		StatusCode: e.StatusCode,
+		ClientIP:   e.ClientIP,
+		Before:     encodeAuditJSON(before),
+		After:      encodeAuditJSON(after),
+	}
+	return s.db.WithContext(ctx).Create(&event).Error
+}
+
+func (s *AuditService) List(ctx context.Context, page, size int, filter AuditFilter) (PaginatedAuditEvents, error) {
+	if page < 1 {
+		page = 1
+	}
+	if size <= 0 || size > 200 {
+		size = 50
+	}
+
+	query := s.db.WithContext(ctx).Model(&models.AuditEvent{})
+	if filter.Actor != "" {
+		query = query.Where("actor = ?", filter.Actor)
+	}
+	if prefix, ok := strings.CutSuffix(filter.Action, ".*"); ok {
+		query = query.Where("action LIKE ?", prefix+".%")
+	} else if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+	if filter.TargetType != "" {
+		query = query.Where("target_type = ?", filter.TargetType)
+	}
+	if filter.TargetID != "" {
+		query = query.Where("target_id = ?", filter.TargetID)
+	}
+	if filter.Since != nil {
+		query = query.Where("created_at >= ?", *filter.Since)
+	}
+	if filter.Until != nil {
+		query = query.Where("created_at < ?", *filter.Until)
+	}
+
+	var total int64
+	if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+		return PaginatedAuditEvents{}, err
+	}
+	var events []models.AuditEvent
+	if err := query.Order("id desc").Limit(size).Offset((page - 1) * size).Find(&events).Error; err != nil {
+		return PaginatedAuditEvents{}, err
+	}
+
+	items := make([]AuditEventView, len(events))
+	for i, ev := range events {
+		items[i] = AuditEventView{AuditEvent: ev}
+		if ev.Before != "" {
+			items[i].Before = json.RawMessage(ev.Before)
+		}
+		if ev.After != "" {
+			items[i].After = json.RawMessage(ev.After)
+		}
+	}
+	return PaginatedAuditEvents{Items: items, Total: total, Page: page, Size: size}, nil
+}
+
+func (s *AuditService) DeleteOlderThan(ctx context.Context, before time.Time) (int64, error) {
+	result := s.db.WithContext(ctx).Where("created_at < ?", before).Delete(&models.AuditEvent{})
+	return result.RowsAffected, result.Error
+}
+
+// toAuditJSON round-trips v through JSON so structs, gin.H and raw bodies all
+// become plain maps, slices and scalars.
+func toAuditJSON(v any) any {
+	if v == nil {
+		return nil
+	}
+	var raw []byte
+	switch t := v.(type) {
+	case json.RawMessage:
+		raw = t
+	case []byte:
+		raw = t
+	default:
+		var err error
+		if raw, err = json.Marshal(v); err != nil {
+			return nil
+		}
+	}
+	var out any
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return nil
+	}
+	return out
+}
+
+func maskAuditValue(v any) any {
+	return maskAuditField("", v)
+}
+
+func maskAuditField(name string, v any) any {
+	secret := auditSecretFields[strings.ToLower(name)]
+	switch t := v.(type) {
+	case map[string]any:
+		for k, child := range t {
+			t[k] = maskAuditField(k, child)
+		}
+		return t
+	case []any:
+		for i, child := range t {
+			// Elements inherit their parent's name, so {"keys": ["tvly-..."]}
+			// is masked too.
+			t[i] = maskAuditField(name, child)
+		}
+		return t
+	case string:
+		if secret {
+			return util.MaskAPIKey(t)
+		}
+		return t
+	default:
+		return t
+	}
+}
+
+func diffAuditObjects(before, after map[string]any) (map[string]any, map[string]any) {
+	b, a := map[string]any{}, map[string]any{}
+	for k, v := range before {
+		if auditIgnoredFields[k] {
+			continue
+		}
+		if other, ok := after[k]; !ok || !reflect.DeepEqual(v, other) {
+			b[k] = v
+		}
+	}
+	for k, v := range after {
+		if auditIgnoredFields[k] {
+			continue
+		}
+		if other, ok := before[k]; !ok || !reflect.DeepEqual(v, other) {
+			a[k] = v
+		}
+	}
+	return b, a
+}
+
+func encodeAuditJSON(v any) string {
+	if v == nil {
+		return ""
+	}
+	if m, ok := v.(map[string]any); ok && len(m) == 0 {
+		return ""
+	}
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	return string(raw)
+}
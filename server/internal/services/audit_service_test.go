@@ -0,0 +1,73 @@
+package services
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"tavily-proxy/server/internal/db"
+	"tavily-proxy/server/internal/models"
+)
+
+func TestAuditService_MasksNestedSecretsAndPurgesOldEvents(t *testing.T) {
+	t.Parallel()
+
+	database, err := db.Open(filepath.Join(t.TempDir(), "app.db"))
+	if err != nil {
+		t.Fatalf("db open: %v", err)
+	}
+	sqlDB, err := database.DB()
+	if err != nil {
+		t.Fatalf("db handle: %v", err)
+	}
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	audit := NewAuditService(database, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	ctx := context.Background()
+
+	if err := audit.Record(ctx, AuditEntry{
+		Action: "key.import",
+		After: map[string]any{
+			"keys":  []any{map[string]any{"key": "tvly-aaaa-bbbb-1111"}, "tvly-cccc-dddd-2222"},
+			"token": "th-0123456789",
+			"alias": "kept",
+		},
+	}); err != nil {
+		t.Fatalf("record: %v", err)
+	}
+	var stored models.AuditEvent
+	if err := database.First(&stored).Error; err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	for _, secret := range []string{"aaaa-bbbb", "cccc-dddd", "0123456789"} {
+		if strings.Contains(stored.After, secret) {
+			t.Fatalf("secret %q leaked into %s", secret, stored.After)
+		}
+	}
+	if !strings.Contains(stored.After, `"alias":"kept"`) {
+		t.Fatalf("non-secret fields must be kept: %s", stored.After)
+	}
+
+	old := time.Now().AddDate(0, 0, -400)
+	if err := database.Model(&stored).Update("created_at", old).Error; err != nil {
+		t.Fatalf("age event: %v", err)
+	}
+	if err := audit.Record(ctx, AuditEntry{Action: "logs.clear"}); err != nil {
+		t.Fatalf("record: %v", err)
+	}
+
+	since := time.Now().AddDate(0, 0, -1)
+	recent, err := audit.List(ctx, 1, 10, AuditFilter{Since: &since})
+	if err != nil || recent.Total != 1 || recent.Items[0].Action != "logs.clear" {
+		t.Fatalf("since filter: %+v %v", recent, err)
+	}
+
+	deleted, err := audit.DeleteOlderThan(ctx, time.Now().AddDate(0, 0, -365))
+	if err != nil || deleted != 1 {
+		t.Fatalf("purge: deleted=%d err=%v", deleted, err)
+	}
+}
@@ -0,0 +1,462 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"tavily-proxy/server/internal/db"
+)
+
+const (
+	backupFilePrefix = "tavily-proxy-"
+	backupFileSuffix = ".db"
+	backupTimeLayout = "20060102-150405"
+)
+
+var (
+	ErrBackupUnsupported     = errors.New("backup_unsupported")
+	ErrRestoreInvalidFile    = errors.New("invalid_backup_file")
+	ErrRestoreCipherMissing  = errors.New("restore_cipher_missing")
+	ErrRestoreCipherMismatch = errors.New("restore_cipher_mismatch")
+)
+
+// Tables that only hold request history; they can be left out of a backup
+// and are only replaced on restore when asked for.
+var backupLogTables = map[string]bool{
+	"request_logs":    true,
+	"request_stats":   true,
+	"request_rollups": true,
+}
+
+// Tables restore leaves untouched: live coordination state between replicas,
+// and the audit trail, which must survive rolling the data back.
+var backupRuntimeTables = map[string]bool{
+	"coordination_leases": true,
+	"rate_counters":       true,
+	"audit_events":        true,
+	"admin_sessions":      true,
+	"o_id_c_login_states": true,
+	"idempotency_records": true,
+}
+
+var sqliteFileHeader = []byte("SQLite format 3\x00")
+
+type BackupOptions struct {
+	IncludeLogs bool
+}
+
+type RestoreOptions struct {
+	// IncludeLogs replaces request history with the backup's copy; otherwise
+	// the current history is kept.
+	IncludeLogs bool
+	// RestoreMasterKey takes the master key from the backup. By default the
+	// current key is kept so the caller is not locked out.
+	RestoreMasterKey bool
+}
+
+type BackupInfo struct {
+	Name        string    `json:"name"`
+	Path        string    `json:"-"`
+	Size        int64     `json:"size"`
+	CreatedAt   time.Time `json:"created_at"`
+	IncludeLogs bool      `json:"include_logs"`
+}
+
+type RestoreResult struct {
+	Tables           map[string]int64 `json:"tables"`
+	MasterKeyChanged bool             `json:"master_key_changed"`
+}
+
+// BackupService takes consistent snapshots of the SQLite database while the
+// server is running and swaps a snapshot back in.
+type BackupService struct {
+	db     *gorm.DB
+	logger *slog.Logger
+
+	cipher    *TokenCipher
+	masterKey *MasterKeyService
+	settings  *SettingsService
+	policies  *PolicyService
+	filters   *FilterService
+}
+
+func NewBackupService(db *gorm.DB, logger *slog.Logger) *BackupService {
+	return &BackupService{db: db, logger: logger}
+}
+
+// WithCipher lets restores check that distributed keys in a backup can be
+// decrypted with the current USER_KEY_ENCRYPTION_KEY.
+func (s *BackupService) WithCipher(cipher *TokenCipher) *BackupService {
+	s.cipher = cipher
+	return s
+}
+
+// WithMasterKey reloads the in-memory master key after a restore.
+func (s *BackupService) WithMasterKey(masterKey *MasterKeyService) *BackupService {
+	s.masterKey = masterKey
+	return s
+}
+
+// WithSettings drops cached settings after a restore replaced them.
+func (s *BackupService) WithSettings(settings *SettingsService) *BackupService {
+	s.settings = settings
+	return s
+}
+
+// WithPolicies drops cached request policies after a restore replaced them.
+func (s *BackupService) WithPolicies(policies *PolicyService) *BackupService {
+	s.policies = policies
+	return s
+}
+
+// WithFilters drops cached response filters after a restore replaced them.
+func (s *BackupService) WithFilters(filters *FilterService) *BackupService {
+	s.filters = filters
+	return s
+}
+
+func (s *BackupService) Supported() bool {
+	return s.db.Dialector.Name() == "sqlite"
+}
+
+// Snapshot writes a consistent copy of the database to dst, which must not
+// exist yet.
+func (s *BackupService) Snapshot(ctx context.Context, dst string, opts BackupOptions) (BackupInfo, error) {
+	if !s.Supported() {
+		return BackupInfo{}, ErrBackupUnsupported
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0o755); err != nil {
+		return BackupInfo{}, err
+	}
+
+	if err := s.db.WithContext(ctx).Exec("VACUUM INTO ?", dst).Error; err != nil {
+		return BackupInfo{}, err
+	}
+
+	if !opts.IncludeLogs {
+		if err := s.withAttached(ctx, dst, "backup_dst", func(conn *sql.Conn) error {
+			for table := range backupLogTables {
+				if _, err := conn.ExecContext(ctx, fmt.Sprintf("DELETE FROM backup_dst.%q", table)); err != nil {
+					return err
+				}
+			}
+			_, err := conn.ExecContext(ctx, "VACUUM backup_dst")
+			return err
+		}); err != nil {
+			_ = os.Remove(dst)
+			return BackupInfo{}, err
+		}
+	}
+
+	st, err := os.Stat(dst)
+	if err != nil {
+		return BackupInfo{}, err
+	}
+	return BackupInfo{
+		Name:        filepath.Base(dst),
+		Path:        dst,
+		Size:        st.Size(),
+		CreatedAt:   st.ModTime(),
+		IncludeLogs: opts.IncludeLogs,
+	}, nil
+}
+
+// WriteScheduled stores a timestamped snapshot in dir and prunes older ones
+// beyond keep.
+func (s *BackupService) WriteScheduled(ctx context.Context, dir string, keep int, opts BackupOptions) (BackupInfo, error) {
+	name := backupFilePrefix + time.Now().UTC().Format(backupTimeLayout) + backupFileSuffix
+	info, err := s.Snapshot(ctx, filepath.Join(dir, name), opts)
+	if err != nil {
+		return BackupInfo{}, err
+	}
+	if keep > 0 {
+		if err := PruneBackups(dir, keep); err != nil {
+			s.logger.Error("backup: prune failed", "dir", dir, "err", err)
+		}
+	}
+	return info, nil
+}
+
+// ListBackups returns the scheduled backups in dir, newest first.
+func ListBackups(dir string) ([]BackupInfo, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var out []BackupInfo
+	for _, e := range entries {
+		name := e.Name()
+		if e.IsDir() || !strings.HasPrefix(name, backupFilePrefix) || !strings.HasSuffix(name, backupFileSuffix) {
+			continue
+		}
+		st, err := e.Info()
+		if err != nil {
+			continue
+		}
+		out = append(out, BackupInfo{Name: name, Path: filepath.Join(dir, name), Size: st.Size(), CreatedAt: st.ModTime()})
+	}
+	// Names embed a sortable UTC timestamp.
+	sort.Slice(out, func(i, j int) bool { return out[i].Name > out[j].Name })
+	return out, nil
+}
+
+func PruneBackups(dir string, keep int) error {
+	items, err := ListBackups(dir)
+	if err != nil {
+		return err
+	}
+	for i := keep; i < len(items); i++ {
+		if err := os.Remove(items[i].Path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// Restore validates the SQLite file at src and copies its tables over the
+// live ones inside a single transaction. Admin tokens revoked after the
+// snapshot was taken stay revoked.
+func (s *BackupService) Restore(ctx context.Context, src string, opts RestoreOptions) (RestoreResult, error) {
+	if !s.Supported() {
+		return RestoreResult{}, ErrBackupUnsupported
+	}
+	if err := checkSQLiteHeader(src); err != nil {
+		return RestoreResult{}, err
+	}
+
+	previousMasterKey := ""
+	if s.masterKey != nil {
+		previousMasterKey = s.masterKey.Get()
+	}
+
+	result := RestoreResult{Tables: map[string]int64{}}
+	err := s.withAttached(ctx, src, "restore_src", func(conn *sql.Conn) error {
+		var check string
+		if err := conn.QueryRowContext(ctx, "PRAGMA restore_src.quick_check").Scan(&check); err != nil || check != "ok" {
+			return fmt.Errorf("%w: integrity check failed", ErrRestoreInvalidFile)
+		}
+
+		srcTables, err := attachedTables(ctx, conn, "restore_src")
+		if err != nil {
+			return err
+		}
+		for _, required := range []string{"api_keys", "settings"} {
+			if !srcTables[required] {
+				return fmt.Errorf("%w: missing table %s", ErrRestoreInvalidFile, required)
+			}
+		}
+		if srcTables["distributed_keys"] {
+			if err := s.checkDistributedKeyCiphertexts(ctx, conn); err != nil {
+				return err
+			}
+		}
+
+		tx, err := conn.BeginTx(ctx, nil)
+		if err != nil {
+			return err
+		}
+		defer func() { _ = tx.Rollback() }()
+
+		// Tokens revoked since the snapshot must stay revoked.
+		if _, err := tx.ExecContext(ctx, "CREATE TEMP TABLE restore_revoked_tokens AS SELECT token_hash, revoked_at FROM main.admin_tokens WHERE revoked_at IS NOT NULL"); err != nil {
+			return err
+		}
+
+		for _, model := range db.Models() {
+			table, err := s.tableName(model)
+			if err != nil {
+				return err
+			}
+			if backupRuntimeTables[table] || (backupLogTables[table] && !opts.IncludeLogs) {
+				continue
+			}
+
+			if _, err := tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM main.%q", table)); err != nil {
+				return err
+			}
+			if !srcTables[table] {
+				// Older backups may predate a table; it is restored empty.
+				result.Tables[table] = 0
+				continue
+			}
+
+			cols, err := sharedColumns(ctx, tx, table)
+			if err != nil {
+				return err
+			}
+			res, err := tx.ExecContext(ctx, fmt.Sprintf("INSERT INTO main.%q (%s) SELECT %s FROM restore_src.%q", table, cols, cols, table))
+			if err != nil {
+				return fmt.Errorf("restore %s: %w", table, err)
+			}
+			result.Tables[table], _ = res.RowsAffected()
+		}
+
+		if _, err := tx.ExecContext(ctx, `UPDATE main.admin_tokens
+			SET revoked_at = (SELECT r.revoked_at FROM restore_revoked_tokens r WHERE r.token_hash = admin_tokens.token_hash)
+			WHERE revoked_at IS NULL AND token_hash IN (SELECT token_hash FROM restore_revoked_tokens)`); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, "DROP TABLE restore_revoked_tokens"); err != nil {
+			return err
+		}
+
+		if !opts.RestoreMasterKey && previousMasterKey != "" {
+			if _, err := tx.ExecContext(ctx, "INSERT OR REPLACE INTO main.settings (key, value) VALUES (?, ?)", masterKeySettingKey, previousMasterKey); err != nil {
+				return err
+			}
+		}
+		return tx.Commit()
+	})
+	if err != nil {
+		return RestoreResult{}, err
+	}
+
+	if s.settings != nil {
+		s.settings.InvalidateCache()
+	}
+	if s.policies != nil {
+		s.policies.InvalidateCache()
+	}
+	if s.filters != nil {
+		s.filters.InvalidateCache()
+	}
+	if s.masterKey != nil {
+		if err := s.masterKey.LoadOrCreate(ctx); err != nil {
+			return RestoreResult{}, err
+		}
+		result.MasterKeyChanged = s.masterKey.Get() != previousMasterKey
+	}
+	s.logger.Info("backup restored", "tables", result.Tables, "master_key_changed", result.MasterKeyChanged)
+	return result, nil
+}
+
+func (s *BackupService) checkDistributedKeyCiphertexts(ctx context.Context, conn *sql.Conn) error {
+	rows, err := conn.QueryContext(ctx, "SELECT ciphertext FROM restore_src.distributed_keys")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var ciphertext string
+		if err := rows.Scan(&ciphertext); err != nil {
+			return err
+		}
+		if s.cipher == nil {
+			return ErrRestoreCipherMissing
+		}
+		if _, err := s.cipher.Decrypt(ciphertext); err != nil {
+			return ErrRestoreCipherMismatch
+		}
+	}
+	return rows.Err()
+}
+
+// withAttached runs fn on one pooled connection with path attached as schema;
+// ATTACH is per-connection, so everything has to go through conn.
+func (s *BackupService) withAttached(ctx context.Context, path, schema string, fn func(conn *sql.Conn) error) error {
+	sqlDB, err := s.db.DB()
+	if err != nil {
+		return err
+	}
+	conn, err := sqlDB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, "ATTACH DATABASE ? AS "+schema, path); err != nil {
+		return fmt.Errorf("%w: %v", ErrRestoreInvalidFile, err)
+	}
+	defer func() {
+		if _, err := conn.ExecContext(context.Background(), "DETACH DATABASE "+schema); err != nil {
+			s.logger.Error("backup: detach failed", "schema", schema, "err", err)
+		}
+	}()
+	return fn(conn)
+}
+
+func (s *BackupService) tableName(model any) (string, error) {
+	stmt := &gorm.Statement{DB: s.db}
+	if err := stmt.Parse(model); err != nil {
+		return "", err
+	}
+	return stmt.Schema.Table, nil
+}
+
+func attachedTables(ctx context.Context, conn *sql.Conn, schema string) (map[string]bool, error) {
+	rows, err := conn.QueryContext(ctx, fmt.Sprintf("SELECT name FROM %s.sqlite_master WHERE type = 'table'", schema))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	out := map[string]bool{}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		out[name] = true
+	}
+	return out, rows.Err()
+}
+
+// sharedColumns lists the columns present in both the live and the restored
+// table, so backups from older or newer schemas still line up.
+func sharedColumns(ctx context.Context, tx *sql.Tx, table string) (string, error) {
+	rows, err := tx.QueryContext(ctx, `
+SELECT m.name FROM pragma_table_info(?, 'main') AS m
+JOIN pragma_table_info(?, 'restore_src') AS r ON r.name = m.name
+ORDER BY m.cid`, table, table)
+	if err != nil {
+		return "", err
+	}
+	defer rows.Close()
+
+	var cols []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return "", err
+		}
+		cols = append(cols, fmt.Sprintf("%q", name))
+	}
+	if err := rows.Err(); err != nil {
+		return "", err
+	}
+	if len(cols) == 0 {
+		return "", fmt.Errorf("%w: table %s has no usable columns", ErrRestoreInvalidFile, table)
+	}
+	return strings.Join(cols, ", "), nil
+}
+
+func checkSQLiteHeader(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	header := make([]byte, len(sqliteFileHeader))
+	if _, err := io.ReadFull(f, header); err != nil || !bytes.Equal(header, sqliteFileHeader) {
+		return fmt.Errorf("%w: not a SQLite database", ErrRestoreInvalidFile)
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"tavily-proxy/server/internal/db"
+	"tavily-proxy/server/internal/models"
+)
+
+func TestBackupService_SnapshotAndRestore(t *testing.T) {
+	t.Parallel()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	dir := t.TempDir()
+	database, err := db.Open(filepath.Join(dir, "app.db"))
+	if err != nil {
+		t.Fatalf("db open: %v", err)
+	}
+	sqlDB, err := database.DB()
+	if err != nil {
+		t.Fatalf("db handle: %v", err)
+	}
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	ctx := context.Background()
+	master := NewMasterKeyService(database, logger)
+	if err := master.LoadOrCreate(ctx); err != nil {
+		t.Fatalf("master init: %v", err)
+	}
+	cipher, err := NewTokenCipher("0123456789abcdef0123456789abcdef")
+	if err != nil {
+		t.Fatalf("token cipher: %v", err)
+	}
+	keys := NewKeyService(database, logger)
+	if _, err := keys.Create(ctx, "tvly-backed-up", "main", 1000); err != nil {
+		t.Fatalf("create key: %v", err)
+	}
+	if _, _, err := NewDistributedKeyService(database, logger, cipher, 60).Create(ctx, DistributedKeyCreateInput{Name: "client"}); err != nil {
+		t.Fatalf("create distributed key: %v", err)
+	}
+	if err := database.Create(&models.RequestLog{RequestID: "r1", Endpoint: "/search", StatusCode: 200}).Error; err != nil {
+		t.Fatalf("create log: %v", err)
+	}
+	admins := NewAdminService(database, logger)
+	admin, err := admins.Create(ctx, "vera", RoleViewer)
+	if err != nil {
+		t.Fatalf("create admin: %v", err)
+	}
+	adminToken, plainToken, err := admins.CreateToken(ctx, admin.ID, AdminTokenCreateInput{Name: "laptop"})
+	if err != nil {
+		t.Fatalf("create admin token: %v", err)
+	}
+
+	backups := NewBackupService(database, logger).WithCipher(cipher).WithMasterKey(master)
+	snapshot := filepath.Join(dir, "snap.db")
+	info, err := backups.Snapshot(ctx, snapshot, BackupOptions{})
+	if err != nil {
+		t.Fatalf("snapshot: %v", err)
+	}
+	if info.Size == 0 {
+		t.Fatalf("empty snapshot")
+	}
+
+	copyDB, err := db.Open(snapshot)
+	if err != nil {
+		t.Fatalf("open snapshot: %v", err)
+	}
+	var logCount, keyCount int64
+	copyDB.Model(&models.RequestLog{}).Count(&logCount)
+	copyDB.Model(&models.APIKey{}).Count(&keyCount)
+	if copySQL, err := copyDB.DB(); err == nil {
+		_ = copySQL.Close()
+	}
+	if logCount != 0 || keyCount != 1 {
+		t.Fatalf("unexpected snapshot contents: logs=%d keys=%d", logCount, keyCount)
+	}
+
+	// Diverge from the snapshot, then restore it.
+	if _, err := keys.Create(ctx, "tvly-added-later", "later", 1000); err != nil {
+		t.Fatalf("create later key: %v", err)
+	}
+	if err := admins.RevokeToken(ctx, admin.ID, adminToken.ID); err != nil {
+		t.Fatalf("revoke admin token: %v", err)
+	}
+	currentMaster, err := master.Reset(ctx)
+	if err != nil {
+		t.Fatalf("reset master: %v", err)
+	}
+
+	if _, err := NewBackupService(database, logger).Restore(ctx, snapshot, RestoreOptions{}); err != ErrRestoreCipherMissing {
+		t.Fatalf("unexpected error without cipher: %v", err)
+	}
+	otherCipher, _ := NewTokenCipher("fedcba9876543210fedcba9876543210")
+	if _, err := NewBackupService(database, logger).WithCipher(otherCipher).Restore(ctx, snapshot, RestoreOptions{}); err != ErrRestoreCipherMismatch {
+		t.Fatalf("unexpected error with wrong cipher: %v", err)
+	}
+	junk := filepath.Join(dir, "junk.db")
+	if err := os.WriteFile(junk, []byte("not a database"), 0o600); err != nil {
+		t.Fatalf("write junk: %v", err)
+	}
+	if _, err := backups.Restore(ctx, junk, RestoreOptions{}); err == nil {
+		t.Fatalf("expected junk file to be rejected")
+	}
+
+	result, err := backups.Restore(ctx, snapshot, RestoreOptions{})
+	if err != nil {
+		t.Fatalf("restore: %v", err)
+	}
+	if result.Tables["api_keys"] != 1 || result.Tables["distributed_keys"] != 1 || result.MasterKeyChanged {
+		t.Fatalf("unexpected restore result: %+v", result)
+	}
+	if later, _ := keys.FindByKey(ctx, "tvly-added-later"); later != nil {
+		t.Fatalf("key added after the snapshot survived the restore")
+	}
+	if master.Get() != currentMaster {
+		t.Fatalf("master key should be kept by default")
+	}
+	if _, err := admins.Authenticate(ctx, plainToken, time.Now()); !errors.Is(err, ErrAdminTokenInvalid) {
+		t.Fatalf("a token revoked after the snapshot must stay revoked, got %v", err)
+	}
+	database.Model(&models.RequestLog{}).Count(&logCount)
+	if logCount != 1 {
+		t.Fatalf("request logs should be kept when include_logs is off, got %d", logCount)
+	}
+}
+
+func TestPruneBackups_KeepsNewest(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	names := []string{
+		"tavily-proxy-20240101-000000.db",
+		"tavily-proxy-20240102-000000.db",
+		"tavily-proxy-20240103-000000.db",
+		"unrelated.db",
+	}
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("x"), 0o600); err != nil {
+			t.Fatalf("write %s: %v", name, err)
+		}
+	}
+
+	if err := PruneBackups(dir, 2); err != nil {
+		t.Fatalf("prune: %v", err)
+	}
+	items, err := ListBackups(dir)
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(items) != 2 || items[0].Name != names[2] || items[1].Name != names[1] {
+		t.Fatalf("unexpected backups after prune: %+v", items)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "unrelated.db")); err != nil {
+		t.Fatalf("unrelated file removed: %v", err)
+	}
+}
@@ -0,0 +1,124 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strings"
+	"sync"
+)
+
+// upstreamResult is the outcome of sending one request upstream, shared by
+// every caller coalesced onto it.
+type upstreamResult struct {
+	ok          bool
+	resp        ProxyResponse
+	keyID       uint
+	keyAlias    string
+	status      int
+	latencyMs   int64
+	tavilyReqID string
+	attempts    []Attempt
+
+	// noKeys is set when there was no key to try, lastErr when every key
+	// failed; err is returned to callers as is.
+	noKeys  bool
+	lastErr error
+	err     error
+}
+
+type flightCall struct {
+	done    chan struct{}
+	res     upstreamResult
+	waiters int
+	cancel  context.CancelFunc
+}
+
+// flightGroup shares one upstream call between concurrent identical requests.
+// The call runs detached from any single caller and is cancelled once every
+// caller waiting for it has gone away.
+type flightGroup struct {
+	mu    sync.Mutex
+	calls map[string]*flightCall
+}
+
+// do runs fn, or waits for the identical call already in flight. shared
+// reports whether the result came from another caller's call.
+func (g *flightGroup) do(ctx context.Context, key string, fn func(context.Context) upstreamResult) (res upstreamResult, shared bool, err error) {
+	g.mu.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*flightCall)
+	}
+	if c, ok := g.calls[key]; ok {
+		c.waiters++
+		g.mu.Unlock()
+		return g.wait(ctx, key, c, true)
+	}
+	callCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	c := &flightCall{done: make(chan struct{}), waiters: 1, cancel: cancel}
+	g.calls[key] = c
+	g.mu.Unlock()
+
+	go func() {
+		c.res = fn(callCtx)
+		g.mu.Lock()
+		if g.calls[key] == c {
+			delete(g.calls, key)
+		}
+		g.mu.Unlock()
+		cancel()
+		close(c.done)
+	}()
+	return g.wait(ctx, key, c, false)
+}
+
+func (g *flightGroup) wait(ctx context.Context, key string, c *flightCall, shared bool) (upstreamResult, bool, error) {
+	select {
+	case <-c.done:
+		return c.res, shared, nil
+	case <-ctx.Done():
+		g.mu.Lock()
+		c.waiters--
+		if c.waiters == 0 {
+			c.cancel()
+			if g.calls[key] == c {
+				delete(g.calls, key)
+			}
+		}
+		g.mu.Unlock()
+		return upstreamResult{}, shared, ctx.Err()
+	}
+}
+
+// coalesceKey identifies requests that would get the same upstream response.
+// JSON bodies are canonicalised so field order and whitespace do not matter.
+// Accept-Encoding is left out: it is never forwarded, so every caller gets a
+// decompressed body.
+func coalesceKey(req ProxyRequest) string {
+	body := bytes.TrimSpace(req.Body)
+	if len(body) > 0 && body[0] == '{' {
+		var m map[string]any
+		dec := json.NewDecoder(bytes.NewReader(body))
+		dec.UseNumber()
+		if err := dec.Decode(&m); err == nil {
+			if canonical, err := json.Marshal(m); err == nil {
+				body = canonical
+			}
+		}
+	}
+	h := sha256.New()
+	for _, part := range []string{
+		strings.ToUpper(req.Method),
+		req.Path,
+		req.RawQuery,
+		req.ContentType,
+		req.Headers.Get("X-Project-Id"),
+	} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
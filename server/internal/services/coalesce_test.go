@@ -0,0 +1,232 @@
+package services
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"tavily-proxy/server/internal/db"
+	"tavily-proxy/server/internal/models"
+)
+
+func TestTavilyProxy_CoalescesConcurrentIdenticalRequests(t *testing.T) {
+	t.Parallel()
+
+	var calls atomic.Int32
+	arrived := make(chan struct{}, 4)
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		arrived <- struct{}{}
+		<-release
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"results":[],"request_id":"tvly-req"}`))
+	}))
+	t.Cleanup(upstream.Close)
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	database, err := db.Open(filepath.Join(t.TempDir(), "app.db"))
+	if err != nil {
+		t.Fatalf("db open: %v", err)
+	}
+	sqlDB, err := database.DB()
+	if err != nil {
+		t.Fatalf("db handle: %v", err)
+	}
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	ctx := context.Background()
+	keys := NewKeyService(database, logger)
+	key, err := keys.Create(ctx, "tvly-test", "test", 1000)
+	if err != nil {
+		t.Fatalf("create key: %v", err)
+	}
+	logs := NewLogService(database, logger)
+	proxy := NewTavilyProxy(upstream.URL, 5*time.Second, keys, logs, nil, logger)
+
+	bodies := []string{
+		`{"query":"q","max_results":5}`,
+		`{"max_results":5, "query":"q"}`,
+		`{"query":"q","max_results":5}`,
+	}
+	responses := make([]ProxyResponse, len(bodies))
+	errs := make([]error, len(bodies))
+	var wg sync.WaitGroup
+	send := func(i int) {
+		defer wg.Done()
+		responses[i], errs[i] = proxy.Do(ctx, ProxyRequest{Method: http.MethodPost, Path: "/search", Body: []byte(bodies[i]), ContentType: "application/json"})
+	}
+
+	wg.Add(1)
+	go send(0)
+	<-arrived
+	for i := 1; i < len(bodies); i++ {
+		wg.Add(1)
+		go send(i)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		proxy.flights.mu.Lock()
+		waiters := 0
+		for _, c := range proxy.flights.calls {
+			waiters = c.waiters
+		}
+		proxy.flights.mu.Unlock()
+		if waiters == len(bodies) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("callers did not join the in-flight request, waiters=%d", waiters)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+
+	if got := calls.Load(); got != 1 {
+		t.Fatalf("expected one upstream call, got %d", got)
+	}
+	ids := map[string]bool{}
+	coalesced := 0
+	for i, resp := range responses {
+		if errs[i] != nil || resp.StatusCode != http.StatusOK || resp.TavilyRequestID != "tvly-req" {
+			t.Fatalf("caller %d: %+v %v", i, resp, errs[i])
+		}
+		ids[resp.ProxyRequestID] = true
+		if resp.Coalesced {
+			coalesced++
+		}
+	}
+	if len(ids) != len(bodies) || coalesced != len(bodies)-1 {
+		t.Fatalf("expected distinct request IDs and %d coalesced callers, got %d IDs and %d", len(bodies)-1, len(ids), coalesced)
+	}
+
+	var rows []models.RequestLog
+	if err := database.Order("id asc").Find(&rows).Error; err != nil || len(rows) != len(bodies) {
+		t.Fatalf("expected one log per caller, got %d %v", len(rows), err)
+	}
+	flagged := 0
+	for _, row := range rows {
+		if row.Coalesced {
+			flagged++
+		}
+	}
+	if flagged != len(bodies)-1 {
+		t.Fatalf("expected %d coalesced log rows, got %d", len(bodies)-1, flagged)
+	}
+	stored, err := keys.Get(ctx, key.ID)
+	if err != nil || stored.UsedQuota != 1 {
+		t.Fatalf("the shared call should be counted once: %+v %v", stored, err)
+	}
+
+	if _, err := proxy.Do(ctx, ProxyRequest{Method: http.MethodPost, Path: "/search", Body: []byte(bodies[0])}); err != nil {
+		t.Fatalf("later request: %v", err)
+	}
+	if got := calls.Load(); got != 2 {
+		t.Fatalf("completed requests must not be reused, got %d upstream calls", got)
+	}
+}
+
+func TestTavilyProxy_CoalescesMixedAcceptEncoding(t *testing.T) {
+	t.Parallel()
+
+	var calls atomic.Int32
+	arrived := make(chan struct{}, 2)
+	release := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		arrived <- struct{}{}
+		<-release
+		body := []byte(`{"results":[],"request_id":"tvly-req"}`)
+		w.Header().Set("Content-Type", "application/json")
+		if strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			var buf bytes.Buffer
+			zw := gzip.NewWriter(&buf)
+			_, _ = zw.Write(body)
+			_ = zw.Close()
+			w.Header().Set("Content-Encoding", "gzip")
+			body = buf.Bytes()
+		}
+		_, _ = w.Write(body)
+	}))
+	t.Cleanup(upstream.Close)
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	database, err := db.Open(filepath.Join(t.TempDir(), "app.db"))
+	if err != nil {
+		t.Fatalf("db open: %v", err)
+	}
+	sqlDB, err := database.DB()
+	if err != nil {
+		t.Fatalf("db handle: %v", err)
+	}
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	ctx := context.Background()
+	keys := NewKeyService(database, logger)
+	if _, err := keys.Create(ctx, "tvly-test", "test", 1000); err != nil {
+		t.Fatalf("create key: %v", err)
+	}
+	proxy := NewTavilyProxy(upstream.URL, 5*time.Second, keys, nil, nil, logger)
+
+	// The leader asks for gzip, the follower does not.
+	encodings := []string{"gzip", ""}
+	responses := make([]ProxyResponse, len(encodings))
+	errs := make([]error, len(encodings))
+	var wg sync.WaitGroup
+	send := func(i int) {
+		defer wg.Done()
+		headers := http.Header{}
+		if encodings[i] != "" {
+			headers.Set("Accept-Encoding", encodings[i])
+		}
+		responses[i], errs[i] = proxy.Do(ctx, ProxyRequest{Method: http.MethodPost, Path: "/search", Headers: headers, Body: []byte(`{"query":"q"}`), ContentType: "application/json"})
+	}
+
+	wg.Add(1)
+	go send(0)
+	<-arrived
+	wg.Add(1)
+	go send(1)
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		proxy.flights.mu.Lock()
+		waiters := 0
+		for _, c := range proxy.flights.calls {
+			waiters = c.waiters
+		}
+		proxy.flights.mu.Unlock()
+		if waiters == len(encodings) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("follower did not join the in-flight request, waiters=%d", waiters)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	close(release)
+	wg.Wait()
+
+	if got := calls.Load(); got != 1 {
+		t.Fatalf("expected one upstream call, got %d", got)
+	}
+	for i, resp := range responses {
+		if errs[i] != nil || resp.StatusCode != http.StatusOK {
+			t.Fatalf("caller %d: %+v %v", i, resp, errs[i])
+		}
+		if resp.Headers.Get("Content-Encoding") != "" || !json.Valid(resp.Body) {
+			t.Fatalf("caller %d got an encoded body: %q", i, resp.Body)
+		}
+	}
+}
@@ -0,0 +1,317 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"tavily-proxy/server/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	CoordinationLocal = "local"
+	CoordinationDB    = "db"
+	CoordinationRedis = "redis"
+)
+
+// SchedulerLeaseName is the lease held by the instance that runs scheduled jobs.
+const SchedulerLeaseName = "scheduler"
+
+var ErrCoordinationBackend = errors.New("invalid_coordination_backend")
+
+// Coordinator shares leases and rate-limit counters between replicas.
+type Coordinator interface {
+	InstanceID() string
+	// AcquireLease takes the named lease, or renews it if this instance already
+	// holds it, for ttl. It reports whether this instance holds it afterwards.
+	AcquireLease(ctx context.Context, name string, ttl time.Duration) (bool, error)
+	ReleaseLease(ctx context.Context, name string) error
+	// IncrWindow adds one to the counter for name in the window starting at
+	// windowStart and returns the new total across all instances.
+	IncrWindow(ctx context.Context, name string, windowStart time.Time, window time.Duration) (int64, error)
+}
+
+// NewCoordinator builds the coordinator selected by COORDINATION_BACKEND.
+func NewCoordinator(backend string, db *gorm.DB, redisURL, instanceID string) (Coordinator, error) {
+	if strings.TrimSpace(instanceID) == "" {
+		instanceID = DefaultInstanceID()
+	}
+	switch strings.ToLower(strings.TrimSpace(backend)) {
+	case "", CoordinationLocal:
+		return NewLocalCoordinator(instanceID), nil
+	case CoordinationDB:
+		return NewDBCoordinator(db, instanceID), nil
+	case CoordinationRedis:
+		if strings.TrimSpace(redisURL) == "" {
+			return nil, fmt.Errorf("%w: REDIS_URL is required for the redis backend", ErrCoordinationBackend)
+		}
+		return NewRedisCoordinator(redisURL, instanceID)
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrCoordinationBackend, backend)
+	}
+}
+
+func DefaultInstanceID() string {
+	host, err := os.Hostname()
+	if err != nil || host == "" {
+		host = "instance"
+	}
+	return host + "-" + uuid.NewString()[:8]
+}
+
+// LocalCoordinator keeps everything in process; it is the single-instance
+// default and always wins its leases.
+type LocalCoordinator struct {
+	instanceID string
+
+	mu       sync.Mutex
+	counters map[string]rateBucket
+}
+
+func NewLocalCoordinator(instanceID string) *LocalCoordinator {
+	return &LocalCoordinator{instanceID: instanceID, counters: make(map[string]rateBucket)}
+}
+
+func (c *LocalCoordinator) InstanceID() string { return c.instanceID }
+
+func (c *LocalCoordinator) AcquireLease(context.Context, string, time.Duration) (bool, error) {
+	return true, nil
+}
+
+func (c *LocalCoordinator) ReleaseLease(context.Context, string) error { return nil }
+
+func (c *LocalCoordinator) IncrWindow(_ context.Context, name string, windowStart time.Time, window time.Duration) (int64, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cutoff := windowStart.Add(-2 * window)
+	for k, b := range c.counters {
+		if b.windowStart.Before(cutoff) {
+			delete(c.counters, k)
+		}
+	}
+
+	current, ok := c.counters[name]
+	if !ok || !current.windowStart.Equal(windowStart) {
+		current = rateBucket{windowStart: windowStart}
+	}
+	current.count++
+	c.counters[name] = current
+	return int64(current.count), nil
+}
+
+// DBCoordinator keeps leases and counters in the shared database, so it works
+// on any backend DATABASE_URL supports without extra infrastructure.
+type DBCoordinator struct {
+	db         *gorm.DB
+	instanceID string
+	lastGC     atomic.Int64
+}
+
+func NewDBCoordinator(db *gorm.DB, instanceID string) *DBCoordinator {
+	return &DBCoordinator{db: db, instanceID: instanceID}
+}
+
+func (c *DBCoordinator) InstanceID() string { return c.instanceID }
+
+func (c *DBCoordinator) AcquireLease(ctx context.Context, name string, ttl time.Duration) (bool, error) {
+	now := time.Now().UTC()
+	db := c.db.WithContext(ctx)
+
+	seed := models.CoordinationLease{Name: name, ExpiresAt: time.Unix(0, 0).UTC()}
+	if err := db.Clauses(clause.OnConflict{DoNothing: true}).Create(&seed).Error; err != nil {
+		return false, err
+	}
+
+	res := db.Model(&models.CoordinationLease{}).
+		Where("name = ? AND (holder = ? OR expires_at < ?)", name, c.instanceID, now).
+		Updates(map[string]any{"holder": c.instanceID, "expires_at": now.Add(ttl)})
+	if res.Error != nil {
+		return false, res.Error
+	}
+	return res.RowsAffected > 0, nil
+}
+
+func (c *DBCoordinator) ReleaseLease(ctx context.Context, name string) error {
+	return c.db.WithContext(ctx).
+		Model(&models.CoordinationLease{}).
+		Where("name = ? AND holder = ?", name, c.instanceID).
+		Updates(map[string]any{"holder": "", "expires_at": time.Unix(0, 0).UTC()}).
+		Error
+}
+
+func (c *DBCoordinator) IncrWindow(ctx context.Context, name string, windowStart time.Time, window time.Duration) (int64, error) {
+	db := c.db.WithContext(ctx)
+	row := models.RateCounter{
+		Name:        name,
+		WindowStart: windowStart.Unix(),
+		Count:       1,
+		ExpiresAt:   windowStart.Add(2 * window).UTC(),
+	}
+	err := db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "name"}, {Name: "window_start"}},
+		DoUpdates: clause.Assignments(map[string]any{
+			"count": gorm.Expr("? + ?", upsertCurrent("count"), 1),
+		}),
+	}).Create(&row).Error
+	if err != nil {
+		return 0, err
+	}
+
+	var current models.RateCounter
+	if err := db.Where("name = ? AND window_start = ?", name, row.WindowStart).First(&current).Error; err != nil {
+		return 0, err
+	}
+
+	c.gc(ctx, windowStart)
+	return current.Count, nil
+}
+
+// gc drops expired counters once per window, using the caller's clock.
+func (c *DBCoordinator) gc(ctx context.Context, windowStart time.Time) {
+	last := c.lastGC.Load()
+	if windowStart.Unix() <= last || !c.lastGC.CompareAndSwap(last, windowStart.Unix()) {
+		return
+	}
+	_ = c.db.WithContext(ctx).Where("expires_at < ?", windowStart.UTC()).Delete(&models.RateCounter{}).Error
+}
+
+const redisKeyPrefix = "tavily-proxy:"
+
+var redisAcquireLease = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	redis.call('PEXPIRE', KEYS[1], ARGV[2])
+	return 1
+end
+if redis.call('SET', KEYS[1], ARGV[1], 'NX', 'PX', ARGV[2]) then
+	return 1
+end
+return 0
+`)
+
+var redisReleaseLease = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('DEL', KEYS[1])
+end
+return 0
+`)
+
+// RedisCoordinator keeps leases and counters in Redis, which takes the
+// per-request counter writes off the database.
+type RedisCoordinator struct {
+	client     *redis.Client
+	instanceID string
+}
+
+func NewRedisCoordinator(redisURL, instanceID string) (*RedisCoordinator, error) {
+	opts, err := redis.ParseURL(redisURL)
+	if err != nil {
+		return nil, fmt.Errorf("invalid REDIS_URL: %w", err)
+	}
+	return &RedisCoordinator{client: redis.NewClient(opts), instanceID: instanceID}, nil
+}
+
+func (c *RedisCoordinator) InstanceID() string { return c.instanceID }
+
+func (c *RedisCoordinator) Close() error { return c.client.Close() }
+
+func (c *RedisCoordinator) AcquireLease(ctx context.Context, name string, ttl time.Duration) (bool, error) {
+	held, err := redisAcquireLease.Run(ctx, c.client, []string{redisKeyPrefix + "lease:" + name}, c.instanceID, ttl.Milliseconds()).Int()
+	if err != nil {
+		return false, err
+	}
+	return held == 1, nil
+}
+
+func (c *RedisCoordinator) ReleaseLease(ctx context.Context, name string) error {
+	return redisReleaseLease.Run(ctx, c.client, []string{redisKeyPrefix + "lease:" + name}, c.instanceID).Err()
+}
+
+func (c *RedisCoordinator) IncrWindow(ctx context.Context, name string, windowStart time.Time, window time.Duration) (int64, error) {
+	key := redisKeyPrefix + "rate:" + name + ":" + strconv.FormatInt(windowStart.Unix(), 10)
+	var incr *redis.IntCmd
+	_, err := c.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		incr = pipe.Incr(ctx, key)
+		pipe.PExpire(ctx, key, 2*window)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return incr.Val(), nil
+}
+
+// LeaderElector keeps renewing a lease in the background; scheduled jobs only
+// run while IsLeader reports true, so a fleet runs each of them once.
+type LeaderElector struct {
+	coordinator Coordinator
+	name        string
+	ttl         time.Duration
+	logger      *slog.Logger
+
+	leader atomic.Bool
+}
+
+func NewLeaderElector(coordinator Coordinator, name string, ttl time.Duration, logger *slog.Logger) *LeaderElector {
+	if ttl <= 0 {
+		ttl = 30 * time.Second
+	}
+	return &LeaderElector{coordinator: coordinator, name: name, ttl: ttl, logger: logger}
+}
+
+// IsLeader reports whether this instance currently holds the lease. A nil
+// elector always leads, which keeps single-instance callers simple.
+func (e *LeaderElector) IsLeader() bool {
+	if e == nil {
+		return true
+	}
+	return e.leader.Load()
+}
+
+// Start makes a first attempt synchronously, then renews every third of the
+// TTL until ctx is done, when the lease is handed back.
+func (e *LeaderElector) Start(ctx context.Context) {
+	e.tick(ctx)
+
+	go func() {
+		ticker := time.NewTicker(e.ttl / 3)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				releaseCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+				_ = e.coordinator.ReleaseLease(releaseCtx, e.name)
+				cancel()
+				e.leader.Store(false)
+				return
+			case <-ticker.C:
+				e.tick(ctx)
+			}
+		}
+	}()
+}
+
+func (e *LeaderElector) tick(ctx context.Context) {
+	held, err := e.coordinator.AcquireLease(ctx, e.name, e.ttl)
+	if err != nil {
+		// Step down rather than risk two leaders while the store is unreachable.
+		held = false
+		e.logger.Warn("leader election: lease renewal failed", "lease", e.name, "err", err)
+	}
+	if was := e.leader.Swap(held); was != held {
+		e.logger.Info("leader election: leadership changed", "lease", e.name, "instance", e.coordinator.InstanceID(), "leader", held)
+	}
+}
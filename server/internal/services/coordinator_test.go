@@ -0,0 +1,148 @@
+package services
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"tavily-proxy/server/internal/db"
+	"tavily-proxy/server/internal/models"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestDBCoordinator_LeaseAndSharedRateLimit(t *testing.T) {
+	t.Parallel()
+
+	database, err := db.Open(filepath.Join(t.TempDir(), "app.db"))
+	if err != nil {
+		t.Fatalf("db open: %v", err)
+	}
+	sqlDB, err := database.DB()
+	if err != nil {
+		t.Fatalf("db handle: %v", err)
+	}
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	ctx := context.Background()
+	a := NewDBCoordinator(database, "a")
+	b := NewDBCoordinator(database, "b")
+
+	if held, err := a.AcquireLease(ctx, SchedulerLeaseName, time.Minute); err != nil || !held {
+		t.Fatalf("a should take the free lease: %v %v", held, err)
+	}
+	if held, err := b.AcquireLease(ctx, SchedulerLeaseName, time.Minute); err != nil || held {
+		t.Fatalf("b should not take a held lease: %v %v", held, err)
+	}
+	if held, err := a.AcquireLease(ctx, SchedulerLeaseName, time.Minute); err != nil || !held {
+		t.Fatalf("a should renew its own lease: %v %v", held, err)
+	}
+
+	// An expired lease is up for grabs.
+	if err := database.Model(&models.CoordinationLease{}).Where("name = ?", SchedulerLeaseName).
+		Update("expires_at", time.Now().Add(-time.Second).UTC()).Error; err != nil {
+		t.Fatalf("expire lease: %v", err)
+	}
+	if held, err := b.AcquireLease(ctx, SchedulerLeaseName, time.Minute); err != nil || !held {
+		t.Fatalf("b should take the expired lease: %v %v", held, err)
+	}
+	if err := b.ReleaseLease(ctx, SchedulerLeaseName); err != nil {
+		t.Fatalf("release: %v", err)
+	}
+	if held, err := a.AcquireLease(ctx, SchedulerLeaseName, time.Minute); err != nil || !held {
+		t.Fatalf("a should take the released lease: %v %v", held, err)
+	}
+
+	// Two replicas with limit 3 admit three requests between them, not six.
+	now := time.Date(2024, 1, 1, 12, 0, 10, 0, time.UTC)
+	limiters := []*DistributedRateLimiter{
+		NewDistributedRateLimiter(time.Minute).WithCoordinator(a),
+		NewDistributedRateLimiter(time.Minute).WithCoordinator(b),
+	}
+	allowed := 0
+	for i := 0; i < 6; i++ {
+		if limiters[i%2].AllowContext(ctx, 9, 3, now) {
+			allowed++
+		}
+	}
+	if allowed != 3 {
+		t.Fatalf("expected 3 requests across replicas, got %d", allowed)
+	}
+	if !limiters[0].AllowContext(ctx, 9, 3, now.Add(time.Minute)) {
+		t.Fatalf("next window should start fresh")
+	}
+}
+
+func TestRedisCoordinator_LeaseAndCounter(t *testing.T) {
+	t.Parallel()
+
+	srv := miniredis.RunT(t)
+	ctx := context.Background()
+
+	a, err := NewRedisCoordinator("redis://"+srv.Addr(), "a")
+	if err != nil {
+		t.Fatalf("coordinator a: %v", err)
+	}
+	t.Cleanup(func() { _ = a.Close() })
+	b, err := NewRedisCoordinator("redis://"+srv.Addr(), "b")
+	if err != nil {
+		t.Fatalf("coordinator b: %v", err)
+	}
+	t.Cleanup(func() { _ = b.Close() })
+
+	if held, err := a.AcquireLease(ctx, "scheduler", time.Second); err != nil || !held {
+		t.Fatalf("a should take the free lease: %v %v", held, err)
+	}
+	if held, err := b.AcquireLease(ctx, "scheduler", time.Second); err != nil || held {
+		t.Fatalf("b should not take a held lease: %v %v", held, err)
+	}
+	srv.FastForward(2 * time.Second)
+	if held, err := b.AcquireLease(ctx, "scheduler", time.Second); err != nil || !held {
+		t.Fatalf("b should take the expired lease: %v %v", held, err)
+	}
+
+	windowStart := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	for i, c := range []Coordinator{a, b, a} {
+		n, err := c.IncrWindow(ctx, "dkey:1", windowStart, time.Minute)
+		if err != nil {
+			t.Fatalf("incr: %v", err)
+		}
+		if n != int64(i+1) {
+			t.Fatalf("expected shared count %d, got %d", i+1, n)
+		}
+	}
+}
+
+func TestLeaderElector_SingleLeader(t *testing.T) {
+	t.Parallel()
+
+	database, err := db.Open(filepath.Join(t.TempDir(), "app.db"))
+	if err != nil {
+		t.Fatalf("db open: %v", err)
+	}
+	sqlDB, err := database.DB()
+	if err != nil {
+		t.Fatalf("db handle: %v", err)
+	}
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	first := NewLeaderElector(NewDBCoordinator(database, "a"), SchedulerLeaseName, time.Minute, logger)
+	second := NewLeaderElector(NewDBCoordinator(database, "b"), SchedulerLeaseName, time.Minute, logger)
+	first.Start(ctx)
+	second.Start(ctx)
+
+	if !first.IsLeader() || second.IsLeader() {
+		t.Fatalf("expected exactly the first elector to lead: first=%v second=%v", first.IsLeader(), second.IsLeader())
+	}
+	var nilElector *LeaderElector
+	if !nilElector.IsLeader() {
+		t.Fatalf("nil elector should always lead")
+	}
+}
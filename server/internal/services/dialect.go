@@ -0,0 +1,55 @@
+package services
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// upsertCurrent references the stored row's column inside an upsert's update
+// clause. Postgres rejects the bare column name there as ambiguous.
+func upsertCurrent(column string) clause.Column {
+	return clause.Column{Table: clause.CurrentTable, Name: column}
+}
+
+// upsertExcluded references the value that conflicted on insert: EXCLUDED.col
+// on SQLite and Postgres, VALUES(col) on MySQL.
+func upsertExcluded(db *gorm.DB, column string) clause.Expr {
+	if db.Dialector.Name() == "mysql" {
+		return gorm.Expr("VALUES(?)", clause.Column{Name: column})
+	}
+	return gorm.Expr("?", clause.Column{Table: "excluded", Name: column})
+}
+
+// localTimeBucketExpr formats created_at in local time using the database's
+// own date functions, matching the bucket strings StatsService writes.
+func localTimeBucketExpr(db *gorm.DB, granularity string) string {
+	switch db.Dialector.Name() {
+	case "postgres":
+		switch granularity {
+		case "hour":
+			return "to_char(created_at, 'YYYY-MM-DD HH24:00')"
+		case "day":
+			return "to_char(created_at, 'YYYY-MM-DD')"
+		default:
+			return "to_char(created_at, 'YYYY-MM')"
+		}
+	case "mysql":
+		switch granularity {
+		case "hour":
+			return "DATE_FORMAT(created_at, '%Y-%m-%d %H:00')"
+		case "day":
+			return "DATE_FORMAT(created_at, '%Y-%m-%d')"
+		default:
+			return "DATE_FORMAT(created_at, '%Y-%m')"
+		}
+	default:
+		switch granularity {
+		case "hour":
+			return "strftime('%Y-%m-%d %H:00', created_at, 'localtime')"
+		case "day":
+			return "strftime('%Y-%m-%d', created_at, 'localtime')"
+		default:
+			return "strftime('%Y-%m', created_at, 'localtime')"
+		}
+	}
+}
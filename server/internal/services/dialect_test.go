@@ -0,0 +1,218 @@
+package services
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"tavily-proxy/server/internal/db"
+	"tavily-proxy/server/internal/models"
+
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+type sqlRecorder struct {
+	mu  sync.Mutex
+	sql []string
+}
+
+func (r *sqlRecorder) LogMode(logger.LogLevel) logger.Interface      { return r }
+func (r *sqlRecorder) Info(context.Context, string, ...interface{})  {}
+func (r *sqlRecorder) Warn(context.Context, string, ...interface{})  {}
+func (r *sqlRecorder) Error(context.Context, string, ...interface{}) {}
+func (r *sqlRecorder) Trace(_ context.Context, _ time.Time, fc func() (string, int64), _ error) {
+	sql, _ := fc()
+	r.mu.Lock()
+	r.sql = append(r.sql, sql)
+	r.mu.Unlock()
+}
+
+func (r *sqlRecorder) last() string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if len(r.sql) == 0 {
+		return ""
+	}
+	return r.sql[len(r.sql)-1]
+}
+
+// TestUpsertSQL_PerDialect renders the upserts without a server, so the
+// Postgres and MySQL syntax is checked even when no database is available.
+func TestUpsertSQL_PerDialect(t *testing.T) {
+	t.Parallel()
+
+	cases := []struct {
+		name      string
+		dialector gorm.Dialector
+		stats     string
+		usage     string
+		setting   string
+	}{
+		{
+			name:      "postgres",
+			dialector: postgres.New(postgres.Config{DSN: "postgres://u:p@127.0.0.1:1/db"}),
+			stats:     `ON CONFLICT ("granularity","bucket","endpoint") DO UPDATE SET "count"="request_stats"."count" + 1`,
+			usage:     `"total_count"="distributed_key_usage_dailies"."total_count" + "excluded"."total_count"`,
+			setting:   `WHERE "key" = 'k'`,
+		},
+		{
+			name:      "mysql",
+			dialector: mysql.New(mysql.Config{DSN: "u:p@tcp(127.0.0.1:1)/db", SkipInitializeWithVersion: true}),
+			stats:     "ON DUPLICATE KEY UPDATE `count`=`request_stats`.`count` + 1",
+			usage:     "`total_count`=`distributed_key_usage_dailies`.`total_count` + VALUES(`total_count`)",
+			setting:   "WHERE `key` = 'k'",
+		},
+	}
+
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			rec := &sqlRecorder{}
+			database, err := gorm.Open(tc.dialector, &gorm.Config{DryRun: true, DisableAutomaticPing: true, SkipDefaultTransaction: true, Logger: rec})
+			if err != nil {
+				t.Fatalf("open: %v", err)
+			}
+			ctx := context.Background()
+
+			if err := NewStatsService(database).upsertIncrement(ctx, "day", "2024-01-01", "", 1, time.Now()); err != nil {
+				t.Fatalf("upsert stats: %v", err)
+			}
+			if got := rec.last(); !strings.Contains(got, tc.stats) {
+				t.Fatalf("stats upsert:\n%s\nwant substring:\n%s", got, tc.stats)
+			}
+
+			if err := NewDistributedKeyUsageService(database).Record(ctx, 1, 200, time.Now()); err != nil {
+				t.Fatalf("record usage: %v", err)
+			}
+			if got := rec.last(); !strings.Contains(got, tc.usage) {
+				t.Fatalf("usage upsert:\n%s\nwant substring:\n%s", got, tc.usage)
+			}
+
+			if _, _, err := NewSettingsService(database).Get(ctx, "k"); err != nil {
+				t.Fatalf("get setting: %v", err)
+			}
+			if got := rec.last(); !strings.Contains(got, tc.setting) {
+				t.Fatalf("setting lookup:\n%s\nwant substring:\n%s", got, tc.setting)
+			}
+		})
+	}
+}
+
+// TestDialectUpserts_Integration always runs against SQLite. Point
+// TAVILY_PROXY_TEST_POSTGRES_URL / TAVILY_PROXY_TEST_MYSQL_URL at a disposable
+// database (e.g. a local container) to run it there too; its tables are wiped.
+func TestDialectUpserts_Integration(t *testing.T) {
+	t.Parallel()
+
+	targets := map[string]string{"sqlite": ""}
+	for name, env := range map[string]string{
+		"postgres": "TAVILY_PROXY_TEST_POSTGRES_URL",
+		"mysql":    "TAVILY_PROXY_TEST_MYSQL_URL",
+	} {
+		if url := os.Getenv(env); url != "" {
+			targets[name] = url
+		}
+	}
+
+	for name, url := range targets {
+		name, url := name, url
+		t.Run(name, func(t *testing.T) {
+			database, err := db.OpenURL(url, filepath.Join(t.TempDir(), "app.db"))
+			if err != nil {
+				t.Fatalf("db open: %v", err)
+			}
+			sqlDB, err := database.DB()
+			if err != nil {
+				t.Fatalf("db handle: %v", err)
+			}
+			t.Cleanup(func() { _ = sqlDB.Close() })
+			for _, model := range db.Models() {
+				if err := database.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(model).Error; err != nil {
+					t.Fatalf("wipe %T: %v", model, err)
+				}
+			}
+
+			ctx := context.Background()
+			when := time.Date(2024, 5, 6, 7, 8, 0, 0, time.Local)
+
+			usage := NewDistributedKeyUsageService(database)
+			for _, code := range []int{200, 200, 429} {
+				if err := usage.Record(ctx, 7, code, when); err != nil {
+					t.Fatalf("record usage: %v", err)
+				}
+			}
+			totals, err := usage.Totals(ctx, 7)
+			if err != nil {
+				t.Fatalf("usage totals: %v", err)
+			}
+			if totals.TotalCount != 3 || totals.Status2xx != 2 || totals.Status4xx != 1 {
+				t.Fatalf("unexpected usage totals: %+v", totals)
+			}
+
+			stats := NewStatsService(database)
+			for i := 0; i < 2; i++ {
+				if err := stats.RecordRequest(ctx, "/search", when); err != nil {
+					t.Fatalf("record request: %v", err)
+				}
+				if err := stats.RecordRollup(ctx, RequestEvent{Endpoint: "/search", StatusCode: 200, LatencyMs: int64(40 * (i + 1)), OccurredAt: when}); err != nil {
+					t.Fatalf("record rollup: %v", err)
+				}
+			}
+			var day models.RequestStat
+			if err := database.Where("granularity = ? AND bucket = ? AND endpoint = ?", "day", "2024-05-06", "/search").First(&day).Error; err != nil {
+				t.Fatalf("load day stat: %v", err)
+			}
+			var rollup models.RequestRollup
+			if err := database.First(&rollup).Error; err != nil {
+				t.Fatalf("load rollup: %v", err)
+			}
+			if day.Count != 2 || rollup.Count != 2 || rollup.LatencySumMs != 120 || rollup.LatencyMaxMs != 80 {
+				t.Fatalf("unexpected counters: day=%d rollup=%+v", day.Count, rollup)
+			}
+
+			settings := NewSettingsService(database)
+			for _, v := range []string{"a", "b"} {
+				if err := settings.Set(ctx, "dialect_test", v); err != nil {
+					t.Fatalf("set setting: %v", err)
+				}
+			}
+			if v, ok, err := settings.Get(ctx, "dialect_test"); err != nil || !ok || v != "b" {
+				t.Fatalf("unexpected setting: %q %v %v", v, ok, err)
+			}
+
+			keys := NewKeyService(database, slog.New(slog.NewTextHandler(io.Discard, nil)))
+			if _, err := keys.Create(ctx, "tvly-dialect", "main", 1000); err != nil {
+				t.Fatalf("create key: %v", err)
+			}
+			if found, err := keys.FindByKey(ctx, "tvly-dialect"); err != nil || found == nil {
+				t.Fatalf("find key: %v %v", found, err)
+			}
+
+			if err := database.Create(&models.RequestLog{RequestID: "r1", Endpoint: "/search", StatusCode: 200, CreatedAt: when}).Error; err != nil {
+				t.Fatalf("create log: %v", err)
+			}
+			if err := database.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&models.RequestStat{}).Error; err != nil {
+				t.Fatalf("clear stats: %v", err)
+			}
+			if err := stats.BackfillFromLogsIfEmpty(ctx); err != nil {
+				t.Fatalf("backfill: %v", err)
+			}
+			var backfilled int64
+			database.Model(&models.RequestStat{}).Where("granularity = ? AND endpoint = ?", "month", "/search").Count(&backfilled)
+			if backfilled != 1 {
+				t.Fatalf("unexpected backfilled month rows: %d", backfilled)
+			}
+		})
+	}
+}
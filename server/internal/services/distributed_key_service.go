@@ -281,7 +281,7 @@ func isUniqueConstraintError(err error) bool {
 		return false
 	}
 	msg := strings.ToLower(err.Error())
-	return strings.Contains(msg, "unique constraint") || strings.Contains(msg, "duplicate key")
+	return strings.Contains(msg, "unique constraint") || strings.Contains(msg, "duplicate key") || strings.Contains(msg, "duplicate entry")
 }
 
 func ParseRFC3339Ptr(raw string) (*time.Time, error) {
@@ -67,10 +67,10 @@ func (s *DistributedKeyUsageService) Record(ctx context.Context, distributedKeyI
 				{Name: "date"},
 			},
 			DoUpdates: clause.Assignments(map[string]any{
-				"total_count": gorm.Expr("total_count + EXCLUDED.total_count"),
-				"status_2xx":  gorm.Expr("status_2xx + EXCLUDED.status_2xx"),
-				"status_4xx":  gorm.Expr("status_4xx + EXCLUDED.status_4xx"),
-				"status_5xx":  gorm.Expr("status_5xx + EXCLUDED.status_5xx"),
+				"total_count": gorm.Expr("? + ?", upsertCurrent("total_count"), upsertExcluded(s.db, "total_count")),
+				"status_2xx":  gorm.Expr("? + ?", upsertCurrent("status_2xx"), upsertExcluded(s.db, "status_2xx")),
+				"status_4xx":  gorm.Expr("? + ?", upsertCurrent("status_4xx"), upsertExcluded(s.db, "status_4xx")),
+				"status_5xx":  gorm.Expr("? + ?", upsertCurrent("status_5xx"), upsertExcluded(s.db, "status_5xx")),
 				"updated_at":  when.UTC(),
 			}),
 		}).
@@ -1,12 +1,15 @@
 package services
 
 import (
+	"context"
+	"strconv"
 	"sync"
 	"time"
 )
 
 type DistributedRateLimiter struct {
-	window time.Duration
+	window      time.Duration
+	coordinator Coordinator
 
 	mu      sync.Mutex
 	buckets map[uint]rateBucket
@@ -27,7 +30,18 @@ func NewDistributedRateLimiter(window time.Duration) *DistributedRateLimiter {
 	}
 }
 
+// WithCoordinator shares the counters with other instances, so the limit
+// applies to the fleet rather than to each replica.
+func (l *DistributedRateLimiter) WithCoordinator(coordinator Coordinator) *DistributedRateLimiter {
+	l.coordinator = coordinator
+	return l
+}
+
 func (l *DistributedRateLimiter) Allow(keyID uint, limit int, now time.Time) bool {
+	return l.AllowContext(context.Background(), keyID, limit, now)
+}
+
+func (l *DistributedRateLimiter) AllowContext(ctx context.Context, keyID uint, limit int, now time.Time) bool {
 	if keyID == 0 || limit == 0 {
 		return true
 	}
@@ -37,6 +51,14 @@ func (l *DistributedRateLimiter) Allow(keyID uint, limit int, now time.Time) boo
 
 	windowStart := now.UTC().Truncate(l.window)
 
+	if l.coordinator != nil {
+		count, err := l.coordinator.IncrWindow(ctx, "dkey:"+strconv.FormatUint(uint64(keyID), 10), windowStart, l.window)
+		if err == nil {
+			return count <= int64(limit)
+		}
+		// Fall back to this instance's own counter while the shared store is unreachable.
+	}
+
 	l.mu.Lock()
 	defer l.mu.Unlock()
 
@@ -0,0 +1,385 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"tavily-proxy/server/internal/models"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrFilterNotFound       = errors.New("filter_not_found")
+	ErrFilterNameTaken      = errors.New("filter_name_taken")
+	ErrFilterInvalidName    = errors.New("invalid_filter_name")
+	ErrFilterInvalidKind    = errors.New("invalid_filter_kind")
+	ErrFilterInvalidPattern = errors.New("invalid_filter_pattern")
+	ErrFilterUnreadableBody = errors.New("unfilterable_response")
+)
+
+// Response filter kinds. The domain and url kinds drop results; the redact
+// kinds replace matches in result content.
+const (
+	FilterDomain       = "domain"
+	FilterDomainSuffix = "domain_suffix"
+	FilterURLRegex     = "url_regex"
+	FilterRedactEmail  = "redact_email"
+	FilterRedactPhone  = "redact_phone"
+	FilterRedactRegex  = "redact_regex"
+)
+
+// FilteredResultsHeader reports how many results filters removed from a
+// response.
+const FilteredResultsHeader = "X-Proxy-Filtered-Results"
+
+const defaultRedaction = "[redacted]"
+
+var (
+	emailPattern = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)
+	phonePattern = regexp.MustCompile(`(?:\+\d{1,3}[\s.-]?)?(?:\(\d{2,4}\)|\d{2,4})[\s.-]\d{3,4}[\s.-]\d{3,4}`)
+)
+
+type FilterInput struct {
+	Name        string
+	Enabled     bool
+	Kind        string
+	Pattern     string
+	Replacement string
+}
+
+// defaultFilterCacheTTL bounds how stale filters written by another replica
+// can be; writes through this service reload immediately.
+const defaultFilterCacheTTL = 10 * time.Second
+
+type redaction struct {
+	re          *regexp.Regexp
+	replacement string
+}
+
+// filterSet is the compiled form of the enabled filters.
+type filterSet struct {
+	domains    map[string]bool
+	suffixes   []string
+	urlRegexes []*regexp.Regexp
+	redactions []redaction
+}
+
+func (f *filterSet) empty() bool {
+	return len(f.domains) == 0 && len(f.suffixes) == 0 && len(f.urlRegexes) == 0 && len(f.redactions) == 0
+}
+
+func (f *filterSet) blocks(raw string) bool {
+	if raw == "" {
+		return false
+	}
+	for _, re := range f.urlRegexes {
+		if re.MatchString(raw) {
+			return true
+		}
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return false
+	}
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	if host == "" {
+		return false
+	}
+	if f.domains[host] {
+		return true
+	}
+	for _, suffix := range f.suffixes {
+		if host == suffix || strings.HasSuffix(host, "."+suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// redact reports how many matches it replaced.
+func (f *filterSet) redact(s string) (string, int) {
+	total := 0
+	for _, r := range f.redactions {
+		n := 0
+		s = r.re.ReplaceAllStringFunc(s, func(string) string {
+			n++
+			return r.replacement
+		})
+		total += n
+	}
+	return s, total
+}
+
+// FilterService stores response filters and applies them to /search and
+// /extract responses. The compiled filters are cached since they are used on
+// every response.
+type FilterService struct {
+	db     *gorm.DB
+	logger *slog.Logger
+
+	cacheTTL time.Duration
+	mu       sync.Mutex
+	cached   *filterSet
+	expires  time.Time
+}
+
+func NewFilterService(db *gorm.DB, logger *slog.Logger) *FilterService {
+	return &FilterService{db: db, logger: logger, cacheTTL: defaultFilterCacheTTL}
+}
+
+// WithCacheTTL changes how long compiled filters are cached; 0 disables the
+// cache.
+func (s *FilterService) WithCacheTTL(ttl time.Duration) *FilterService {
+	s.cacheTTL = ttl
+	s.InvalidateCache()
+	return s
+}
+
+// InvalidateCache makes the next response reload filters, e.g. after a
+// restore replaced the table.
+func (s *FilterService) InvalidateCache() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cached, s.expires = nil, time.Time{}
+}
+
+func (s *FilterService) List(ctx context.Context) ([]models.ResponseFilter, error) {
+	var out []models.ResponseFilter
+	err := s.db.WithContext(ctx).Order("id asc").Find(&out).Error
+	return out, err
+}
+
+func (s *FilterService) Get(ctx context.Context, id uint) (*models.ResponseFilter, error) {
+	var filter models.ResponseFilter
+	if err := s.db.WithContext(ctx).First(&filter, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrFilterNotFound
+		}
+		return nil, err
+	}
+	return &filter, nil
+}
+
+func (s *FilterService) Create(ctx context.Context, in FilterInput) (*models.ResponseFilter, error) {
+	filter, err := newFilter(in)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.db.WithContext(ctx).Create(&filter).Error; err != nil {
+		if isUniqueConstraintError(err) {
+			return nil, ErrFilterNameTaken
+		}
+		return nil, err
+	}
+	s.InvalidateCache()
+	s.logger.Info("response filter created", "id", filter.ID, "name", filter.Name, "kind", filter.Kind)
+	return &filter, nil
+}
+
+// Update replaces every field of the filter.
+func (s *FilterService) Update(ctx context.Context, id uint, in FilterInput) (*models.ResponseFilter, error) {
+	existing, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	filter, err := newFilter(in)
+	if err != nil {
+		return nil, err
+	}
+	filter.ID, filter.CreatedAt = existing.ID, existing.CreatedAt
+	if err := s.db.WithContext(ctx).Save(&filter).Error; err != nil {
+		if isUniqueConstraintError(err) {
+			return nil, ErrFilterNameTaken
+		}
+		return nil, err
+	}
+	s.InvalidateCache()
+	return &filter, nil
+}
+
+func (s *FilterService) Delete(ctx context.Context, id uint) error {
+	res := s.db.WithContext(ctx).Delete(&models.ResponseFilter{}, id)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrFilterNotFound
+	}
+	s.InvalidateCache()
+	return nil
+}
+
+func newFilter(in FilterInput) (models.ResponseFilter, error) {
+	f := models.ResponseFilter{
+		Name:        strings.TrimSpace(in.Name),
+		Enabled:     in.Enabled,
+		Kind:        strings.ToLower(strings.TrimSpace(in.Kind)),
+		Pattern:     strings.TrimSpace(in.Pattern),
+		Replacement: in.Replacement,
+	}
+	if f.Name == "" || len(f.Name) > 64 {
+		return f, ErrFilterInvalidName
+	}
+	if len(f.Pattern) > 1024 || len(f.Replacement) > 64 {
+		return f, fmt.Errorf("%w: pattern or replacement is too long", ErrFilterInvalidPattern)
+	}
+	switch f.Kind {
+	case FilterDomain, FilterDomainSuffix:
+		f.Pattern = strings.TrimPrefix(strings.ToLower(f.Pattern), ".")
+		if f.Pattern == "" || strings.ContainsAny(f.Pattern, "/:* ") {
+			return f, fmt.Errorf("%w: expected a host name such as example.com", ErrFilterInvalidPattern)
+		}
+	case FilterURLRegex, FilterRedactRegex:
+		if f.Pattern == "" {
+			return f, fmt.Errorf("%w: pattern is required", ErrFilterInvalidPattern)
+		}
+		if _, err := regexp.Compile(f.Pattern); err != nil {
+			return f, fmt.Errorf("%w: %v", ErrFilterInvalidPattern, err)
+		}
+	case FilterRedactEmail, FilterRedactPhone:
+		f.Pattern = ""
+	default:
+		return f, ErrFilterInvalidKind
+	}
+	return f, nil
+}
+
+func (s *FilterService) load(ctx context.Context) (*filterSet, error) {
+	now := time.Now()
+	if s.cacheTTL > 0 {
+		s.mu.Lock()
+		cached, expires := s.cached, s.expires
+		s.mu.Unlock()
+		if cached != nil && now.Before(expires) {
+			return cached, nil
+		}
+	}
+	var rows []models.ResponseFilter
+	if err := s.db.WithContext(ctx).Where("enabled = ?", true).Order("id asc").Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	set := &filterSet{domains: map[string]bool{}}
+	for _, row := range rows {
+		replacement := row.Replacement
+		if replacement == "" {
+			replacement = defaultRedaction
+		}
+		switch row.Kind {
+		case FilterDomain:
+			set.domains[row.Pattern] = true
+		case FilterDomainSuffix:
+			set.suffixes = append(set.suffixes, row.Pattern)
+		case FilterURLRegex, FilterRedactRegex:
+			re, err := regexp.Compile(row.Pattern)
+			if err != nil {
+				// Patterns are validated on write; skip rows edited by hand.
+				s.logger.Warn("response filter skipped", "id", row.ID, "err", err)
+				continue
+			}
+			if row.Kind == FilterURLRegex {
+				set.urlRegexes = append(set.urlRegexes, re)
+			} else {
+				set.redactions = append(set.redactions, redaction{re: re, replacement: replacement})
+			}
+		case FilterRedactEmail:
+			set.redactions = append(set.redactions, redaction{re: emailPattern, replacement: replacement})
+		case FilterRedactPhone:
+			set.redactions = append(set.redactions, redaction{re: phonePattern, replacement: replacement})
+		}
+	}
+	if s.cacheTTL > 0 {
+		s.mu.Lock()
+		s.cached, s.expires = set, now.Add(s.cacheTTL)
+		s.mu.Unlock()
+	}
+	return set, nil
+}
+
+// Apply filters a successful /search or /extract response. Blocked results
+// and images are removed, content and raw_content are redacted, and a changed
+// body gets a filtered_results count. Other responses are returned as is; a
+// body that cannot be decoded while filters are active is an error.
+func (s *FilterService) Apply(ctx context.Context, path string, resp ProxyResponse) (ProxyResponse, error) {
+	if path != "/search" && path != "/extract" {
+		return resp, nil
+	}
+	set, err := s.load(ctx)
+	if err != nil {
+		return resp, err
+	}
+	if set.empty() {
+		return resp, nil
+	}
+	var body map[string]any
+	dec := json.NewDecoder(bytes.NewReader(resp.Body))
+	dec.UseNumber()
+	if err := dec.Decode(&body); err != nil {
+		return resp, fmt.Errorf("%w: %v", ErrFilterUnreadableBody, err)
+	}
+
+	removed, redacted := 0, 0
+	if results, ok := body["results"].([]any); ok {
+		kept := make([]any, 0, len(results))
+		for _, r := range results {
+			item, ok := r.(map[string]any)
+			if !ok {
+				kept = append(kept, r)
+				continue
+			}
+			if u, _ := item["url"].(string); set.blocks(u) {
+				removed++
+				continue
+			}
+			for _, field := range []string{"content", "raw_content"} {
+				if text, ok := item[field].(string); ok {
+					var n int
+					item[field], n = set.redact(text)
+					redacted += n
+				}
+			}
+			kept = append(kept, item)
+		}
+		body["results"] = kept
+	}
+	if images, ok := body["images"].([]any); ok {
+		kept := make([]any, 0, len(images))
+		for _, img := range images {
+			u, _ := img.(string)
+			if m, ok := img.(map[string]any); ok {
+				u, _ = m["url"].(string)
+			}
+			if !set.blocks(u) {
+				kept = append(kept, img)
+			}
+		}
+		body["images"] = kept
+	}
+
+	resp.Headers = resp.Headers.Clone()
+	if resp.Headers == nil {
+		resp.Headers = make(map[string][]string)
+	}
+	resp.Headers.Set(FilteredResultsHeader, strconv.Itoa(removed))
+	if removed == 0 && redacted == 0 {
+		return resp, nil
+	}
+	body["filtered_results"] = removed
+	raw, err := json.Marshal(body)
+	if err != nil {
+		return resp, err
+	}
+	resp.Body = raw
+	resp.Headers.Del("Content-Length")
+	return resp, nil
+}
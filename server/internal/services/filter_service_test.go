@@ -0,0 +1,176 @@
+package services
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"tavily-proxy/server/internal/db"
+)
+
+func TestFilterService_FiltersSearchResults(t *testing.T) {
+	t.Parallel()
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"query":"q","images":["https://cdn.blocked.example/a.png","https://ok.example/b.png"],"results":[
+			{"url":"https://blocked.example/page","content":"x"},
+			{"url":"https://news.tracker.example/a","content":"x"},
+			{"url":"https://ok.example/ads/1","content":"x"},
+			{"url":"https://ok.example/article","content":"mail jane.doe@corp.example or call +1 555-123-4567","raw_content":"jane.doe@corp.example"}
+		],"response_time":1.5}`))
+	}))
+	t.Cleanup(upstream.Close)
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	database, err := db.Open(filepath.Join(t.TempDir(), "app.db"))
+	if err != nil {
+		t.Fatalf("db open: %v", err)
+	}
+	sqlDB, err := database.DB()
+	if err != nil {
+		t.Fatalf("db handle: %v", err)
+	}
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	ctx := context.Background()
+	keys := NewKeyService(database, logger)
+	if _, err := keys.Create(ctx, "tvly-test", "test", 1000); err != nil {
+		t.Fatalf("create key: %v", err)
+	}
+	filters := NewFilterService(database, logger)
+	proxy := NewTavilyProxy(upstream.URL, 5*time.Second, keys, nil, nil, logger).WithFilters(filters)
+
+	search := func() (ProxyResponse, map[string]any) {
+		t.Helper()
+		resp, err := proxy.Do(ctx, ProxyRequest{Method: http.MethodPost, Path: "/search", Body: []byte(`{"query":"q"}`)})
+		if err != nil {
+			t.Fatalf("search: %v", err)
+		}
+		var body map[string]any
+		if err := json.Unmarshal(resp.Body, &body); err != nil {
+			t.Fatalf("decode: %v", err)
+		}
+		return resp, body
+	}
+
+	if _, body := search(); len(body["results"].([]any)) != 4 || body["filtered_results"] != nil {
+		t.Fatalf("no filters should leave the response untouched: %v", body)
+	}
+
+	for _, in := range []FilterInput{
+		{Name: "blocked", Enabled: true, Kind: FilterDomainSuffix, Pattern: "blocked.example"},
+		{Name: "tracker", Enabled: true, Kind: FilterDomain, Pattern: "News.Tracker.example"},
+		{Name: "ads", Enabled: true, Kind: FilterURLRegex, Pattern: `/ads/`},
+		{Name: "emails", Enabled: true, Kind: FilterRedactEmail},
+		{Name: "phones", Enabled: true, Kind: FilterRedactPhone, Replacement: "[phone]"},
+		{Name: "off", Enabled: false, Kind: FilterDomain, Pattern: "ok.example"},
+	} {
+		if _, err := filters.Create(ctx, in); err != nil {
+			t.Fatalf("create %s: %v", in.Name, err)
+		}
+	}
+
+	resp, body := search()
+	results := body["results"].([]any)
+	if len(results) != 1 || body["filtered_results"] != 3.0 || body["response_time"] != 1.5 {
+		t.Fatalf("unexpected filtered body: %v", body)
+	}
+	kept := results[0].(map[string]any)
+	if kept["content"] != "mail [redacted] or call [phone]" || kept["raw_content"] != "[redacted]" {
+		t.Fatalf("content not redacted: %v", kept)
+	}
+	if images := body["images"].([]any); len(images) != 1 || images[0] != "https://ok.example/b.png" {
+		t.Fatalf("blocked images should be dropped: %v", images)
+	}
+	if got := resp.Headers.Get(FilteredResultsHeader); got != "3" {
+		t.Fatalf("expected filtered header 3, got %q", got)
+	}
+
+	if _, err := filters.Create(ctx, FilterInput{Name: "bad", Kind: FilterURLRegex, Pattern: "("}); !errors.Is(err, ErrFilterInvalidPattern) {
+		t.Fatalf("invalid regex must be rejected, got %v", err)
+	}
+	if _, err := filters.Create(ctx, FilterInput{Name: "bad", Kind: FilterDomain, Pattern: "https://x.example/"}); !errors.Is(err, ErrFilterInvalidPattern) {
+		t.Fatalf("URL as domain must be rejected, got %v", err)
+	}
+	if _, err := filters.Create(ctx, FilterInput{Name: "bad", Kind: "block"}); !errors.Is(err, ErrFilterInvalidKind) {
+		t.Fatalf("unknown kind must be rejected, got %v", err)
+	}
+	if _, err := filters.Create(ctx, FilterInput{Name: "ads", Kind: FilterRedactEmail}); !errors.Is(err, ErrFilterNameTaken) {
+		t.Fatalf("duplicate names must be rejected, got %v", err)
+	}
+}
+
+func TestFilterService_FailsClosed(t *testing.T) {
+	t.Parallel()
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/extract" {
+			_, _ = w.Write([]byte("<html>not json</html>"))
+			return
+		}
+		body := []byte(`{"results":[{"url":"https://blocked.example/page","content":"x"},{"url":"https://ok.example/","content":"x"}]}`)
+		w.Header().Set("Content-Type", "application/json")
+		if strings.Contains(r.Header.Get("Accept-Encoding"), "gzip") {
+			var buf bytes.Buffer
+			zw := gzip.NewWriter(&buf)
+			_, _ = zw.Write(body)
+			_ = zw.Close()
+			w.Header().Set("Content-Encoding", "gzip")
+			body = buf.Bytes()
+		}
+		_, _ = w.Write(body)
+	}))
+	t.Cleanup(upstream.Close)
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	database, err := db.Open(filepath.Join(t.TempDir(), "app.db"))
+	if err != nil {
+		t.Fatalf("db open: %v", err)
+	}
+	sqlDB, err := database.DB()
+	if err != nil {
+		t.Fatalf("db handle: %v", err)
+	}
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	ctx := context.Background()
+	keys := NewKeyService(database, logger)
+	if _, err := keys.Create(ctx, "tvly-test", "test", 1000); err != nil {
+		t.Fatalf("create key: %v", err)
+	}
+	filters := NewFilterService(database, logger)
+	if _, err := filters.Create(ctx, FilterInput{Name: "blocked", Enabled: true, Kind: FilterDomainSuffix, Pattern: "blocked.example"}); err != nil {
+		t.Fatalf("create filter: %v", err)
+	}
+	proxy := NewTavilyProxy(upstream.URL, 5*time.Second, keys, nil, nil, logger).WithFilters(filters)
+
+	// A client asking for gzip must not get the body past the filters.
+	headers := http.Header{}
+	headers.Set("Accept-Encoding", "gzip, deflate")
+	resp, err := proxy.Do(ctx, ProxyRequest{Method: http.MethodPost, Path: "/search", Headers: headers, Body: []byte(`{"query":"q"}`)})
+	if err != nil {
+		t.Fatalf("search: %v", err)
+	}
+	var body map[string]any
+	if err := json.Unmarshal(resp.Body, &body); err != nil {
+		t.Fatalf("decode: %v (%q)", err, resp.Body)
+	}
+	if results := body["results"].([]any); len(results) != 1 || body["filtered_results"] != 1.0 {
+		t.Fatalf("gzip response was not filtered: %v", body)
+	}
+
+	if _, err := proxy.Do(ctx, ProxyRequest{Method: http.MethodPost, Path: "/extract", Body: []byte(`{"urls":["https://ok.example/"]}`)}); !errors.Is(err, ErrFilterUnreadableBody) {
+		t.Fatalf("undecodable body must not be returned unfiltered, got %v", err)
+	}
+}
@@ -0,0 +1,191 @@
+package services
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"tavily-proxy/server/internal/models"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrIdempotencyKeyInvalid  = errors.New("invalid_idempotency_key")
+	ErrIdempotencyKeyReused   = errors.New("idempotency_key_reused")
+	ErrIdempotencyInProgress  = errors.New("idempotency_key_in_progress")
+	ErrIdempotencyTooLarge    = errors.New("idempotency_response_too_large")
+	errIdempotencyKeyConflict = errors.New("idempotency key conflict")
+)
+
+// idempotencyLockTTL is how long a request that never completed (e.g. the
+// process died) keeps its key locked.
+const idempotencyLockTTL = 10 * time.Minute
+
+// defaultIdempotencyMaxBody is the largest response body kept for replay.
+const defaultIdempotencyMaxBody = 1 << 20
+
+type IdempotencyRequest struct {
+	// Scope is the caller credential the key belongs to, so callers cannot
+	// see each other's responses.
+	Scope    string
+	Key      string
+	Method   string
+	Path     string
+	RawQuery string
+	Body     []byte
+}
+
+type StoredResponse struct {
+	StatusCode int
+	Headers    http.Header
+	Body       []byte
+}
+
+// IdempotencyService remembers the first response to a request sent with an
+// Idempotency-Key so retries get the same response instead of a second
+// upstream call.
+type IdempotencyService struct {
+	db      *gorm.DB
+	logger  *slog.Logger
+	ttl     time.Duration
+	maxBody int
+}
+
+func NewIdempotencyService(db *gorm.DB, logger *slog.Logger) *IdempotencyService {
+	return &IdempotencyService{db: db, logger: logger, ttl: 24 * time.Hour, maxBody: defaultIdempotencyMaxBody}
+}
+
+func (s *IdempotencyService) WithTTL(ttl time.Duration) *IdempotencyService {
+	if ttl > 0 {
+		s.ttl = ttl
+	}
+	return s
+}
+
+func (s *IdempotencyService) WithMaxBody(n int) *IdempotencyService {
+	if n > 0 {
+		s.maxBody = n
+	}
+	return s
+}
+
+// MaxBody is the largest response body Complete accepts.
+func (s *IdempotencyService) MaxBody() int { return s.maxBody }
+
+// Begin claims the key for req. It returns the stored response when the key
+// was already used for the same request, and nil when the caller should go
+// ahead and then call Complete or Release.
+func (s *IdempotencyService) Begin(ctx context.Context, req IdempotencyRequest, now time.Time) (*StoredResponse, error) {
+	if !validIdempotencyKey(req.Key) {
+		return nil, ErrIdempotencyKeyInvalid
+	}
+	fingerprint := idempotencyFingerprint(req)
+
+	for attempt := 0; attempt < 3; attempt++ {
+		var existing models.IdempotencyRecord
+		err := s.db.WithContext(ctx).Where("scope = ? AND idempotency_key = ?", req.Scope, req.Key).First(&existing).Error
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			record := models.IdempotencyRecord{
+				Scope:       req.Scope,
+				Key:         req.Key,
+				Fingerprint: fingerprint,
+				ExpiresAt:   now.Add(idempotencyLockTTL),
+			}
+			err = s.db.WithContext(ctx).Create(&record).Error
+			if err == nil {
+				return nil, nil
+			}
+			if isUniqueConstraintError(err) {
+				// Another request claimed the key first.
+				continue
+			}
+			return nil, err
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !existing.ExpiresAt.After(now) {
+			if err := s.db.WithContext(ctx).Where("id = ? AND expires_at = ?", existing.ID, existing.ExpiresAt).Delete(&models.IdempotencyRecord{}).Error; err != nil {
+				return nil, err
+			}
+			continue
+		}
+		if existing.Fingerprint != fingerprint {
+			return nil, ErrIdempotencyKeyReused
+		}
+		if existing.StatusCode == 0 {
+			return nil, ErrIdempotencyInProgress
+		}
+		stored := &StoredResponse{StatusCode: existing.StatusCode, Headers: http.Header{}, Body: existing.Body}
+		if existing.Headers != "" {
+			if err := json.Unmarshal([]byte(existing.Headers), &stored.Headers); err != nil {
+				return nil, err
+			}
+		}
+		return stored, nil
+	}
+	return nil, errIdempotencyKeyConflict
+}
+
+// Complete stores the response for the key claimed by Begin and keeps it for
+// the configured TTL. A body over MaxBody is not stored and the caller should
+// release the key instead.
+func (s *IdempotencyService) Complete(ctx context.Context, scope, key string, resp StoredResponse, now time.Time) error {
+	if len(resp.Body) > s.maxBody {
+		return ErrIdempotencyTooLarge
+	}
+	headers, err := json.Marshal(resp.Headers)
+	if err != nil {
+		return err
+	}
+	return s.db.WithContext(ctx).Model(&models.IdempotencyRecord{}).
+		Where("scope = ? AND idempotency_key = ? AND status_code = ?", scope, key, 0).
+		Updates(map[string]any{
+			"status_code": resp.StatusCode,
+			"headers":     string(headers),
+			"body":        resp.Body,
+			"expires_at":  now.Add(s.ttl),
+		}).Error
+}
+
+// Release frees a key claimed by Begin whose request produced no response
+// worth replaying, so the client can retry it.
+func (s *IdempotencyService) Release(ctx context.Context, scope, key string) error {
+	return s.db.WithContext(ctx).
+		Where("scope = ? AND idempotency_key = ? AND status_code = ?", scope, key, 0).
+		Delete(&models.IdempotencyRecord{}).Error
+}
+
+func (s *IdempotencyService) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	res := s.db.WithContext(ctx).Where("expires_at <= ?", now).Delete(&models.IdempotencyRecord{})
+	return res.RowsAffected, res.Error
+}
+
+func validIdempotencyKey(key string) bool {
+	if key == "" || len(key) > 255 {
+		return false
+	}
+	for _, r := range key {
+		if r < 0x21 || r > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+func idempotencyFingerprint(req IdempotencyRequest) string {
+	h := sha256.New()
+	for _, part := range []string{strings.ToUpper(req.Method), req.Path, req.RawQuery} {
+		h.Write([]byte(part))
+		h.Write([]byte{0})
+	}
+	h.Write(req.Body)
+	return hex.EncodeToString(h.Sum(nil))
+}
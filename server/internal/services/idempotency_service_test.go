@@ -0,0 +1,81 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"tavily-proxy/server/internal/db"
+)
+
+func TestIdempotencyService_ReplaysWithinWindow(t *testing.T) {
+	t.Parallel()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	database, err := db.Open(filepath.Join(t.TempDir(), "app.db"))
+	if err != nil {
+		t.Fatalf("db open: %v", err)
+	}
+	sqlDB, err := database.DB()
+	if err != nil {
+		t.Fatalf("db handle: %v", err)
+	}
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	ctx := context.Background()
+	idem := NewIdempotencyService(database, logger).WithTTL(time.Hour)
+	now := time.Now()
+	req := IdempotencyRequest{Scope: "master", Key: "crawl-1", Method: http.MethodPost, Path: "/crawl", Body: []byte(`{"url":"https://example.com"}`)}
+
+	if stored, err := idem.Begin(ctx, req, now); err != nil || stored != nil {
+		t.Fatalf("first use should claim the key: %v %v", stored, err)
+	}
+	if _, err := idem.Begin(ctx, req, now); !errors.Is(err, ErrIdempotencyInProgress) {
+		t.Fatalf("expected in progress, got %v", err)
+	}
+	other := req
+	other.Scope = "dk:1"
+	if stored, err := idem.Begin(ctx, other, now); err != nil || stored != nil {
+		t.Fatalf("keys are scoped per caller: %v %v", stored, err)
+	}
+
+	headers := http.Header{"Content-Type": {"application/json"}}
+	if err := idem.Complete(ctx, req.Scope, req.Key, StoredResponse{StatusCode: http.StatusOK, Headers: headers, Body: []byte(`{"ok":true}`)}, now); err != nil {
+		t.Fatalf("complete: %v", err)
+	}
+	if err := NewIdempotencyService(database, logger).WithMaxBody(4).Complete(ctx, other.Scope, other.Key, StoredResponse{StatusCode: http.StatusOK, Body: []byte(`{"ok":true}`)}, now); !errors.Is(err, ErrIdempotencyTooLarge) {
+		t.Fatalf("expected oversized body to be refused, got %v", err)
+	}
+	stored, err := idem.Begin(ctx, req, now.Add(time.Minute))
+	if err != nil || stored == nil || stored.StatusCode != http.StatusOK || string(stored.Body) != `{"ok":true}` || stored.Headers.Get("Content-Type") != "application/json" {
+		t.Fatalf("expected the stored response, got %+v %v", stored, err)
+	}
+
+	changed := req
+	changed.Body = []byte(`{"url":"https://example.org"}`)
+	if _, err := idem.Begin(ctx, changed, now); !errors.Is(err, ErrIdempotencyKeyReused) {
+		t.Fatalf("expected reuse with a different body to fail, got %v", err)
+	}
+	if stored, err := idem.Begin(ctx, changed, now.Add(2*time.Hour)); err != nil || stored != nil {
+		t.Fatalf("an expired key should be claimable again: %v %v", stored, err)
+	}
+
+	if err := idem.Release(ctx, other.Scope, other.Key); err != nil {
+		t.Fatalf("release: %v", err)
+	}
+	if stored, err := idem.Begin(ctx, other, now); err != nil || stored != nil {
+		t.Fatalf("a released key should be claimable again: %v %v", stored, err)
+	}
+
+	if _, err := idem.Begin(ctx, IdempotencyRequest{Scope: "master", Key: "has space"}, now); !errors.Is(err, ErrIdempotencyKeyInvalid) {
+		t.Fatalf("expected invalid key, got %v", err)
+	}
+	if deleted, err := idem.DeleteExpired(ctx, now.Add(48*time.Hour)); err != nil || deleted != 2 {
+		t.Fatalf("expected both records to expire, got %d %v", deleted, err)
+	}
+}
@@ -0,0 +1,204 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"tavily-proxy/server/internal/models"
+
+	"gorm.io/gorm"
+)
+
+const (
+	JobTypeQuotaSync      = "quota_sync"
+	JobTypeKeyBatchCreate = "key_batch_create"
+)
+
+const (
+	defaultJobListLimit = 50
+	maxJobListLimit     = 500
+	jobPersistInterval  = 2 * time.Second
+)
+
+var (
+	ErrJobNotFound   = errors.New("job_not_found")
+	ErrJobNotRunning = errors.New("job_not_running")
+	ErrJobNotPaused  = errors.New("job_not_paused")
+)
+
+// isActiveJobStatus reports whether a job still owns its runner goroutine.
+func isActiveJobStatus(status string) bool {
+	return status == "running" || status == "paused"
+}
+
+// JobStore persists background job progress so history survives restarts and
+// interrupted jobs can be picked up again on boot.
+type JobStore struct {
+	db *gorm.DB
+}
+
+func NewJobStore(db *gorm.DB) *JobStore {
+	return &JobStore{db: db}
+}
+
+func (s *JobStore) Save(ctx context.Context, job *models.Job) error {
+	return s.db.WithContext(ctx).Save(job).Error
+}
+
+func (s *JobStore) Get(ctx context.Context, id string) (*models.Job, error) {
+	var job models.Job
+	tx := s.db.WithContext(ctx).Where("id = ?", id).Limit(1).Find(&job)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	if tx.RowsAffected == 0 {
+		return nil, nil
+	}
+	return &job, nil
+}
+
+func (s *JobStore) List(ctx context.Context, jobType string, limit int) ([]models.Job, error) {
+	if limit <= 0 {
+		limit = defaultJobListLimit
+	}
+	if limit > maxJobListLimit {
+		limit = maxJobListLimit
+	}
+
+	query := s.db.WithContext(ctx).
+		Model(&models.Job{}).
+		Omit("params", "state").
+		Order("created_at desc").
+		Limit(limit)
+	if jobType != "" {
+		query = query.Where("type = ?", jobType)
+	}
+
+	var jobs []models.Job
+	if err := query.Find(&jobs).Error; err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+// Interrupted returns jobs of the given type that were still running when the
+// process stopped, newest first.
+func (s *JobStore) Interrupted(ctx context.Context, jobType string) ([]models.Job, error) {
+	var jobs []models.Job
+	if err := s.db.WithContext(ctx).
+		Where("type = ? AND status IN ?", jobType, []string{"running", "paused"}).
+		Order("created_at desc").
+		Find(&jobs).Error; err != nil {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+func (s *JobStore) MarkInterrupted(ctx context.Context, job *models.Job, reason string) error {
+	now := time.Now()
+	job.Status = "error"
+	job.Error = reason
+	job.EndedAt = &now
+	job.Params = ""
+	return s.Save(ctx, job)
+}
+
+// jobRecorder throttles how often a running job's state is written back.
+type jobRecorder struct {
+	store   *JobStore
+	logger  *slog.Logger
+	jobType string
+
+	mu          sync.Mutex
+	params      string
+	lastPersist time.Time
+}
+
+func newJobRecorder(store *JobStore, logger *slog.Logger, jobType string) *jobRecorder {
+	return &jobRecorder{store: store, logger: logger, jobType: jobType}
+}
+
+func (r *jobRecorder) setParams(params any) {
+	if r == nil || r.store == nil {
+		return
+	}
+	raw, err := json.Marshal(params)
+	if err != nil {
+		r.logger.Error("job: encode params failed", "type", r.jobType, "err", err)
+		return
+	}
+	r.mu.Lock()
+	r.params = string(raw)
+	r.mu.Unlock()
+}
+
+func (r *jobRecorder) record(job jobSnapshot, force bool) {
+	if r == nil || r.store == nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if !force && time.Since(r.lastPersist) < jobPersistInterval {
+		return
+	}
+	r.lastPersist = time.Now()
+
+	snapshot := job.state
+	if r, ok := snapshot.(jobStateRedactor); ok {
+		snapshot = r.redactedState()
+	}
+	state, err := json.Marshal(snapshot)
+	if err != nil {
+		r.logger.Error("job: encode state failed", "type", r.jobType, "id", job.id, "err", err)
+		return
+	}
+	// Params are only needed to resume a job; a finished one drops them.
+	if !isActiveJobStatus(job.status) {
+		r.params = ""
+	}
+
+	rec := &models.Job{
+		ID:        job.id,
+		Type:      r.jobType,
+		Status:    job.status,
+		Params:    r.params,
+		State:     string(state),
+		Error:     job.err,
+		Total:     job.total,
+		Completed: job.completed,
+		Succeeded: job.succeeded,
+		Failed:    job.failed,
+		StartedAt: job.startedAt,
+		EndedAt:   job.endedAt,
+	}
+	if job.startedAt != nil {
+		rec.CreatedAt = *job.startedAt
+	}
+	if err := r.store.Save(context.Background(), rec); err != nil {
+		r.logger.Error("job: persist failed", "type", r.jobType, "id", job.id, "err", err)
+	}
+}
+
+// jobStateRedactor is implemented by job states holding secrets; the redacted
+// copy is what gets persisted.
+type jobStateRedactor interface {
+	redactedState() any
+}
+
+type jobSnapshot struct {
+	id        string
+	status    string
+	err       string
+	total     int
+	completed int
+	succeeded int
+	failed    int
+	startedAt *time.Time
+	endedAt   *time.Time
+	state     any
+}
@@ -0,0 +1,213 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"tavily-proxy/server/internal/db"
+	"tavily-proxy/server/internal/models"
+)
+
+func TestKeyBatchCreateJobService_PersistsHistory(t *testing.T) {
+	t.Parallel()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	database, err := db.Open(filepath.Join(t.TempDir(), "app.db"))
+	if err != nil {
+		t.Fatalf("db open: %v", err)
+	}
+	sqlDB, err := database.DB()
+	if err != nil {
+		t.Fatalf("db handle: %v", err)
+	}
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	store := NewJobStore(database)
+	keys := NewKeyService(database, logger)
+	jobs := NewKeyBatchCreateJobService(keys, logger).WithJobStore(store)
+
+	ctx := context.Background()
+	if _, err := keys.Create(ctx, "tvly-persist-000002", "Default", 1000); err != nil {
+		t.Fatalf("seed key: %v", err)
+	}
+	started, _, err := jobs.Start([]string{"tvly-persist-000001", "tvly-persist-000002"}, "", 1000)
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		rec, err := store.Get(ctx, started.ID)
+		if err != nil {
+			t.Fatalf("get job: %v", err)
+		}
+		if rec != nil && rec.Status == "completed" {
+			if rec.Type != JobTypeKeyBatchCreate || rec.Succeeded != 1 || rec.Failed != 1 {
+				t.Fatalf("unexpected record: %+v", rec)
+			}
+			if rec.Params != "" {
+				t.Fatalf("params left on finished job: %s", rec.Params)
+			}
+			if strings.Contains(rec.State, "tvly-persist-000001") || strings.Contains(rec.State, "tvly-persist-000002") {
+				t.Fatalf("raw keys left in finished job state: %s", rec.State)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for persisted completion")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	history, err := store.List(ctx, JobTypeKeyBatchCreate, 10)
+	if err != nil {
+		t.Fatalf("list jobs: %v", err)
+	}
+	if len(history) != 1 || history[0].ID != started.ID {
+		t.Fatalf("unexpected history: %+v", history)
+	}
+}
+
+func TestKeyBatchCreateJobService_RecoverInterruptedResumes(t *testing.T) {
+	t.Parallel()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	database, err := db.Open(filepath.Join(t.TempDir(), "app.db"))
+	if err != nil {
+		t.Fatalf("db open: %v", err)
+	}
+	sqlDB, err := database.DB()
+	if err != nil {
+		t.Fatalf("db handle: %v", err)
+	}
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	ctx := context.Background()
+	store := NewJobStore(database)
+	keys := NewKeyService(database, logger)
+	if _, err := keys.Create(ctx, "tvly-done-1", "Default", 1000); err != nil {
+		t.Fatalf("seed key: %v", err)
+	}
+
+	// Simulate a process that died after creating the first of three keys.
+	startedAt := time.Now().Add(-time.Minute)
+	params, _ := json.Marshal(keyBatchCreateJobParams{Keys: []string{"tvly-done-1", "tvly-todo-2", "tvly-todo-3"}, Alias: "Default", TotalQuota: 1000})
+	state, _ := json.Marshal(KeyBatchCreateJobStatus{ID: "job-1", Status: "running", Total: 3, Completed: 1, Succeeded: 1, StartedAt: &startedAt})
+	stale := &models.Job{ID: "job-0", Type: JobTypeKeyBatchCreate, Status: "running", State: "{}", StartedAt: &startedAt, CreatedAt: startedAt.Add(-time.Minute)}
+	if err := store.Save(ctx, stale); err != nil {
+		t.Fatalf("seed stale job: %v", err)
+	}
+	if err := store.Save(ctx, &models.Job{ID: "job-1", Type: JobTypeKeyBatchCreate, Status: "running", Params: string(params), State: string(state), Total: 3, Completed: 1, Succeeded: 1, StartedAt: &startedAt, CreatedAt: startedAt}); err != nil {
+		t.Fatalf("seed job: %v", err)
+	}
+
+	jobs := NewKeyBatchCreateJobService(keys, logger).WithJobStore(store)
+	if err := jobs.RecoverInterrupted(ctx, true); err != nil {
+		t.Fatalf("recover: %v", err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		got := jobs.Get()
+		if got.Status == "completed" {
+			if got.ID != "job-1" || got.Completed != 3 || got.Succeeded != 3 {
+				t.Fatalf("unexpected resumed job: %+v", got)
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for resumed job: %+v", got)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	items, err := keys.List(ctx)
+	if err != nil || len(items) != 3 {
+		t.Fatalf("unexpected keys after resume: n=%d err=%v", len(items), err)
+	}
+
+	old, err := store.Get(ctx, "job-0")
+	if err != nil || old == nil || old.Status != "error" {
+		t.Fatalf("older interrupted job not failed: %+v err=%v", old, err)
+	}
+}
+
+func TestQuotaSyncJobService_CancelStopsRemainingItems(t *testing.T) {
+	t.Parallel()
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(`{"key":{"usage":1,"limit":1000}}`))
+	}))
+	t.Cleanup(upstream.Close)
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	database, err := db.Open(filepath.Join(t.TempDir(), "app.db"))
+	if err != nil {
+		t.Fatalf("db open: %v", err)
+	}
+	sqlDB, err := database.DB()
+	if err != nil {
+		t.Fatalf("db handle: %v", err)
+	}
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	ctx := context.Background()
+	store := NewJobStore(database)
+	keys := NewKeyService(database, logger)
+	for i := 0; i < 3; i++ {
+		if _, err := keys.Create(ctx, fmt.Sprintf("tvly-cancel-%d", i), "test", 1000); err != nil {
+			t.Fatalf("create key %d: %v", i, err)
+		}
+	}
+	proxy := NewTavilyProxy(upstream.URL, 5*time.Second, keys, nil, nil, logger)
+	jobs := NewQuotaSyncJobService(keys, NewQuotaSyncService(keys, proxy, logger), logger).WithJobStore(store)
+
+	started, _, err := jobs.Start(time.Minute)
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for jobs.Get().Completed < 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for first item")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	cancelled, err := jobs.Cancel(started.ID)
+	if err != nil {
+		t.Fatalf("cancel: %v", err)
+	}
+	if cancelled.Status != "cancelled" || cancelled.Completed != 1 || cancelled.Cancelled != 2 {
+		t.Fatalf("unexpected cancelled job: %+v", cancelled)
+	}
+	if _, err := jobs.Cancel(started.ID); err != ErrJobNotRunning {
+		t.Fatalf("unexpected second cancel error: %v", err)
+	}
+
+	deadline = time.Now().Add(2 * time.Second)
+	for {
+		rec, err := store.Get(ctx, started.ID)
+		if err != nil {
+			t.Fatalf("get job: %v", err)
+		}
+		if rec != nil && rec.Status == "cancelled" && rec.EndedAt != nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for persisted cancel: %+v", rec)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -2,55 +2,113 @@ package services
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"log/slog"
+	"net/http"
 	"strings"
 	"sync"
 	"time"
 
 	"github.com/google/uuid"
+
+	"tavily-proxy/server/internal/util"
 )
 
 const maxBatchCreateKeys = 5000
 
 var (
-	ErrBatchCreateNoKeys   = errors.New("no keys to create")
-	ErrBatchCreateTooLarge = errors.New("too many keys in one batch")
+	ErrBatchCreateNoKeys          = errors.New("no keys to create")
+	ErrBatchCreateTooLarge        = errors.New("too many keys in one batch")
+	ErrBatchValidationUnavailable = errors.New("batch validation needs an upstream proxy")
+)
+
+const (
+	KeyBatchResultCreated    = "created"
+	KeyBatchResultUnverified = "unverified"
+	KeyBatchResultDuplicate  = "duplicate"
+	KeyBatchResultInvalid    = "invalid"
+	KeyBatchResultExhausted  = "exhausted"
+	KeyBatchResultError      = "error"
 )
 
+// KeyBatchCreateFailure reports a key that was not added. Key is masked.
 type KeyBatchCreateFailure struct {
 	Key   string `json:"key"`
 	Error string `json:"error"`
 }
 
+// KeyBatchCreateResult is the outcome for one key. Key is always masked.
+type KeyBatchCreateResult struct {
+	Key        string `json:"key"`
+	Status     string `json:"status"` // created|unverified|duplicate|invalid|exhausted|error
+	Error      string `json:"error,omitempty"`
+	ID         uint   `json:"id,omitempty"`
+	UsedQuota  int    `json:"used_quota,omitempty"`
+	TotalQuota int    `json:"total_quota,omitempty"`
+}
+
+type KeyBatchCreateOptions struct {
+	Alias      string
+	TotalQuota int
+	// Validate checks each key against the upstream usage endpoint and takes
+	// its quota from there.
+	Validate bool
+}
+
 type KeyBatchCreateJobStatus struct {
-	ID     string `json:"id"`
-	Status string `json:"status"` // idle|running|completed|error
-	Error  string `json:"error,omitempty"`
+	ID       string `json:"id"`
+	Status   string `json:"status"` // idle|running|paused|completed|cancelled|error
+	Error    string `json:"error,omitempty"`
+	Validate bool   `json:"validate,omitempty"`
 
 	Total     int `json:"total"`
 	Completed int `json:"completed"`
 	Succeeded int `json:"succeeded"`
 	Failed    int `json:"failed"`
+	Cancelled int `json:"cancelled,omitempty"`
 
 	Failures []KeyBatchCreateFailure `json:"failures,omitempty"`
+	Results  []KeyBatchCreateResult  `json:"results,omitempty"`
 
 	StartedAt *time.Time `json:"started_at,omitempty"`
 	EndedAt   *time.Time `json:"ended_at,omitempty"`
 }
 
+type keyBatchCreateJobParams struct {
+	Keys       []string `json:"keys"`
+	Alias      string   `json:"alias"`
+	TotalQuota int      `json:"total_quota"`
+	Validate   bool     `json:"validate,omitempty"`
+}
+
 type KeyBatchCreateJobService struct {
-	keys   *KeyService
-	logger *slog.Logger
+	keys     *KeyService
+	proxy    *TavilyProxy
+	logger   *slog.Logger
+	recorder *jobRecorder
 
-	mu  sync.RWMutex
-	job *KeyBatchCreateJobStatus
+	mu     sync.RWMutex
+	job    *KeyBatchCreateJobStatus
+	cancel context.CancelFunc
+	resume chan struct{}
 }
 
 func NewKeyBatchCreateJobService(keys *KeyService, logger *slog.Logger) *KeyBatchCreateJobService {
 	return &KeyBatchCreateJobService{keys: keys, logger: logger}
 }
 
+func (s *KeyBatchCreateJobService) WithJobStore(store *JobStore) *KeyBatchCreateJobService {
+	s.recorder = newJobRecorder(store, s.logger, JobTypeKeyBatchCreate)
+	return s
+}
+
+// WithProxy enables upstream validation for batches started with Validate.
+func (s *KeyBatchCreateJobService) WithProxy(proxy *TavilyProxy) *KeyBatchCreateJobService {
+	s.proxy = proxy
+	return s
+}
+
 func (s *KeyBatchCreateJobService) Get() KeyBatchCreateJobStatus {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -62,6 +120,10 @@ func (s *KeyBatchCreateJobService) Get() KeyBatchCreateJobStatus {
 }
 
 func (s *KeyBatchCreateJobService) Start(rawKeys []string, alias string, totalQuota int) (KeyBatchCreateJobStatus, bool, error) {
+	return s.StartWithOptions(rawKeys, KeyBatchCreateOptions{Alias: alias, TotalQuota: totalQuota})
+}
+
+func (s *KeyBatchCreateJobService) StartWithOptions(rawKeys []string, opts KeyBatchCreateOptions) (KeyBatchCreateJobStatus, bool, error) {
 	keys := normalizeBatchKeys(rawKeys)
 	if len(keys) == 0 {
 		return KeyBatchCreateJobStatus{}, false, ErrBatchCreateNoKeys
@@ -69,13 +131,17 @@ func (s *KeyBatchCreateJobService) Start(rawKeys []string, alias string, totalQu
 	if len(keys) > maxBatchCreateKeys {
 		return KeyBatchCreateJobStatus{}, false, ErrBatchCreateTooLarge
 	}
+	if opts.Validate && s.proxy == nil {
+		return KeyBatchCreateJobStatus{}, false, ErrBatchValidationUnavailable
+	}
 
+	alias := opts.Alias
 	if strings.TrimSpace(alias) == "" {
 		alias = "Default"
 	}
 
 	s.mu.Lock()
-	if s.job != nil && s.job.Status == "running" {
+	if s.job != nil && isActiveJobStatus(s.job.Status) {
 		job := cloneKeyBatchCreateJobStatus(*s.job)
 		s.mu.Unlock()
 		return job, true, nil
@@ -85,22 +151,172 @@ func (s *KeyBatchCreateJobService) Start(rawKeys []string, alias string, totalQu
 	job := &KeyBatchCreateJobStatus{
 		ID:        uuid.NewString(),
 		Status:    "running",
+		Validate:  opts.Validate,
 		Total:     len(keys),
 		StartedAt: &startedAt,
 	}
+	ctx, cancel := context.WithCancel(context.Background())
 	s.job = job
+	s.cancel = cancel
+	s.resume = nil
+	snapshot := cloneKeyBatchCreateJobStatus(*job)
 	s.mu.Unlock()
 
-	go s.runJob(job.ID, keys, alias, totalQuota)
+	params := keyBatchCreateJobParams{Keys: keys, Alias: alias, TotalQuota: opts.TotalQuota, Validate: opts.Validate}
+	s.recorder.setParams(params)
+	s.recorder.record(keyBatchCreateJobSnapshot(snapshot), true)
+
+	go s.runJob(ctx, job.ID, params, 0)
+
+	return snapshot, false, nil
+}
+
+// Cancel stops a running or paused batch. Keys already created are kept; the
+// ones not reached are counted as cancelled.
+func (s *KeyBatchCreateJobService) Cancel(id string) (KeyBatchCreateJobStatus, error) {
+	s.mu.Lock()
+	if s.job == nil || s.job.ID != id {
+		s.mu.Unlock()
+		return KeyBatchCreateJobStatus{}, ErrJobNotFound
+	}
+	if !isActiveJobStatus(s.job.Status) {
+		job := cloneKeyBatchCreateJobStatus(*s.job)
+		s.mu.Unlock()
+		return job, ErrJobNotRunning
+	}
+
+	endedAt := time.Now()
+	s.job.Status = "cancelled"
+	s.job.EndedAt = &endedAt
+	s.job.Cancelled = s.job.Total - s.job.Completed
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.resume = nil
+	job := cloneKeyBatchCreateJobStatus(*s.job)
+	s.mu.Unlock()
+
+	s.recorder.record(keyBatchCreateJobSnapshot(job), true)
+	return job, nil
+}
+
+// Pause holds the batch before its next key.
+func (s *KeyBatchCreateJobService) Pause(id string) (KeyBatchCreateJobStatus, error) {
+	s.mu.Lock()
+	if s.job == nil || s.job.ID != id {
+		s.mu.Unlock()
+		return KeyBatchCreateJobStatus{}, ErrJobNotFound
+	}
+	if s.job.Status != "running" {
+		job := cloneKeyBatchCreateJobStatus(*s.job)
+		s.mu.Unlock()
+		return job, ErrJobNotRunning
+	}
+
+	s.job.Status = "paused"
+	s.resume = make(chan struct{})
+	job := cloneKeyBatchCreateJobStatus(*s.job)
+	s.mu.Unlock()
+
+	s.recorder.record(keyBatchCreateJobSnapshot(job), true)
+	return job, nil
+}
+
+func (s *KeyBatchCreateJobService) Resume(id string) (KeyBatchCreateJobStatus, error) {
+	s.mu.Lock()
+	if s.job == nil || s.job.ID != id {
+		s.mu.Unlock()
+		return KeyBatchCreateJobStatus{}, ErrJobNotFound
+	}
+	if s.job.Status != "paused" {
+		job := cloneKeyBatchCreateJobStatus(*s.job)
+		s.mu.Unlock()
+		return job, ErrJobNotPaused
+	}
+
+	s.job.Status = "running"
+	if s.resume != nil {
+		close(s.resume)
+		s.resume = nil
+	}
+	job := cloneKeyBatchCreateJobStatus(*s.job)
+	s.mu.Unlock()
+
+	s.recorder.record(keyBatchCreateJobSnapshot(job), true)
+	return job, nil
+}
+
+// RecoverInterrupted resumes the newest batch left running by a previous
+// process (or marks it failed when resume is false); older ones are failed.
+func (s *KeyBatchCreateJobService) RecoverInterrupted(ctx context.Context, resume bool) error {
+	if s.recorder == nil {
+		return nil
+	}
+	store := s.recorder.store
+
+	records, err := store.Interrupted(ctx, JobTypeKeyBatchCreate)
+	if err != nil {
+		return err
+	}
+
+	for i := range records {
+		rec := &records[i]
+		if !resume || i > 0 {
+			if err := store.MarkInterrupted(ctx, rec, "interrupted by restart"); err != nil {
+				return err
+			}
+			continue
+		}
+
+		var job KeyBatchCreateJobStatus
+		var params keyBatchCreateJobParams
+		if err := json.Unmarshal([]byte(rec.State), &job); err != nil || json.Unmarshal([]byte(rec.Params), &params) != nil {
+			if err := store.MarkInterrupted(ctx, rec, "interrupted by restart: unreadable state"); err != nil {
+				return err
+			}
+			continue
+		}
+
+		job.ID = rec.ID
+		job.Status = "running"
+		job.EndedAt = nil
+		runCtx, cancel := context.WithCancel(context.Background())
+
+		s.mu.Lock()
+		s.job = &job
+		s.cancel = cancel
+		s.resume = nil
+		if rec.Status == "paused" {
+			job.Status = "paused"
+			s.resume = make(chan struct{})
+		}
+		snapshot := cloneKeyBatchCreateJobStatus(job)
+		s.mu.Unlock()
+
+		s.recorder.setParams(params)
+		s.recorder.record(keyBatchCreateJobSnapshot(snapshot), true)
+		s.logger.Info("key batch create job resumed", "id", job.ID, "remaining", len(params.Keys)-job.Completed)
 
-	return cloneKeyBatchCreateJobStatus(*job), false, nil
+		// Keys are created in order, so everything before Completed is done.
+		go s.runJob(runCtx, job.ID, params, job.Completed)
+	}
+	return nil
 }
 
-func (s *KeyBatchCreateJobService) runJob(jobID string, keys []string, alias string, totalQuota int) {
-	ctx := context.Background()
+func (s *KeyBatchCreateJobService) runJob(ctx context.Context, jobID string, params keyBatchCreateJobParams, offset int) {
+	if offset > len(params.Keys) {
+		offset = len(params.Keys)
+	}
+	for _, key := range params.Keys[offset:] {
+		if !s.waitWhilePaused(ctx, jobID) {
+			break
+		}
 
-	for _, key := range keys {
-		_, err := s.keys.Create(ctx, key, alias, totalQuota)
+		// A key that was created before the cancel landed is still reported.
+		result := s.createOne(ctx, key, params)
+		if result.Status == KeyBatchResultError && ctx.Err() != nil {
+			break
+		}
 
 		s.mu.Lock()
 		if s.job == nil || s.job.ID != jobID {
@@ -109,25 +325,199 @@ func (s *KeyBatchCreateJobService) runJob(jobID string, keys []string, alias str
 		}
 
 		s.job.Completed++
-		if err != nil {
+		s.job.Results = append(s.job.Results, result)
+		switch result.Status {
+		case KeyBatchResultCreated, KeyBatchResultUnverified:
+			s.job.Succeeded++
+		default:
 			s.job.Failed++
 			s.job.Failures = append(s.job.Failures, KeyBatchCreateFailure{
-				Key:   key,
-				Error: err.Error(),
+				Key:   util.MaskAPIKey(key),
+				Error: batchFailureMessage(result),
 			})
-		} else {
-			s.job.Succeeded++
 		}
+		snapshot := cloneKeyBatchCreateJobStatus(*s.job)
 		s.mu.Unlock()
+
+		s.recorder.record(keyBatchCreateJobSnapshot(snapshot), false)
 	}
+	s.waitWhilePaused(ctx, jobID)
 
 	endedAt := time.Now()
 	s.mu.Lock()
-	if s.job != nil && s.job.ID == jobID {
+	if s.job == nil || s.job.ID != jobID {
+		s.mu.Unlock()
+		return
+	}
+	if s.job.Status == "running" {
 		s.job.Status = "completed"
 		s.job.EndedAt = &endedAt
 	}
+	if s.job.Status == "cancelled" {
+		s.job.Cancelled = s.job.Total - s.job.Completed
+	}
+	s.cancel = nil
+	snapshot := cloneKeyBatchCreateJobStatus(*s.job)
 	s.mu.Unlock()
+
+	s.recorder.record(keyBatchCreateJobSnapshot(snapshot), true)
+}
+
+// waitWhilePaused blocks while the batch is paused. It reports false once the
+// batch has been cancelled or replaced.
+func (s *KeyBatchCreateJobService) waitWhilePaused(ctx context.Context, jobID string) bool {
+	for {
+		if ctx.Err() != nil {
+			return false
+		}
+		s.mu.RLock()
+		current := s.job != nil && s.job.ID == jobID
+		resume := s.resume
+		s.mu.RUnlock()
+		if !current {
+			return false
+		}
+		if resume == nil {
+			return true
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-resume:
+		}
+	}
+}
+
+// createOne inserts a single key, checking for an existing row first and, in
+// validation mode, probing the upstream usage endpoint before the insert.
+func (s *KeyBatchCreateJobService) createOne(ctx context.Context, key string, params keyBatchCreateJobParams) KeyBatchCreateResult {
+	result := KeyBatchCreateResult{Key: util.MaskAPIKey(key)}
+
+	existing, err := s.keys.FindByKey(ctx, key)
+	if err != nil {
+		result.Status = KeyBatchResultError
+		result.Error = err.Error()
+		return result
+	}
+	if existing != nil {
+		result.Status = KeyBatchResultDuplicate
+		result.ID = existing.ID
+		return result
+	}
+
+	var usage int
+	var limit *int
+	var usageErr error
+	if params.Validate && s.proxy != nil {
+		usage, limit, usageErr = s.proxy.GetUsage(ctx, key)
+		if usageErr != nil && ctx.Err() != nil {
+			result.Status = KeyBatchResultError
+			result.Error = ctx.Err().Error()
+			return result
+		}
+	}
+
+	created, err := s.keys.Create(ctx, key, params.Alias, params.TotalQuota)
+	if err != nil {
+		result.Status = KeyBatchResultError
+		result.Error = err.Error()
+		return result
+	}
+	result.ID = created.ID
+	result.TotalQuota = created.TotalQuota
+
+	if !params.Validate || s.proxy == nil {
+		result.Status = KeyBatchResultCreated
+		return result
+	}
+
+	if usageErr != nil {
+		result.Error = usageErr.Error()
+		if ue := (*UpstreamStatusError)(nil); errors.As(usageErr, &ue) {
+			switch ue.StatusCode {
+			case http.StatusUnauthorized:
+				_ = s.keys.MarkInvalid(ctx, created.ID)
+				result.Status = KeyBatchResultInvalid
+				return result
+			case 432, 433:
+				_ = s.keys.MarkExhausted(ctx, created.ID)
+				result.Status = KeyBatchResultExhausted
+				result.UsedQuota = created.TotalQuota
+				return result
+			}
+		}
+		// Upstream hiccups should not block the import; the key is kept with
+		// the requested quota and can be synced later.
+		result.Status = KeyBatchResultUnverified
+		return result
+	}
+
+	totalQuota := created.TotalQuota
+	if limit != nil && *limit > 0 {
+		totalQuota = *limit
+	}
+	if usage > totalQuota {
+		usage = totalQuota
+	}
+	_ = s.keys.SetUsage(ctx, created.ID, usage, &totalQuota)
+
+	result.UsedQuota = usage
+	result.TotalQuota = totalQuota
+	result.Status = KeyBatchResultCreated
+	if usage >= totalQuota {
+		result.Status = KeyBatchResultExhausted
+	}
+	return result
+}
+
+func batchFailureMessage(result KeyBatchCreateResult) string {
+	switch result.Status {
+	case KeyBatchResultDuplicate:
+		return "key already exists"
+	case KeyBatchResultExhausted:
+		if result.Error == "" {
+			return "key quota exhausted"
+		}
+	case KeyBatchResultInvalid:
+		if result.Error == "" {
+			return "key rejected by upstream"
+		}
+	}
+	return result.Error
+}
+
+func (job KeyBatchCreateJobStatus) redactedState() any {
+	out := cloneKeyBatchCreateJobStatus(job)
+	for i := range out.Failures {
+		out.Failures[i].Key = maskBatchKey(out.Failures[i].Key)
+	}
+	for i := range out.Results {
+		out.Results[i].Key = maskBatchKey(out.Results[i].Key)
+	}
+	return out
+}
+
+// maskBatchKey masks key unless it already is.
+func maskBatchKey(key string) string {
+	if strings.Contains(key, "****") {
+		return key
+	}
+	return util.MaskAPIKey(key)
+}
+
+func keyBatchCreateJobSnapshot(job KeyBatchCreateJobStatus) jobSnapshot {
+	return jobSnapshot{
+		id:        job.ID,
+		status:    job.Status,
+		err:       job.Error,
+		total:     job.Total,
+		completed: job.Completed,
+		succeeded: job.Succeeded,
+		failed:    job.Failed,
+		startedAt: job.StartedAt,
+		endedAt:   job.EndedAt,
+		state:     job,
+	}
 }
 
 func normalizeBatchKeys(rawKeys []string) []string {
@@ -153,6 +543,10 @@ func cloneKeyBatchCreateJobStatus(in KeyBatchCreateJobStatus) KeyBatchCreateJobS
 		out.Failures = make([]KeyBatchCreateFailure, len(in.Failures))
 		copy(out.Failures, in.Failures)
 	}
+	if in.Results != nil {
+		out.Results = make([]KeyBatchCreateResult, len(in.Results))
+		copy(out.Results, in.Results)
+	}
 	if in.StartedAt != nil {
 		t := *in.StartedAt
 		out.StartedAt = &t
@@ -4,12 +4,15 @@ import (
 	"context"
 	"io"
 	"log/slog"
+	"net/http"
+	"net/http/httptest"
 	"path/filepath"
 	"strconv"
 	"testing"
 	"time"
 
 	"tavily-proxy/server/internal/db"
+	"tavily-proxy/server/internal/util"
 )
 
 func TestKeyBatchCreateJobService_StartAndComplete(t *testing.T) {
@@ -117,7 +120,7 @@ func TestKeyBatchCreateJobService_Failures(t *testing.T) {
 			if got.Completed != 2 || got.Succeeded != 1 || got.Failed != 1 {
 				t.Fatalf("unexpected counters: %+v", got)
 			}
-			if len(got.Failures) != 1 || got.Failures[0].Key != "tvly-exists" {
+			if len(got.Failures) != 1 || got.Failures[0].Key != util.MaskAPIKey("tvly-exists") || got.Failures[0].Key == "tvly-exists" {
 				t.Fatalf("unexpected failures: %+v", got.Failures)
 			}
 			break
@@ -158,3 +161,98 @@ func TestKeyBatchCreateJobService_ValidateInput(t *testing.T) {
 		t.Fatalf("unexpected error for oversized batch: %v", err)
 	}
 }
+
+func TestKeyBatchCreateJobService_ValidateAgainstUpstream(t *testing.T) {
+	t.Parallel()
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Header.Get("Authorization") {
+		case "Bearer tvly-good-000001":
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"key":{"usage":120,"limit":500}}`))
+		case "Bearer tvly-bad-0000001":
+			w.WriteHeader(http.StatusUnauthorized)
+		case "Bearer tvly-spent-00001":
+			w.WriteHeader(432)
+		default:
+			w.WriteHeader(http.StatusBadGateway)
+		}
+	}))
+	t.Cleanup(upstream.Close)
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	database, err := db.Open(filepath.Join(t.TempDir(), "app.db"))
+	if err != nil {
+		t.Fatalf("db open: %v", err)
+	}
+	sqlDB, err := database.DB()
+	if err != nil {
+		t.Fatalf("db handle: %v", err)
+	}
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	ctx := context.Background()
+	keys := NewKeyService(database, logger)
+	if _, err := keys.Create(ctx, "tvly-exists-00001", "Default", 1000); err != nil {
+		t.Fatalf("seed key: %v", err)
+	}
+
+	if _, _, err := NewKeyBatchCreateJobService(keys, logger).StartWithOptions([]string{"tvly-x"}, KeyBatchCreateOptions{Validate: true}); err != ErrBatchValidationUnavailable {
+		t.Fatalf("unexpected error without proxy: %v", err)
+	}
+
+	proxy := NewTavilyProxy(upstream.URL, 5*time.Second, keys, nil, nil, logger)
+	jobs := NewKeyBatchCreateJobService(keys, logger).WithProxy(proxy)
+	input := []string{"tvly-good-000001", "tvly-bad-0000001", "tvly-spent-00001", "tvly-exists-00001", "tvly-flaky-00001"}
+	if _, _, err := jobs.StartWithOptions(input, KeyBatchCreateOptions{TotalQuota: 1000, Validate: true}); err != nil {
+		t.Fatalf("start: %v", err)
+	}
+
+	var got KeyBatchCreateJobStatus
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		got = jobs.Get()
+		if got.Status == "completed" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for completion: %+v", got)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	want := []string{KeyBatchResultCreated, KeyBatchResultInvalid, KeyBatchResultExhausted, KeyBatchResultDuplicate, KeyBatchResultUnverified}
+	if len(got.Results) != len(want) {
+		t.Fatalf("unexpected results: %+v", got.Results)
+	}
+	for i, res := range got.Results {
+		if res.Status != want[i] {
+			t.Fatalf("result %d: got %q want %q (%+v)", i, res.Status, want[i], res)
+		}
+		if res.Key == input[i] {
+			t.Fatalf("result %d exposes the raw key", i)
+		}
+	}
+	for _, f := range got.Failures {
+		for _, raw := range input {
+			if f.Key == raw {
+				t.Fatalf("failure exposes the raw key: %+v", f)
+			}
+		}
+	}
+	if got.Succeeded != 2 || got.Failed != 3 || len(got.Failures) != 3 {
+		t.Fatalf("unexpected counters: %+v", got)
+	}
+	if got.Results[0].UsedQuota != 120 || got.Results[0].TotalQuota != 500 {
+		t.Fatalf("quota not taken from upstream: %+v", got.Results[0])
+	}
+
+	bad, err := keys.FindByKey(ctx, "tvly-bad-0000001")
+	if err != nil || bad == nil || !bad.IsInvalid || bad.IsActive {
+		t.Fatalf("invalid key not marked: %+v err=%v", bad, err)
+	}
+	spent, err := keys.FindByKey(ctx, "tvly-spent-00001")
+	if err != nil || spent == nil || spent.UsedQuota != spent.TotalQuota {
+		t.Fatalf("exhausted key not marked: %+v err=%v", spent, err)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"log/slog"
 	"math/rand"
 	"sort"
+	"sync"
 	"time"
 
 	"tavily-proxy/server/internal/models"
@@ -16,12 +17,36 @@ import (
 type KeyService struct {
 	db     *gorm.DB
 	logger *slog.Logger
+
+	observersMu sync.RWMutex
+	observers   []func(keyID uint)
 }
 
 func NewKeyService(db *gorm.DB, logger *slog.Logger) *KeyService {
 	return &KeyService{db: db, logger: logger}
 }
 
+// OnQuotaChange registers fn to run after every successful write that may
+// change a key's quota or state, and with it the pool totals. keyID is 0 when
+// several keys changed at once. fn runs synchronously and must not block.
+func (s *KeyService) OnQuotaChange(fn func(keyID uint)) {
+	s.observersMu.Lock()
+	defer s.observersMu.Unlock()
+	s.observers = append(s.observers, fn)
+}
+
+func (s *KeyService) notifyQuotaChange(keyID uint, err error) error {
+	if err != nil {
+		return err
+	}
+	s.observersMu.RLock()
+	defer s.observersMu.RUnlock()
+	for _, fn := range s.observers {
+		fn(keyID)
+	}
+	return nil
+}
+
 func (s *KeyService) List(ctx context.Context) ([]models.APIKey, error) {
 	var keys []models.APIKey
 	if err := s.db.WithContext(ctx).Order("id desc").Find(&keys).Error; err != nil {
@@ -45,6 +70,7 @@ func (s *KeyService) Create(ctx context.Context, key, alias string, totalQuota i
 	if err := s.db.WithContext(ctx).Create(&record).Error; err != nil {
 		return nil, err
 	}
+	_ = s.notifyQuotaChange(record.ID, nil)
 	return &record, nil
 }
 
@@ -93,40 +119,41 @@ func (s *KeyService) Update(ctx context.Context, id uint, upd KeyUpdate) (*model
 	if err := s.db.WithContext(ctx).Save(&key).Error; err != nil {
 		return nil, err
 	}
+	_ = s.notifyQuotaChange(key.ID, nil)
 	return &key, nil
 }
 
 func (s *KeyService) Delete(ctx context.Context, id uint) error {
-	return s.db.WithContext(ctx).Delete(&models.APIKey{}, id).Error
+	return s.notifyQuotaChange(id, s.db.WithContext(ctx).Delete(&models.APIKey{}, id).Error)
 }
 
 func (s *KeyService) MarkInactive(ctx context.Context, id uint) error {
-	return s.db.WithContext(ctx).Model(&models.APIKey{}).Where("id = ?", id).Update("is_active", false).Error
+	return s.notifyQuotaChange(id, s.db.WithContext(ctx).Model(&models.APIKey{}).Where("id = ?", id).Update("is_active", false).Error)
 }
 
 func (s *KeyService) MarkInvalid(ctx context.Context, id uint) error {
-	return s.db.WithContext(ctx).Model(&models.APIKey{}).Where("id = ?", id).Updates(map[string]any{
+	return s.notifyQuotaChange(id, s.db.WithContext(ctx).Model(&models.APIKey{}).Where("id = ?", id).Updates(map[string]any{
 		"is_active":  false,
 		"is_invalid": true,
-	}).Error
+	}).Error)
 }
 
 func (s *KeyService) MarkExhausted(ctx context.Context, id uint) error {
-	return s.db.WithContext(ctx).Model(&models.APIKey{}).
+	return s.notifyQuotaChange(id, s.db.WithContext(ctx).Model(&models.APIKey{}).
 		Where("id = ?", id).
-		Update("used_quota", gorm.Expr("total_quota")).Error
+		Update("used_quota", gorm.Expr("total_quota")).Error)
 }
 
 func (s *KeyService) IncrementUsed(ctx context.Context, id uint) error {
 	now := time.Now()
-	return s.db.WithContext(ctx).Model(&models.APIKey{}).Where("id = ?", id).Updates(map[string]any{
+	return s.notifyQuotaChange(id, s.db.WithContext(ctx).Model(&models.APIKey{}).Where("id = ?", id).Updates(map[string]any{
 		"used_quota":   gorm.Expr("CASE WHEN used_quota + 1 > total_quota THEN total_quota ELSE used_quota + 1 END"),
 		"last_used_at": &now,
-	}).Error
+	}).Error)
 }
 
 func (s *KeyService) ResetAllUsage(ctx context.Context) error {
-	return s.db.WithContext(ctx).Model(&models.APIKey{}).Update("used_quota", 0).Error
+	return s.notifyQuotaChange(0, s.db.WithContext(ctx).Model(&models.APIKey{}).Update("used_quota", 0).Error)
 }
 
 func (s *KeyService) SetUsage(ctx context.Context, id uint, used int, total *int) error {
@@ -139,7 +166,7 @@ func (s *KeyService) SetUsage(ctx context.Context, id uint, used int, total *int
 			updates["used_quota"] = *total
 		}
 	}
-	return s.db.WithContext(ctx).Model(&models.APIKey{}).Where("id = ?", id).Updates(updates).Error
+	return s.notifyQuotaChange(id, s.db.WithContext(ctx).Model(&models.APIKey{}).Where("id = ?", id).Updates(updates).Error)
 }
 
 func (s *KeyService) Candidates(ctx context.Context) ([]models.APIKey, error) {
@@ -195,7 +222,19 @@ func (s *KeyService) FindByID(ctx context.Context, id uint) (*models.APIKey, err
 	return &key, nil
 }
 
+func (s *KeyService) FindByKey(ctx context.Context, key string) (*models.APIKey, error) {
+	var item models.APIKey
+	tx := s.db.WithContext(ctx).Where(map[string]any{"key": key}).Limit(1).Find(&item)
+	if tx.Error != nil {
+		return nil, tx.Error
+	}
+	if tx.RowsAffected == 0 {
+		return nil, nil
+	}
+	return &item, nil
+}
+
 func (s *KeyService) DeleteInvalid(ctx context.Context) (int64, error) {
 	result := s.db.WithContext(ctx).Where("is_invalid = ?", true).Delete(&models.APIKey{})
-	return result.RowsAffected, result.Error
+	return result.RowsAffected, s.notifyQuotaChange(0, result.Error)
 }
@@ -0,0 +1,634 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/scrypt"
+	"gorm.io/gorm"
+
+	"tavily-proxy/server/internal/models"
+	"tavily-proxy/server/internal/util"
+)
+
+const (
+	KeyTransferFormatJSON = "json"
+	KeyTransferFormatCSV  = "csv"
+	KeyTransferFormatTXT  = "txt"
+
+	KeyImportConflictSkip      = "skip"
+	KeyImportConflictOverwrite = "overwrite"
+	KeyImportConflictMerge     = "merge"
+)
+
+const (
+	keyTransferVersion   = 1
+	keyTransferKind      = "tavily-proxy-keys"
+	keyTransferEncryptor = "scrypt-aes-256-gcm"
+	maxKeyImportRecords  = 50000
+
+	// scrypt cost parameters recommended for interactive use.
+	keyTransferScryptN = 1 << 15
+	keyTransferScryptR = 8
+	keyTransferScryptP = 1
+	// maxKeyTransferScryptMemory bounds 128·N·r·p for sealed files we open.
+	maxKeyTransferScryptMemory = 256 << 20
+)
+
+var (
+	ErrKeyTransferFormat             = errors.New("unsupported_format")
+	ErrKeyTransferConflictPolicy     = errors.New("invalid_conflict_policy")
+	ErrKeyTransferTooLarge           = errors.New("too_many_keys")
+	ErrKeyTransferPassphraseRequired = errors.New("passphrase_required")
+	ErrKeyTransferDecrypt            = errors.New("decrypt_failed")
+)
+
+var keyTransferCSVHeader = []string{
+	"key", "alias", "total_quota", "used_quota", "is_active", "is_invalid", "last_used_at", "created_at", "updated_at",
+}
+
+// KeyTransferRecord carries every APIKey field that is meaningful on another
+// instance; database ids are not exported.
+type KeyTransferRecord struct {
+	Key        string     `json:"key"`
+	Alias      string     `json:"alias"`
+	TotalQuota int        `json:"total_quota"`
+	UsedQuota  int        `json:"used_quota"`
+	IsActive   bool       `json:"is_active"`
+	IsInvalid  bool       `json:"is_invalid"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	CreatedAt  *time.Time `json:"created_at,omitempty"`
+	UpdatedAt  *time.Time `json:"updated_at,omitempty"`
+}
+
+type keyTransferDocument struct {
+	Kind       string              `json:"kind"`
+	Version    int                 `json:"version"`
+	ExportedAt time.Time           `json:"exported_at"`
+	Keys       []KeyTransferRecord `json:"keys"`
+}
+
+type keyTransferEnvelope struct {
+	Kind       string `json:"kind"`
+	Version    int    `json:"version"`
+	Encryption string `json:"encryption"`
+	Format     string `json:"format"`
+	N          int    `json:"n"`
+	R          int    `json:"r"`
+	P          int    `json:"p"`
+	Salt       []byte `json:"salt"`
+	Nonce      []byte `json:"nonce"`
+	Data       []byte `json:"data"`
+}
+
+type KeyImportOptions struct {
+	DryRun   bool
+	Conflict string // skip|overwrite|merge
+}
+
+type KeyImportItem struct {
+	Key    string `json:"key"`    // masked
+	Action string `json:"action"` // created|updated|skipped|error
+	Error  string `json:"error,omitempty"`
+}
+
+type KeyImportResult struct {
+	DryRun   bool            `json:"dry_run"`
+	Conflict string          `json:"conflict"`
+	Total    int             `json:"total"`
+	Created  int             `json:"created"`
+	Updated  int             `json:"updated"`
+	Skipped  int             `json:"skipped"`
+	Failed   int             `json:"failed"`
+	Items    []KeyImportItem `json:"items"`
+}
+
+func NormalizeKeyTransferFormat(format string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(format)) {
+	case "", KeyTransferFormatTXT, "text":
+		return KeyTransferFormatTXT, nil
+	case KeyTransferFormatJSON:
+		return KeyTransferFormatJSON, nil
+	case KeyTransferFormatCSV:
+		return KeyTransferFormatCSV, nil
+	default:
+		return "", ErrKeyTransferFormat
+	}
+}
+
+// ExportRecords returns all keys in id-desc order. Invalid keys are only
+// included on request since they cannot serve traffic anyway.
+func (s *KeyService) ExportRecords(ctx context.Context, includeInvalid bool) ([]KeyTransferRecord, error) {
+	items, err := s.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	out := make([]KeyTransferRecord, 0, len(items))
+	for _, k := range items {
+		if k.IsInvalid && !includeInvalid {
+			continue
+		}
+		if strings.TrimSpace(k.Key) == "" {
+			continue
+		}
+		createdAt, updatedAt := k.CreatedAt, k.UpdatedAt
+		out = append(out, KeyTransferRecord{
+			Key:        strings.TrimSpace(k.Key),
+			Alias:      k.Alias,
+			TotalQuota: k.TotalQuota,
+			UsedQuota:  k.UsedQuota,
+			IsActive:   k.IsActive,
+			IsInvalid:  k.IsInvalid,
+			LastUsedAt: k.LastUsedAt,
+			CreatedAt:  &createdAt,
+			UpdatedAt:  &updatedAt,
+		})
+	}
+	return out, nil
+}
+
+// Import applies records in a single transaction. Rows that cannot be used
+// are reported per item; database failures abort the whole import.
+func (s *KeyService) Import(ctx context.Context, records []KeyTransferRecord, opts KeyImportOptions) (KeyImportResult, error) {
+	conflict := strings.ToLower(strings.TrimSpace(opts.Conflict))
+	if conflict == "" {
+		conflict = KeyImportConflictSkip
+	}
+	switch conflict {
+	case KeyImportConflictSkip, KeyImportConflictOverwrite, KeyImportConflictMerge:
+	default:
+		return KeyImportResult{}, ErrKeyTransferConflictPolicy
+	}
+	if len(records) > maxKeyImportRecords {
+		return KeyImportResult{}, ErrKeyTransferTooLarge
+	}
+
+	result := KeyImportResult{
+		DryRun:   opts.DryRun,
+		Conflict: conflict,
+		Total:    len(records),
+		Items:    make([]KeyImportItem, 0, len(records)),
+	}
+
+	apply := func(tx *gorm.DB) error {
+		seen := make(map[string]struct{}, len(records))
+		for _, rec := range records {
+			rec.Key = strings.TrimSpace(rec.Key)
+			item := KeyImportItem{Key: util.MaskAPIKey(rec.Key)}
+
+			if rec.Key == "" {
+				item.Action = "error"
+				item.Error = "missing key"
+				result.Failed++
+				result.Items = append(result.Items, item)
+				continue
+			}
+			if _, ok := seen[rec.Key]; ok {
+				item.Action = "skipped"
+				item.Error = "duplicate in file"
+				result.Skipped++
+				result.Items = append(result.Items, item)
+				continue
+			}
+			seen[rec.Key] = struct{}{}
+
+			var existing models.APIKey
+			found := tx.Where(map[string]any{"key": rec.Key}).Limit(1).Find(&existing)
+			if found.Error != nil {
+				return found.Error
+			}
+
+			if found.RowsAffected == 0 {
+				row := newAPIKeyFromTransfer(rec)
+				if !opts.DryRun {
+					// is_active has a column default, so a false value is
+					// dropped by Create and has to be written separately.
+					active := row.IsActive
+					if err := tx.Create(&row).Error; err != nil {
+						return err
+					}
+					if !active {
+						if err := tx.Model(&models.APIKey{}).Where("id = ?", row.ID).Update("is_active", false).Error; err != nil {
+							return err
+						}
+					}
+				}
+				item.Action = "created"
+				result.Created++
+				result.Items = append(result.Items, item)
+				continue
+			}
+
+			if conflict == KeyImportConflictSkip {
+				item.Action = "skipped"
+				result.Skipped++
+				result.Items = append(result.Items, item)
+				continue
+			}
+
+			updates := transferUpdates(existing, rec, conflict)
+			if !opts.DryRun {
+				if err := tx.Model(&models.APIKey{}).Where("id = ?", existing.ID).Updates(updates).Error; err != nil {
+					return err
+				}
+			}
+			item.Action = "updated"
+			result.Updated++
+			result.Items = append(result.Items, item)
+		}
+		return nil
+	}
+
+	db := s.db.WithContext(ctx)
+	var err error
+	if opts.DryRun {
+		err = apply(db)
+	} else {
+		err = db.Transaction(apply)
+	}
+	if err != nil {
+		return KeyImportResult{}, err
+	}
+	_ = s.notifyQuotaChange(0, nil)
+	return result, nil
+}
+
+func newAPIKeyFromTransfer(rec KeyTransferRecord) models.APIKey {
+	alias := strings.TrimSpace(rec.Alias)
+	if alias == "" {
+		alias = "Default"
+	}
+	total := rec.TotalQuota
+	if total <= 0 {
+		total = 1000
+	}
+	used := rec.UsedQuota
+	if used < 0 {
+		used = 0
+	}
+	if used > total {
+		used = total
+	}
+	row := models.APIKey{
+		Key:        rec.Key,
+		Alias:      alias,
+		TotalQuota: total,
+		UsedQuota:  used,
+		IsActive:   rec.IsActive && !rec.IsInvalid,
+		IsInvalid:  rec.IsInvalid,
+		LastUsedAt: rec.LastUsedAt,
+	}
+	if rec.CreatedAt != nil {
+		row.CreatedAt = *rec.CreatedAt
+	}
+	return row
+}
+
+// transferUpdates builds the column updates for an existing key. Overwrite
+// takes the imported values as-is; merge keeps the more conservative state of
+// both sides so a merge never revives a key that either side gave up on.
+func transferUpdates(existing models.APIKey, rec KeyTransferRecord, conflict string) map[string]any {
+	incoming := newAPIKeyFromTransfer(rec)
+
+	if conflict == KeyImportConflictOverwrite {
+		return map[string]any{
+			"alias":        incoming.Alias,
+			"total_quota":  incoming.TotalQuota,
+			"used_quota":   incoming.UsedQuota,
+			"is_active":    incoming.IsActive,
+			"is_invalid":   incoming.IsInvalid,
+			"last_used_at": incoming.LastUsedAt,
+		}
+	}
+
+	alias := existing.Alias
+	if strings.TrimSpace(rec.Alias) != "" {
+		alias = incoming.Alias
+	}
+	total := existing.TotalQuota
+	if rec.TotalQuota > 0 {
+		total = incoming.TotalQuota
+	}
+	used := existing.UsedQuota
+	if incoming.UsedQuota > used {
+		used = incoming.UsedQuota
+	}
+	if used > total {
+		used = total
+	}
+	lastUsed := existing.LastUsedAt
+	if incoming.LastUsedAt != nil && (lastUsed == nil || incoming.LastUsedAt.After(*lastUsed)) {
+		lastUsed = incoming.LastUsedAt
+	}
+	invalid := existing.IsInvalid || incoming.IsInvalid
+	return map[string]any{
+		"alias":        alias,
+		"total_quota":  total,
+		"used_quota":   used,
+		"is_active":    existing.IsActive && incoming.IsActive && !invalid,
+		"is_invalid":   invalid,
+		"last_used_at": lastUsed,
+	}
+}
+
+// EncodeKeyTransfer renders records in the given format. The txt format only
+// carries the raw keys, one per line.
+func EncodeKeyTransfer(records []KeyTransferRecord, format string) ([]byte, error) {
+	switch format {
+	case KeyTransferFormatTXT:
+		var buf bytes.Buffer
+		for _, rec := range records {
+			buf.WriteString(rec.Key)
+			buf.WriteByte('\n')
+		}
+		return buf.Bytes(), nil
+	case KeyTransferFormatJSON:
+		return json.MarshalIndent(keyTransferDocument{
+			Kind:       keyTransferKind,
+			Version:    keyTransferVersion,
+			ExportedAt: time.Now().UTC(),
+			Keys:       records,
+		}, "", "  ")
+	case KeyTransferFormatCSV:
+		var buf bytes.Buffer
+		w := csv.NewWriter(&buf)
+		_ = w.Write(keyTransferCSVHeader)
+		for _, rec := range records {
+			_ = w.Write([]string{
+				rec.Key,
+				rec.Alias,
+				strconv.Itoa(rec.TotalQuota),
+				strconv.Itoa(rec.UsedQuota),
+				strconv.FormatBool(rec.IsActive),
+				strconv.FormatBool(rec.IsInvalid),
+				formatTransferTime(rec.LastUsedAt),
+				formatTransferTime(rec.CreatedAt),
+				formatTransferTime(rec.UpdatedAt),
+			})
+		}
+		w.Flush()
+		if err := w.Error(); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	default:
+		return nil, ErrKeyTransferFormat
+	}
+}
+
+// DecodeKeyTransfer parses an export file. An empty format is detected from
+// the content. Encrypted files need a passphrase.
+func DecodeKeyTransfer(data []byte, format, passphrase string) ([]KeyTransferRecord, error) {
+	if IsSealedKeyTransfer(data) {
+		plain, inner, err := OpenKeyTransfer(data, passphrase)
+		if err != nil {
+			return nil, err
+		}
+		data = plain
+		if format == "" {
+			format = inner
+		}
+	}
+
+	if strings.TrimSpace(format) == "" {
+		format = detectKeyTransferFormat(data)
+	}
+	format, err := NormalizeKeyTransferFormat(format)
+	if err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case KeyTransferFormatJSON:
+		return decodeKeyTransferJSON(data)
+	case KeyTransferFormatCSV:
+		return decodeKeyTransferCSV(data)
+	default:
+		var out []KeyTransferRecord
+		for _, line := range strings.Split(string(data), "\n") {
+			key := strings.TrimSpace(line)
+			if key == "" {
+				continue
+			}
+			out = append(out, KeyTransferRecord{Key: key, IsActive: true})
+		}
+		return out, nil
+	}
+}
+
+func detectKeyTransferFormat(data []byte) string {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && (trimmed[0] == '{' || trimmed[0] == '[') {
+		return KeyTransferFormatJSON
+	}
+	firstLine, _, _ := strings.Cut(string(trimmed), "\n")
+	if strings.HasPrefix(strings.ToLower(strings.TrimSpace(firstLine)), "key,") {
+		return KeyTransferFormatCSV
+	}
+	return KeyTransferFormatTXT
+}
+
+func decodeKeyTransferJSON(data []byte) ([]KeyTransferRecord, error) {
+	trimmed := bytes.TrimSpace(data)
+	// A bare array of records is accepted as well as the export document.
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		var out []KeyTransferRecord
+		if err := json.Unmarshal(trimmed, &out); err != nil {
+			return nil, fmt.Errorf("invalid json: %w", err)
+		}
+		return out, nil
+	}
+
+	var doc keyTransferDocument
+	if err := json.Unmarshal(trimmed, &doc); err != nil {
+		return nil, fmt.Errorf("invalid json: %w", err)
+	}
+	if doc.Version > keyTransferVersion {
+		return nil, fmt.Errorf("unsupported export version %d", doc.Version)
+	}
+	return doc.Keys, nil
+}
+
+func decodeKeyTransferCSV(data []byte) ([]KeyTransferRecord, error) {
+	r := csv.NewReader(bytes.NewReader(data))
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+
+	header, err := r.Read()
+	if err != nil {
+		return nil, fmt.Errorf("invalid csv: %w", err)
+	}
+	cols := make(map[string]int, len(header))
+	for i, name := range header {
+		cols[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := cols["key"]; !ok {
+		return nil, errors.New("invalid csv: missing key column")
+	}
+
+	var out []KeyTransferRecord
+	for line := 2; ; line++ {
+		row, err := r.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid csv: %w", err)
+		}
+		field := func(name string) string {
+			if i, ok := cols[name]; ok && i < len(row) {
+				return strings.TrimSpace(row[i])
+			}
+			return ""
+		}
+
+		rec := KeyTransferRecord{Key: field("key"), Alias: field("alias"), IsActive: true}
+		if v := field("total_quota"); v != "" {
+			if rec.TotalQuota, err = strconv.Atoi(v); err != nil {
+				return nil, fmt.Errorf("invalid csv: line %d: total_quota: %w", line, err)
+			}
+		}
+		if v := field("used_quota"); v != "" {
+			if rec.UsedQuota, err = strconv.Atoi(v); err != nil {
+				return nil, fmt.Errorf("invalid csv: line %d: used_quota: %w", line, err)
+			}
+		}
+		if v := field("is_active"); v != "" {
+			if rec.IsActive, err = strconv.ParseBool(v); err != nil {
+				return nil, fmt.Errorf("invalid csv: line %d: is_active: %w", line, err)
+			}
+		}
+		if v := field("is_invalid"); v != "" {
+			if rec.IsInvalid, err = strconv.ParseBool(v); err != nil {
+				return nil, fmt.Errorf("invalid csv: line %d: is_invalid: %w", line, err)
+			}
+		}
+		for name, dst := range map[string]**time.Time{
+			"last_used_at": &rec.LastUsedAt,
+			"created_at":   &rec.CreatedAt,
+			"updated_at":   &rec.UpdatedAt,
+		} {
+			v := field(name)
+			if v == "" {
+				continue
+			}
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid csv: line %d: %s: %w", line, name, err)
+			}
+			*dst = &t
+		}
+		out = append(out, rec)
+	}
+	return out, nil
+}
+
+func formatTransferTime(t *time.Time) string {
+	if t == nil || t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
+
+// SealKeyTransfer encrypts an export with a key derived from passphrase, so
+// the file can be moved between instances without exposing the keys.
+func SealKeyTransfer(plain []byte, format, passphrase string) ([]byte, error) {
+	if passphrase == "" {
+		return nil, ErrKeyTransferPassphraseRequired
+	}
+
+	salt := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, err
+	}
+	aead, err := keyTransferAEAD(passphrase, salt, keyTransferScryptN, keyTransferScryptR, keyTransferScryptP)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	env := keyTransferEnvelope{
+		Kind:       keyTransferKind,
+		Version:    keyTransferVersion,
+		Encryption: keyTransferEncryptor,
+		Format:     format,
+		N:          keyTransferScryptN,
+		R:          keyTransferScryptR,
+		P:          keyTransferScryptP,
+		Salt:       salt,
+		Nonce:      nonce,
+	}
+	env.Data = aead.Seal(nil, nonce, plain, []byte(format))
+	return json.MarshalIndent(env, "", "  ")
+}
+
+// OpenKeyTransfer decrypts a sealed export and returns the inner format.
+func OpenKeyTransfer(data []byte, passphrase string) ([]byte, string, error) {
+	var env keyTransferEnvelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return nil, "", fmt.Errorf("invalid envelope: %w", err)
+	}
+	if env.Encryption != keyTransferEncryptor {
+		return nil, "", fmt.Errorf("unsupported encryption %q", env.Encryption)
+	}
+	if passphrase == "" {
+		return nil, "", ErrKeyTransferPassphraseRequired
+	}
+	// Bound the cost parameters so a crafted file cannot exhaust memory or pin
+	// the CPU.
+	if env.N <= 1 || env.N > 1<<20 || env.R <= 0 || env.R > 32 || env.P <= 0 || env.P > 16 ||
+		128*int64(env.N)*int64(env.R)*int64(env.P) > maxKeyTransferScryptMemory {
+		return nil, "", errors.New("invalid envelope: scrypt parameters out of range")
+	}
+
+	aead, err := keyTransferAEAD(passphrase, env.Salt, env.N, env.R, env.P)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(env.Nonce) != aead.NonceSize() {
+		return nil, "", errors.New("invalid envelope: bad nonce")
+	}
+	plain, err := aead.Open(nil, env.Nonce, env.Data, []byte(env.Format))
+	if err != nil {
+		return nil, "", ErrKeyTransferDecrypt
+	}
+	return plain, env.Format, nil
+}
+
+func IsSealedKeyTransfer(data []byte) bool {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) == 0 || trimmed[0] != '{' {
+		return false
+	}
+	var probe struct {
+		Encryption string `json:"encryption"`
+	}
+	return json.Unmarshal(trimmed, &probe) == nil && probe.Encryption != ""
+}
+
+func keyTransferAEAD(passphrase string, salt []byte, n, r, p int) (cipher.AEAD, error) {
+	key, err := scrypt.Key([]byte(passphrase), salt, n, r, p, 32)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
@@ -0,0 +1,151 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"tavily-proxy/server/internal/db"
+)
+
+func TestKeyTransfer_RoundTripFormats(t *testing.T) {
+	t.Parallel()
+
+	lastUsed := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	records := []KeyTransferRecord{
+		{Key: "tvly-one", Alias: "main, eu", TotalQuota: 1000, UsedQuota: 42, IsActive: true, LastUsedAt: &lastUsed},
+		{Key: "tvly-two", Alias: "spare", TotalQuota: 500, UsedQuota: 500, IsInvalid: true},
+	}
+
+	for _, format := range []string{KeyTransferFormatJSON, KeyTransferFormatCSV} {
+		plain, err := EncodeKeyTransfer(records, format)
+		if err != nil {
+			t.Fatalf("%s encode: %v", format, err)
+		}
+		sealed, err := SealKeyTransfer(plain, format, "correct horse")
+		if err != nil {
+			t.Fatalf("%s seal: %v", format, err)
+		}
+		if !IsSealedKeyTransfer(sealed) {
+			t.Fatalf("%s: sealed file not detected", format)
+		}
+
+		if _, err := DecodeKeyTransfer(sealed, "", ""); err != ErrKeyTransferPassphraseRequired {
+			t.Fatalf("%s: unexpected error without passphrase: %v", format, err)
+		}
+		if _, err := DecodeKeyTransfer(sealed, "", "wrong"); err != ErrKeyTransferDecrypt {
+			t.Fatalf("%s: unexpected error with wrong passphrase: %v", format, err)
+		}
+
+		got, err := DecodeKeyTransfer(sealed, "", "correct horse")
+		if err != nil {
+			t.Fatalf("%s decode: %v", format, err)
+		}
+		if len(got) != 2 {
+			t.Fatalf("%s: unexpected records: %+v", format, got)
+		}
+		if got[0].Alias != "main, eu" || got[0].UsedQuota != 42 || !got[0].IsActive || got[0].LastUsedAt == nil || !got[0].LastUsedAt.Equal(lastUsed) {
+			t.Fatalf("%s: first record mismatch: %+v", format, got[0])
+		}
+		if !got[1].IsInvalid || got[1].IsActive || got[1].TotalQuota != 500 {
+			t.Fatalf("%s: second record mismatch: %+v", format, got[1])
+		}
+	}
+
+	// A crafted envelope must not make the decrypt allocate gigabytes.
+	sealed, err := SealKeyTransfer([]byte("tvly-a"), KeyTransferFormatTXT, "pw")
+	if err != nil {
+		t.Fatalf("seal: %v", err)
+	}
+	var env map[string]any
+	if err := json.Unmarshal(sealed, &env); err != nil {
+		t.Fatalf("decode envelope: %v", err)
+	}
+	env["n"], env["r"] = 1<<20, 32
+	costly, _ := json.Marshal(env)
+	if _, _, err := OpenKeyTransfer(costly, "pw"); err == nil || !strings.Contains(err.Error(), "out of range") {
+		t.Fatalf("expensive scrypt parameters must be rejected, got %v", err)
+	}
+
+	txt, err := DecodeKeyTransfer([]byte("tvly-a\n\n tvly-b \n"), "", "")
+	if err != nil || len(txt) != 2 || txt[1].Key != "tvly-b" {
+		t.Fatalf("unexpected txt decode: %+v err=%v", txt, err)
+	}
+}
+
+func TestKeyService_ImportConflictPolicies(t *testing.T) {
+	t.Parallel()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	database, err := db.Open(filepath.Join(t.TempDir(), "app.db"))
+	if err != nil {
+		t.Fatalf("db open: %v", err)
+	}
+	sqlDB, err := database.DB()
+	if err != nil {
+		t.Fatalf("db handle: %v", err)
+	}
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	ctx := context.Background()
+	keys := NewKeyService(database, logger)
+	existing, err := keys.Create(ctx, "tvly-existing", "old", 1000)
+	if err != nil {
+		t.Fatalf("seed key: %v", err)
+	}
+	if err := keys.SetUsage(ctx, existing.ID, 300, nil); err != nil {
+		t.Fatalf("seed usage: %v", err)
+	}
+
+	records := []KeyTransferRecord{
+		{Key: "tvly-existing", Alias: "new", TotalQuota: 2000, UsedQuota: 100, IsActive: true},
+		{Key: "tvly-fresh", Alias: "fresh", TotalQuota: 800, UsedQuota: 10, IsActive: true},
+		{Key: "tvly-fresh", Alias: "again"},
+		{Key: "  "},
+	}
+
+	if _, err := keys.Import(ctx, records, KeyImportOptions{Conflict: "replace"}); err != ErrKeyTransferConflictPolicy {
+		t.Fatalf("unexpected error for bad policy: %v", err)
+	}
+
+	dry, err := keys.Import(ctx, records, KeyImportOptions{DryRun: true, Conflict: KeyImportConflictMerge})
+	if err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	if dry.Created != 1 || dry.Updated != 1 || dry.Skipped != 1 || dry.Failed != 1 {
+		t.Fatalf("unexpected dry run result: %+v", dry)
+	}
+	if items, _ := keys.List(ctx); len(items) != 1 {
+		t.Fatalf("dry run wrote rows: %d", len(items))
+	}
+
+	if _, err := keys.Import(ctx, records, KeyImportOptions{Conflict: KeyImportConflictMerge}); err != nil {
+		t.Fatalf("merge import: %v", err)
+	}
+	merged, _ := keys.FindByKey(ctx, "tvly-existing")
+	if merged.Alias != "new" || merged.TotalQuota != 2000 || merged.UsedQuota != 300 {
+		t.Fatalf("unexpected merge: %+v", merged)
+	}
+	fresh, _ := keys.FindByKey(ctx, "tvly-fresh")
+	if fresh == nil || fresh.Alias != "fresh" || fresh.UsedQuota != 10 || fresh.TotalQuota != 800 {
+		t.Fatalf("unexpected created key: %+v", fresh)
+	}
+
+	skipped, err := keys.Import(ctx, records[:1], KeyImportOptions{})
+	if err != nil || skipped.Skipped != 1 {
+		t.Fatalf("unexpected skip result: %+v err=%v", skipped, err)
+	}
+
+	if _, err := keys.Import(ctx, records[:1], KeyImportOptions{Conflict: KeyImportConflictOverwrite}); err != nil {
+		t.Fatalf("overwrite import: %v", err)
+	}
+	overwritten, _ := keys.FindByKey(ctx, "tvly-existing")
+	if overwritten.UsedQuota != 100 || overwritten.TotalQuota != 2000 {
+		t.Fatalf("unexpected overwrite: %+v", overwritten)
+	}
+}
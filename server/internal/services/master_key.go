@@ -35,7 +35,7 @@ func (s *MasterKeyService) LoadOrCreate(ctx context.Context) error {
 
 func (s *MasterKeyService) LoadOrCreateWithDefault(ctx context.Context, preferred string) error {
 	var setting models.Setting
-	err := s.db.WithContext(ctx).First(&setting, "key = ?", masterKeySettingKey).Error
+	err := s.db.WithContext(ctx).Where(map[string]any{"key": masterKeySettingKey}).First(&setting).Error
 	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
 		return err
 	}
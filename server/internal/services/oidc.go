@@ -0,0 +1,479 @@
+package services
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	ErrOIDCInvalidToken = errors.New("oidc_invalid_token")
+	ErrOIDCExchange     = errors.New("oidc_exchange_failed")
+	ErrOIDCDiscovery    = errors.New("oidc_discovery_failed")
+)
+
+// oidcClockSkew tolerates small clock differences with the IdP when checking
+// exp and iat.
+const oidcClockSkew = time.Minute
+
+type OIDCConfig struct {
+	IssuerURL    string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+	// GroupsClaim names the ID token claim that lists the user's groups.
+	GroupsClaim string
+	// RoleMapping maps IdP group names to admin roles. A user in several
+	// mapped groups gets the most privileged role.
+	RoleMapping map[string]Role
+	HTTPClient  *http.Client
+}
+
+// OIDCIdentity is the verified subset of ID token claims the proxy uses.
+type OIDCIdentity struct {
+	Subject string
+	Email   string
+	Name    string
+	Groups  []string
+}
+
+// DisplayName prefers the email, which is what admins recognise in audit logs.
+func (i OIDCIdentity) DisplayName() string {
+	switch {
+	case i.Email != "":
+		return i.Email
+	case i.Name != "":
+		return i.Name
+	}
+	return i.Subject
+}
+
+type oidcDiscovery struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// OIDCProvider runs the authorization code flow with PKCE against a single
+// issuer. Discovery and signing keys are fetched lazily and cached; keys are
+// refetched when a token names an unknown key id.
+type OIDCProvider struct {
+	cfg    OIDCConfig
+	client *http.Client
+
+	mu        sync.Mutex
+	discovery *oidcDiscovery
+	keys      map[string]crypto.PublicKey
+}
+
+func NewOIDCProvider(cfg OIDCConfig) *OIDCProvider {
+	cfg.IssuerURL = strings.TrimRight(cfg.IssuerURL, "/")
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"openid", "profile", "email"}
+	}
+	if cfg.GroupsClaim == "" {
+		cfg.GroupsClaim = "groups"
+	}
+	client := cfg.HTTPClient
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	return &OIDCProvider{cfg: cfg, client: client}
+}
+
+// ParseRoleMapping parses "group=role" pairs separated by commas.
+func ParseRoleMapping(raw string) (map[string]Role, error) {
+	out := map[string]Role{}
+	for _, pair := range strings.Split(raw, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		group, roleName, ok := strings.Cut(pair, "=")
+		group = strings.TrimSpace(group)
+		if !ok || group == "" {
+			return nil, fmt.Errorf("%q: expected group=role", pair)
+		}
+		role, err := ParseRole(roleName)
+		if err != nil {
+			return nil, fmt.Errorf("%q: unknown role %q", pair, strings.TrimSpace(roleName))
+		}
+		out[group] = role
+	}
+	return out, nil
+}
+
+// roleRank orders roles from most to least privileged for group mapping.
+var roleRank = map[Role]int{RoleOwner: 4, RoleOperator: 3, RoleViewer: 2, RoleBilling: 1}
+
+// RoleFor picks the most privileged role mapped from any of the groups.
+func (p *OIDCProvider) RoleFor(groups []string) (Role, bool) {
+	var best Role
+	for _, g := range groups {
+		if role, ok := p.cfg.RoleMapping[g]; ok && roleRank[role] > roleRank[best] {
+			best = role
+		}
+	}
+	return best, best != ""
+}
+
+// NewPKCEVerifier returns a random code verifier and its S256 challenge.
+func NewPKCEVerifier() (verifier, challenge string, err error) {
+	verifier, err = randomURLToken(32)
+	if err != nil {
+		return "", "", err
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	return verifier, base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+func (p *OIDCProvider) AuthCodeURL(ctx context.Context, state, nonce, challenge string) (string, error) {
+	d, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.cfg.ClientID},
+		"redirect_uri":          {p.cfg.RedirectURL},
+		"scope":                 {strings.Join(p.cfg.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {challenge},
+		"code_challenge_method": {"S256"},
+	}
+	sep := "?"
+	if strings.Contains(d.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return d.AuthorizationEndpoint + sep + q.Encode(), nil
+}
+
+// Exchange redeems an authorization code and returns the verified identity.
+func (p *OIDCProvider) Exchange(ctx context.Context, code, verifier, nonce string, now time.Time) (OIDCIdentity, error) {
+	d, err := p.discover(ctx)
+	if err != nil {
+		return OIDCIdentity{}, err
+	}
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.cfg.RedirectURL},
+		"client_id":     {p.cfg.ClientID},
+		"code_verifier": {verifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return OIDCIdentity{}, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.cfg.ClientSecret != "" {
+		req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+	}
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return OIDCIdentity{}, fmt.Errorf("%w: %v", ErrOIDCExchange, err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode != http.StatusOK {
+		return OIDCIdentity{}, fmt.Errorf("%w: token endpoint returned %d: %s", ErrOIDCExchange, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	var tok struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.Unmarshal(body, &tok); err != nil || tok.IDToken == "" {
+		return OIDCIdentity{}, fmt.Errorf("%w: response has no id_token", ErrOIDCExchange)
+	}
+	return p.VerifyIDToken(ctx, tok.IDToken, nonce, now)
+}
+
+// VerifyIDToken checks the signature, issuer, audience, expiry and nonce of
+// an ID token.
+func (p *OIDCProvider) VerifyIDToken(ctx context.Context, raw, nonce string, now time.Time) (OIDCIdentity, error) {
+	parts := strings.Split(raw, ".")
+	if len(parts) != 3 {
+		return OIDCIdentity{}, fmt.Errorf("%w: malformed token", ErrOIDCInvalidToken)
+	}
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeJWTPart(parts[0], &header); err != nil {
+		return OIDCIdentity{}, fmt.Errorf("%w: header: %v", ErrOIDCInvalidToken, err)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return OIDCIdentity{}, fmt.Errorf("%w: signature encoding", ErrOIDCInvalidToken)
+	}
+	key, err := p.signingKey(ctx, header.Kid)
+	if err != nil {
+		return OIDCIdentity{}, err
+	}
+	if err := verifyJWTSignature(header.Alg, key, parts[0]+"."+parts[1], sig); err != nil {
+		return OIDCIdentity{}, fmt.Errorf("%w: %v", ErrOIDCInvalidToken, err)
+	}
+
+	var claims map[string]any
+	if err := decodeJWTPart(parts[1], &claims); err != nil {
+		return OIDCIdentity{}, fmt.Errorf("%w: claims: %v", ErrOIDCInvalidToken, err)
+	}
+	d, err := p.discover(ctx)
+	if err != nil {
+		return OIDCIdentity{}, err
+	}
+	if iss, _ := claims["iss"].(string); iss != d.Issuer {
+		return OIDCIdentity{}, fmt.Errorf("%w: unexpected issuer %q", ErrOIDCInvalidToken, iss)
+	}
+	if !claimContains(claims["aud"], p.cfg.ClientID) {
+		return OIDCIdentity{}, fmt.Errorf("%w: audience mismatch", ErrOIDCInvalidToken)
+	}
+	exp, ok := claims["exp"].(float64)
+	if !ok || now.After(time.Unix(int64(exp), 0).Add(oidcClockSkew)) {
+		return OIDCIdentity{}, fmt.Errorf("%w: token expired", ErrOIDCInvalidToken)
+	}
+	if iat, ok := claims["iat"].(float64); ok && time.Unix(int64(iat), 0).After(now.Add(oidcClockSkew)) {
+		return OIDCIdentity{}, fmt.Errorf("%w: token issued in the future", ErrOIDCInvalidToken)
+	}
+	if got, _ := claims["nonce"].(string); subtle.ConstantTimeCompare([]byte(got), []byte(nonce)) != 1 {
+		return OIDCIdentity{}, fmt.Errorf("%w: nonce mismatch", ErrOIDCInvalidToken)
+	}
+
+	id := OIDCIdentity{}
+	id.Subject, _ = claims["sub"].(string)
+	id.Email, _ = claims["email"].(string)
+	id.Name, _ = claims["name"].(string)
+	if id.Subject == "" {
+		return OIDCIdentity{}, fmt.Errorf("%w: missing sub", ErrOIDCInvalidToken)
+	}
+	switch groups := claims[p.cfg.GroupsClaim].(type) {
+	case []any:
+		for _, g := range groups {
+			if s, ok := g.(string); ok {
+				id.Groups = append(id.Groups, s)
+			}
+		}
+	case string:
+		id.Groups = strings.FieldsFunc(groups, func(r rune) bool { return r == ',' || r == ' ' })
+	}
+	sort.Strings(id.Groups)
+	return id, nil
+}
+
+func (p *OIDCProvider) discover(ctx context.Context) (*oidcDiscovery, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.discovery != nil {
+		return p.discovery, nil
+	}
+	var d oidcDiscovery
+	if err := p.getJSON(ctx, p.cfg.IssuerURL+"/.well-known/openid-configuration", &d); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrOIDCDiscovery, err)
+	}
+	if strings.TrimRight(d.Issuer, "/") != p.cfg.IssuerURL {
+		return nil, fmt.Errorf("%w: issuer %q does not match %q", ErrOIDCDiscovery, d.Issuer, p.cfg.IssuerURL)
+	}
+	if d.AuthorizationEndpoint == "" || d.TokenEndpoint == "" || d.JWKSURI == "" {
+		return nil, fmt.Errorf("%w: incomplete provider metadata", ErrOIDCDiscovery)
+	}
+	p.discovery = &d
+	return p.discovery, nil
+}
+
+func (p *OIDCProvider) signingKey(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	d, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	key, ok := p.lookupKey(kid)
+	p.mu.Unlock()
+	if ok {
+		return key, nil
+	}
+
+	// The IdP may have rotated its keys since the last fetch.
+	var set struct {
+		Keys []jsonWebKey `json:"keys"`
+	}
+	if err := p.getJSON(ctx, d.JWKSURI, &set); err != nil {
+		return nil, fmt.Errorf("%w: jwks: %v", ErrOIDCDiscovery, err)
+	}
+	keys := map[string]crypto.PublicKey{}
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		if pub, err := k.publicKey(); err == nil {
+			keys[k.Kid] = pub
+		}
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.keys = keys
+	if key, ok := p.lookupKey(kid); ok {
+		return key, nil
+	}
+	return nil, fmt.Errorf("%w: unknown signing key %q", ErrOIDCInvalidToken, kid)
+}
+
+// lookupKey must be called with p.mu held. A token without kid is accepted
+// only when the IdP publishes a single key.
+func (p *OIDCProvider) lookupKey(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(p.keys) == 1 {
+		for _, k := range p.keys {
+			return k, true
+		}
+	}
+	k, ok := p.keys[kid]
+	return k, ok
+}
+
+func (p *OIDCProvider) getJSON(ctx context.Context, url string, out any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned %d", url, resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(out)
+}
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func (k jsonWebKey) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+func verifyJWTSignature(alg string, key crypto.PublicKey, signed string, sig []byte) error {
+	var hash crypto.Hash
+	switch alg {
+	case "RS256", "ES256":
+		hash = crypto.SHA256
+	case "RS384", "ES384":
+		hash = crypto.SHA384
+	case "RS512":
+		hash = crypto.SHA512
+	default:
+		return fmt.Errorf("unsupported alg %q", alg)
+	}
+	h := hash.New()
+	h.Write([]byte(signed))
+	digest := h.Sum(nil)
+
+	switch pub := key.(type) {
+	case *rsa.PublicKey:
+		if !strings.HasPrefix(alg, "RS") {
+			return errors.New("alg does not match key type")
+		}
+		return rsa.VerifyPKCS1v15(pub, hash, digest, sig)
+	case *ecdsa.PublicKey:
+		if !strings.HasPrefix(alg, "ES") || len(sig)%2 != 0 {
+			return errors.New("alg does not match key type")
+		}
+		r := new(big.Int).SetBytes(sig[:len(sig)/2])
+		s := new(big.Int).SetBytes(sig[len(sig)/2:])
+		if !ecdsa.Verify(pub, digest, r, s) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	}
+	return errors.New("unsupported key")
+}
+
+func decodeJWTPart(part string, out any) error {
+	raw, err := base64.RawURLEncoding.DecodeString(part)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(raw, out)
+}
+
+func claimContains(claim any, want string) bool {
+	switch v := claim.(type) {
+	case string:
+		return v == want
+	case []any:
+		for _, item := range v {
+			if s, ok := item.(string); ok && s == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func randomURLToken(n int) (string, error) {
+	raw := make([]byte, n)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
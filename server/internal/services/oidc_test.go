@@ -0,0 +1,69 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"tavily-proxy/server/internal/oidctest"
+)
+
+func TestOIDCProvider_VerifyIDToken(t *testing.T) {
+	t.Parallel()
+
+	idp := oidctest.New(t)
+	mapping, err := ParseRoleMapping("eng=viewer, ops = operator,admins=owner")
+	if err != nil {
+		t.Fatalf("parse mapping: %v", err)
+	}
+	provider := NewOIDCProvider(OIDCConfig{
+		IssuerURL:   idp.URL,
+		ClientID:    oidctest.ClientID,
+		RedirectURL: "http://proxy.test/auth/oidc/callback",
+		RoleMapping: mapping,
+	})
+	ctx := context.Background()
+	now := time.Now()
+
+	id, err := provider.VerifyIDToken(ctx, idp.Sign(map[string]any{
+		"sub": "u1", "email": "a@example.com", "nonce": "n1", "groups": []string{"ops", "eng"},
+	}), "n1", now)
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if id.DisplayName() != "a@example.com" || len(id.Groups) != 2 {
+		t.Fatalf("unexpected identity: %+v", id)
+	}
+	if role, ok := provider.RoleFor(id.Groups); !ok || role != RoleOperator {
+		t.Fatalf("expected the most privileged mapped role, got %q", role)
+	}
+	if _, ok := provider.RoleFor([]string{"sales"}); ok {
+		t.Fatalf("unmapped groups must not get a role")
+	}
+
+	for name, tc := range map[string]struct {
+		claims map[string]any
+		nonce  string
+	}{
+		"wrong nonce":    {map[string]any{"sub": "u1", "nonce": "other"}, "n1"},
+		"wrong audience": {map[string]any{"sub": "u1", "nonce": "n1", "aud": "someone-else"}, "n1"},
+		"wrong issuer":   {map[string]any{"sub": "u1", "nonce": "n1", "iss": "https://evil.example"}, "n1"},
+		"expired":        {map[string]any{"sub": "u1", "nonce": "n1", "exp": now.Add(-time.Hour).Unix()}, "n1"},
+		"missing sub":    {map[string]any{"nonce": "n1"}, "n1"},
+	} {
+		if _, err := provider.VerifyIDToken(ctx, idp.Sign(tc.claims), tc.nonce, now); !errors.Is(err, ErrOIDCInvalidToken) {
+			t.Errorf("%s: expected invalid token, got %v", name, err)
+		}
+	}
+
+	token := idp.Sign(map[string]any{"sub": "u1", "nonce": "n1"})
+	tampered := token[:len(token)-4] + "AAAA"
+	if _, err := provider.VerifyIDToken(ctx, tampered, "n1", now); !errors.Is(err, ErrOIDCInvalidToken) {
+		t.Fatalf("tampered signature must be rejected, got %v", err)
+	}
+
+	if _, err := ParseRoleMapping("eng=root"); err == nil {
+		t.Fatalf("unknown role must be rejected")
+	}
+}
@@ -0,0 +1,416 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"tavily-proxy/server/internal/models"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrPolicyNotFound      = errors.New("policy_not_found")
+	ErrPolicyNameTaken     = errors.New("policy_name_taken")
+	ErrPolicyInvalidName   = errors.New("invalid_policy_name")
+	ErrPolicyInvalidAction = errors.New("invalid_policy_action")
+	ErrPolicyInvalidCaller = errors.New("invalid_policy_caller")
+	ErrPolicyInvalidRule   = errors.New("invalid_policy_rule")
+)
+
+// Callers of the proxy, as matched by request policies.
+const (
+	CallerAny         = "any"
+	CallerMaster      = "master"
+	CallerDistributed = "distributed"
+)
+
+// Policy actions. set_default fills a missing field, override always sets it,
+// append adds values to an array field, clamp bounds a numeric field and
+// reject refuses the request.
+const (
+	PolicySetDefault = "set_default"
+	PolicyOverride   = "override"
+	PolicyAppend     = "append"
+	PolicyClamp      = "clamp"
+	PolicyReject     = "reject"
+)
+
+// PolicyRejectedError is returned by TavilyProxy.Do when a reject policy
+// matched; nothing was sent upstream.
+type PolicyRejectedError struct {
+	Policy  string
+	Message string
+}
+
+func (e *PolicyRejectedError) Error() string {
+	if e.Message == "" {
+		return "policy_rejected: " + e.Policy
+	}
+	return "policy_rejected: " + e.Message
+}
+
+type PolicyInput struct {
+	Name     string
+	Priority int
+	Enabled  bool
+	Endpoint string
+	Caller   string
+	Action   string
+	Field    string
+	Value    json.RawMessage
+	Min      *float64
+	Max      *float64
+	Message  string
+}
+
+// defaultPolicyCacheTTL bounds how stale policies written by another replica
+// can be; writes through this service reload immediately.
+const defaultPolicyCacheTTL = 10 * time.Second
+
+// PolicyService stores request policies and applies them to proxied requests.
+// Enabled policies are cached since they are read on every request.
+type PolicyService struct {
+	db     *gorm.DB
+	logger *slog.Logger
+
+	cacheTTL time.Duration
+	mu       sync.Mutex
+	cached   []models.RequestPolicy
+	expires  time.Time
+}
+
+func NewPolicyService(db *gorm.DB, logger *slog.Logger) *PolicyService {
+	return &PolicyService{db: db, logger: logger, cacheTTL: defaultPolicyCacheTTL}
+}
+
+// WithCacheTTL changes how long enabled policies are cached; 0 disables the
+// cache.
+func (s *PolicyService) WithCacheTTL(ttl time.Duration) *PolicyService {
+	s.cacheTTL = ttl
+	s.InvalidateCache()
+	return s
+}
+
+// InvalidateCache makes the next request reload policies, e.g. after a
+// restore replaced the table.
+func (s *PolicyService) InvalidateCache() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.cached, s.expires = nil, time.Time{}
+}
+
+// List returns every policy in evaluation order.
+func (s *PolicyService) List(ctx context.Context) ([]models.RequestPolicy, error) {
+	var out []models.RequestPolicy
+	err := s.db.WithContext(ctx).Order("priority asc, id asc").Find(&out).Error
+	return out, err
+}
+
+func (s *PolicyService) Get(ctx context.Context, id uint) (*models.RequestPolicy, error) {
+	var policy models.RequestPolicy
+	if err := s.db.WithContext(ctx).First(&policy, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrPolicyNotFound
+		}
+		return nil, err
+	}
+	return &policy, nil
+}
+
+func (s *PolicyService) Create(ctx context.Context, in PolicyInput) (*models.RequestPolicy, error) {
+	policy, err := newPolicy(in)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.db.WithContext(ctx).Create(&policy).Error; err != nil {
+		if isUniqueConstraintError(err) {
+			return nil, ErrPolicyNameTaken
+		}
+		return nil, err
+	}
+	s.InvalidateCache()
+	s.logger.Info("request policy created", "id", policy.ID, "name", policy.Name, "action", policy.Action)
+	return &policy, nil
+}
+
+// Update replaces every field of the policy.
+func (s *PolicyService) Update(ctx context.Context, id uint, in PolicyInput) (*models.RequestPolicy, error) {
+	existing, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	policy, err := newPolicy(in)
+	if err != nil {
+		return nil, err
+	}
+	policy.ID, policy.CreatedAt = existing.ID, existing.CreatedAt
+	if err := s.db.WithContext(ctx).Save(&policy).Error; err != nil {
+		if isUniqueConstraintError(err) {
+			return nil, ErrPolicyNameTaken
+		}
+		return nil, err
+	}
+	s.InvalidateCache()
+	return &policy, nil
+}
+
+func (s *PolicyService) Delete(ctx context.Context, id uint) error {
+	res := s.db.WithContext(ctx).Delete(&models.RequestPolicy{}, id)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return ErrPolicyNotFound
+	}
+	s.InvalidateCache()
+	return nil
+}
+
+func newPolicy(in PolicyInput) (models.RequestPolicy, error) {
+	p := models.RequestPolicy{
+		Name:     strings.TrimSpace(in.Name),
+		Priority: in.Priority,
+		Enabled:  in.Enabled,
+		Endpoint: strings.TrimSpace(in.Endpoint),
+		Caller:   strings.ToLower(strings.TrimSpace(in.Caller)),
+		Action:   strings.ToLower(strings.TrimSpace(in.Action)),
+		Field:    strings.TrimSpace(in.Field),
+		Min:      in.Min,
+		Max:      in.Max,
+		Message:  strings.TrimSpace(in.Message),
+	}
+	if p.Name == "" || len(p.Name) > 64 {
+		return p, ErrPolicyInvalidName
+	}
+	if p.Endpoint == "*" {
+		p.Endpoint = ""
+	}
+	if p.Endpoint != "" && !strings.HasPrefix(p.Endpoint, "/") {
+		return p, fmt.Errorf("%w: endpoint must start with /", ErrPolicyInvalidRule)
+	}
+	if p.Caller == "" {
+		p.Caller = CallerAny
+	}
+	switch p.Caller {
+	case CallerAny, CallerMaster, CallerDistributed:
+	default:
+		return p, ErrPolicyInvalidCaller
+	}
+	if len(p.Message) > 255 {
+		return p, fmt.Errorf("%w: message is too long", ErrPolicyInvalidRule)
+	}
+
+	value := bytes.TrimSpace(in.Value)
+	if len(value) > 0 && !json.Valid(value) {
+		return p, fmt.Errorf("%w: value must be JSON", ErrPolicyInvalidRule)
+	}
+	p.Value = string(value)
+
+	switch p.Action {
+	case PolicySetDefault, PolicyOverride, PolicyAppend:
+		if p.Field == "" || p.Value == "" {
+			return p, fmt.Errorf("%w: %s needs field and value", ErrPolicyInvalidRule, p.Action)
+		}
+	case PolicyClamp:
+		if p.Field == "" || (p.Min == nil && p.Max == nil) {
+			return p, fmt.Errorf("%w: clamp needs field and min or max", ErrPolicyInvalidRule)
+		}
+		if p.Min != nil && p.Max != nil && *p.Min > *p.Max {
+			return p, fmt.Errorf("%w: min is greater than max", ErrPolicyInvalidRule)
+		}
+	case PolicyReject:
+		if p.Value != "" && p.Field == "" {
+			return p, fmt.Errorf("%w: reject with a value needs a field", ErrPolicyInvalidRule)
+		}
+	default:
+		return p, ErrPolicyInvalidAction
+	}
+	return p, nil
+}
+
+func (s *PolicyService) enabled(ctx context.Context) ([]models.RequestPolicy, error) {
+	now := time.Now()
+	if s.cacheTTL > 0 {
+		s.mu.Lock()
+		cached, expires := s.cached, s.expires
+		s.mu.Unlock()
+		if cached != nil && now.Before(expires) {
+			return cached, nil
+		}
+	}
+	var out []models.RequestPolicy
+	if err := s.db.WithContext(ctx).Where("enabled = ?", true).Order("priority asc, id asc").Find(&out).Error; err != nil {
+		return nil, err
+	}
+	if out == nil {
+		out = []models.RequestPolicy{}
+	}
+	if s.cacheTTL > 0 {
+		s.mu.Lock()
+		s.cached, s.expires = out, now.Add(s.cacheTTL)
+		s.mu.Unlock()
+	}
+	return out, nil
+}
+
+// Apply runs the enabled policies that match the request and returns the
+// body to send upstream. Only JSON object bodies are rewritten; other bodies
+// are passed through and only field-less reject policies apply to them.
+func (s *PolicyService) Apply(ctx context.Context, req ProxyRequest) ([]byte, error) {
+	policies, err := s.enabled(ctx)
+	if err != nil {
+		return nil, err
+	}
+	caller := req.Caller()
+
+	var body map[string]any
+	trimmed := bytes.TrimSpace(req.Body)
+	switch {
+	case len(trimmed) == 0 && strings.EqualFold(req.Method, http.MethodPost):
+		body = map[string]any{}
+	case len(trimmed) > 0 && trimmed[0] == '{':
+		dec := json.NewDecoder(bytes.NewReader(trimmed))
+		dec.UseNumber()
+		if err := dec.Decode(&body); err != nil {
+			body = nil
+		}
+	}
+
+	changed := false
+	for _, p := range policies {
+		if p.Endpoint != "" && p.Endpoint != req.Path {
+			continue
+		}
+		if p.Caller != CallerAny && p.Caller != caller {
+			continue
+		}
+		if p.Action == PolicyReject {
+			if policyRejects(p, body) {
+				return nil, &PolicyRejectedError{Policy: p.Name, Message: p.Message}
+			}
+			continue
+		}
+		if body == nil {
+			continue
+		}
+		if applyPolicy(p, body) {
+			changed = true
+		}
+	}
+	if !changed {
+		return req.Body, nil
+	}
+	return json.Marshal(body)
+}
+
+func policyRejects(p models.RequestPolicy, body map[string]any) bool {
+	if p.Field == "" {
+		return true
+	}
+	current, ok := body[p.Field]
+	if !ok {
+		return false
+	}
+	if p.Value == "" {
+		return true
+	}
+	want, err := decodePolicyValue(p.Value)
+	if err != nil {
+		return false
+	}
+	return jsonEqual(current, want)
+}
+
+// applyPolicy reports whether it changed body.
+func applyPolicy(p models.RequestPolicy, body map[string]any) bool {
+	current, present := body[p.Field]
+	switch p.Action {
+	case PolicySetDefault, PolicyOverride:
+		if p.Action == PolicySetDefault && present && current != nil {
+			return false
+		}
+		value, err := decodePolicyValue(p.Value)
+		if err != nil || (present && jsonEqual(current, value)) {
+			return false
+		}
+		body[p.Field] = value
+		return true
+	case PolicyAppend:
+		value, err := decodePolicyValue(p.Value)
+		if err != nil {
+			return false
+		}
+		additions, ok := value.([]any)
+		if !ok {
+			additions = []any{value}
+		}
+		existing, _ := current.([]any)
+		if present && current != nil && existing == nil {
+			// A scalar where an array is expected is left for upstream to reject.
+			return false
+		}
+		merged := append([]any{}, existing...)
+		for _, add := range additions {
+			dup := false
+			for _, have := range merged {
+				if jsonEqual(have, add) {
+					dup = true
+					break
+				}
+			}
+			if !dup {
+				merged = append(merged, add)
+			}
+		}
+		if len(merged) == len(existing) {
+			return false
+		}
+		body[p.Field] = merged
+		return true
+	case PolicyClamp:
+		n, ok := current.(json.Number)
+		if !ok {
+			return false
+		}
+		f, err := n.Float64()
+		if err != nil {
+			return false
+		}
+		clamped := f
+		if p.Min != nil && clamped < *p.Min {
+			clamped = *p.Min
+		}
+		if p.Max != nil && clamped > *p.Max {
+			clamped = *p.Max
+		}
+		if clamped == f {
+			return false
+		}
+		body[p.Field] = clamped
+		return true
+	}
+	return false
+}
+
+func decodePolicyValue(raw string) (any, error) {
+	dec := json.NewDecoder(strings.NewReader(raw))
+	dec.UseNumber()
+	var v any
+	err := dec.Decode(&v)
+	return v, err
+}
+
+func jsonEqual(a, b any) bool {
+	ra, errA := json.Marshal(a)
+	rb, errB := json.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(ra, rb)
+}
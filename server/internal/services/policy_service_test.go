@@ -0,0 +1,105 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"tavily-proxy/server/internal/db"
+)
+
+func TestPolicyService_AppliedBeforeUpstream(t *testing.T) {
+	t.Parallel()
+
+	var mu sync.Mutex
+	var received map[string]any
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		raw, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		received = nil
+		_ = json.Unmarshal(raw, &received)
+		mu.Unlock()
+		_, _ = w.Write([]byte(`{"results":[]}`))
+	}))
+	t.Cleanup(upstream.Close)
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	database, err := db.Open(filepath.Join(t.TempDir(), "app.db"))
+	if err != nil {
+		t.Fatalf("db open: %v", err)
+	}
+	sqlDB, err := database.DB()
+	if err != nil {
+		t.Fatalf("db handle: %v", err)
+	}
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	ctx := context.Background()
+	keys := NewKeyService(database, logger)
+	if _, err := keys.Create(ctx, "tvly-test", "test", 1000); err != nil {
+		t.Fatalf("create key: %v", err)
+	}
+	policies := NewPolicyService(database, logger)
+	proxy := NewTavilyProxy(upstream.URL, 5*time.Second, keys, nil, nil, logger).WithPolicies(policies)
+
+	maxResults := 5.0
+	for _, in := range []PolicyInput{
+		{Name: "basic-depth", Enabled: true, Endpoint: "/search", Action: PolicyOverride, Field: "search_depth", Value: json.RawMessage(`"basic"`)},
+		{Name: "cap-results", Enabled: true, Endpoint: "/search", Caller: CallerDistributed, Action: PolicyClamp, Field: "max_results", Max: &maxResults},
+		{Name: "blocklist", Enabled: true, Action: PolicyAppend, Field: "exclude_domains", Value: json.RawMessage(`["spam.example","ads.example"]`)},
+		{Name: "usage", Enabled: true, Action: PolicySetDefault, Field: "include_usage", Value: json.RawMessage(`true`)},
+		{Name: "no-finance", Enabled: true, Endpoint: "/search", Action: PolicyReject, Field: "topic", Value: json.RawMessage(`"finance"`), Message: "finance searches are not allowed"},
+		{Name: "disabled", Enabled: false, Action: PolicyReject},
+	} {
+		if _, err := policies.Create(ctx, in); err != nil {
+			t.Fatalf("create %s: %v", in.Name, err)
+		}
+	}
+
+	send := func(body string, distributedKeyID uint) (map[string]any, error) {
+		_, err := proxy.Do(ctx, ProxyRequest{Method: http.MethodPost, Path: "/search", Body: []byte(body), DistributedKeyID: distributedKeyID})
+		mu.Lock()
+		defer mu.Unlock()
+		return received, err
+	}
+
+	got, err := send(`{"query":"q","search_depth":"advanced","max_results":20,"exclude_domains":["ads.example"],"include_usage":false}`, 7)
+	if err != nil {
+		t.Fatalf("distributed request: %v", err)
+	}
+	if got["search_depth"] != "basic" || got["max_results"] != 5.0 || got["include_usage"] != false {
+		t.Fatalf("unexpected rewritten body: %v", got)
+	}
+	if domains, _ := got["exclude_domains"].([]any); len(domains) != 2 || domains[0] != "ads.example" || domains[1] != "spam.example" {
+		t.Fatalf("blocklist should be merged without duplicates: %v", got["exclude_domains"])
+	}
+
+	got, err = send(`{"query":"q","max_results":20}`, 0)
+	if err != nil {
+		t.Fatalf("master request: %v", err)
+	}
+	if got["max_results"] != 20.0 || got["include_usage"] != true {
+		t.Fatalf("distributed-only clamp must not apply to the master key: %v", got)
+	}
+
+	_, err = send(`{"query":"q","topic":"finance"}`, 0)
+	var rejected *PolicyRejectedError
+	if !errors.As(err, &rejected) || rejected.Policy != "no-finance" || rejected.Message != "finance searches are not allowed" {
+		t.Fatalf("expected a policy rejection, got %v", err)
+	}
+
+	if _, err := policies.Create(ctx, PolicyInput{Name: "bad", Action: PolicyClamp, Field: "max_results"}); !errors.Is(err, ErrPolicyInvalidRule) {
+		t.Fatalf("clamp without bounds must be invalid, got %v", err)
+	}
+	if _, err := policies.Create(ctx, PolicyInput{Name: "usage", Action: PolicyReject}); !errors.Is(err, ErrPolicyNameTaken) {
+		t.Fatalf("duplicate names must be rejected, got %v", err)
+	}
+}
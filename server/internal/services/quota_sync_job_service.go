@@ -2,6 +2,7 @@ package services
 
 import (
 	"context"
+	"encoding/json"
 	"log/slog"
 	"sync"
 	"time"
@@ -13,7 +14,7 @@ import (
 
 type QuotaSyncJobStatus struct {
 	ID         string `json:"id"`
-	Status     string `json:"status"` // idle|running|completed|error
+	Status     string `json:"status"` // idle|running|paused|completed|cancelled|error
 	Error      string `json:"error,omitempty"`
 	IntervalMs int    `json:"interval_ms,omitempty"`
 
@@ -21,6 +22,7 @@ type QuotaSyncJobStatus struct {
 	Completed int `json:"completed"`
 	Succeeded int `json:"succeeded"`
 	Failed    int `json:"failed"`
+	Cancelled int `json:"cancelled,omitempty"`
 
 	Items []QuotaSyncItemResult `json:"items,omitempty"`
 
@@ -28,19 +30,36 @@ type QuotaSyncJobStatus struct {
 	EndedAt   *time.Time `json:"ended_at,omitempty"`
 }
 
+type quotaSyncJobParams struct {
+	IntervalMs int `json:"interval_ms"`
+}
+
+type quotaSyncWork struct {
+	idx int
+	key models.APIKey
+}
+
 type QuotaSyncJobService struct {
-	keys   *KeyService
-	sync   *QuotaSyncService
-	logger *slog.Logger
+	keys     *KeyService
+	sync     *QuotaSyncService
+	logger   *slog.Logger
+	recorder *jobRecorder
 
-	mu  sync.RWMutex
-	job *QuotaSyncJobStatus
+	mu     sync.RWMutex
+	job    *QuotaSyncJobStatus
+	cancel context.CancelFunc
+	resume chan struct{}
 }
 
 func NewQuotaSyncJobService(keys *KeyService, sync *QuotaSyncService, logger *slog.Logger) *QuotaSyncJobService {
 	return &QuotaSyncJobService{keys: keys, sync: sync, logger: logger}
 }
 
+func (s *QuotaSyncJobService) WithJobStore(store *JobStore) *QuotaSyncJobService {
+	s.recorder = newJobRecorder(store, s.logger, JobTypeQuotaSync)
+	return s
+}
+
 func (s *QuotaSyncJobService) Get() QuotaSyncJobStatus {
 	s.mu.RLock()
 	defer s.mu.RUnlock()
@@ -60,14 +79,13 @@ func (s *QuotaSyncJobService) Start(interval time.Duration) (QuotaSyncJobStatus,
 	}
 
 	s.mu.Lock()
-	if s.job != nil && s.job.Status == "running" {
+	if s.job != nil && isActiveJobStatus(s.job.Status) {
 		job := cloneQuotaSyncJobStatus(*s.job)
 		s.mu.Unlock()
 		return job, true, nil
 	}
 
-	ctx := context.Background()
-	keyItems, err := s.keys.List(ctx)
+	keyItems, err := s.keys.List(context.Background())
 	if err != nil {
 		s.mu.Unlock()
 		return QuotaSyncJobStatus{}, false, err
@@ -87,31 +105,200 @@ func (s *QuotaSyncJobService) Start(interval time.Duration) (QuotaSyncJobStatus,
 		EndedAt:    nil,
 	}
 
+	work := make([]quotaSyncWork, len(keyItems))
 	for i, k := range keyItems {
 		job.Items[i] = QuotaSyncItemResult{
 			ID:     k.ID,
 			Alias:  k.Alias,
 			Status: "pending",
 		}
+		work[i] = quotaSyncWork{idx: i, key: k}
 	}
 
+	ctx, cancel := context.WithCancel(context.Background())
 	s.job = job
+	s.cancel = cancel
+	s.resume = nil
+	snapshot := cloneQuotaSyncJobStatus(*job)
 	s.mu.Unlock()
 
-	go s.runJob(job.ID, keyItems, interval)
+	s.recorder.setParams(quotaSyncJobParams{IntervalMs: snapshot.IntervalMs})
+	s.recorder.record(quotaSyncJobSnapshot(snapshot), true)
 
-	return cloneQuotaSyncJobStatus(*job), false, nil
+	go s.runJob(ctx, job.ID, work, interval)
+
+	return snapshot, false, nil
 }
 
-func (s *QuotaSyncJobService) runJob(jobID string, keyItems []models.APIKey, interval time.Duration) {
-	ctx := context.Background()
+// Cancel stops a running or paused job. Keys that were already synced keep
+// their results; the rest are reported as cancelled.
+func (s *QuotaSyncJobService) Cancel(id string) (QuotaSyncJobStatus, error) {
+	s.mu.Lock()
+	if s.job == nil || s.job.ID != id {
+		s.mu.Unlock()
+		return QuotaSyncJobStatus{}, ErrJobNotFound
+	}
+	if !isActiveJobStatus(s.job.Status) {
+		job := cloneQuotaSyncJobStatus(*s.job)
+		s.mu.Unlock()
+		return job, ErrJobNotRunning
+	}
 
-	for i, k := range keyItems {
-		if interval > 0 && i > 0 {
-			time.Sleep(interval)
+	endedAt := time.Now()
+	s.job.Status = "cancelled"
+	s.job.EndedAt = &endedAt
+	markQuotaSyncCancelled(s.job)
+	if s.cancel != nil {
+		s.cancel()
+	}
+	s.resume = nil
+	job := cloneQuotaSyncJobStatus(*s.job)
+	s.mu.Unlock()
+
+	s.recorder.record(quotaSyncJobSnapshot(job), true)
+	return job, nil
+}
+
+// Pause holds the job before its next key; the key in flight still finishes.
+func (s *QuotaSyncJobService) Pause(id string) (QuotaSyncJobStatus, error) {
+	s.mu.Lock()
+	if s.job == nil || s.job.ID != id {
+		s.mu.Unlock()
+		return QuotaSyncJobStatus{}, ErrJobNotFound
+	}
+	if s.job.Status != "running" {
+		job := cloneQuotaSyncJobStatus(*s.job)
+		s.mu.Unlock()
+		return job, ErrJobNotRunning
+	}
+
+	s.job.Status = "paused"
+	s.resume = make(chan struct{})
+	job := cloneQuotaSyncJobStatus(*s.job)
+	s.mu.Unlock()
+
+	s.recorder.record(quotaSyncJobSnapshot(job), true)
+	return job, nil
+}
+
+func (s *QuotaSyncJobService) Resume(id string) (QuotaSyncJobStatus, error) {
+	s.mu.Lock()
+	if s.job == nil || s.job.ID != id {
+		s.mu.Unlock()
+		return QuotaSyncJobStatus{}, ErrJobNotFound
+	}
+	if s.job.Status != "paused" {
+		job := cloneQuotaSyncJobStatus(*s.job)
+		s.mu.Unlock()
+		return job, ErrJobNotPaused
+	}
+
+	s.job.Status = "running"
+	if s.resume != nil {
+		close(s.resume)
+		s.resume = nil
+	}
+	job := cloneQuotaSyncJobStatus(*s.job)
+	s.mu.Unlock()
+
+	s.recorder.record(quotaSyncJobSnapshot(job), true)
+	return job, nil
+}
+
+// RecoverInterrupted resumes the newest quota sync left running by a previous
+// process (or marks it failed when resume is false); older ones are failed.
+func (s *QuotaSyncJobService) RecoverInterrupted(ctx context.Context, resume bool) error {
+	if s.recorder == nil {
+		return nil
+	}
+	store := s.recorder.store
+
+	records, err := store.Interrupted(ctx, JobTypeQuotaSync)
+	if err != nil {
+		return err
+	}
+
+	for i := range records {
+		rec := &records[i]
+		if !resume || i > 0 {
+			if err := store.MarkInterrupted(ctx, rec, "interrupted by restart"); err != nil {
+				return err
+			}
+			continue
+		}
+
+		var job QuotaSyncJobStatus
+		var params quotaSyncJobParams
+		if err := json.Unmarshal([]byte(rec.State), &job); err != nil {
+			if err := store.MarkInterrupted(ctx, rec, "interrupted by restart: unreadable state"); err != nil {
+				return err
+			}
+			continue
+		}
+		_ = json.Unmarshal([]byte(rec.Params), &params)
+
+		var work []quotaSyncWork
+		for idx, item := range job.Items {
+			if item.Status != "pending" {
+				continue
+			}
+			key, err := s.keys.FindByID(ctx, item.ID)
+			if err != nil {
+				return err
+			}
+			if key == nil {
+				job.Items[idx].Status = "error"
+				job.Items[idx].Error = "key deleted"
+				job.Completed++
+				job.Failed++
+				continue
+			}
+			work = append(work, quotaSyncWork{idx: idx, key: *key})
+		}
+
+		job.ID = rec.ID
+		job.Status = "running"
+		job.EndedAt = nil
+		runCtx, cancel := context.WithCancel(context.Background())
+
+		s.mu.Lock()
+		s.job = &job
+		s.cancel = cancel
+		s.resume = nil
+		if rec.Status == "paused" {
+			job.Status = "paused"
+			s.resume = make(chan struct{})
+		}
+		snapshot := cloneQuotaSyncJobStatus(job)
+		s.mu.Unlock()
+
+		s.recorder.setParams(params)
+		s.recorder.record(quotaSyncJobSnapshot(snapshot), true)
+		s.logger.Info("quota sync job resumed", "id", job.ID, "remaining", len(work))
+
+		go s.runJob(runCtx, job.ID, work, time.Duration(params.IntervalMs)*time.Millisecond)
+	}
+	return nil
+}
+
+func (s *QuotaSyncJobService) runJob(ctx context.Context, jobID string, work []quotaSyncWork, interval time.Duration) {
+	for n, w := range work {
+		if interval > 0 && n > 0 {
+			timer := time.NewTimer(interval)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+			case <-timer.C:
+			}
+		}
+		if !s.waitWhilePaused(ctx, jobID) {
+			break
 		}
 
-		item := s.sync.syncKey(ctx, k)
+		item := s.sync.syncKey(ctx, w.key)
+		if ctx.Err() != nil {
+			break
+		}
 
 		s.mu.Lock()
 		if s.job == nil || s.job.ID != jobID {
@@ -119,23 +306,90 @@ func (s *QuotaSyncJobService) runJob(jobID string, keyItems []models.APIKey, int
 			return
 		}
 
-		s.job.Items[i] = item
+		s.job.Items[w.idx] = item
 		s.job.Completed++
 		if item.Status == "ok" {
 			s.job.Succeeded++
 		} else {
 			s.job.Failed++
 		}
+		snapshot := cloneQuotaSyncJobStatus(*s.job)
 		s.mu.Unlock()
+
+		s.recorder.record(quotaSyncJobSnapshot(snapshot), false)
 	}
+	// A pause that arrived during the last key still holds the job open.
+	s.waitWhilePaused(ctx, jobID)
 
 	endedAt := time.Now()
 	s.mu.Lock()
-	if s.job != nil && s.job.ID == jobID {
+	if s.job == nil || s.job.ID != jobID {
+		s.mu.Unlock()
+		return
+	}
+	if s.job.Status == "running" {
 		s.job.Status = "completed"
 		s.job.EndedAt = &endedAt
 	}
+	if s.job.Status == "cancelled" {
+		markQuotaSyncCancelled(s.job)
+	}
+	s.cancel = nil
+	snapshot := cloneQuotaSyncJobStatus(*s.job)
 	s.mu.Unlock()
+
+	s.recorder.record(quotaSyncJobSnapshot(snapshot), true)
+}
+
+// waitWhilePaused blocks while the job is paused. It reports false once the
+// job has been cancelled or replaced.
+func (s *QuotaSyncJobService) waitWhilePaused(ctx context.Context, jobID string) bool {
+	for {
+		if ctx.Err() != nil {
+			return false
+		}
+		s.mu.RLock()
+		current := s.job != nil && s.job.ID == jobID
+		resume := s.resume
+		s.mu.RUnlock()
+		if !current {
+			return false
+		}
+		if resume == nil {
+			return true
+		}
+		select {
+		case <-ctx.Done():
+			return false
+		case <-resume:
+		}
+	}
+}
+
+func markQuotaSyncCancelled(job *QuotaSyncJobStatus) {
+	cancelled := 0
+	for i := range job.Items {
+		if job.Items[i].Status == "pending" || job.Items[i].Status == "cancelled" {
+			job.Items[i].Status = "cancelled"
+			cancelled++
+		}
+	}
+	job.Cancelled = cancelled
+}
+
+func quotaSyncJobSnapshot(job QuotaSyncJobStatus) jobSnapshot {
+	return jobSnapshot{
+		id:        job.ID,
+		status:    job.Status,
+		err:       job.Error,
+		total:     job.Total,
+		completed: job.Completed,
+		succeeded: job.Succeeded,
+		failed:    job.Failed,
+		startedAt: job.StartedAt,
+		endedAt:   job.EndedAt,
+		state:     job,
+	}
 }
 
 func cloneQuotaSyncJobStatus(in QuotaSyncJobStatus) QuotaSyncJobStatus {
@@ -112,3 +112,113 @@ func TestQuotaSyncJobService_RunsInBackgroundAndReportsProgress(t *testing.T) {
 		time.Sleep(10 * time.Millisecond)
 	}
 }
+
+func TestQuotaSyncJobService_PauseResumeAndCancel(t *testing.T) {
+	t.Parallel()
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		_, _ = w.Write([]byte(`{"key":{"usage":1,"limit":1000}}`))
+	}))
+	t.Cleanup(upstream.Close)
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	database, err := db.Open(filepath.Join(t.TempDir(), "app.db"))
+	if err != nil {
+		t.Fatalf("db open: %v", err)
+	}
+	sqlDB, err := database.DB()
+	if err != nil {
+		t.Fatalf("db handle: %v", err)
+	}
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	keys := NewKeyService(database, logger)
+	proxy := NewTavilyProxy(upstream.URL, 5*time.Second, keys, nil, nil, logger)
+	jobs := NewQuotaSyncJobService(keys, NewQuotaSyncService(keys, proxy, logger), logger)
+
+	ctx := context.Background()
+	for i := 0; i < 4; i++ {
+		if _, err := keys.Create(ctx, fmt.Sprintf("tvly-test-%d", i), "test", 1000); err != nil {
+			t.Fatalf("create key %d: %v", i, err)
+		}
+	}
+
+	waitFor := func(cond func(QuotaSyncJobStatus) bool) QuotaSyncJobStatus {
+		t.Helper()
+		deadline := time.Now().Add(2 * time.Second)
+		for {
+			got := jobs.Get()
+			if cond(got) {
+				return got
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for job: %+v", got)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	started, _, err := jobs.Start(20 * time.Millisecond)
+	if err != nil {
+		t.Fatalf("start: %v", err)
+	}
+	if _, err := jobs.Resume(started.ID); err != ErrJobNotPaused {
+		t.Fatalf("unexpected resume error on running job: %v", err)
+	}
+
+	waitFor(func(j QuotaSyncJobStatus) bool { return j.Completed >= 1 })
+	paused, err := jobs.Pause(started.ID)
+	if err != nil {
+		t.Fatalf("pause: %v", err)
+	}
+	if paused.Status != "paused" {
+		t.Fatalf("unexpected status after pause: %q", paused.Status)
+	}
+	if _, already, _ := jobs.Start(0); !already {
+		t.Fatalf("expected paused job to block a new start")
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if got := jobs.Get(); got.Status != "paused" || got.Completed > paused.Completed+1 {
+		t.Fatalf("job kept running while paused: %+v", got)
+	}
+
+	if _, err := jobs.Resume(started.ID); err != nil {
+		t.Fatalf("resume: %v", err)
+	}
+	done := waitFor(func(j QuotaSyncJobStatus) bool { return j.Status == "completed" })
+	if done.Succeeded != 4 || done.Cancelled != 0 {
+		t.Fatalf("unexpected resumed result: %+v", done)
+	}
+
+	second, _, err := jobs.Start(time.Minute)
+	if err != nil {
+		t.Fatalf("start second: %v", err)
+	}
+	waitFor(func(j QuotaSyncJobStatus) bool { return j.Completed >= 1 })
+	if _, err := jobs.Pause(second.ID); err != nil {
+		t.Fatalf("pause second: %v", err)
+	}
+	cancelled, err := jobs.Cancel(second.ID)
+	if err != nil {
+		t.Fatalf("cancel paused job: %v", err)
+	}
+	if cancelled.Status != "cancelled" || cancelled.Completed != 1 || cancelled.Cancelled != 3 {
+		t.Fatalf("unexpected partial result: %+v", cancelled)
+	}
+	for i, item := range cancelled.Items {
+		want := "cancelled"
+		if i == 0 {
+			want = "ok"
+		}
+		if item.Status != want {
+			t.Fatalf("unexpected item %d status: got %q want %q", i, item.Status, want)
+		}
+	}
+	if _, err := jobs.Pause(second.ID); err != ErrJobNotRunning {
+		t.Fatalf("unexpected pause error after cancel: %v", err)
+	}
+}
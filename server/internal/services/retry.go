@@ -0,0 +1,99 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// RetryPolicy controls how TavilyProxy retries transient upstream failures:
+// network errors and 500, 502, 503 and 504 responses. A failed attempt is
+// retried on the next key, wrapping around when every key has been tried.
+type RetryPolicy struct {
+	// MaxAttempts is the number of upstream calls after which a transient
+	// failure is no longer retried; 1 disables retries.
+	MaxAttempts int
+	// Budget is the total time a request may spend on retries, measured from
+	// the first attempt. Retries are not started, and are cut off, once it is
+	// spent.
+	Budget time.Duration
+	// Backoff is the delay before the first retry. It doubles for each later
+	// retry, up to maxRetryBackoff, with random jitter.
+	Backoff time.Duration
+}
+
+const maxRetryBackoff = 5 * time.Second
+
+// AttemptsHeader reports how many upstream calls a proxied request took.
+const AttemptsHeader = "X-Proxy-Attempts"
+
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{MaxAttempts: 3, Budget: 30 * time.Second, Backoff: 250 * time.Millisecond}
+}
+
+// Attempt describes one upstream call, as recorded in request logs.
+type Attempt struct {
+	KeyID     uint   `json:"key_id"`
+	KeyAlias  string `json:"key_alias"`
+	Status    int    `json:"status,omitempty"`
+	Error     string `json:"error,omitempty"`
+	LatencyMs int64  `json:"latency_ms"`
+}
+
+// backoff returns the jittered delay before retry n (1-based): a random
+// duration between half and all of Backoff*2^(n-1).
+func (r RetryPolicy) backoff(n int) time.Duration {
+	d := r.Backoff
+	for i := 1; i < n && d < maxRetryBackoff; i++ {
+		d *= 2
+	}
+	d = min(d, maxRetryBackoff)
+	if d <= 0 {
+		return 0
+	}
+	half := d / 2
+	return half + rand.N(d-half+1)
+}
+
+func retryableStatus(status int) bool {
+	switch status {
+	case http.StatusInternalServerError, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// transientError reports whether err is a network failure worth retrying.
+// Cancellation by the caller is not.
+func transientError(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.ECONNREFUSED) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// sleepContext waits for d or until ctx is done, reporting whether the full
+// delay passed.
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
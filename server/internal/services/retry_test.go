@@ -0,0 +1,100 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"tavily-proxy/server/internal/db"
+	"tavily-proxy/server/internal/models"
+)
+
+func TestTavilyProxy_RetriesTransientFailuresOnOtherKeys(t *testing.T) {
+	t.Parallel()
+
+	var mu sync.Mutex
+	var seen []string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		seen = append(seen, r.Header.Get("Authorization"))
+		n := len(seen)
+		mu.Unlock()
+		switch {
+		case r.URL.Path == "/always-down":
+			w.WriteHeader(http.StatusBadGateway)
+		case n == 1:
+			w.WriteHeader(http.StatusServiceUnavailable)
+		case n == 2:
+			// Drop the connection without a response.
+			conn, _, _ := w.(http.Hijacker).Hijack()
+			_ = conn.Close()
+		default:
+			_, _ = w.Write([]byte(`{"results":[]}`))
+		}
+	}))
+	t.Cleanup(upstream.Close)
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	database, err := db.Open(filepath.Join(t.TempDir(), "app.db"))
+	if err != nil {
+		t.Fatalf("db open: %v", err)
+	}
+	sqlDB, err := database.DB()
+	if err != nil {
+		t.Fatalf("db handle: %v", err)
+	}
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	ctx := context.Background()
+	keys := NewKeyService(database, logger)
+	for _, k := range []string{"tvly-a", "tvly-b"} {
+		if _, err := keys.Create(ctx, k, k, 1000); err != nil {
+			t.Fatalf("create key: %v", err)
+		}
+	}
+	logs := NewLogService(database, logger)
+	proxy := NewTavilyProxy(upstream.URL, 5*time.Second, keys, logs, nil, logger).
+		WithRetry(RetryPolicy{MaxAttempts: 3, Budget: 5 * time.Second, Backoff: time.Millisecond})
+
+	resp, err := proxy.Do(ctx, ProxyRequest{Method: http.MethodPost, Path: "/search", Body: []byte(`{"query":"q"}`)})
+	if err != nil || resp.StatusCode != http.StatusOK || resp.Attempts != 3 {
+		t.Fatalf("expected success on the third attempt: %+v %v", resp, err)
+	}
+	mu.Lock()
+	if len(seen) != 3 || seen[0] == seen[1] || seen[2] != seen[0] {
+		t.Fatalf("retries should move to the other key and wrap around: %v", seen)
+	}
+	mu.Unlock()
+
+	var row models.RequestLog
+	if err := database.Order("id desc").First(&row).Error; err != nil {
+		t.Fatalf("load log: %v", err)
+	}
+	var attempts []Attempt
+	if err := json.Unmarshal([]byte(row.AttemptLog), &attempts); err != nil || row.Attempts != 3 || len(attempts) != 3 {
+		t.Fatalf("attempts should be logged: %d %q %v", row.Attempts, row.AttemptLog, err)
+	}
+	if attempts[0].Status != http.StatusServiceUnavailable || attempts[1].Error == "" || attempts[2].Status != http.StatusOK {
+		t.Fatalf("unexpected attempt details: %+v", attempts)
+	}
+
+	proxy.WithRetry(RetryPolicy{MaxAttempts: 2, Budget: 5 * time.Second, Backoff: time.Millisecond})
+	resp, err = proxy.Do(ctx, ProxyRequest{Method: http.MethodPost, Path: "/always-down", Body: []byte(`{}`)})
+	if err != nil || resp.StatusCode != http.StatusBadGateway || resp.Attempts != 2 {
+		t.Fatalf("the last 5xx should be returned after max attempts: %+v %v", resp, err)
+	}
+
+	proxy.WithRetry(RetryPolicy{MaxAttempts: 5, Budget: 50 * time.Millisecond, Backoff: time.Second})
+	start := time.Now()
+	resp, err = proxy.Do(ctx, ProxyRequest{Method: http.MethodPost, Path: "/always-down", Body: []byte(`{}`)})
+	if err != nil || resp.Attempts != 1 || time.Since(start) > time.Second {
+		t.Fatalf("a retry that does not fit the budget must not be started: %+v %v", resp, err)
+	}
+}
@@ -0,0 +1,213 @@
+package services
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"log/slog"
+	"time"
+
+	"tavily-proxy/server/internal/models"
+
+	"gorm.io/gorm"
+)
+
+var (
+	ErrSessionInvalid    = errors.New("session_invalid")
+	ErrLoginStateInvalid = errors.New("login_state_invalid")
+	ErrTooManyLogins     = errors.New("too_many_pending_logins")
+)
+
+// SessionTokenPrefix marks browser session ids so they cannot be mistaken for
+// other credentials in logs.
+const SessionTokenPrefix = "sess_"
+
+// loginStateTTL bounds how long a user may take at the IdP's login page.
+const loginStateTTL = 10 * time.Minute
+
+// defaultMaxPendingLogins caps unexpired login states. Starting a login needs
+// no credentials, so without a cap anyone could fill the table.
+const defaultMaxPendingLogins = 1000
+
+// PendingLogin is what the callback needs to finish a login started by
+// BeginLogin.
+type PendingLogin struct {
+	Nonce    string
+	Verifier string
+	ReturnTo string
+}
+
+type SessionService struct {
+	db               *gorm.DB
+	logger           *slog.Logger
+	ttl              time.Duration
+	maxPendingLogins int
+}
+
+func NewSessionService(db *gorm.DB, logger *slog.Logger) *SessionService {
+	return &SessionService{db: db, logger: logger, ttl: 12 * time.Hour, maxPendingLogins: defaultMaxPendingLogins}
+}
+
+func (s *SessionService) WithTTL(ttl time.Duration) *SessionService {
+	if ttl > 0 {
+		s.ttl = ttl
+	}
+	return s
+}
+
+func (s *SessionService) WithMaxPendingLogins(n int) *SessionService {
+	if n > 0 {
+		s.maxPendingLogins = n
+	}
+	return s
+}
+
+func (s *SessionService) TTL() time.Duration { return s.ttl }
+
+// BeginLogin stores the nonce and PKCE verifier for a new login and returns
+// the state to send to the IdP along with the code challenge. It fails with
+// ErrTooManyLogins while too many logins are pending.
+func (s *SessionService) BeginLogin(ctx context.Context, returnTo string, now time.Time) (state, nonce, challenge string, err error) {
+	var pending int64
+	if err := s.db.WithContext(ctx).Model(&models.OIDCLoginState{}).Where("expires_at > ?", now).Count(&pending).Error; err != nil {
+		return "", "", "", err
+	}
+	if pending >= int64(s.maxPendingLogins) {
+		return "", "", "", ErrTooManyLogins
+	}
+
+	state, err = randomURLToken(32)
+	if err != nil {
+		return "", "", "", err
+	}
+	nonce, err = randomURLToken(16)
+	if err != nil {
+		return "", "", "", err
+	}
+	verifier, challenge, err := NewPKCEVerifier()
+	if err != nil {
+		return "", "", "", err
+	}
+	record := models.OIDCLoginState{
+		StateHash: hashToken(state),
+		Nonce:     nonce,
+		Verifier:  verifier,
+		ReturnTo:  returnTo,
+		ExpiresAt: now.Add(loginStateTTL),
+	}
+	if err := s.db.WithContext(ctx).Create(&record).Error; err != nil {
+		return "", "", "", err
+	}
+	return state, nonce, challenge, nil
+}
+
+// CompleteLogin consumes the pending login for state; each state can be used
+// once.
+func (s *SessionService) CompleteLogin(ctx context.Context, state string, now time.Time) (PendingLogin, error) {
+	var record models.OIDCLoginState
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("state_hash = ?", hashToken(state)).Limit(1).Find(&record).Error; err != nil {
+			return err
+		}
+		if record.ID == 0 {
+			return ErrLoginStateInvalid
+		}
+		res := tx.Delete(&models.OIDCLoginState{}, record.ID)
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			// Another request consumed it first.
+			return ErrLoginStateInvalid
+		}
+		return nil
+	})
+	if err != nil {
+		return PendingLogin{}, err
+	}
+	if !record.ExpiresAt.After(now) {
+		return PendingLogin{}, ErrLoginStateInvalid
+	}
+	return PendingLogin{Nonce: record.Nonce, Verifier: record.Verifier, ReturnTo: record.ReturnTo}, nil
+}
+
+// Create starts a session for a verified identity. The session token goes in
+// an HttpOnly cookie; the CSRF token must be echoed back in a header on every
+// mutating request.
+func (s *SessionService) Create(ctx context.Context, id OIDCIdentity, role Role, now time.Time) (token, csrf string, session *models.AdminSession, err error) {
+	if token, err = randomURLToken(32); err != nil {
+		return "", "", nil, err
+	}
+	token = SessionTokenPrefix + token
+	if csrf, err = randomURLToken(32); err != nil {
+		return "", "", nil, err
+	}
+	record := models.AdminSession{
+		TokenHash:  hashToken(token),
+		CSRFHash:   hashToken(csrf),
+		Subject:    id.Subject,
+		Email:      id.Email,
+		Name:       id.Name,
+		Role:       string(role),
+		ExpiresAt:  now.Add(s.ttl),
+		LastSeenAt: now,
+	}
+	if err := s.db.WithContext(ctx).Create(&record).Error; err != nil {
+		return "", "", nil, err
+	}
+	s.logger.Info("admin session created", "subject", id.Subject, "email", id.Email, "role", role)
+	return token, csrf, &record, nil
+}
+
+// Authenticate resolves a session token to its principal.
+func (s *SessionService) Authenticate(ctx context.Context, token string, now time.Time) (Principal, *models.AdminSession, error) {
+	if token == "" {
+		return Principal{}, nil, ErrSessionInvalid
+	}
+	var record models.AdminSession
+	if err := s.db.WithContext(ctx).Where("token_hash = ?", hashToken(token)).Limit(1).Find(&record).Error; err != nil {
+		return Principal{}, nil, err
+	}
+	if record.ID == 0 || !record.ExpiresAt.After(now) {
+		return Principal{}, nil, ErrSessionInvalid
+	}
+	if now.Sub(record.LastSeenAt) > time.Minute {
+		_ = s.db.WithContext(ctx).Model(&record).Update("last_seen_at", now).Error
+	}
+	name := record.Email
+	if name == "" {
+		name = record.Subject
+	}
+	return Principal{
+		Actor:      "sso:" + name,
+		Name:       name,
+		Role:       Role(record.Role),
+		Credential: tokenPrefix(token) + "…",
+		AuthMethod: AuthMethodSession,
+	}, &record, nil
+}
+
+// CheckCSRF reports whether csrf is the token issued with the session.
+func CheckCSRF(session *models.AdminSession, csrf string) bool {
+	if session == nil || csrf == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(hashToken(csrf)), []byte(session.CSRFHash)) == 1
+}
+
+func (s *SessionService) Delete(ctx context.Context, token string) error {
+	return s.db.WithContext(ctx).Where("token_hash = ?", hashToken(token)).Delete(&models.AdminSession{}).Error
+}
+
+// DeleteExpired purges expired sessions and abandoned logins.
+func (s *SessionService) DeleteExpired(ctx context.Context, now time.Time) (int64, error) {
+	var total int64
+	for _, model := range []any{&models.AdminSession{}, &models.OIDCLoginState{}} {
+		res := s.db.WithContext(ctx).Where("expires_at <= ?", now).Delete(model)
+		if res.Error != nil {
+			return total, res.Error
+		}
+		total += res.RowsAffected
+	}
+	return total, nil
+}
@@ -0,0 +1,50 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"tavily-proxy/server/internal/db"
+)
+
+func TestSessionService_CapsPendingLogins(t *testing.T) {
+	t.Parallel()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	database, err := db.Open(filepath.Join(t.TempDir(), "app.db"))
+	if err != nil {
+		t.Fatalf("db open: %v", err)
+	}
+	sqlDB, err := database.DB()
+	if err != nil {
+		t.Fatalf("db handle: %v", err)
+	}
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	ctx := context.Background()
+	sessions := NewSessionService(database, logger).WithMaxPendingLogins(2)
+	now := time.Now().UTC()
+	for i := 0; i < 2; i++ {
+		if _, _, _, err := sessions.BeginLogin(ctx, "/", now); err != nil {
+			t.Fatalf("begin login %d: %v", i, err)
+		}
+	}
+	if _, _, _, err := sessions.BeginLogin(ctx, "/", now); !errors.Is(err, ErrTooManyLogins) {
+		t.Fatalf("expected the pending login cap, got %v", err)
+	}
+
+	// Expired logins do not count towards the cap and are purged.
+	later := now.Add(loginStateTTL + time.Second)
+	if _, _, _, err := sessions.BeginLogin(ctx, "/", later); err != nil {
+		t.Fatalf("begin login after expiry: %v", err)
+	}
+	deleted, err := sessions.DeleteExpired(ctx, later)
+	if err != nil || deleted != 2 {
+		t.Fatalf("expected 2 expired logins purged, got %d %v", deleted, err)
+	}
+}
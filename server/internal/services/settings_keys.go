@@ -14,4 +14,23 @@ const (
 	SettingLogRetentionDays    = "log_retention_days"
 	SettingLogCleanupLastRunAt = "log_cleanup_last_run_at"
 	SettingLogCleanupLastError = "log_cleanup_last_error"
+
+	SettingBackupEnabled        = "backup_enabled"
+	SettingBackupIntervalHours  = "backup_interval_hours"
+	SettingBackupRetentionCount = "backup_retention_count"
+	SettingBackupIncludeLogs    = "backup_include_logs"
+	SettingBackupLastRunAt      = "backup_last_run_at"
+	SettingBackupLastSuccessAt  = "backup_last_success_at"
+	SettingBackupLastError      = "backup_last_error"
+
+	SettingAuditRetentionDays    = "audit_retention_days"
+	SettingAuditCleanupLastRunAt = "audit_cleanup_last_run_at"
+
+	SettingMCPOutputMarkdown       = "mcp_output_markdown"
+	SettingMCPOutputStripMedia     = "mcp_output_strip_media"
+	SettingMCPOutputMaxResultChars = "mcp_output_max_result_chars"
+	SettingMCPOutputMaxChars       = "mcp_output_max_chars"
+	SettingMCPOutputContinuation   = "mcp_output_continuation"
+
+	SettingMonthlyResetLastMonth = "monthly_reset_last_month"
 )
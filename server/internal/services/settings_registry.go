@@ -0,0 +1,143 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+type SettingType string
+
+const (
+	SettingTypeBool SettingType = "bool"
+	SettingTypeInt  SettingType = "int"
+)
+
+// SettingDef describes a user-editable setting. Values are stored as strings
+// in the settings table; Normalize is the only way a value gets there through
+// the API or the config file.
+type SettingDef struct {
+	Name        string      `json:"name"`
+	Type        SettingType `json:"type"`
+	Default     string      `json:"default"`
+	Min         *int        `json:"min,omitempty"`
+	Max         *int        `json:"max,omitempty"`
+	Description string      `json:"description"`
+	// RestartRequired marks settings only read at startup.
+	RestartRequired bool `json:"restart_required"`
+}
+
+var ErrUnknownSetting = errors.New("unknown_setting")
+
+func boolSetting(name, def, description string) SettingDef {
+	return SettingDef{Name: name, Type: SettingTypeBool, Default: def, Description: description}
+}
+
+func intSetting(name string, def, min, max int, description string) SettingDef {
+	return SettingDef{Name: name, Type: SettingTypeInt, Default: strconv.Itoa(def), Min: &min, Max: &max, Description: description}
+}
+
+var settingDefs = []SettingDef{
+	boolSetting(SettingAutoSyncEnabled, "false", "Periodically sync quota usage of every key from upstream."),
+	intSetting(SettingAutoSyncIntervalMinutes, 60, 1, 1440, "Minutes between automatic quota syncs."),
+	intSetting(SettingAutoSyncConcurrency, 1, 1, 32, "Keys synced in parallel during an automatic sync."),
+	intSetting(SettingAutoSyncRequestIntervalSeconds, 0, 0, 60, "Pause between upstream usage requests during a sync."),
+	boolSetting(SettingRequestLoggingEnabled, "true", "Record proxied requests in the request log."),
+	intSetting(SettingLogRetentionDays, 30, 0, 3650, "Days to keep request logs and per-minute stats; 0 keeps them forever."),
+	boolSetting(SettingBackupEnabled, "false", "Write scheduled SQLite backups to BACKUP_DIR."),
+	intSetting(SettingBackupIntervalHours, 24, 1, 720, "Hours between scheduled backups."),
+	intSetting(SettingBackupRetentionCount, 7, 1, 365, "Scheduled backups to keep."),
+	boolSetting(SettingBackupIncludeLogs, "false", "Include request logs and stats in scheduled backups."),
+	intSetting(SettingAuditRetentionDays, 365, 0, 3650, "Days to keep audit events; 0 keeps them forever."),
+	boolSetting(SettingMCPOutputMarkdown, "false", "Render MCP search, extract, crawl and map results as Markdown instead of raw JSON."),
+	boolSetting(SettingMCPOutputStripMedia, "false", "Drop images and favicons from MCP tool output."),
+	intSetting(SettingMCPOutputMaxResultChars, 0, 0, 1000000, "Characters of content kept per result in MCP tool output; 0 keeps all."),
+	intSetting(SettingMCPOutputMaxChars, 0, 0, 10000000, "Characters of text returned per MCP tool call; 0 is unlimited."),
+	boolSetting(SettingMCPOutputContinuation, "true", "Keep output beyond mcp_output_max_chars for the tavily-continue tool instead of dropping it."),
+}
+
+// SettingDefs returns the registry in display order.
+func SettingDefs() []SettingDef {
+	out := make([]SettingDef, len(settingDefs))
+	copy(out, settingDefs)
+	return out
+}
+
+func LookupSettingDef(name string) (SettingDef, bool) {
+	for _, def := range settingDefs {
+		if def.Name == name {
+			return def, true
+		}
+	}
+	return SettingDef{}, false
+}
+
+// Normalize validates raw and returns the canonical stored form.
+func (d SettingDef) Normalize(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	switch d.Type {
+	case SettingTypeBool:
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return "", errors.New("expected true or false")
+		}
+		return strconv.FormatBool(b), nil
+	case SettingTypeInt:
+		n, err := strconv.Atoi(raw)
+		if err != nil {
+			return "", errors.New("expected an integer")
+		}
+		if (d.Min != nil && n < *d.Min) || (d.Max != nil && n > *d.Max) {
+			return "", fmt.Errorf("must be between %d and %d", *d.Min, *d.Max)
+		}
+		return strconv.Itoa(n), nil
+	default:
+		return "", fmt.Errorf("unsupported setting type %q", d.Type)
+	}
+}
+
+// NormalizeValue accepts a decoded JSON value (bool, number or string).
+func (d SettingDef) NormalizeValue(v any) (string, error) {
+	switch t := v.(type) {
+	case string:
+		return d.Normalize(t)
+	case bool:
+		if d.Type != SettingTypeBool {
+			return "", errors.New("expected an integer")
+		}
+		return strconv.FormatBool(t), nil
+	case float64:
+		if d.Type != SettingTypeInt {
+			return "", errors.New("expected true or false")
+		}
+		if t != math.Trunc(t) || math.Abs(t) > math.MaxInt32 {
+			return "", errors.New("expected an integer")
+		}
+		return d.Normalize(strconv.Itoa(int(t)))
+	case int:
+		return d.Normalize(strconv.Itoa(t))
+	default:
+		return "", fmt.Errorf("expected a %s value", d.Type)
+	}
+}
+
+// Decode turns a stored value into its typed form, falling back to the
+// default for values written before validation existed.
+func (d SettingDef) Decode(stored string) any {
+	normalized, err := d.Normalize(stored)
+	if err != nil {
+		normalized = d.Default
+	}
+	switch d.Type {
+	case SettingTypeBool:
+		b, _ := strconv.ParseBool(normalized)
+		return b
+	case SettingTypeInt:
+		n, _ := strconv.Atoi(normalized)
+		return n
+	default:
+		return normalized
+	}
+}
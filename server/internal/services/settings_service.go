@@ -2,39 +2,290 @@ package services
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"tavily-proxy/server/internal/models"
 
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
+// ErrSettingPinned is returned when writing a setting the config file or env
+// pins; the pinned value always wins, so a stored value would never apply.
+var ErrSettingPinned = errors.New("setting_managed_by_config")
+
+// SettingError names the setting an Apply failed on. Err is ErrUnknownSetting,
+// ErrSettingPinned or a validation message.
+type SettingError struct {
+	Name string
+	Err  error
+}
+
+func (e *SettingError) Error() string { return e.Name + ": " + e.Err.Error() }
+func (e *SettingError) Unwrap() error { return e.Err }
+
+// SettingSourceAPI marks changes made through the admin API.
+const SettingSourceAPI = "api"
+
+// defaultSettingsCacheTTL bounds how stale a value written by another replica
+// (or the CLI) can be; writes through this service invalidate immediately.
+const defaultSettingsCacheTTL = 10 * time.Second
+
+type settingCacheEntry struct {
+	value   string
+	ok      bool
+	expires time.Time
+}
+
 type SettingsService struct {
-	db *gorm.DB
+	db     *gorm.DB
+	pinned atomic.Pointer[map[string]string]
+
+	cacheTTL time.Duration
+	mu       sync.Mutex
+	cache    map[string]settingCacheEntry
 }
 
 func NewSettingsService(db *gorm.DB) *SettingsService {
-	return &SettingsService{db: db}
+	return &SettingsService{db: db, cacheTTL: defaultSettingsCacheTTL, cache: map[string]settingCacheEntry{}}
+}
+
+// WithCacheTTL changes how long reads are cached; 0 disables the cache.
+func (s *SettingsService) WithCacheTTL(ttl time.Duration) *SettingsService {
+	s.cacheTTL = ttl
+	s.InvalidateCache()
+	return s
+}
+
+// InvalidateCache drops cached values for keys, or every value when none are
+// given (e.g. after a restore replaced the settings table).
+func (s *SettingsService) InvalidateCache(keys ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(keys) == 0 {
+		s.cache = map[string]settingCacheEntry{}
+		return
+	}
+	for _, key := range keys {
+		delete(s.cache, key)
+	}
+}
+
+// WithPinned sets values that take precedence over the database.
+func (s *SettingsService) WithPinned(values map[string]string) *SettingsService {
+	s.SetPinned(values)
+	return s
+}
+
+// SetPinned swaps the pinned values; it is safe to call while serving, which
+// is how a config reload applies.
+func (s *SettingsService) SetPinned(values map[string]string) {
+	copied := make(map[string]string, len(values))
+	for k, v := range values {
+		copied[k] = v
+	}
+	s.pinned.Store(&copied)
+}
+
+func (s *SettingsService) IsPinned(key string) bool {
+	if p := s.pinned.Load(); p != nil {
+		_, ok := (*p)[key]
+		return ok
+	}
+	return false
 }
 
 func (s *SettingsService) Get(ctx context.Context, key string) (string, bool, error) {
+	if p := s.pinned.Load(); p != nil {
+		if v, ok := (*p)[key]; ok {
+			return v, true, nil
+		}
+	}
+	if s.cacheTTL > 0 {
+		s.mu.Lock()
+		entry, hit := s.cache[key]
+		s.mu.Unlock()
+		if hit && time.Now().Before(entry.expires) {
+			return entry.value, entry.ok, nil
+		}
+	}
+
 	var setting models.Setting
-	tx := s.db.WithContext(ctx).Where("key = ?", key).Limit(1).Find(&setting)
+	tx := s.db.WithContext(ctx).Where(map[string]any{"key": key}).Limit(1).Find(&setting)
 	if tx.Error != nil {
 		return "", false, tx.Error
 	}
-	if tx.RowsAffected == 0 {
-		return "", false, nil
+	ok := tx.RowsAffected > 0
+	if s.cacheTTL > 0 {
+		s.mu.Lock()
+		s.cache[key] = settingCacheEntry{value: setting.Value, ok: ok, expires: time.Now().Add(s.cacheTTL)}
+		s.mu.Unlock()
 	}
-	return setting.Value, true, nil
+	return setting.Value, ok, nil
 }
 
 func (s *SettingsService) Set(ctx context.Context, key, value string) error {
+	if s.IsPinned(key) {
+		return ErrSettingPinned
+	}
+	defer s.InvalidateCache(key)
 	return s.db.WithContext(ctx).Save(&models.Setting{Key: key, Value: value}).Error
 }
 
+// CompareAndSet stores value only if the stored value is still old, with an
+// empty old matching an unset key. It reads the database, not the cache, so
+// replicas can use it to claim a one-off task.
+func (s *SettingsService) CompareAndSet(ctx context.Context, key, old, value string) (bool, error) {
+	if s.IsPinned(key) {
+		return false, ErrSettingPinned
+	}
+	defer s.InvalidateCache(key)
+	db := s.db.WithContext(ctx)
+	result := db.Model(&models.Setting{}).
+		Where(map[string]any{"key": key, "value": old}).
+		Updates(map[string]any{"value": value, "updated_at": time.Now()})
+	if result.Error != nil || result.RowsAffected > 0 || old != "" {
+		return result.RowsAffected > 0, result.Error
+	}
+	result = db.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.Setting{Key: key, Value: value})
+	return result.RowsAffected > 0, result.Error
+}
+
+// SettingValue is a registered setting with its effective value.
+type SettingValue struct {
+	SettingDef
+	Value     any        `json:"value"`
+	IsDefault bool       `json:"is_default"`
+	Pinned    bool       `json:"pinned"`
+	UpdatedAt *time.Time `json:"updated_at"`
+}
+
+// Values returns every registered setting in registry order.
+func (s *SettingsService) Values(ctx context.Context) ([]SettingValue, error) {
+	defs := SettingDefs()
+	names := make([]string, len(defs))
+	for i, def := range defs {
+		names[i] = def.Name
+	}
+	var rows []models.Setting
+	if err := s.db.WithContext(ctx).Where(map[string]any{"key": names}).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	stored := make(map[string]models.Setting, len(rows))
+	for _, row := range rows {
+		stored[row.Key] = row
+	}
+
+	out := make([]SettingValue, len(defs))
+	for i, def := range defs {
+		row, ok := stored[def.Name]
+		out[i] = s.settingValue(def, row, ok)
+	}
+	return out, nil
+}
+
+func (s *SettingsService) Value(ctx context.Context, name string) (SettingValue, error) {
+	def, ok := LookupSettingDef(name)
+	if !ok {
+		return SettingValue{}, &SettingError{Name: name, Err: ErrUnknownSetting}
+	}
+	var row models.Setting
+	tx := s.db.WithContext(ctx).Where(map[string]any{"key": name}).Limit(1).Find(&row)
+	if tx.Error != nil {
+		return SettingValue{}, tx.Error
+	}
+	return s.settingValue(def, row, tx.RowsAffected > 0), nil
+}
+
+func (s *SettingsService) settingValue(def SettingDef, row models.Setting, stored bool) SettingValue {
+	v := SettingValue{SettingDef: def, Value: def.Decode(def.Default), IsDefault: true}
+	if stored {
+		v.Value, v.IsDefault = def.Decode(row.Value), false
+		updatedAt := row.UpdatedAt
+		v.UpdatedAt = &updatedAt
+	}
+	if p := s.pinned.Load(); p != nil {
+		if pinned, ok := (*p)[def.Name]; ok {
+			v.Value, v.IsDefault, v.Pinned = def.Decode(pinned), false, true
+		}
+	}
+	return v
+}
+
+// Apply validates every value first and then writes them in one transaction,
+// recording a SettingChange for each value that actually changed.
+func (s *SettingsService) Apply(ctx context.Context, values map[string]string, source string) ([]models.SettingChange, error) {
+	names := make([]string, 0, len(values))
+	normalized := make(map[string]string, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		def, ok := LookupSettingDef(name)
+		if !ok {
+			return nil, &SettingError{Name: name, Err: ErrUnknownSetting}
+		}
+		if s.IsPinned(name) {
+			return nil, &SettingError{Name: name, Err: ErrSettingPinned}
+		}
+		v, err := def.Normalize(values[name])
+		if err != nil {
+			return nil, &SettingError{Name: name, Err: err}
+		}
+		normalized[name] = v
+	}
+
+	var changes []models.SettingChange
+	err := s.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, name := range names {
+			var current models.Setting
+			res := tx.Where(map[string]any{"key": name}).Limit(1).Find(&current)
+			if res.Error != nil {
+				return res.Error
+			}
+			var old *string
+			if res.RowsAffected > 0 {
+				if current.Value == normalized[name] {
+					continue
+				}
+				old = &current.Value
+			}
+			if err := tx.Save(&models.Setting{Key: name, Value: normalized[name]}).Error; err != nil {
+				return err
+			}
+			change := models.SettingChange{Name: name, OldValue: old, NewValue: normalized[name], Source: source}
+			if err := tx.Create(&change).Error; err != nil {
+				return err
+			}
+			changes = append(changes, change)
+		}
+		return nil
+	})
+	s.InvalidateCache(names...)
+	if err != nil {
+		return nil, fmt.Errorf("apply settings: %w", err)
+	}
+	return changes, nil
+}
+
+// History lists recent changes of one setting, newest first.
+func (s *SettingsService) History(ctx context.Context, name string, limit int) ([]models.SettingChange, error) {
+	if limit <= 0 || limit > 500 {
+		limit = 50
+	}
+	var out []models.SettingChange
+	err := s.db.WithContext(ctx).Where("name = ?", name).Order("id DESC").Limit(limit).Find(&out).Error
+	return out, err
+}
+
 func (s *SettingsService) GetBool(ctx context.Context, key string, def bool) (bool, error) {
 	v, ok, err := s.Get(ctx, key)
 	if err != nil || !ok {
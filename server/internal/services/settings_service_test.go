@@ -0,0 +1,172 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"tavily-proxy/server/internal/db"
+	"tavily-proxy/server/internal/models"
+)
+
+func TestSettingsService_ApplyValidatesAndRecordsHistory(t *testing.T) {
+	t.Parallel()
+
+	database, err := db.Open(filepath.Join(t.TempDir(), "app.db"))
+	if err != nil {
+		t.Fatalf("db open: %v", err)
+	}
+	sqlDB, err := database.DB()
+	if err != nil {
+		t.Fatalf("db handle: %v", err)
+	}
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	settings := NewSettingsService(database)
+	ctx := context.Background()
+
+	// One invalid entry rejects the whole batch.
+	_, err = settings.Apply(ctx, map[string]string{
+		SettingLogRetentionDays:    "14",
+		SettingBackupIntervalHours: "0",
+	}, SettingSourceAPI)
+	var settingErr *SettingError
+	if !errors.As(err, &settingErr) || settingErr.Name != SettingBackupIntervalHours {
+		t.Fatalf("expected a validation error for %s, got %v", SettingBackupIntervalHours, err)
+	}
+	if _, ok, _ := settings.Get(ctx, SettingLogRetentionDays); ok {
+		t.Fatalf("nothing should be written when validation fails")
+	}
+	if _, err := settings.Apply(ctx, map[string]string{"log_retention": "1"}, SettingSourceAPI); !errors.Is(err, ErrUnknownSetting) {
+		t.Fatalf("expected ErrUnknownSetting, got %v", err)
+	}
+
+	changes, err := settings.Apply(ctx, map[string]string{SettingLogRetentionDays: " 14 ", SettingBackupEnabled: "TRUE"}, SettingSourceAPI)
+	if err != nil || len(changes) != 2 {
+		t.Fatalf("apply: %d changes, %v", len(changes), err)
+	}
+	if changes, err := settings.Apply(ctx, map[string]string{SettingLogRetentionDays: "14"}, SettingSourceAPI); err != nil || len(changes) != 0 {
+		t.Fatalf("unchanged value should not be recorded: %d %v", len(changes), err)
+	}
+	if _, err := settings.Apply(ctx, map[string]string{SettingLogRetentionDays: "7"}, SettingSourceAPI); err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+
+	history, err := settings.History(ctx, SettingLogRetentionDays, 0)
+	if err != nil || len(history) != 2 {
+		t.Fatalf("history: %d %v", len(history), err)
+	}
+	if history[0].NewValue != "7" || history[0].OldValue == nil || *history[0].OldValue != "14" {
+		t.Fatalf("unexpected latest change: %+v", history[0])
+	}
+	if history[1].OldValue != nil || history[1].Source != SettingSourceAPI {
+		t.Fatalf("first change should come from unset: %+v", history[1])
+	}
+
+	values, err := settings.Values(ctx)
+	if err != nil || len(values) != len(SettingDefs()) {
+		t.Fatalf("values: %d %v", len(values), err)
+	}
+	byName := map[string]SettingValue{}
+	for _, v := range values {
+		byName[v.Name] = v
+	}
+	if v := byName[SettingLogRetentionDays]; v.Value != 7 || v.IsDefault || v.UpdatedAt == nil {
+		t.Fatalf("unexpected retention value: %+v", v)
+	}
+	if v := byName[SettingBackupEnabled]; v.Value != true {
+		t.Fatalf("unexpected backup value: %+v", v)
+	}
+	if v := byName[SettingAutoSyncIntervalMinutes]; v.Value != 60 || !v.IsDefault {
+		t.Fatalf("expected default interval: %+v", v)
+	}
+
+	settings.SetPinned(map[string]string{SettingBackupEnabled: "false"})
+	if _, err := settings.Apply(ctx, map[string]string{SettingBackupEnabled: "true"}, SettingSourceAPI); !errors.Is(err, ErrSettingPinned) {
+		t.Fatalf("expected ErrSettingPinned, got %v", err)
+	}
+	if v, _ := settings.Value(ctx, SettingBackupEnabled); v.Value != false || !v.Pinned {
+		t.Fatalf("pinned value should win: %+v", v)
+	}
+}
+
+func TestSettingsService_CachesReadsUntilInvalidated(t *testing.T) {
+	t.Parallel()
+
+	database, err := db.Open(filepath.Join(t.TempDir(), "app.db"))
+	if err != nil {
+		t.Fatalf("db open: %v", err)
+	}
+	sqlDB, err := database.DB()
+	if err != nil {
+		t.Fatalf("db handle: %v", err)
+	}
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	settings := NewSettingsService(database).WithCacheTTL(time.Hour)
+	ctx := context.Background()
+
+	if enabled, _ := settings.GetBool(ctx, SettingRequestLoggingEnabled, true); !enabled {
+		t.Fatalf("expected default true")
+	}
+	// A write that bypasses the service, as another replica would do.
+	if err := database.Save(&models.Setting{Key: SettingRequestLoggingEnabled, Value: "false"}).Error; err != nil {
+		t.Fatalf("save: %v", err)
+	}
+	if enabled, _ := settings.GetBool(ctx, SettingRequestLoggingEnabled, true); !enabled {
+		t.Fatalf("expected the cached value until the TTL expires")
+	}
+	settings.InvalidateCache()
+	if enabled, _ := settings.GetBool(ctx, SettingRequestLoggingEnabled, true); enabled {
+		t.Fatalf("expected the stored value after invalidation")
+	}
+
+	if err := settings.SetBool(ctx, SettingRequestLoggingEnabled, true); err != nil {
+		t.Fatalf("set: %v", err)
+	}
+	if enabled, _ := settings.GetBool(ctx, SettingRequestLoggingEnabled, false); !enabled {
+		t.Fatalf("writes through the service must be visible immediately")
+	}
+}
+
+func TestSettingsService_CompareAndSetClaimsOnce(t *testing.T) {
+	t.Parallel()
+
+	database, err := db.Open(filepath.Join(t.TempDir(), "app.db"))
+	if err != nil {
+		t.Fatalf("db open: %v", err)
+	}
+	sqlDB, err := database.DB()
+	if err != nil {
+		t.Fatalf("db handle: %v", err)
+	}
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	// Two replicas share the database but not the cache.
+	a := NewSettingsService(database)
+	b := NewSettingsService(database)
+	ctx := context.Background()
+
+	if ok, err := a.CompareAndSet(ctx, SettingMonthlyResetLastMonth, "", "2026-09"); err != nil || !ok {
+		t.Fatalf("unset key should be claimable: %v %v", ok, err)
+	}
+	if ok, err := b.CompareAndSet(ctx, SettingMonthlyResetLastMonth, "", "2026-09"); err != nil || ok {
+		t.Fatalf("unset key must be claimed only once: %v %v", ok, err)
+	}
+
+	if v, _, _ := b.Get(ctx, SettingMonthlyResetLastMonth); v != "2026-09" {
+		t.Fatalf("unexpected value: %q", v)
+	}
+	if ok, err := a.CompareAndSet(ctx, SettingMonthlyResetLastMonth, "2026-09", "2026-10"); err != nil || !ok {
+		t.Fatalf("first claim should win: %v %v", ok, err)
+	}
+	// b still has the old month cached; the claim must not rely on it.
+	if ok, err := b.CompareAndSet(ctx, SettingMonthlyResetLastMonth, "2026-09", "2026-10"); err != nil || ok {
+		t.Fatalf("second claim must lose: %v %v", ok, err)
+	}
+	if v, _, _ := b.Get(ctx, SettingMonthlyResetLastMonth); v != "2026-10" {
+		t.Fatalf("unexpected value after claims: %q", v)
+	}
+}
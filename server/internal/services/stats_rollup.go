@@ -0,0 +1,473 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"tavily-proxy/server/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const maxTimeSeriesBuckets = 5000
+
+var (
+	ErrInvalidGranularity = errors.New("invalid_granularity")
+	ErrInvalidGroupBy     = errors.New("invalid_group_by")
+	ErrInvalidTimeRange   = errors.New("invalid_range")
+	ErrTooManyTimeBuckets = errors.New("too_many_buckets")
+)
+
+var (
+	latencyHistogramBounds  = []int64{50, 100, 250, 500, 1000, 2500, 5000, 10000, 30000}
+	latencyHistogramColumns = []string{"lat_50", "lat_100", "lat_250", "lat_500", "lat_1000", "lat_2500", "lat_5000", "lat_10000", "lat_30000", "lat_inf"}
+)
+
+type RequestEvent struct {
+	Endpoint         string
+	KeyID            uint
+	DistributedKeyID uint
+	StatusCode       int
+	LatencyMs        int64
+	OccurredAt       time.Time
+}
+
+type TimeSeriesQuery struct {
+	Granularity      string
+	From             time.Time
+	To               time.Time
+	Location         *time.Location
+	GroupBy          string
+	Endpoint         string
+	KeyID            uint
+	DistributedKeyID uint
+}
+
+type TimeSeriesLatency struct {
+	Avg []int64 `json:"avg"`
+	P50 []int64 `json:"p50"`
+	P90 []int64 `json:"p90"`
+	P99 []int64 `json:"p99"`
+	Max []int64 `json:"max"`
+}
+
+func StatusClass(statusCode int) string {
+	if statusCode >= 100 && statusCode < 600 {
+		return strconv.Itoa(statusCode/100) + "xx"
+	}
+	return "other"
+}
+
+func (s *StatsService) RecordRollup(ctx context.Context, ev RequestEvent) error {
+	occurredAt := ev.OccurredAt
+	if occurredAt.IsZero() {
+		occurredAt = time.Now()
+	}
+	latency := ev.LatencyMs
+	if latency < 0 {
+		latency = 0
+	}
+	histColumn := latencyHistogramColumns[len(latencyHistogramColumns)-1]
+	for i, bound := range latencyHistogramBounds {
+		if latency <= bound {
+			histColumn = latencyHistogramColumns[i]
+			break
+		}
+	}
+
+	updatedAt := time.Now()
+	row := models.RequestRollup{
+		Minute:           occurredAt.UTC().Truncate(time.Minute).Unix(),
+		Endpoint:         ev.Endpoint,
+		KeyID:            ev.KeyID,
+		DistributedKeyID: ev.DistributedKeyID,
+		StatusClass:      StatusClass(ev.StatusCode),
+		Count:            1,
+		LatencySumMs:     latency,
+		LatencyMaxMs:     latency,
+		UpdatedAt:        updatedAt,
+	}
+	setRollupHistogram(&row, histColumn)
+
+	return s.db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns: []clause.Column{
+			{Name: "minute"},
+			{Name: "endpoint"},
+			{Name: "key_id"},
+			{Name: "distributed_key_id"},
+			{Name: "status_class"},
+		},
+		DoUpdates: clause.Assignments(map[string]any{
+			"count":          gorm.Expr("? + ?", upsertCurrent("count"), 1),
+			"latency_sum_ms": gorm.Expr("? + ?", upsertCurrent("latency_sum_ms"), latency),
+			"latency_max_ms": gorm.Expr("CASE WHEN ? < ? THEN ? ELSE ? END", upsertCurrent("latency_max_ms"), latency, latency, upsertCurrent("latency_max_ms")),
+			histColumn:       gorm.Expr("? + ?", upsertCurrent(histColumn), 1),
+			"updated_at":     updatedAt,
+		}),
+	}).Create(&row).Error
+}
+
+func (s *StatsService) DeleteRollupsOlderThan(ctx context.Context, before time.Time) (int64, error) {
+	result := s.db.WithContext(ctx).Where("minute < ?", before.UTC().Truncate(time.Minute).Unix()).Delete(&models.RequestRollup{})
+	return result.RowsAffected, result.Error
+}
+
+func setRollupHistogram(row *models.RequestRollup, column string) {
+	switch column {
+	case "lat_50":
+		row.Lat50 = 1
+	case "lat_100":
+		row.Lat100 = 1
+	case "lat_250":
+		row.Lat250 = 1
+	case "lat_500":
+		row.Lat500 = 1
+	case "lat_1000":
+		row.Lat1000 = 1
+	case "lat_2500":
+		row.Lat2500 = 1
+	case "lat_5000":
+		row.Lat5000 = 1
+	case "lat_10000":
+		row.Lat10000 = 1
+	case "lat_30000":
+		row.Lat30000 = 1
+	default:
+		row.LatInf = 1
+	}
+}
+
+// QueryTimeSeries buckets the per-minute rollups into the requested range,
+// granularity and timezone, optionally broken down by one dimension.
+func (s *StatsService) QueryTimeSeries(ctx context.Context, q TimeSeriesQuery) (TimeSeries, error) {
+	loc := q.Location
+	if loc == nil {
+		loc = time.Local
+	}
+
+	granularity := q.Granularity
+	if granularity == "" {
+		granularity = "hour"
+	}
+	floor, step, label, defaultSpan, ok := timeSeriesCalendar(granularity, loc)
+	if !ok {
+		return TimeSeries{}, ErrInvalidGranularity
+	}
+
+	groupColumn, ok := timeSeriesGroupColumn(q.GroupBy)
+	if !ok {
+		return TimeSeries{}, ErrInvalidGroupBy
+	}
+
+	to := q.To
+	if to.IsZero() {
+		to = time.Now()
+	}
+	from := q.From
+	if from.IsZero() {
+		from = defaultSpan(to)
+	}
+	if !from.Before(to) {
+		return TimeSeries{}, ErrInvalidTimeRange
+	}
+
+	var starts []time.Time
+	for t := floor(from.In(loc)); t.Before(to); t = floor(step(t)) {
+		if len(starts) >= maxTimeSeriesBuckets {
+			return TimeSeries{}, ErrTooManyTimeBuckets
+		}
+		starts = append(starts, t)
+	}
+	index := make(map[int64]int, len(starts))
+	for i, t := range starts {
+		index[t.Unix()] = i
+	}
+
+	type row struct {
+		Minute       int64  `gorm:"column:minute"`
+		Grp          string `gorm:"column:grp"`
+		Count        int64  `gorm:"column:count"`
+		LatencySumMs int64  `gorm:"column:latency_sum_ms"`
+		LatencyMaxMs int64  `gorm:"column:latency_max_ms"`
+		Lat50        int64  `gorm:"column:lat_50"`
+		Lat100       int64  `gorm:"column:lat_100"`
+		Lat250       int64  `gorm:"column:lat_250"`
+		Lat500       int64  `gorm:"column:lat_500"`
+		Lat1000      int64  `gorm:"column:lat_1000"`
+		Lat2500      int64  `gorm:"column:lat_2500"`
+		Lat5000      int64  `gorm:"column:lat_5000"`
+		Lat10000     int64  `gorm:"column:lat_10000"`
+		Lat30000     int64  `gorm:"column:lat_30000"`
+		LatInf       int64  `gorm:"column:lat_inf"`
+	}
+
+	selectCols := "minute, " + groupColumn + " AS grp, SUM(count) AS count, SUM(latency_sum_ms) AS latency_sum_ms, MAX(latency_max_ms) AS latency_max_ms"
+	for _, col := range latencyHistogramColumns {
+		selectCols += ", SUM(" + col + ") AS " + col
+	}
+
+	query := s.db.WithContext(ctx).
+		Model(&models.RequestRollup{}).
+		Select(selectCols).
+		Where("minute >= ? AND minute < ?", from.UTC().Truncate(time.Minute).Unix(), to.Unix())
+	if q.Endpoint != "" {
+		query = query.Where("endpoint = ?", q.Endpoint)
+	}
+	if q.KeyID != 0 {
+		query = query.Where("key_id = ?", q.KeyID)
+	}
+	if q.DistributedKeyID != 0 {
+		query = query.Where("distributed_key_id = ?", q.DistributedKeyID)
+	}
+
+	var rows []row
+	if err := query.Group("minute, grp").Scan(&rows).Error; err != nil {
+		return TimeSeries{}, err
+	}
+
+	points := len(starts)
+	seriesData := map[string][]int64{}
+	latencySum := make([]int64, points)
+	latencyMax := make([]int64, points)
+	counts := make([]int64, points)
+	hist := make([][]int64, points)
+	for i := range hist {
+		hist[i] = make([]int64, len(latencyHistogramColumns))
+	}
+
+	for _, r := range rows {
+		bucket := floor(time.Unix(r.Minute, 0).In(loc)).Unix()
+		idx, ok := index[bucket]
+		if !ok {
+			continue
+		}
+		data, ok := seriesData[r.Grp]
+		if !ok {
+			data = make([]int64, points)
+			seriesData[r.Grp] = data
+		}
+		data[idx] += r.Count
+		counts[idx] += r.Count
+		latencySum[idx] += r.LatencySumMs
+		if r.LatencyMaxMs > latencyMax[idx] {
+			latencyMax[idx] = r.LatencyMaxMs
+		}
+		for i, v := range []int64{r.Lat50, r.Lat100, r.Lat250, r.Lat500, r.Lat1000, r.Lat2500, r.Lat5000, r.Lat10000, r.Lat30000, r.LatInf} {
+			hist[idx][i] += v
+		}
+	}
+
+	names, err := s.timeSeriesGroupNames(ctx, q.GroupBy, seriesData)
+	if err != nil {
+		return TimeSeries{}, err
+	}
+
+	out := TimeSeries{
+		Granularity: granularity,
+		Timezone:    loc.String(),
+		GroupBy:     q.GroupBy,
+		Labels:      make([]string, 0, points),
+		Buckets:     make([]string, 0, points),
+		Series:      []TimeSeriesSeries{},
+		Latency: &TimeSeriesLatency{
+			Avg: make([]int64, points),
+			P50: make([]int64, points),
+			P90: make([]int64, points),
+			P99: make([]int64, points),
+			Max: latencyMax,
+		},
+	}
+	for _, t := range starts {
+		out.Labels = append(out.Labels, label(t))
+		out.Buckets = append(out.Buckets, t.Format(time.RFC3339))
+	}
+
+	if q.GroupBy == "" {
+		total := make([]int64, points)
+		copy(total, counts)
+		out.Series = append(out.Series, TimeSeriesSeries{Name: "All Requests", Data: total})
+	} else {
+		keys := make([]string, 0, len(seriesData))
+		for k := range seriesData {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			out.Series = append(out.Series, TimeSeriesSeries{Name: names[k], Key: k, Data: seriesData[k]})
+		}
+	}
+
+	for i := 0; i < points; i++ {
+		if counts[i] == 0 {
+			continue
+		}
+		out.Latency.Avg[i] = latencySum[i] / counts[i]
+		out.Latency.P50[i] = histogramPercentile(hist[i], counts[i], 0.50, latencyMax[i])
+		out.Latency.P90[i] = histogramPercentile(hist[i], counts[i], 0.90, latencyMax[i])
+		out.Latency.P99[i] = histogramPercentile(hist[i], counts[i], 0.99, latencyMax[i])
+	}
+
+	return out, nil
+}
+
+func timeSeriesCalendar(granularity string, loc *time.Location) (
+	floor func(time.Time) time.Time,
+	step func(time.Time) time.Time,
+	label func(time.Time) string,
+	defaultSpan func(time.Time) time.Time,
+	ok bool,
+) {
+	switch granularity {
+	case "minute":
+		floor = func(t time.Time) time.Time {
+			t = t.In(loc)
+			return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), 0, 0, loc)
+		}
+		step = func(t time.Time) time.Time { return t.Add(time.Minute) }
+		label = func(t time.Time) string { return t.Format("01-02 15:04") }
+		defaultSpan = func(to time.Time) time.Time { return to.Add(-time.Hour) }
+	case "hour":
+		floor = func(t time.Time) time.Time {
+			t = t.In(loc)
+			return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), 0, 0, 0, loc)
+		}
+		step = func(t time.Time) time.Time { return t.Add(time.Hour) }
+		label = func(t time.Time) string { return t.Format("01-02 15:00") }
+		defaultSpan = func(to time.Time) time.Time { return to.Add(-24 * time.Hour) }
+	case "day":
+		floor = func(t time.Time) time.Time {
+			t = t.In(loc)
+			return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, loc)
+		}
+		step = func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }
+		label = func(t time.Time) string { return t.Format("01-02") }
+		defaultSpan = func(to time.Time) time.Time { return to.AddDate(0, 0, -30) }
+	case "week":
+		floor = func(t time.Time) time.Time {
+			t = t.In(loc)
+			offset := (int(t.Weekday()) + 6) % 7 // weeks start on Monday
+			return time.Date(t.Year(), t.Month(), t.Day()-offset, 0, 0, 0, 0, loc)
+		}
+		step = func(t time.Time) time.Time { return t.AddDate(0, 0, 7) }
+		label = func(t time.Time) string { return t.Format("2006-01-02") }
+		defaultSpan = func(to time.Time) time.Time { return to.AddDate(0, 0, -7*12) }
+	case "month":
+		floor = func(t time.Time) time.Time {
+			t = t.In(loc)
+			return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, loc)
+		}
+		step = func(t time.Time) time.Time { return t.AddDate(0, 1, 0) }
+		label = func(t time.Time) string { return t.Format("2006-01") }
+		defaultSpan = func(to time.Time) time.Time { return to.AddDate(0, -12, 0) }
+	default:
+		return nil, nil, nil, nil, false
+	}
+	return floor, step, label, defaultSpan, true
+}
+
+func timeSeriesGroupColumn(groupBy string) (string, bool) {
+	switch groupBy {
+	case "":
+		return "''", true
+	case "endpoint":
+		return "endpoint", true
+	case "key":
+		return "key_id", true
+	case "distributed_key":
+		return "distributed_key_id", true
+	case "status_class":
+		return "status_class", true
+	default:
+		return "", false
+	}
+}
+
+func (s *StatsService) timeSeriesGroupNames(ctx context.Context, groupBy string, groups map[string][]int64) (map[string]string, error) {
+	names := make(map[string]string, len(groups))
+	for k := range groups {
+		names[k] = k
+	}
+
+	switch groupBy {
+	case "endpoint":
+		for k := range groups {
+			if k == "" {
+				names[k] = "(unknown)"
+			}
+		}
+	case "key":
+		var keys []models.APIKey
+		if err := s.db.WithContext(ctx).Select("id", "alias").Find(&keys).Error; err != nil {
+			return nil, err
+		}
+		aliases := make(map[string]string, len(keys))
+		for _, k := range keys {
+			aliases[strconv.FormatUint(uint64(k.ID), 10)] = k.Alias
+		}
+		for k := range groups {
+			switch {
+			case k == "0":
+				names[k] = "(no key)"
+			case aliases[k] != "":
+				names[k] = fmt.Sprintf("%s #%s", aliases[k], k)
+			default:
+				names[k] = "#" + k
+			}
+		}
+	case "distributed_key":
+		var keys []models.DistributedKey
+		if err := s.db.WithContext(ctx).Select("id", "name").Find(&keys).Error; err != nil {
+			return nil, err
+		}
+		labels := make(map[string]string, len(keys))
+		for _, k := range keys {
+			labels[strconv.FormatUint(uint64(k.ID), 10)] = k.Name
+		}
+		for k := range groups {
+			switch {
+			case k == "0":
+				names[k] = "Master Key"
+			case labels[k] != "":
+				names[k] = fmt.Sprintf("%s #%s", labels[k], k)
+			default:
+				names[k] = "#" + k
+			}
+		}
+	}
+	return names, nil
+}
+
+// histogramPercentile estimates a percentile by interpolating linearly inside
+// the histogram bucket that contains it. The open-ended bucket is capped by the max latency.
+func histogramPercentile(hist []int64, total int64, p float64, maxLatency int64) int64 {
+	if total <= 0 {
+		return 0
+	}
+	target := p * float64(total)
+	var cumulative int64
+	lower := int64(0)
+	for i, n := range hist {
+		upper := maxLatency
+		if i < len(latencyHistogramBounds) {
+			upper = latencyHistogramBounds[i]
+		}
+		if n > 0 && float64(cumulative+n) >= target {
+			fraction := (target - float64(cumulative)) / float64(n)
+			v := lower + int64(fraction*float64(upper-lower))
+			if v > maxLatency {
+				v = maxLatency
+			}
+			return v
+		}
+		cumulative += n
+		if i < len(latencyHistogramBounds) {
+			lower = latencyHistogramBounds[i]
+		}
+	}
+	return maxLatency
+}
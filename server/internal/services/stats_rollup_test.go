@@ -0,0 +1,166 @@
+package services
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"tavily-proxy/server/internal/db"
+	"tavily-proxy/server/internal/models"
+)
+
+func TestStatsService_QueryTimeSeries_TimezoneAndStatusBreakdown(t *testing.T) {
+	t.Parallel()
+
+	database, err := db.Open(filepath.Join(t.TempDir(), "app.db"))
+	if err != nil {
+		t.Fatalf("db open: %v", err)
+	}
+	sqlDB, err := database.DB()
+	if err != nil {
+		t.Fatalf("db handle: %v", err)
+	}
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	stats := NewStatsService(database)
+	ctx := context.Background()
+
+	// 2024-03-01 15:30 UTC is already 2024-03-01 23:30 in Shanghai; 16:30 UTC is the next day there.
+	base := time.Date(2024, 3, 1, 15, 30, 0, 0, time.UTC)
+	events := []RequestEvent{
+		{Endpoint: "/search", KeyID: 1, StatusCode: 200, LatencyMs: 40, OccurredAt: base},
+		{Endpoint: "/search", KeyID: 1, StatusCode: 200, LatencyMs: 80, OccurredAt: base.Add(time.Minute)},
+		{Endpoint: "/extract", KeyID: 2, StatusCode: 502, LatencyMs: 3000, OccurredAt: base.Add(time.Hour)},
+	}
+	for _, ev := range events {
+		if err := stats.RecordRollup(ctx, ev); err != nil {
+			t.Fatalf("record rollup: %v", err)
+		}
+	}
+
+	shanghai := time.FixedZone("UTC+8", 8*3600)
+	out, err := stats.QueryTimeSeries(ctx, TimeSeriesQuery{
+		Granularity: "day",
+		From:        time.Date(2024, 3, 1, 0, 0, 0, 0, shanghai),
+		To:          time.Date(2024, 3, 3, 0, 0, 0, 0, shanghai),
+		Location:    shanghai,
+		GroupBy:     "status_class",
+	})
+	if err != nil {
+		t.Fatalf("query: %v", err)
+	}
+
+	if len(out.Labels) != 2 || out.Buckets[0] != "2024-03-01T00:00:00+08:00" {
+		t.Fatalf("unexpected buckets: labels=%v buckets=%v", out.Labels, out.Buckets)
+	}
+	if len(out.Series) != 2 {
+		t.Fatalf("unexpected series: %+v", out.Series)
+	}
+	for _, series := range out.Series {
+		switch series.Key {
+		case "2xx":
+			if series.Data[0] != 2 || series.Data[1] != 0 {
+				t.Fatalf("unexpected 2xx data: %v", series.Data)
+			}
+		case "5xx":
+			if series.Data[0] != 0 || series.Data[1] != 1 {
+				t.Fatalf("unexpected 5xx data: %v", series.Data)
+			}
+		default:
+			t.Fatalf("unexpected series key: %q", series.Key)
+		}
+	}
+
+	if out.Latency == nil {
+		t.Fatalf("missing latency")
+	}
+	if out.Latency.Avg[0] != 60 || out.Latency.Max[0] != 80 {
+		t.Fatalf("unexpected latency day 1: avg=%d max=%d", out.Latency.Avg[0], out.Latency.Max[0])
+	}
+	if p50 := out.Latency.P50[0]; p50 <= 0 || p50 > 50 {
+		t.Fatalf("unexpected p50: %d", p50)
+	}
+	if p99 := out.Latency.P99[1]; p99 <= 2500 || p99 > 3000 {
+		t.Fatalf("unexpected p99: %d", p99)
+	}
+}
+
+func TestStatsService_QueryTimeSeries_ValidatesInput(t *testing.T) {
+	t.Parallel()
+
+	database, err := db.Open(filepath.Join(t.TempDir(), "app.db"))
+	if err != nil {
+		t.Fatalf("db open: %v", err)
+	}
+	sqlDB, err := database.DB()
+	if err != nil {
+		t.Fatalf("db handle: %v", err)
+	}
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	stats := NewStatsService(database)
+	ctx := context.Background()
+	now := time.Now()
+
+	if _, err := stats.QueryTimeSeries(ctx, TimeSeriesQuery{Granularity: "decade"}); err != ErrInvalidGranularity {
+		t.Fatalf("unexpected error for granularity: %v", err)
+	}
+	if _, err := stats.QueryTimeSeries(ctx, TimeSeriesQuery{GroupBy: "country"}); err != ErrInvalidGroupBy {
+		t.Fatalf("unexpected error for group_by: %v", err)
+	}
+	if _, err := stats.QueryTimeSeries(ctx, TimeSeriesQuery{From: now, To: now.Add(-time.Hour)}); err != ErrInvalidTimeRange {
+		t.Fatalf("unexpected error for range: %v", err)
+	}
+	if _, err := stats.QueryTimeSeries(ctx, TimeSeriesQuery{Granularity: "minute", From: now.AddDate(0, 0, -30), To: now}); err != ErrTooManyTimeBuckets {
+		t.Fatalf("unexpected error for bucket cap: %v", err)
+	}
+
+	out, err := stats.QueryTimeSeries(ctx, TimeSeriesQuery{Granularity: "week", From: now.AddDate(0, 0, -21), To: now})
+	if err != nil {
+		t.Fatalf("week query: %v", err)
+	}
+	if len(out.Labels) < 3 || len(out.Labels) > 4 {
+		t.Fatalf("unexpected week bucket count: %d", len(out.Labels))
+	}
+}
+
+func TestStatsService_DeleteRollupsOlderThan(t *testing.T) {
+	t.Parallel()
+
+	database, err := db.Open(filepath.Join(t.TempDir(), "app.db"))
+	if err != nil {
+		t.Fatalf("db open: %v", err)
+	}
+	sqlDB, err := database.DB()
+	if err != nil {
+		t.Fatalf("db handle: %v", err)
+	}
+	t.Cleanup(func() { _ = sqlDB.Close() })
+
+	stats := NewStatsService(database)
+	ctx := context.Background()
+
+	cutoff := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	for _, at := range []time.Time{cutoff.Add(-time.Hour), cutoff.Add(-time.Minute), cutoff, cutoff.Add(time.Hour)} {
+		if err := stats.RecordRollup(ctx, RequestEvent{Endpoint: "/search", KeyID: 1, StatusCode: 200, LatencyMs: 10, OccurredAt: at}); err != nil {
+			t.Fatalf("record rollup: %v", err)
+		}
+	}
+
+	deleted, err := stats.DeleteRollupsOlderThan(ctx, cutoff)
+	if err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if deleted != 2 {
+		t.Fatalf("unexpected deleted count: got %d want 2", deleted)
+	}
+
+	var remaining int64
+	if err := database.Model(&models.RequestRollup{}).Count(&remaining).Error; err != nil {
+		t.Fatalf("count: %v", err)
+	}
+	if remaining != 2 {
+		t.Fatalf("unexpected remaining rollups: got %d want 2", remaining)
+	}
+}
@@ -30,13 +30,18 @@ type Stats struct {
 
 type TimeSeriesSeries struct {
 	Name string  `json:"name"`
+	Key  string  `json:"key,omitempty"`
 	Data []int64 `json:"data"`
 }
 
 type TimeSeries struct {
 	Granularity string             `json:"granularity"`
+	Timezone    string             `json:"timezone,omitempty"`
+	GroupBy     string             `json:"group_by,omitempty"`
 	Labels      []string           `json:"labels"`
+	Buckets     []string           `json:"buckets,omitempty"`
 	Series      []TimeSeriesSeries `json:"series"`
+	Latency     *TimeSeriesLatency `json:"latency,omitempty"`
 }
 
 func (s *StatsService) Get(ctx context.Context) (Stats, error) {
@@ -232,7 +237,7 @@ func (s *StatsService) upsertIncrement(ctx context.Context, granularity, bucket,
 	return s.db.WithContext(ctx).Clauses(clause.OnConflict{
 		Columns: []clause.Column{{Name: "granularity"}, {Name: "bucket"}, {Name: "endpoint"}},
 		DoUpdates: clause.Assignments(map[string]any{
-			"count":      gorm.Expr("count + ?", inc),
+			"count":      gorm.Expr("? + ?", upsertCurrent("count"), inc),
 			"updated_at": updatedAt,
 		}),
 	}).Create(&stat).Error
@@ -258,9 +263,9 @@ func (s *StatsService) BackfillFromLogsIfEmpty(ctx context.Context) error {
 	}
 
 	specs := []spec{
-		{granularity: "hour", expr: "strftime('%Y-%m-%d %H:00', created_at, 'localtime')"},
-		{granularity: "day", expr: "strftime('%Y-%m-%d', created_at, 'localtime')"},
-		{granularity: "month", expr: "strftime('%Y-%m', created_at, 'localtime')"},
+		{granularity: "hour", expr: localTimeBucketExpr(s.db, "hour")},
+		{granularity: "day", expr: localTimeBucketExpr(s.db, "day")},
+		{granularity: "month", expr: localTimeBucketExpr(s.db, "month")},
 	}
 
 	updatedAt := time.Now()
@@ -22,6 +22,10 @@ type TavilyProxy struct {
 	client  *http.Client
 
 	settings *SettingsService
+	policies *PolicyService
+	filters  *FilterService
+	flights  flightGroup
+	retry    RetryPolicy
 	keys     *KeyService
 	logs     *LogService
 	stats    *StatsService
@@ -36,6 +40,22 @@ type ProxyRequest struct {
 	Body        []byte
 	ClientIP    string
 	ContentType string
+
+	DistributedKeyID uint
+	// CallerType is CallerMaster or CallerDistributed; when empty it is
+	// derived from DistributedKeyID.
+	CallerType string
+}
+
+// Caller reports who sent the request, for matching request policies.
+func (r ProxyRequest) Caller() string {
+	if r.CallerType != "" {
+		return r.CallerType
+	}
+	if r.DistributedKeyID != 0 {
+		return CallerDistributed
+	}
+	return CallerMaster
 }
 
 type ProxyResponse struct {
@@ -44,6 +64,11 @@ type ProxyResponse struct {
 	Body            []byte
 	ProxyRequestID  string
 	TavilyRequestID string
+	// Coalesced is set when the response came from another caller's
+	// identical in-flight request.
+	Coalesced bool
+	// Attempts is the number of upstream calls the response took.
+	Attempts int
 }
 
 func NewTavilyProxy(baseURL string, timeout time.Duration, keys *KeyService, logs *LogService, stats *StatsService, logger *slog.Logger) *TavilyProxy {
@@ -57,6 +82,7 @@ func NewTavilyProxy(baseURL string, timeout time.Duration, keys *KeyService, log
 		stats:    stats,
 		logger:   logger,
 		settings: nil,
+		retry:    DefaultRetryPolicy(),
 	}
 }
 
@@ -67,6 +93,32 @@ func (p *TavilyProxy) WithSettings(settings *SettingsService) *TavilyProxy {
 	return p
 }
 
+// WithPolicies applies request policies to every request before it is sent
+// upstream or logged.
+func (p *TavilyProxy) WithPolicies(policies *PolicyService) *TavilyProxy {
+	p.policies = policies
+	return p
+}
+
+// WithRetry replaces the default retry policy for transient upstream
+// failures.
+func (p *TavilyProxy) WithRetry(policy RetryPolicy) *TavilyProxy {
+	if policy.MaxAttempts < 1 {
+		policy.MaxAttempts = 1
+	}
+	p.retry = policy
+	return p
+}
+
+// WithFilters applies response filters to successful responses before they
+// are logged or returned.
+func (p *TavilyProxy) WithFilters(filters *FilterService) *TavilyProxy {
+	p.filters = filters
+	return p
+}
+
+// isRequestLoggingEnabled runs on every request; SettingsService caches the
+// value so this is normally not a database read.
 func (p *TavilyProxy) isRequestLoggingEnabled(ctx context.Context) bool {
 	if p.settings == nil {
 		return true
@@ -83,6 +135,14 @@ func (p *TavilyProxy) Do(ctx context.Context, req ProxyRequest) (ProxyResponse,
 
 	proxyReqID := uuid.NewString()
 
+	if p.policies != nil {
+		body, err := p.policies.Apply(ctx, req)
+		if err != nil {
+			return ProxyResponse{}, err
+		}
+		req.Body = body
+	}
+
 	loggingEnabled := p.logs != nil && p.isRequestLoggingEnabled(ctx)
 	captureBodies := strings.EqualFold(req.Method, http.MethodPost) && req.Path == "/search"
 	requestBody, requestTruncated := "", false
@@ -90,12 +150,20 @@ func (p *TavilyProxy) Do(ctx context.Context, req ProxyRequest) (ProxyResponse,
 		requestBody, requestTruncated = truncateForLog(req.Body, maxLogBytes)
 	}
 
-	candidates, err := p.keys.Candidates(ctx)
+	// Concurrent identical requests share one upstream call; each caller still
+	// gets its own proxy request ID, log entry and stats.
+	start := time.Now()
+	res, coalesced, err := p.flights.do(ctx, coalesceKey(req), func(ctx context.Context) upstreamResult {
+		return p.forward(ctx, req, proxyReqID)
+	})
 	if err != nil {
 		return ProxyResponse{}, err
 	}
+	if res.err != nil {
+		return ProxyResponse{}, res.err
+	}
 
-	if len(candidates) == 0 {
+	if res.noKeys {
 		if captureBodies {
 			createdAt := time.Now()
 			if loggingEnabled {
@@ -110,103 +178,232 @@ func (p *TavilyProxy) Do(ctx context.Context, req ProxyRequest) (ProxyResponse,
 					RequestTruncated:  requestTruncated,
 					ResponseBody:      `{"error":"no_available_keys","message":"No active Tavily API keys with remaining quota."}`,
 					ResponseTruncated: false,
+					Coalesced:         coalesced,
 					ClientIP:          req.ClientIP,
 					CreatedAt:         createdAt,
 				})
 			}
-			if p.stats != nil {
-				_ = p.stats.RecordRequest(ctx, req.Path, createdAt)
-			}
+			p.recordStats(ctx, req, 0, http.StatusServiceUnavailable, 0, createdAt)
 		}
 		return ProxyResponse{}, ErrNoAvailableKeys
 	}
 
-	var lastErr error
-	for _, key := range candidates {
-		resp, status, latencyMs, tavilyReqID, err := p.tryKey(ctx, key.ID, key.Key, req, proxyReqID)
-
-		if err != nil {
-			lastErr = err
-			continue
-		}
-
-		switch status {
-		case http.StatusUnauthorized:
-			_ = p.keys.MarkInvalid(ctx, key.ID)
-			continue
-		case http.StatusTooManyRequests, 432, 433:
-			_ = p.keys.MarkExhausted(ctx, key.ID)
-			continue
-		}
-
-		if status == http.StatusOK && !strings.EqualFold(req.Method, http.MethodGet) {
-			_ = p.keys.IncrementUsed(ctx, key.ID)
-		}
-
-		createdAt := time.Now()
-		if loggingEnabled {
-			if captureBodies {
-				responseBody, responseTruncated := truncateForLog(resp.Body, maxLogBytes)
+	if !res.ok {
+		if captureBodies && res.lastErr != nil {
+			createdAt := time.Now()
+			if loggingEnabled {
 				_ = p.logs.Create(ctx, &models.RequestLog{
 					RequestID:         proxyReqID,
-					KeyUsed:           key.ID,
-					KeyAlias:          key.Alias,
+					KeyUsed:           0,
+					KeyAlias:          "",
 					Endpoint:          req.Path,
-					StatusCode:        status,
-					LatencyMs:         latencyMs,
+					StatusCode:        http.StatusBadGateway,
+					LatencyMs:         0,
 					RequestBody:       requestBody,
 					RequestTruncated:  requestTruncated,
-					ResponseBody:      responseBody,
-					ResponseTruncated: responseTruncated,
+					ResponseBody:      res.lastErr.Error(),
+					ResponseTruncated: false,
+					Coalesced:         coalesced,
+					Attempts:          len(res.attempts),
+					AttemptLog:        attemptLog(res.attempts),
 					ClientIP:          req.ClientIP,
 					CreatedAt:         createdAt,
 				})
-			} else {
-				_ = p.logs.Create(ctx, &models.RequestLog{
-					RequestID:  proxyReqID,
-					KeyUsed:    key.ID,
-					KeyAlias:   key.Alias,
-					Endpoint:   req.Path,
-					StatusCode: status,
-					LatencyMs:  latencyMs,
-					ClientIP:   req.ClientIP,
-					CreatedAt:  createdAt,
-				})
 			}
+			p.recordStats(ctx, req, 0, http.StatusBadGateway, 0, createdAt)
 		}
-		if p.stats != nil {
-			_ = p.stats.RecordRequest(ctx, req.Path, createdAt)
-		}
+		return ProxyResponse{ProxyRequestID: proxyReqID, Attempts: len(res.attempts)}, ErrNoAvailableKeys
+	}
 
-		resp.ProxyRequestID = proxyReqID
-		resp.TavilyRequestID = tavilyReqID
-		return resp, nil
+	resp, status, latencyMs := res.resp, res.status, res.latencyMs
+	if coalesced {
+		resp.Headers = resp.Headers.Clone()
+		latencyMs = time.Since(start).Milliseconds()
 	}
 
-	if captureBodies && lastErr != nil {
-		createdAt := time.Now()
-		if loggingEnabled {
+	createdAt := time.Now()
+	if loggingEnabled {
+		if captureBodies {
+			responseBody, responseTruncated := truncateForLog(resp.Body, maxLogBytes)
 			_ = p.logs.Create(ctx, &models.RequestLog{
 				RequestID:         proxyReqID,
-				KeyUsed:           0,
-				KeyAlias:          "",
+				KeyUsed:           res.keyID,
+				KeyAlias:          res.keyAlias,
 				Endpoint:          req.Path,
-				StatusCode:        http.StatusBadGateway,
-				LatencyMs:         0,
+				StatusCode:        status,
+				LatencyMs:         latencyMs,
 				RequestBody:       requestBody,
 				RequestTruncated:  requestTruncated,
-				ResponseBody:      lastErr.Error(),
-				ResponseTruncated: false,
+				ResponseBody:      responseBody,
+				ResponseTruncated: responseTruncated,
+				Coalesced:         coalesced,
+				Attempts:          len(res.attempts),
+				AttemptLog:        attemptLog(res.attempts),
 				ClientIP:          req.ClientIP,
 				CreatedAt:         createdAt,
 			})
+		} else {
+			_ = p.logs.Create(ctx, &models.RequestLog{
+				RequestID:  proxyReqID,
+				KeyUsed:    res.keyID,
+				KeyAlias:   res.keyAlias,
+				Endpoint:   req.Path,
+				StatusCode: status,
+				LatencyMs:  latencyMs,
+				Coalesced:  coalesced,
+				Attempts:   len(res.attempts),
+				AttemptLog: attemptLog(res.attempts),
+				ClientIP:   req.ClientIP,
+				CreatedAt:  createdAt,
+			})
+		}
+	}
+	p.recordStats(ctx, req, res.keyID, status, latencyMs, createdAt)
+
+	resp.ProxyRequestID = proxyReqID
+	resp.TavilyRequestID = res.tavilyReqID
+	resp.Coalesced = coalesced
+	resp.Attempts = len(res.attempts)
+	return resp, nil
+}
+
+// attemptLog records the individual upstream calls when there was more than
+// one.
+func attemptLog(attempts []Attempt) string {
+	if len(attempts) < 2 {
+		return ""
+	}
+	raw, err := json.Marshal(attempts)
+	if err != nil {
+		return ""
+	}
+	return string(raw)
+}
+
+// forward tries the candidate keys in order until one gets a response that is
+// not an auth or quota failure.
+func (p *TavilyProxy) forward(ctx context.Context, req ProxyRequest, proxyReqID string) upstreamResult {
+	candidates, err := p.keys.Candidates(ctx)
+	if err != nil {
+		return upstreamResult{err: err}
+	}
+	if len(candidates) == 0 {
+		return upstreamResult{noKeys: true}
+	}
+
+	var deadline time.Time
+	if p.retry.Budget > 0 {
+		deadline = time.Now().Add(p.retry.Budget)
+	}
+	queue := append([]models.APIKey(nil), candidates...)
+	var attempts []Attempt
+	var lastErr error
+	var failed *upstreamResult
+	for retries := 0; len(queue) > 0; {
+		key := queue[0]
+		queue = queue[1:]
+
+		attemptCtx, cancel := ctx, context.CancelFunc(func() {})
+		if retries > 0 && !deadline.IsZero() {
+			attemptCtx, cancel = context.WithDeadline(ctx, deadline)
+		}
+		resp, status, latencyMs, tavilyReqID, err := p.tryKey(attemptCtx, key.ID, key.Key, req, proxyReqID)
+		cancel()
+		attempt := Attempt{KeyID: key.ID, KeyAlias: key.Alias, Status: status, LatencyMs: latencyMs}
+		if err != nil {
+			attempt.Error = err.Error()
+		}
+		attempts = append(attempts, attempt)
+
+		if err != nil {
+			lastErr = err
+			if !transientError(err) {
+				continue
+			}
+		} else {
+			switch status {
+			case http.StatusUnauthorized:
+				_ = p.keys.MarkInvalid(ctx, key.ID)
+				continue
+			case http.StatusTooManyRequests, 432, 433:
+				_ = p.keys.MarkExhausted(ctx, key.ID)
+				continue
+			}
+
+			if !retryableStatus(status) {
+				if status == http.StatusOK && p.filters != nil {
+					// Fail closed: a response that could not be filtered is not returned.
+					resp, err = p.filters.Apply(ctx, req.Path, resp)
+					if err != nil {
+						return upstreamResult{err: err, attempts: attempts}
+					}
+				}
+
+				if status == http.StatusOK && !strings.EqualFold(req.Method, http.MethodGet) {
+					_ = p.keys.IncrementUsed(ctx, key.ID)
+				}
+
+				return upstreamResult{
+					ok:          true,
+					resp:        resp,
+					keyID:       key.ID,
+					keyAlias:    key.Alias,
+					status:      status,
+					latencyMs:   latencyMs,
+					tavilyReqID: tavilyReqID,
+					attempts:    attempts,
+				}
+			}
+			failed = &upstreamResult{
+				ok:          true,
+				resp:        resp,
+				keyID:       key.ID,
+				keyAlias:    key.Alias,
+				status:      status,
+				latencyMs:   latencyMs,
+				tavilyReqID: tavilyReqID,
+			}
+		}
+
+		// Transient failure: retry, preferring keys that have not failed yet.
+		if len(attempts) >= p.retry.MaxAttempts {
+			break
 		}
-		if p.stats != nil {
-			_ = p.stats.RecordRequest(ctx, req.Path, createdAt)
+		retries++
+		delay := p.retry.backoff(retries)
+		if !deadline.IsZero() && !time.Now().Add(delay).Before(deadline) {
+			break
+		}
+		queue = append(queue, key)
+		p.logger.Warn("upstream attempt failed, retrying",
+			"request_id", proxyReqID, "key_id", key.ID, "status", status, "err", err, "retry_in", delay)
+		if !sleepContext(ctx, delay) {
+			break
 		}
 	}
 
-	return ProxyResponse{}, ErrNoAvailableKeys
+	// A 5xx response from Tavily is passed on rather than replaced by a
+	// generic error.
+	if failed != nil {
+		failed.attempts = attempts
+		return *failed
+	}
+	return upstreamResult{lastErr: lastErr, attempts: attempts}
+}
+
+func (p *TavilyProxy) recordStats(ctx context.Context, req ProxyRequest, keyID uint, statusCode int, latencyMs int64, createdAt time.Time) {
+	if p.stats == nil {
+		return
+	}
+	_ = p.stats.RecordRequest(ctx, req.Path, createdAt)
+	_ = p.stats.RecordRollup(ctx, RequestEvent{
+		Endpoint:         req.Path,
+		KeyID:            keyID,
+		DistributedKeyID: req.DistributedKeyID,
+		StatusCode:       statusCode,
+		LatencyMs:        latencyMs,
+		OccurredAt:       createdAt,
+	})
 }
 
 func truncateForLog(data []byte, maxBytes int) (string, bool) {
@@ -258,10 +455,13 @@ func (p *TavilyProxy) tryKey(ctx context.Context, keyID uint, tavilyKey string,
 	}, upstreamResp.StatusCode, latencyMs, requestID, nil
 }
 
+// copyHeaders forwards client headers upstream. Accept-Encoding is left to the
+// transport, which then decompresses the body, so filters always see plain
+// JSON and coalesced callers share a body none of them has to decode.
 func copyHeaders(dst http.Header, src http.Header) {
 	for k, vv := range src {
 		switch strings.ToLower(k) {
-		case "host", "content-length":
+		case "host", "content-length", "accept-encoding":
 			continue
 		}
 		for _, v := range vv {
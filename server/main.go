@@ -3,6 +3,9 @@ package main
 import (
 	"context"
 	"embed"
+	"errors"
+	"flag"
+	"fmt"
 	"log/slog"
 	"os"
 	"os/signal"
@@ -10,6 +13,7 @@ import (
 	"syscall"
 	"time"
 
+	"tavily-proxy/server/internal/cli"
 	"tavily-proxy/server/internal/config"
 	"tavily-proxy/server/internal/db"
 	"tavily-proxy/server/internal/httpserver"
@@ -22,13 +26,51 @@ var embeddedPublic embed.FS
 
 func main() {
 	logger := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{Level: slog.LevelInfo}))
-	cfg := config.FromEnv()
+	cfg, rest, err := config.Load(os.Args[1:], os.LookupEnv)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(cli.Run(context.Background(), cfg, []string{"help"}, os.Stdin, os.Stdout, os.Stderr))
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if cfg.ConfigFile != "" {
+		logger.Info("config file loaded", "path", cfg.ConfigFile)
+	}
 
-	database, err := db.Open(cfg.DatabasePath)
+	if len(rest) > 0 {
+		os.Exit(cli.Run(context.Background(), cfg, rest, os.Stdin, os.Stdout, os.Stderr))
+	}
+
+	database, err := db.Connect(cfg.DatabaseURL, cfg.DatabasePath)
 	if err != nil {
 		logger.Error("db open failed", "err", err)
 		os.Exit(1)
 	}
+	pending, err := db.CheckSchema(database)
+	if err != nil {
+		logger.Error("db schema check failed", "err", err)
+		os.Exit(1)
+	}
+	if pending > 0 {
+		if !cfg.DBAutoMigrate {
+			logger.Error("db has pending migrations; run `tavily-proxy db migrate up` or set DB_AUTO_MIGRATE=true", "pending", pending)
+			os.Exit(1)
+		}
+		ran, err := db.Migrate(database)
+		if err != nil {
+			logger.Error("db migrate failed", "err", err)
+			os.Exit(1)
+		}
+		logger.Info("db migrations applied", "count", len(ran), "version", db.LatestVersion())
+	}
+
+	coordinator, err := services.NewCoordinator(cfg.CoordinationBackend, database, cfg.RedisURL, cfg.InstanceID)
+	if err != nil {
+		logger.Error("coordinator init failed", "err", err)
+		os.Exit(1)
+	}
+	logger.Info("coordination configured", "backend", cfg.CoordinationBackend, "instance", coordinator.InstanceID())
 
 	masterKeyService := services.NewMasterKeyService(database, logger)
 	if err := masterKeyService.LoadOrCreateWithDefault(context.Background(), cfg.MasterKey); err != nil {
@@ -36,14 +78,30 @@ func main() {
 		os.Exit(1)
 	}
 
-	settingsService := services.NewSettingsService(database)
+	settingsService := services.NewSettingsService(database).WithPinned(cfg.Settings)
+	policyService := services.NewPolicyService(database, logger)
+	filterService := services.NewFilterService(database, logger)
 	keyService := services.NewKeyService(database, logger)
 	logService := services.NewLogService(database, logger)
 	statsService := services.NewStatsService(database)
+	auditService := services.NewAuditService(database, logger)
+	adminService := services.NewAdminService(database, logger)
+	sessionService := services.NewSessionService(database, logger).WithTTL(cfg.SessionTTL)
+	idempotencyService := services.NewIdempotencyService(database, logger).WithTTL(cfg.IdempotencyTTL)
+	var oidcProvider *services.OIDCProvider
+	if oidcConfig, ok := cfg.OIDC(); ok {
+		oidcProvider = services.NewOIDCProvider(oidcConfig)
+		logger.Info("oidc login enabled", "issuer", oidcConfig.IssuerURL)
+	}
 
 	var distributedKeyService *services.DistributedKeyService
 	var distributedKeyUsageService *services.DistributedKeyUsageService
 	var distributedRateLimiter *services.DistributedRateLimiter
+	backupService := services.NewBackupService(database, logger).
+		WithMasterKey(masterKeyService).
+		WithSettings(settingsService).
+		WithPolicies(policyService).
+		WithFilters(filterService)
 	if strings.TrimSpace(cfg.UserKeyEncryptionKey) == "" {
 		logger.Info("distributed user key feature disabled: USER_KEY_ENCRYPTION_KEY not set")
 	} else {
@@ -55,6 +113,10 @@ func main() {
 		distributedKeyService = services.NewDistributedKeyService(database, logger, userKeyCipher, cfg.UserKeyRateLimitDefault)
 		distributedKeyUsageService = services.NewDistributedKeyUsageService(database)
 		distributedRateLimiter = services.NewDistributedRateLimiter(cfg.UserKeyRateLimitWindow)
+		if _, local := coordinator.(*services.LocalCoordinator); !local {
+			distributedRateLimiter.WithCoordinator(coordinator)
+		}
+		backupService.WithCipher(userKeyCipher)
 	}
 
 	if err := statsService.BackfillFromLogsIfEmpty(context.Background()); err != nil {
@@ -62,10 +124,16 @@ func main() {
 	}
 
 	tavilyProxy := services.NewTavilyProxy(cfg.TavilyBaseURL, cfg.UpstreamTimeout, keyService, logService, statsService, logger).
-		WithSettings(settingsService)
-	keyBatchCreateJob := services.NewKeyBatchCreateJobService(keyService, logger)
+		WithSettings(settingsService).
+		WithPolicies(policyService).
+		WithFilters(filterService).
+		WithRetry(cfg.RetryPolicy())
+	jobStore := services.NewJobStore(database)
+	keyBatchCreateJob := services.NewKeyBatchCreateJobService(keyService, logger).
+		WithProxy(tavilyProxy).
+		WithJobStore(jobStore)
 	quotaSyncService := services.NewQuotaSyncService(keyService, tavilyProxy, logger)
-	quotaSyncJob := services.NewQuotaSyncJobService(keyService, quotaSyncService, logger)
+	quotaSyncJob := services.NewQuotaSyncJobService(keyService, quotaSyncService, logger).WithJobStore(jobStore)
 
 	srv := httpserver.New(httpserver.Dependencies{
 		Config:                     cfg,
@@ -79,8 +147,17 @@ func main() {
 		KeyBatchCreateJob:          keyBatchCreateJob,
 		QuotaSyncService:           quotaSyncService,
 		QuotaSyncJob:               quotaSyncJob,
+		JobStore:                   jobStore,
 		LogService:                 logService,
 		StatsService:               statsService,
+		BackupService:              backupService,
+		AuditService:               auditService,
+		AdminService:               adminService,
+		SessionService:             sessionService,
+		OIDCProvider:               oidcProvider,
+		PolicyService:              policyService,
+		FilterService:              filterService,
+		IdempotencyService:         idempotencyService,
 		TavilyProxy:                tavilyProxy,
 		Logger:                     logger,
 	})
@@ -88,9 +165,31 @@ func main() {
 	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer stop()
 
-	jobs.StartMonthlyReset(ctx, keyService, logger)
-	jobs.StartAutoQuotaSync(ctx, settingsService, quotaSyncService, logger)
-	jobs.StartLogCleanup(ctx, settingsService, logService, logger)
+	leader := services.NewLeaderElector(coordinator, services.SchedulerLeaseName, 30*time.Second, logger)
+	leader.Start(ctx)
+
+	// Replicas share the jobs table, so only the scheduler leader picks up
+	// interrupted jobs; otherwise every booting replica would resume them.
+	if leader.IsLeader() {
+		if err := quotaSyncJob.RecoverInterrupted(context.Background(), cfg.JobResumeOnStart); err != nil {
+			logger.Error("quota sync job recovery failed", "err", err)
+		}
+		if err := keyBatchCreateJob.RecoverInterrupted(context.Background(), cfg.JobResumeOnStart); err != nil {
+			logger.Error("key batch create job recovery failed", "err", err)
+		}
+	} else {
+		logger.Info("job recovery skipped: not the scheduler leader")
+	}
+
+	jobs.StartMonthlyReset(ctx, leader, settingsService, keyService, logger)
+	jobs.StartAutoQuotaSync(ctx, leader, settingsService, quotaSyncService, logger)
+	jobs.StartLogCleanup(ctx, leader, settingsService, logService, statsService, logger)
+	jobs.StartAuditCleanup(ctx, leader, settingsService, auditService, logger)
+	jobs.StartIdempotencyCleanup(ctx, leader, idempotencyService, logger)
+	jobs.StartSessionCleanup(ctx, leader, sessionService, logger)
+	jobs.StartScheduledBackup(ctx, leader, settingsService, backupService, cfg.BackupDir, logger)
+
+	go reloadOnHangup(ctx, cfg, settingsService, logger)
 
 	go func() {
 		logger.Info("server listening", "addr", cfg.ListenAddr)
@@ -104,3 +203,32 @@ func main() {
 	defer cancel()
 	_ = srv.Shutdown(shutdownCtx)
 }
+
+// reloadOnHangup re-reads the config file and env on SIGHUP. Pinned settings
+// apply immediately; anything else is only reported, since it needs a restart.
+// An invalid file keeps the running configuration.
+func reloadOnHangup(ctx context.Context, cfg config.Config, settings *services.SettingsService, logger *slog.Logger) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+		}
+		next, err := cfg.Reload(os.LookupEnv)
+		if err != nil {
+			logger.Error("config reload failed; keeping current configuration", "err", err)
+			continue
+		}
+		settings.SetPinned(next.Settings)
+		if changed := config.RestartRequired(cfg, next); len(changed) > 0 {
+			logger.Warn("config reload: changes require a restart", "fields", changed)
+		}
+		logger.Info("config reloaded", "pinned_settings", len(next.Settings))
+		// Keep comparing against what is actually running.
+		cfg.Settings = next.Settings
+	}
+}
@@ -19,7 +19,23 @@ export function clearMasterKey(): void {
   masterKeyRef.value = ''
 }
 
-export const api = axios.create()
+// Set when the dashboard is signed in through SSO; the session lives in an
+// HttpOnly cookie, so all the client knows is that /api/me succeeded.
+const sessionActiveRef = ref(false)
+
+export function hasSession(): boolean {
+  return sessionActiveRef.value
+}
+
+export function setSessionActive(value: boolean): void {
+  sessionActiveRef.value = value
+}
+
+// Cookie-authenticated writes must echo the CSRF cookie back in a header.
+export const api = axios.create({
+  xsrfCookieName: 'tp_csrf',
+  xsrfHeaderName: 'X-CSRF-Token',
+})
 
 api.interceptors.request.use((config) => {
   const token = getMasterKey()
@@ -35,6 +51,7 @@ api.interceptors.response.use(
   (error) => {
     if (error?.response?.status === 401) {
       clearMasterKey()
+      setSessionActive(false)
       window.dispatchEvent(new Event('auth-required'))
     }
     return Promise.reject(error)
@@ -44,6 +44,12 @@ const MESSAGES: Record<Locale, Record<string, string>> = {
     "auth.accessDashboard": "Access Dashboard",
     "auth.footer":
       "The master key is required to authenticate administrative requests.",
+    "auth.or": "or",
+    "auth.ssoLogin": "Sign in with SSO",
+    "auth.ssoError.no_role": "Your account is not in any group with dashboard access.",
+    "auth.ssoError.state_mismatch": "The sign-in link expired. Please try again.",
+    "auth.ssoError.idp_error": "The identity provider rejected the sign-in.",
+    "auth.ssoError.login_failed": "SSO sign-in failed. Please try again.",
 
     "dashboard.title": "Dashboard",
     "dashboard.refreshData": "Refresh Data",
@@ -154,6 +160,8 @@ const MESSAGES: Record<Locale, Record<string, string>> = {
     "logs.detail.clientIp": "Client IP",
     "logs.detail.latency": "Latency",
     "logs.detail.keyUsed": "Key Used",
+    "logs.detail.coalesced": "Shared upstream call",
+    "logs.detail.attempts": "Upstream Attempts",
     "logs.detail.requestBody": "Request Body",
     "logs.detail.responseBody": "Response Body",
     "logs.errors.loadLogs": "Failed to load logs",
@@ -287,6 +295,12 @@ const MESSAGES: Record<Locale, Record<string, string>> = {
     "auth.masterKeyPlaceholder": "请输入主密钥",
     "auth.accessDashboard": "进入控制台",
     "auth.footer": "主密钥用于验证所有管理请求。",
+    "auth.or": "或",
+    "auth.ssoLogin": "使用 SSO 登录",
+    "auth.ssoError.no_role": "你的账号不在任何有控制台权限的组中。",
+    "auth.ssoError.state_mismatch": "登录链接已过期，请重试。",
+    "auth.ssoError.idp_error": "身份提供方拒绝了本次登录。",
+    "auth.ssoError.login_failed": "SSO 登录失败，请重试。",
 
     "dashboard.title": "仪表盘",
     "dashboard.refreshData": "刷新数据",
@@ -390,6 +404,8 @@ const MESSAGES: Record<Locale, Record<string, string>> = {
     "logs.detail.clientIp": "客户端 IP",
     "logs.detail.latency": "耗时",
     "logs.detail.keyUsed": "使用的密钥",
+    "logs.detail.coalesced": "共享上游调用",
+    "logs.detail.attempts": "上游尝试次数",
     "logs.detail.requestBody": "请求体",
     "logs.detail.responseBody": "响应体",
     "logs.errors.loadLogs": "日志加载失败",
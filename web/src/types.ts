@@ -60,6 +60,9 @@ export type LogItem = {
   request_truncated?: boolean
   response_body?: string | null
   response_truncated?: boolean
+  coalesced?: boolean
+  attempts?: number
+  attempt_log?: string | null
   client_ip: string
   created_at: string
 }